@@ -0,0 +1,158 @@
+package audit
+
+import (
+	"context"
+	"crypto/x509"
+	"log/slog"
+	"path"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/kkloberdanz/teleworker/auth"
+)
+
+// maxRequestBytes is how much of a request's JSON a record keeps.
+const maxRequestBytes = 1024
+
+// NewUnaryInterceptor returns an interceptor that writes a record of each RPC
+// to the log once it returns. It must come after the auth interceptor in the
+// chain, so that the caller's identity is in the context. RPCs that the auth
+// interceptor rejects never reach it, and are recorded by passing Reject to
+// the auth interceptor instead.
+func NewUnaryInterceptor(l *Log) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		l.record(ctx, info.FullMethod, start, req, resp, err)
+		return resp, err
+	}
+}
+
+// NewStreamInterceptor is like NewUnaryInterceptor, for streaming RPCs. The
+// record is written once the stream ends, with the first message the client
+// sent as the request.
+func NewStreamInterceptor(l *Log) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		rs := &recordingStream{ServerStream: ss}
+		err := handler(srv, rs)
+		l.record(ss.Context(), info.FullMethod, start, rs.req, nil, err)
+		return err
+	}
+}
+
+// Reject writes a record of an RPC that the auth interceptor rejected because
+// the caller has no identity, such as one whose certificate the mapper does
+// not accept. The record has no user or role. It is an auth.RejectFunc.
+func (l *Log) Reject(ctx context.Context, method string, req any, err error) {
+	l.record(ctx, method, time.Now(), req, nil, err)
+}
+
+// recordingStream keeps the first message the client sends.
+type recordingStream struct {
+	grpc.ServerStream
+	req any
+}
+
+func (s *recordingStream) RecvMsg(m any) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil && s.req == nil {
+		s.req = m
+	}
+	return err
+}
+
+// jobIDer is implemented by the requests and responses that name a job.
+type jobIDer interface {
+	GetJobId() string
+}
+
+// onBehalfOfer is implemented by the requests an admin may make on another
+// user's behalf.
+type onBehalfOfer interface {
+	GetOnBehalfOf() string
+}
+
+// record writes a record of an RPC. Failing to write it does not fail the
+// RPC, which has already run, but is logged.
+func (l *Log) record(ctx context.Context, method string, start time.Time, req, resp any, err error) {
+	r := Record{
+		Time:      start.UTC(),
+		RPC:       path.Base(method),
+		Code:      status.Code(err).String(),
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if id, idErr := auth.FromContext(ctx); idErr == nil {
+		r.User = id.Username
+		r.Role = id.Role
+	}
+	if err != nil {
+		r.Error = status.Convert(err).Message()
+	}
+	// StartJob names the job in its response.
+	for _, m := range []any{req, resp} {
+		if j, ok := m.(jobIDer); ok && j.GetJobId() != "" {
+			r.JobID = j.GetJobId()
+			break
+		}
+	}
+	if o, ok := req.(onBehalfOfer); ok {
+		r.OnBehalfOf = o.GetOnBehalfOf()
+	}
+	if m, ok := req.(proto.Message); ok {
+		r.Request = summarize(m)
+	}
+
+	if err := l.Write(r); err != nil {
+		slog.Error(
+			"failed to write audit record",
+			"rpc", r.RPC,
+			"user", r.User,
+			"error", err,
+		)
+	}
+}
+
+// HandshakeRPC is the RPC of the records that RejectCertificate writes, which
+// are of TLS handshakes rather than of RPCs.
+const HandshakeRPC = "TLSHandshake"
+
+// RejectCertificate writes a record of a TLS handshake that was rejected
+// because the client's certificate was revoked. No identity is mapped from a
+// rejected certificate, so the user is the certificate's subject common name,
+// and the role is empty. It has the signature of
+// auth.RevocationList.OnReject's function.
+func (l *Log) RejectCertificate(leaf *x509.Certificate, err error) {
+	r := Record{
+		Time:  time.Now().UTC(),
+		User:  leaf.Subject.CommonName,
+		RPC:   HandshakeRPC,
+		Code:  codes.Unauthenticated.String(),
+		Error: err.Error(),
+	}
+	if err := l.Write(r); err != nil {
+		slog.Error(
+			"failed to write audit record",
+			"rpc", r.RPC,
+			"user", r.User,
+			"error", err,
+		)
+	}
+}
+
+// summarize returns the request as JSON, cut to maxRequestBytes.
+func summarize(m proto.Message) string {
+	b, err := protojson.Marshal(m)
+	if err != nil {
+		return ""
+	}
+	if len(b) > maxRequestBytes {
+		return string(b[:maxRequestBytes]) + "..."
+	}
+	return string(b)
+}
@@ -0,0 +1,99 @@
+package audit_test
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/kkloberdanz/teleworker/audit"
+	"github.com/kkloberdanz/teleworker/auth"
+	pb "github.com/kkloberdanz/teleworker/proto/teleworker/v1"
+)
+
+func TestUnaryInterceptor(t *testing.T) {
+	l := openLog(t, filepath.Join(t.TempDir(), "audit.log"), audit.Options{})
+	interceptor := audit.NewUnaryInterceptor(l)
+	ctx := auth.NewContext(t.Context(), auth.Identity{Username: "alice", Role: auth.RoleClient})
+
+	// StartJob names its job in the response.
+	info := &grpc.UnaryServerInfo{FullMethod: pb.TeleWorker_StartJob_FullMethodName}
+	req := &pb.StartJobRequest{Command: "echo", Args: []string{"hello"}}
+	_, err := interceptor(ctx, req, info, func(ctx context.Context, req any) (any, error) {
+		return &pb.StartJobResponse{JobId: "job-1"}, nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	info = &grpc.UnaryServerInfo{FullMethod: pb.TeleWorker_StopJob_FullMethodName}
+	_, err = interceptor(ctx, &pb.StopJobRequest{JobId: "job-2"}, info, func(ctx context.Context, req any) (any, error) {
+		return nil, status.Error(codes.NotFound, "job not found")
+	})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("expected the handler's error, got %v", err)
+	}
+
+	records, err := l.Query(audit.Filter{})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+	start, stop := records[0], records[1]
+	if start.User != "alice" || start.Role != auth.RoleClient || start.RPC != "StartJob" || start.JobID != "job-1" || start.Code != "OK" {
+		t.Fatalf("unexpected record %+v", start)
+	}
+	if !strings.Contains(start.Request, `"command":"echo"`) && !strings.Contains(start.Request, `"command": "echo"`) {
+		t.Fatalf("expected the request to name the command, got %s", start.Request)
+	}
+	if stop.RPC != "StopJob" || stop.JobID != "job-2" || stop.Code != "NotFound" || stop.Error != "job not found" {
+		t.Fatalf("unexpected record %+v", stop)
+	}
+}
+
+func TestReject(t *testing.T) {
+	l := openLog(t, filepath.Join(t.TempDir(), "audit.log"), audit.Options{})
+	// The auth interceptor passes rejected RPCs to Reject, without an
+	// identity in the context.
+	req := &pb.StopJobRequest{JobId: "job-1"}
+	l.Reject(t.Context(), pb.TeleWorker_StopJob_FullMethodName, req, status.Error(codes.PermissionDenied, "no verified certificate chain"))
+
+	records, err := l.Query(audit.Filter{})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(records))
+	}
+	r := records[0]
+	if r.User != "" || r.Role != "" || r.RPC != "StopJob" || r.JobID != "job-1" || r.Code != "PermissionDenied" || r.Error != "no verified certificate chain" {
+		t.Fatalf("unexpected record %+v", r)
+	}
+}
+
+func TestRejectCertificate(t *testing.T) {
+	l := openLog(t, filepath.Join(t.TempDir(), "audit.log"), audit.Options{})
+	leaf := &x509.Certificate{Subject: pkix.Name{CommonName: "mallory"}}
+	l.RejectCertificate(leaf, errors.New("certificate has been revoked"))
+
+	records, err := l.Query(audit.Filter{User: "mallory"})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(records))
+	}
+	r := records[0]
+	if r.RPC != audit.HandshakeRPC || r.Role != "" || r.Code != "Unauthenticated" || r.Error != "certificate has been revoked" {
+		t.Fatalf("unexpected record %+v", r)
+	}
+}
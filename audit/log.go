@@ -0,0 +1,347 @@
+// Package audit keeps an append-only record of every RPC made to the server:
+// who made it, on which job, and how it ended. Records are JSON lines in a
+// file that is rotated when it grows too large. Each record may also carry
+// the hash of the one before it, so that records that are changed, removed or
+// reordered can be detected, see Verify.
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Record is one RPC in the audit log.
+type Record struct {
+	Time       time.Time `json:"time"`                   // When the RPC started, in UTC.
+	User       string    `json:"user"`                   // Username of the caller.
+	Role       string    `json:"role"`                   // Role of the caller.
+	OnBehalfOf string    `json:"on_behalf_of,omitempty"` // User an admin made the RPC on behalf of, if any.
+	RPC        string    `json:"rpc"`                    // Method name, e.g. "StartJob".
+	JobID      string    `json:"job_id,omitempty"`       // Job the RPC was on, or started.
+	Request    string    `json:"request,omitempty"`      // The request as JSON, cut short if it is long.
+	Code       string    `json:"code"`                   // gRPC status code, e.g. "OK" or "NotFound".
+	Error      string    `json:"error,omitempty"`        // Status message, if the RPC failed.
+	LatencyMS  float64   `json:"latency_ms"`             // How long the RPC took. For streams, how long the stream was open.
+	PrevHash   string    `json:"prev_hash,omitempty"`    // Hash of the record before, if the log is hash chained.
+	Hash       string    `json:"hash,omitempty"`         // Hash of this record, with PrevHash and without Hash, if the log is hash chained.
+}
+
+// hash returns the hex SHA-256 hash of the record's JSON, without its Hash.
+func (r Record) hash() (string, error) {
+	r.Hash = ""
+	b, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Options configures a Log.
+type Options struct {
+	MaxSize  int64 // Size in bytes above which the file is rotated. If 0, it is never rotated.
+	MaxFiles int   // Number of rotated files to keep, as <path>.1 (the newest) to <path>.<MaxFiles>. Older files are removed. Must be at least 1 if MaxSize is set.
+	Chain    bool  // If true, each record carries the hash of the one before it.
+}
+
+// Log is an audit log file. It is safe for concurrent use.
+type Log struct {
+	path string
+	opts Options
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64  // Size of f.
+	prev string // Hash of the last record written, if opts.Chain is set.
+}
+
+// Open opens the audit log at path, creating it if it does not exist, and
+// appends to it. If opts.Chain is set, the chain continues from the last
+// record already in the log.
+func Open(path string, opts Options) (*Log, error) {
+	// Rotating without keeping a rotated file would remove the records in
+	// the current file, and the log is append-only.
+	if opts.MaxSize > 0 && opts.MaxFiles < 1 {
+		return nil, fmt.Errorf("audit log must keep at least 1 rotated file, not %d", opts.MaxFiles)
+	}
+	l := &Log{path: path, opts: opts}
+	if opts.Chain {
+		// The last record may be in the newest rotated file, if the log was
+		// rotated just before the server stopped.
+		for _, p := range []string{path, l.rotated(1)} {
+			last, err := lastRecord(p)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return nil, err
+			}
+			if last != nil {
+				l.prev = last.Hash
+				break
+			}
+		}
+	}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *Log) open() error {
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to stat audit log: %w", err)
+	}
+	l.f = f
+	l.size = info.Size()
+	return nil
+}
+
+// rotated returns the path of the nth newest rotated file.
+func (l *Log) rotated(n int) string {
+	return l.path + "." + strconv.Itoa(n)
+}
+
+// Write appends a record to the log, setting its hashes if the log is hash
+// chained, and rotates the file if it has grown past its maximum size.
+func (l *Log) Write(r Record) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.opts.Chain {
+		r.PrevHash = l.prev
+		h, err := r.hash()
+		if err != nil {
+			return fmt.Errorf("failed to hash audit record: %w", err)
+		}
+		r.Hash = h
+	}
+	line, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit record: %w", err)
+	}
+	line = append(line, '\n')
+
+	if l.opts.MaxSize > 0 && l.size > 0 && l.size+int64(len(line)) > l.opts.MaxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	// A single write, so that records from concurrent RPCs are not mixed.
+	n, err := l.f.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write audit record: %w", err)
+	}
+	l.prev = r.Hash
+	return nil
+}
+
+// rotate renames the file to <path>.1, after shifting the rotated files up
+// and removing the oldest, and opens a new file. l.mu must be held.
+func (l *Log) rotate() error {
+	if err := l.f.Close(); err != nil {
+		return fmt.Errorf("failed to close audit log: %w", err)
+	}
+	if err := os.Remove(l.rotated(l.opts.MaxFiles)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove old audit log: %w", err)
+	}
+	for n := l.opts.MaxFiles - 1; n >= 1; n-- {
+		if err := os.Rename(l.rotated(n), l.rotated(n+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to rotate audit log: %w", err)
+		}
+	}
+	if err := os.Rename(l.path, l.rotated(1)); err != nil {
+		return fmt.Errorf("failed to rotate audit log: %w", err)
+	}
+	return l.open()
+}
+
+// Close closes the log file.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Close()
+}
+
+// Filter selects records from the log. Fields that are not set match every
+// record.
+type Filter struct {
+	User  string    // Only records of RPCs made by, or on behalf of, this user.
+	RPC   string    // Only records of this method, e.g. "StopJob".
+	JobID string    // Only records on this job.
+	Since time.Time // Only records of RPCs that started at or after this time.
+	Limit int       // Return at most this many of the newest matching records. If 0, all are returned.
+}
+
+func (f Filter) match(r Record) bool {
+	return (f.User == "" || r.User == f.User || r.OnBehalfOf == f.User) &&
+		(f.RPC == "" || r.RPC == f.RPC) &&
+		(f.JobID == "" || r.JobID == f.JobID) &&
+		!r.Time.Before(f.Since)
+}
+
+// Query returns the records that match the filter, oldest first, from the
+// rotated files and the current one. The files are read from the newest, one
+// record at a time, and only the newest f.Limit matching records are kept, so
+// that a query does not read the whole log into memory. Once f.Limit records
+// have matched, older files are not read.
+func (l *Log) Query(f Filter) ([]Record, error) {
+	files, err := l.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer closeFiles(files)
+
+	var matched []Record
+	for i := len(files) - 1; i >= 0; i-- {
+		var fromFile []Record
+		err := decode(files[i].r, files[i].Name(), func(r Record) error {
+			if !f.match(r) {
+				return nil
+			}
+			fromFile = append(fromFile, r)
+			// Older records in the file would be cut by the limit.
+			if f.Limit > 0 && len(fromFile) > f.Limit-len(matched) {
+				fromFile = fromFile[1:]
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		matched = append(fromFile, matched...)
+		if f.Limit > 0 && len(matched) >= f.Limit {
+			break
+		}
+	}
+	return matched, nil
+}
+
+// Verify checks that every record in the log carries the hash of the record
+// before it, and that its own hash matches its contents. It is meant for logs
+// that were hash chained from the start. The first record that is kept may
+// follow one in a rotated file that was removed, so its PrevHash is not
+// checked.
+func (l *Log) Verify() error {
+	files, err := l.snapshot()
+	if err != nil {
+		return err
+	}
+	defer closeFiles(files)
+
+	n := 0
+	var prev string
+	for _, file := range files {
+		err := decode(file.r, file.Name(), func(r Record) error {
+			n++
+			h, err := r.hash()
+			if err != nil {
+				return fmt.Errorf("failed to hash audit record %d: %w", n, err)
+			}
+			if r.Hash == "" || h != r.Hash {
+				return fmt.Errorf("audit record %d at %s does not match its hash", n, r.Time.Format(time.RFC3339Nano))
+			}
+			if n > 1 && r.PrevHash != prev {
+				return fmt.Errorf("audit record %d at %s does not follow the record before it", n, r.Time.Format(time.RFC3339Nano))
+			}
+			prev = r.Hash
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// snapshotFile is a file of the log as it was when it was opened.
+type snapshotFile struct {
+	*os.File
+	r io.Reader // Reads the file up to its size when it was opened.
+}
+
+// snapshot opens the files of the log, oldest first. Rotating the log renames
+// and removes files, but does not change the ones already open, and the
+// current file is only read up to the size it had, so the files hold the log
+// as it was when snapshot returned.
+func (l *Log) snapshot() ([]snapshotFile, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var files []snapshotFile
+	for n := l.opts.MaxFiles; n >= 0; n-- {
+		path := l.path
+		if n > 0 {
+			path = l.rotated(n)
+		}
+		f, err := os.Open(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			closeFiles(files)
+			return nil, fmt.Errorf("failed to open audit log: %w", err)
+		}
+		var r io.Reader = f
+		if n == 0 {
+			r = io.NewSectionReader(f, 0, l.size)
+		}
+		files = append(files, snapshotFile{File: f, r: r})
+	}
+	return files, nil
+}
+
+// closeFiles closes the files of a snapshot.
+func closeFiles(files []snapshotFile) {
+	for _, f := range files {
+		f.Close()
+	}
+}
+
+// lastRecord returns the last record in the file at path, or nil if it has
+// none.
+func lastRecord(path string) (*Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var last *Record
+	err = decode(f, path, func(r Record) error {
+		last = &r
+		return nil
+	})
+	return last, err
+}
+
+// decode reads the records in the file named path from r, one at a time, and
+// calls fn with each of them, stopping at the first error fn returns.
+func decode(r io.Reader, path string, fn func(Record) error) error {
+	dec := json.NewDecoder(r)
+	for i := 1; ; i++ {
+		var rec Record
+		err := dec.Decode(&rec)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid audit record %d in %s: %w", i, path, err)
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+}
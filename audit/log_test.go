@@ -0,0 +1,243 @@
+package audit_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kkloberdanz/teleworker/audit"
+)
+
+func openLog(t *testing.T, path string, opts audit.Options) *audit.Log {
+	t.Helper()
+	l, err := audit.Open(path, opts)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+// writeRecords writes n records of GetJobStatus calls by alice, on jobs
+// job-<first> to job-<first+n-1>, a second apart.
+func writeRecords(t *testing.T, l *audit.Log, first, n int) {
+	t.Helper()
+	start := time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)
+	for i := first; i < first+n; i++ {
+		err := l.Write(audit.Record{
+			Time:  start.Add(time.Duration(i) * time.Second),
+			User:  "alice",
+			Role:  "client",
+			RPC:   "GetJobStatus",
+			JobID: fmt.Sprintf("job-%d", i),
+			Code:  "OK",
+		})
+		if err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+}
+
+func TestLogRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	// Each record is about 130 bytes, so each file holds a few.
+	l := openLog(t, path, audit.Options{MaxSize: 500, MaxFiles: 2})
+	writeRecords(t, l, 0, 20)
+
+	for _, p := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatalf("expected %s to exist: %v", p, err)
+		}
+		if info.Size() > 500 {
+			t.Fatalf("expected %s to be at most 500 bytes, got %d", p, info.Size())
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatalf("expected the oldest file to be removed, got %v", err)
+	}
+
+	records, err := l.Query(audit.Filter{})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	// The oldest records were removed with their file, and the rest are in
+	// order, ending with the newest.
+	if len(records) == 0 || len(records) >= 20 {
+		t.Fatalf("expected some of the records to be kept, got %d", len(records))
+	}
+	for i := 1; i < len(records); i++ {
+		if !records[i].Time.After(records[i-1].Time) {
+			t.Fatalf("expected records oldest first, got %v after %v", records[i].Time, records[i-1].Time)
+		}
+	}
+	if last := records[len(records)-1]; last.JobID != "job-19" {
+		t.Fatalf("expected the newest record last, got %s", last.JobID)
+	}
+}
+
+func TestOpenWithoutRotatedFiles(t *testing.T) {
+	// Rotating without keeping a rotated file would remove the current one.
+	_, err := audit.Open(filepath.Join(t.TempDir(), "audit.log"), audit.Options{MaxSize: 500})
+	if err == nil {
+		t.Fatal("expected Open to reject rotation without rotated files")
+	}
+}
+
+func TestLogQuery(t *testing.T) {
+	l := openLog(t, filepath.Join(t.TempDir(), "audit.log"), audit.Options{})
+	writeRecords(t, l, 0, 5)
+	if err := l.Write(audit.Record{Time: time.Now(), User: "bob", RPC: "StopJob", JobID: "job-1", Code: "NotFound"}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		filter audit.Filter
+		want   int
+	}{
+		{"all", audit.Filter{}, 6},
+		{"user", audit.Filter{User: "bob"}, 1},
+		{"rpc", audit.Filter{RPC: "GetJobStatus"}, 5},
+		{"job", audit.Filter{JobID: "job-1"}, 2},
+		{"since", audit.Filter{Since: time.Date(2026, 1, 2, 15, 4, 8, 0, time.UTC)}, 3},
+		{"limit", audit.Filter{RPC: "GetJobStatus", Limit: 2}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := l.Query(tt.filter)
+			if err != nil {
+				t.Fatalf("Query failed: %v", err)
+			}
+			if len(records) != tt.want {
+				t.Fatalf("expected %d records, got %d", tt.want, len(records))
+			}
+		})
+	}
+
+	// A limit keeps the newest records.
+	records, err := l.Query(audit.Filter{RPC: "GetJobStatus", Limit: 2})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if records[0].JobID != "job-3" || records[1].JobID != "job-4" {
+		t.Fatalf("expected job-3 and job-4, got %s and %s", records[0].JobID, records[1].JobID)
+	}
+}
+
+func TestLogQueryLimitAcrossFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l := openLog(t, path, audit.Options{MaxSize: 500, MaxFiles: 100})
+	writeRecords(t, l, 0, 20)
+
+	// Break the oldest file. A query that finds its limit in newer files
+	// does not read it.
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil || len(matches) < 3 {
+		t.Fatalf("expected the log to be rotated, got %v (%v)", matches, err)
+	}
+	oldest := fmt.Sprintf("%s.%d", path, len(matches))
+	if err := os.WriteFile(oldest, []byte("not json\n"), 0o600); err != nil {
+		t.Fatalf("failed to write %s: %v", oldest, err)
+	}
+
+	records, err := l.Query(audit.Filter{Limit: 7})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(records) != 7 {
+		t.Fatalf("expected 7 records, got %d", len(records))
+	}
+	for i, r := range records {
+		if want := fmt.Sprintf("job-%d", 13+i); r.JobID != want {
+			t.Fatalf("expected %s at %d, got %s", want, i, r.JobID)
+		}
+	}
+
+	if _, err := l.Query(audit.Filter{}); err == nil {
+		t.Fatal("expected a query of the whole log to fail on the broken file")
+	}
+}
+
+func TestLogQueryWhileWriting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	// Enough files that no record is removed, with rotations as the records
+	// are written.
+	l := openLog(t, path, audit.Options{MaxSize: 500, MaxFiles: 100})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		writeRecords(t, l, 0, 100)
+	}()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		records, err := l.Query(audit.Filter{})
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		// Every query sees the records written so far, in order, with none
+		// missing or read twice across a rotation.
+		for i, r := range records {
+			if want := fmt.Sprintf("job-%d", i); r.JobID != want {
+				t.Fatalf("expected %s at %d, got %s", want, i, r.JobID)
+			}
+		}
+	}
+}
+
+func TestLogChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	opts := audit.Options{MaxSize: 1000, MaxFiles: 5, Chain: true}
+	l := openLog(t, path, opts)
+	writeRecords(t, l, 0, 5)
+	l.Close()
+
+	// The chain continues after the log is reopened, and across rotations.
+	l = openLog(t, path, opts)
+	writeRecords(t, l, 5, 10)
+	if err := l.Verify(); err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if _, err := os.Stat(path + ".1"); err != nil {
+		t.Fatalf("expected the log to be rotated: %v", err)
+	}
+
+	// Editing a record breaks the chain.
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read log: %v", err)
+	}
+	data = bytes.Replace(data, []byte(`"user":"alice"`), []byte(`"user":"bob"`), 1)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("failed to write log: %v", err)
+	}
+	if err := l.Verify(); err == nil {
+		t.Fatal("expected Verify to fail after a record was changed")
+	}
+}
+
+func TestLogChainRemovedRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l := openLog(t, path, audit.Options{Chain: true})
+	writeRecords(t, l, 0, 3)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read log: %v", err)
+	}
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	if err := os.WriteFile(path, append(lines[0], lines[2]...), 0o600); err != nil {
+		t.Fatalf("failed to write log: %v", err)
+	}
+	if err := l.Verify(); err == nil {
+		t.Fatal("expected Verify to fail after a record was removed")
+	}
+}
@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"fmt"
+	"path"
+	"slices"
+)
+
+// Permission is what a job's owner may grant others on that job.
+type Permission string
+
+const (
+	PermissionView Permission = "view" // Get the job's status and stats.
+	PermissionLogs Permission = "logs" // Stream the job's output.
+	PermissionStop Permission = "stop" // Stop the job.
+)
+
+// permissionVerbs maps each permission to the verb it grants.
+var permissionVerbs = map[Permission]Verb{
+	PermissionView: VerbStatus,
+	PermissionLogs: VerbLogs,
+	PermissionStop: VerbStop,
+}
+
+// ParsePermission parses "view", "logs" or "stop".
+func ParsePermission(s string) (Permission, error) {
+	p := Permission(s)
+	if _, ok := permissionVerbs[p]; !ok {
+		return "", fmt.Errorf("unknown permission %q (expected view, logs or stop)", s)
+	}
+	return p, nil
+}
+
+// Grantee is who a job is shared with: a user or a group. Exactly one of the
+// fields is set.
+type Grantee struct {
+	User  string // Username, the CN of their certificate.
+	Group string // Group, see Identity.Groups.
+}
+
+// String returns "user:<name>" or "group:<name>".
+func (g Grantee) String() string {
+	if g.Group != "" {
+		return "group:" + g.Group
+	}
+	return "user:" + g.User
+}
+
+// ACL is the list of users and groups a job is shared with, and the
+// permissions each has. The nil ACL shares the job with no one.
+type ACL map[Grantee][]Permission
+
+// Grant adds permissions for the grantee.
+func (a ACL) Grant(g Grantee, perms ...Permission) {
+	for _, p := range perms {
+		if !slices.Contains(a[g], p) {
+			a[g] = append(a[g], p)
+		}
+	}
+	slices.Sort(a[g])
+}
+
+// Revoke removes permissions from the grantee, or all of its permissions if
+// none are given.
+func (a ACL) Revoke(g Grantee, perms ...Permission) {
+	if len(perms) > 0 {
+		a[g] = slices.DeleteFunc(a[g], func(p Permission) bool {
+			return slices.Contains(perms, p)
+		})
+	}
+	if len(perms) == 0 || len(a[g]) == 0 {
+		delete(a, g)
+	}
+}
+
+// Clone returns a copy of the ACL.
+func (a ACL) Clone() ACL {
+	clone := make(ACL, len(a))
+	for g, perms := range a {
+		clone[g] = slices.Clone(perms)
+	}
+	return clone
+}
+
+// Allows returns true if the ACL grants the caller, by username or by one of
+// their groups, the permission for an RPC, given by its full method name as
+// for Policy.Allows. RPCs no permission grants, such as ShareJob, are never
+// allowed.
+func (a ACL) Allows(id Identity, method string) bool {
+	verb, ok := rpcVerbs[path.Base(method)]
+	if !ok {
+		return false
+	}
+	for g, perms := range a {
+		if g.User != "" && g.User != id.Username {
+			continue
+		}
+		if g.Group != "" && !slices.Contains(id.Groups, g.Group) {
+			continue
+		}
+		for _, p := range perms {
+			if permissionVerbs[p] == verb {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package auth_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/kkloberdanz/teleworker/auth"
+	pb "github.com/kkloberdanz/teleworker/proto/teleworker/v1"
+)
+
+func TestACL(t *testing.T) {
+	bob := auth.Grantee{User: "bob"}
+	ml := auth.Grantee{Group: "ml"}
+
+	acl := make(auth.ACL)
+	acl.Grant(bob, auth.PermissionLogs, auth.PermissionView)
+	acl.Grant(bob, auth.PermissionView)
+	acl.Grant(ml, auth.PermissionStop)
+	if want := []auth.Permission{auth.PermissionLogs, auth.PermissionView}; !slices.Equal(acl[bob], want) {
+		t.Fatalf("expected %q for bob, got %q", want, acl[bob])
+	}
+
+	tests := []struct {
+		name   string
+		id     auth.Identity
+		method string
+		want   bool
+	}{
+		{"user view", auth.Identity{Username: "bob"}, pb.TeleWorker_GetJobStatus_FullMethodName, true},
+		{"user stats", auth.Identity{Username: "bob"}, pb.TeleWorker_WatchJobStats_FullMethodName, true},
+		{"user logs", auth.Identity{Username: "bob"}, pb.TeleWorker_StreamOutput_FullMethodName, true},
+		{"user not granted", auth.Identity{Username: "bob"}, pb.TeleWorker_StopJob_FullMethodName, false},
+		{"group", auth.Identity{Username: "carol", Groups: []string{"ops", "ml"}}, pb.TeleWorker_StopJob_FullMethodName, true},
+		{"group not granted", auth.Identity{Username: "carol", Groups: []string{"ml"}}, pb.TeleWorker_GetJobStatus_FullMethodName, false},
+		{"username is not a group", auth.Identity{Username: "ml"}, pb.TeleWorker_StopJob_FullMethodName, false},
+		{"share is never granted", auth.Identity{Username: "bob"}, pb.TeleWorker_ShareJob_FullMethodName, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := acl.Allows(tt.id, tt.method); got != tt.want {
+				t.Fatalf("Allows = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	clone := acl.Clone()
+	acl.Revoke(bob, auth.PermissionLogs)
+	if want := []auth.Permission{auth.PermissionView}; !slices.Equal(acl[bob], want) {
+		t.Fatalf("expected %q for bob, got %q", want, acl[bob])
+	}
+	if len(clone[bob]) != 2 {
+		t.Fatalf("expected the clone to be unchanged, got %q", clone[bob])
+	}
+	acl.Revoke(bob, auth.PermissionView)
+	acl.Revoke(ml)
+	if len(acl) != 0 {
+		t.Fatalf("expected an empty ACL, got %v", acl)
+	}
+}
+
+func TestParsePermission(t *testing.T) {
+	if p, err := auth.ParsePermission("logs"); err != nil || p != auth.PermissionLogs {
+		t.Fatalf("ParsePermission(logs) = %q, %v", p, err)
+	}
+	if _, err := auth.ParsePermission("share"); err == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -0,0 +1,220 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// ErrCommandDenied is returned when the command policy does not allow a
+// caller to run a command.
+var ErrCommandDenied = errors.New("command not allowed")
+
+// anyArgs, as the last argument pattern of a CommandRule, allows any number
+// of further arguments.
+const anyArgs = "..."
+
+// CommandPolicy restricts the commands each caller may run. Like Policy, rules
+// are granted to roles and to usernames, and a caller has the rules of both.
+// A caller whose role and username have no rules may run nothing.
+//
+// In a policy file, it is the "commands" key:
+//
+//	commands:
+//	  roles:
+//	    client:
+//	      - path: /usr/bin/*
+//	      - path: /usr/bin/python3
+//	        args: ["*.py", "..."]
+//	  users:
+//	    alice:
+//	      - sha256: 9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08
+//	      - image: alpine*
+type CommandPolicy struct {
+	Roles map[string][]CommandRule `yaml:"roles"` // Rules for each role.
+	Users map[string][]CommandRule `yaml:"users"` // Rules for each username, in addition to those of their role.
+}
+
+// CommandRule allows a command. Every field that is set must match.
+type CommandRule struct {
+	Path   string   `yaml:"path"`   // Absolute path or glob, e.g. "/usr/bin/*", matched against the command after it is looked up in PATH.
+	SHA256 string   `yaml:"sha256"` // Hex SHA-256 hash of the executable.
+	Image  string   `yaml:"image"`  // Name or glob of the OCI images the rule allows, relative to the server's image directory. Path then matches the command as given, which is resolved inside the image.
+	Args   []string `yaml:"args"`   // Pattern for each argument, in which "*" matches any characters, including "/", and "?" matches one. A last pattern of "..." allows any further arguments. If nil, any arguments are allowed, and if empty, none are.
+
+	args []*regexp.Regexp // Args compiled by check. nil for anyArgs.
+}
+
+// Command is a command a caller asks to run.
+type Command struct {
+	Name  string   // The command as given, e.g. "ls" or "/usr/bin/ls".
+	Args  []string // Arguments, not including the command.
+	Image string   // Name of the OCI image to run the command from, relative to the server's image directory, or empty to run it on the host.
+}
+
+// check checks that the rule is valid and compiles its argument patterns.
+func (r *CommandRule) check() error {
+	if r.Path == "" && r.SHA256 == "" && r.Image == "" {
+		return errors.New("command rule sets no path, sha256 or image")
+	}
+	if r.Image != "" && r.SHA256 != "" {
+		return errors.New("command rule can not set both image and sha256")
+	}
+	if r.Path != "" && r.Image == "" && !strings.HasPrefix(r.Path, "/") {
+		return fmt.Errorf("command path %q is not absolute", r.Path)
+	}
+	for _, pattern := range []string{r.Path, r.Image} {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid glob %q: %w", pattern, err)
+		}
+	}
+	if r.SHA256 != "" {
+		if b, err := hex.DecodeString(r.SHA256); err != nil || len(b) != sha256.Size {
+			return fmt.Errorf("invalid sha256 %q", r.SHA256)
+		}
+		r.SHA256 = strings.ToLower(r.SHA256)
+	}
+
+	r.args = nil
+	for i, pattern := range r.Args {
+		if pattern == anyArgs {
+			if i != len(r.Args)-1 {
+				return fmt.Errorf("%q must be the last argument pattern", anyArgs)
+			}
+			break
+		}
+		re := regexp.QuoteMeta(pattern)
+		re = strings.ReplaceAll(re, `\*`, ".*")
+		re = strings.ReplaceAll(re, `\?`, ".")
+		r.args = append(r.args, regexp.MustCompile("^"+re+"$"))
+	}
+	return nil
+}
+
+// matchArgs returns true if the arguments match the rule's patterns.
+func (r *CommandRule) matchArgs(args []string) bool {
+	if r.Args == nil {
+		return true
+	}
+	rest := len(r.Args) > 0 && r.Args[len(r.Args)-1] == anyArgs
+	if len(args) < len(r.args) || (!rest && len(args) > len(r.args)) {
+		return false
+	}
+	for i, re := range r.args {
+		if !re.MatchString(args[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckCommand returns an error wrapping ErrCommandDenied unless a command
+// rule allows the caller to run the command. If the policy has no command
+// rules, any command is allowed.
+//
+// Commands run on the host are looked up the way exec.Command does: a name
+// without a slash is looked up in PATH, and other names are used as they
+// are. Only absolute paths can match a rule.
+//
+// If the rule that allows the command gives its hash, the hash is returned.
+// The file may change once it has been checked, so the caller must check the
+// hash again on what it executes, see job.Options.SHA256.
+func (p *Policy) CheckCommand(id Identity, cmd Command) (string, error) {
+	if p.Commands == nil {
+		return "", nil
+	}
+	rules := slices.Concat(p.Commands.Roles[id.Role], p.Commands.Users[id.Username])
+
+	if cmd.Image != "" {
+		if err := checkClean(cmd.Image, cmd.Name); err != nil {
+			return "", err
+		}
+		for _, rule := range rules {
+			if rule.Image == "" || !match(rule.Image, cmd.Image) {
+				continue
+			}
+			if (rule.Path == "" || match(rule.Path, cmd.Name)) && rule.matchArgs(cmd.Args) {
+				return "", nil
+			}
+		}
+		return "", fmt.Errorf("%w: %s may not run %q from image %s", ErrCommandDenied, id.Username, cmd.Name, cmd.Image)
+	}
+
+	resolved := cmd.Name
+	if !strings.Contains(resolved, "/") {
+		lp, err := exec.LookPath(resolved)
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", ErrCommandDenied, err)
+		}
+		resolved = lp
+	}
+	if !filepath.IsAbs(resolved) {
+		return "", fmt.Errorf("%w: %q is not an absolute path", ErrCommandDenied, resolved)
+	}
+	if err := checkClean(resolved); err != nil {
+		return "", err
+	}
+
+	var hash string // Computed once, if a rule needs it.
+	for _, rule := range rules {
+		if rule.Image != "" || (rule.Path != "" && !match(rule.Path, resolved)) || !rule.matchArgs(cmd.Args) {
+			continue
+		}
+		if rule.SHA256 != "" {
+			if hash == "" {
+				var err error
+				if hash, err = hashFile(resolved); err != nil {
+					return "", fmt.Errorf("%w: %v", ErrCommandDenied, err)
+				}
+			}
+			if hash != rule.SHA256 {
+				continue
+			}
+		}
+		return rule.SHA256, nil
+	}
+	return "", fmt.Errorf("%w: %s may not run %s with arguments %q", ErrCommandDenied, id.Username, resolved, cmd.Args)
+}
+
+// checkClean returns an error wrapping ErrCommandDenied if any of the paths
+// is not clean, or has a ".." element, as a relative path that is clean may
+// start with one. In a glob, "*" matches any path element, including ".."
+// and an empty one, so a path with "..", "." or "//" in it could match a rule
+// for a directory it is not in.
+func checkClean(paths ...string) error {
+	for _, p := range paths {
+		if p != "" && (filepath.Clean(p) != p || slices.Contains(strings.Split(p, "/"), "..")) {
+			return fmt.Errorf("%w: %q is not a clean path", ErrCommandDenied, p)
+		}
+	}
+	return nil
+}
+
+// match returns true if name matches the glob pattern.
+func match(pattern, name string) bool {
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
+
+// hashFile returns the hex SHA-256 hash of the file at path.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,140 @@
+package auth_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kkloberdanz/teleworker/auth"
+)
+
+// writeExecutable writes an executable script to dir and returns its path.
+func writeExecutable(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o755); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+	return path
+}
+
+func TestCheckCommand(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PATH", dir)
+	tool := writeExecutable(t, dir, "tool", "#!/bin/sh\n")
+	other := writeExecutable(t, dir, "other", "#!/bin/sh\nexit 1\n")
+	sum := sha256.Sum256([]byte("#!/bin/sh\nexit 1\n"))
+
+	policy, err := auth.ParsePolicy([]byte(`
+roles:
+  client:
+    - verbs: ["*"]
+commands:
+  roles:
+    client:
+      - path: ` + dir + `/t*
+        args: ["-v", "*.txt", "..."]
+      - path: ` + dir + `/jail/*/tool
+  users:
+    alice:
+      - sha256: ` + hex.EncodeToString(sum[:]) + `
+        args: []
+      - image: alpine*
+        path: /bin/sh
+    dave:
+      - image: "*/alpine.tar"
+        path: /bin/*/sh
+`))
+	if err != nil {
+		t.Fatalf("ParsePolicy failed: %v", err)
+	}
+	alice := auth.Identity{Username: "alice", Role: auth.RoleClient}
+	bob := auth.Identity{Username: "bob", Role: auth.RoleClient}
+	dave := auth.Identity{Username: "dave", Role: auth.RoleClient}
+
+	tests := []struct {
+		name string
+		id   auth.Identity
+		cmd  auth.Command
+		ok   bool
+	}{
+		{"looked up in PATH", bob, auth.Command{Name: "tool", Args: []string{"-v", "a.txt"}}, true},
+		{"absolute path", bob, auth.Command{Name: tool, Args: []string{"-v", "dir/a.txt", "more"}}, true},
+		{"too few args", bob, auth.Command{Name: "tool", Args: []string{"-v"}}, false},
+		{"arg does not match", bob, auth.Command{Name: "tool", Args: []string{"-x", "a.txt"}}, false},
+		{"path does not match", bob, auth.Command{Name: other}, false},
+		{"not found", bob, auth.Command{Name: "missing", Args: []string{"-v", "a.txt"}}, false},
+		{"relative path", bob, auth.Command{Name: "./tool", Args: []string{"-v", "a.txt"}}, false},
+		{"hash matches", alice, auth.Command{Name: "other"}, true},
+		{"hash with args", alice, auth.Command{Name: "other", Args: []string{"x"}}, false},
+		{"hash does not match", alice, auth.Command{Name: "/bin/sh"}, false},
+		{"image", alice, auth.Command{Name: "/bin/sh", Args: []string{"-c", "true"}, Image: "alpine.tar"}, true},
+		{"image command does not match", alice, auth.Command{Name: "/bin/ls", Image: "alpine.tar"}, false},
+		{"image not allowed", bob, auth.Command{Name: "tool", Args: []string{"-v", "a.txt"}, Image: "alpine.tar"}, false},
+		// "*" matches ".." and empty path elements, so paths must be clean
+		// to match a glob.
+		{"glob", bob, auth.Command{Name: dir + "/jail/x/tool"}, true},
+		{"glob with ..", bob, auth.Command{Name: dir + "/jail/../tool"}, false},
+		{"glob with //", bob, auth.Command{Name: dir + "/jail//tool"}, false},
+		{"image glob", dave, auth.Command{Name: "/bin/x/sh", Image: "x/alpine.tar"}, true},
+		{"image with ..", dave, auth.Command{Name: "/bin/x/sh", Image: "../alpine.tar"}, false},
+		{"image with //", dave, auth.Command{Name: "/bin/x/sh", Image: "x//alpine.tar"}, false},
+		{"image command with ..", dave, auth.Command{Name: "/bin/../sh", Image: "x/alpine.tar"}, false},
+		{"image command with //", dave, auth.Command{Name: "/bin//sh", Image: "x/alpine.tar"}, false},
+		{"no rules", auth.Identity{Username: "carol", Role: auth.RoleAuditor}, auth.Command{Name: "tool"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := policy.CheckCommand(tt.id, tt.cmd)
+			if tt.ok && err != nil {
+				t.Fatalf("CheckCommand failed: %v", err)
+			}
+			if !tt.ok && !errors.Is(err, auth.ErrCommandDenied) {
+				t.Fatalf("expected ErrCommandDenied, got %v", err)
+			}
+		})
+	}
+
+	// The hash of a command allowed by its hash is returned, so that it can
+	// be checked again on what is executed. Other rules return no hash.
+	if hash, err := policy.CheckCommand(alice, auth.Command{Name: "other"}); err != nil || hash != hex.EncodeToString(sum[:]) {
+		t.Fatalf("expected the hash of other, got %q, %v", hash, err)
+	}
+	if hash, err := policy.CheckCommand(bob, auth.Command{Name: "tool", Args: []string{"-v", "a.txt"}}); err != nil || hash != "" {
+		t.Fatalf("expected no hash, got %q, %v", hash, err)
+	}
+}
+
+func TestCheckCommandNoRules(t *testing.T) {
+	// Without a commands section, any command is allowed, even one that does
+	// not exist.
+	id := auth.Identity{Username: "bob", Role: auth.RoleClient}
+	if _, err := auth.DefaultPolicy().CheckCommand(id, auth.Command{Name: "missing"}); err != nil {
+		t.Fatalf("CheckCommand failed: %v", err)
+	}
+}
+
+func TestParseCommandPolicyErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"empty rule", "commands: {roles: {client: [{args: [a]}]}}"},
+		{"relative path", "commands: {roles: {client: [{path: bin/ls}]}}"},
+		{"bad glob", "commands: {roles: {client: [{path: '/bin/[']}]}}"},
+		{"bad sha256", "commands: {roles: {client: [{sha256: abc}]}}"},
+		{"image and sha256", "commands: {roles: {client: [{image: /a, sha256: " + hex.EncodeToString(make([]byte, 32)) + "}]}}"},
+		{"any args not last", "commands: {roles: {client: [{path: /bin/ls, args: ['...', a]}]}}"},
+		{"misspelled key", "commands: {roles: {client: [{pth: /bin/ls}]}}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := auth.ParsePolicy([]byte(tt.data)); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrCertificateRevoked is returned when a client certificate is on a
+// certificate revocation list.
+var ErrCertificateRevoked = errors.New("certificate has been revoked")
+
+// RevocationList holds the certificate revocation lists (CRLs) read from a
+// set of files, and checks client certificates against them. Reload rereads
+// the files, so that certificates can be revoked without restarting the
+// server.
+type RevocationList struct {
+	paths []string
+
+	mu       sync.RWMutex
+	crls     []crl
+	onReject func(leaf *x509.Certificate, err error) // Called with each certificate verifyConnection rejects, if set.
+}
+
+// crl is one parsed certificate revocation list.
+type crl struct {
+	path    string
+	list    *x509.RevocationList
+	revoked map[string]time.Time // Map serial number, in hex, to the time it was revoked.
+}
+
+// LoadRevocationList reads CRLs from the given files. Each file holds one DER
+// CRL, or any number of PEM "X509 CRL" blocks.
+func LoadRevocationList(paths ...string) (*RevocationList, error) {
+	r := &RevocationList{paths: paths}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload rereads the CRL files. If any of them can not be read, the CRLs
+// loaded before are kept, and an error is returned.
+func (r *RevocationList) Reload() error {
+	var crls []crl
+	for _, path := range r.paths {
+		lists, err := readCRLs(path)
+		if err != nil {
+			return err
+		}
+		for _, list := range lists {
+			if !list.NextUpdate.IsZero() && time.Now().After(list.NextUpdate) {
+				slog.Warn(
+					"certificate revocation list is out of date",
+					"path", path,
+					"issuer", list.Issuer,
+					"nextUpdate", list.NextUpdate,
+				)
+			}
+			revoked := make(map[string]time.Time, len(list.RevokedCertificateEntries))
+			for _, entry := range list.RevokedCertificateEntries {
+				revoked[entry.SerialNumber.Text(16)] = entry.RevocationTime
+			}
+			crls = append(crls, crl{path: path, list: list, revoked: revoked})
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.crls = crls
+	return nil
+}
+
+// OnReject sets a function to call with each client certificate that is
+// rejected during a handshake because it has been revoked, e.g. to write it to
+// an audit log. It is called before the handshake fails.
+func (r *RevocationList) OnReject(f func(leaf *x509.Certificate, err error)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onReject = f
+}
+
+// readCRLs parses the CRLs in a PEM or DER file.
+func readCRLs(path string) ([]*x509.RevocationList, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read crl: %w", err)
+	}
+	if !bytes.Contains(data, []byte("-----BEGIN")) {
+		list, err := x509.ParseRevocationList(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse crl %s: %w", path, err)
+		}
+		return []*x509.RevocationList{list}, nil
+	}
+
+	var lists []*x509.RevocationList
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "X509 CRL" {
+			continue
+		}
+		list, err := x509.ParseRevocationList(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse crl %s: %w", path, err)
+		}
+		lists = append(lists, list)
+	}
+	if len(lists) == 0 {
+		return nil, fmt.Errorf("no crl found in %s", path)
+	}
+	return lists, nil
+}
+
+// Check returns an error wrapping ErrCertificateRevoked if a CRL from the
+// issuer of a verified chain's leaf certificate lists the leaf's serial
+// number. CRLs whose signature does not verify against the issuer are
+// ignored.
+func (r *RevocationList) Check(chain []*x509.Certificate) error {
+	if len(chain) < 2 {
+		return nil
+	}
+	leaf, issuer := chain[0], chain[1]
+	serial := leaf.SerialNumber.Text(16)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, c := range r.crls {
+		if !bytes.Equal(c.list.RawIssuer, issuer.RawSubject) {
+			continue
+		}
+		revokedAt, ok := c.revoked[serial]
+		if !ok {
+			continue
+		}
+		if err := c.list.CheckSignatureFrom(issuer); err != nil {
+			slog.Warn(
+				"ignoring certificate revocation list with a bad signature",
+				"path", c.path,
+				"issuer", c.list.Issuer,
+				"error", err,
+			)
+			continue
+		}
+		return fmt.Errorf("%w: serial %s, revoked at %s by %s", ErrCertificateRevoked, formatSerial(leaf.SerialNumber), revokedAt.Format(time.RFC3339), c.path)
+	}
+	return nil
+}
+
+// verifyConnection is a tls.Config.VerifyConnection callback that rejects
+// revoked client certificates, and logs each rejection and passes it to the
+// OnReject function. Unlike VerifyPeerCertificate, VerifyConnection is also
+// called when a client resumes a session, so a client can not skip the CRLs
+// with a session ticket it got before its certificate was revoked.
+func (r *RevocationList) verifyConnection(cs tls.ConnectionState) error {
+	for _, chain := range cs.VerifiedChains {
+		err := r.Check(chain)
+		if err == nil {
+			continue
+		}
+		leaf := chain[0]
+		slog.Warn(
+			"rejected revoked client certificate",
+			"subject", leaf.Subject.String(),
+			"serial", formatSerial(leaf.SerialNumber),
+			"issuer", leaf.Issuer.String(),
+			"error", err,
+		)
+		r.mu.RLock()
+		onReject := r.onReject
+		r.mu.RUnlock()
+		if onReject != nil {
+			onReject(leaf, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// formatSerial formats a serial number as colon separated hex bytes, like
+// openssl does.
+func formatSerial(n *big.Int) string {
+	var buf bytes.Buffer
+	for i, b := range n.Bytes() {
+		if i > 0 {
+			buf.WriteByte(':')
+		}
+		fmt.Fprintf(&buf, "%02X", b)
+	}
+	return buf.String()
+}
@@ -0,0 +1,219 @@
+package auth_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kkloberdanz/teleworker/auth"
+	"github.com/kkloberdanz/teleworker/testutil"
+)
+
+// parseCert returns the leaf certificate of certs/<name>.crt.
+func parseCert(t *testing.T, name string) *x509.Certificate {
+	t.Helper()
+	cert, err := x509.ParseCertificate(testutil.LoadCert(t, name).Certificate[0])
+	if err != nil {
+		t.Fatalf("failed to parse %s: %v", name, err)
+	}
+	return cert
+}
+
+// createCRL returns a DER CRL, signed by key, that revokes the given serial
+// numbers.
+func createCRL(t *testing.T, issuer *x509.Certificate, key crypto.Signer, serials ...*big.Int) []byte {
+	t.Helper()
+	template := &x509.RevocationList{
+		Number:     big.NewInt(time.Now().UnixNano()),
+		ThisUpdate: time.Now().Add(-time.Minute),
+		NextUpdate: time.Now().Add(time.Hour),
+	}
+	for _, serial := range serials {
+		template.RevokedCertificateEntries = append(template.RevokedCertificateEntries, x509.RevocationListEntry{
+			SerialNumber:   serial,
+			RevocationTime: time.Now().Add(-time.Minute),
+		})
+	}
+	// certs/ca.crt has no key usage extension, which allows it to sign CRLs,
+	// but CreateRevocationList wants the bit set.
+	signer := *issuer
+	signer.KeyUsage |= x509.KeyUsageCRLSign
+	der, err := x509.CreateRevocationList(rand.Reader, template, &signer, key)
+	if err != nil {
+		t.Fatalf("failed to create crl: %v", err)
+	}
+	return der
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+}
+
+func TestRevocationList(t *testing.T) {
+	caTLS := testutil.LoadCert(t, "ca")
+	ca := parseCert(t, "ca")
+	alice := parseCert(t, "alice")
+	bob := parseCert(t, "bob")
+	key := caTLS.PrivateKey.(crypto.Signer)
+
+	path := filepath.Join(t.TempDir(), "ca.crl")
+	writeFile(t, path, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: createCRL(t, ca, key, alice.SerialNumber)}))
+	crl, err := auth.LoadRevocationList(path)
+	if err != nil {
+		t.Fatalf("LoadRevocationList failed: %v", err)
+	}
+	conf, err := auth.ServerTLSConfig(testutil.CACertPEM(t), testutil.LoadCert(t, "server"), crl)
+	if err != nil {
+		t.Fatalf("ServerTLSConfig failed: %v", err)
+	}
+
+	if err := conf.VerifyConnection(tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{alice, ca}}}); !errors.Is(err, auth.ErrCertificateRevoked) {
+		t.Fatalf("expected ErrCertificateRevoked for alice, got %v", err)
+	}
+	if err := conf.VerifyConnection(tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{bob, ca}}}); err != nil {
+		t.Fatalf("expected bob to be accepted, got %v", err)
+	}
+
+	// A CRL that can not be parsed is not loaded, and the old one is kept.
+	writeFile(t, path, []byte("not a crl"))
+	if err := crl.Reload(); err == nil {
+		t.Fatal("expected Reload to fail")
+	}
+	if err := crl.Check([]*x509.Certificate{alice, ca}); !errors.Is(err, auth.ErrCertificateRevoked) {
+		t.Fatalf("expected alice to still be revoked, got %v", err)
+	}
+
+	// DER CRLs are read too.
+	writeFile(t, path, createCRL(t, ca, key, bob.SerialNumber))
+	if err := crl.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if err := crl.Check([]*x509.Certificate{alice, ca}); err != nil {
+		t.Fatalf("expected alice to be accepted, got %v", err)
+	}
+	if err := crl.Check([]*x509.Certificate{bob, ca}); !errors.Is(err, auth.ErrCertificateRevoked) {
+		t.Fatalf("expected ErrCertificateRevoked for bob, got %v", err)
+	}
+}
+
+func TestRevocationListBadSignature(t *testing.T) {
+	ca := parseCert(t, "ca")
+	alice := parseCert(t, "alice")
+
+	// A CRL that names the CA as its issuer, but is signed by another key,
+	// revokes nothing.
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	impostor := *ca
+	impostor.PublicKey = key.Public()
+	path := filepath.Join(t.TempDir(), "ca.crl")
+	writeFile(t, path, createCRL(t, &impostor, key, alice.SerialNumber))
+
+	crl, err := auth.LoadRevocationList(path)
+	if err != nil {
+		t.Fatalf("LoadRevocationList failed: %v", err)
+	}
+	if err := crl.Check([]*x509.Certificate{alice, ca}); err != nil {
+		t.Fatalf("expected alice to be accepted, got %v", err)
+	}
+}
+
+func TestRevocationListHandshake(t *testing.T) {
+	ca := parseCert(t, "ca")
+	alice := parseCert(t, "alice")
+	path := filepath.Join(t.TempDir(), "ca.crl")
+	writeFile(t, path, createCRL(t, ca, testutil.LoadCert(t, "ca").PrivateKey.(crypto.Signer), alice.SerialNumber))
+
+	crl, err := auth.LoadRevocationList(path)
+	if err != nil {
+		t.Fatalf("LoadRevocationList failed: %v", err)
+	}
+	serverConf, err := auth.ServerTLSConfig(testutil.CACertPEM(t), testutil.LoadCert(t, "server"), crl)
+	if err != nil {
+		t.Fatalf("ServerTLSConfig failed: %v", err)
+	}
+	var rejected []string
+	crl.OnReject(func(leaf *x509.Certificate, err error) {
+		if !errors.Is(err, auth.ErrCertificateRevoked) {
+			t.Errorf("expected ErrCertificateRevoked, got %v", err)
+		}
+		rejected = append(rejected, leaf.Subject.CommonName)
+	})
+
+	for _, tt := range []struct {
+		name    string
+		revoked bool
+	}{
+		{"alice", true},
+		{"bob", false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := handshake(t, serverConf, testutil.ClientTLSConfig(t, tt.name))
+			if tt.revoked && !errors.Is(err, auth.ErrCertificateRevoked) {
+				t.Fatalf("expected ErrCertificateRevoked, got %v", err)
+			}
+			if !tt.revoked && err != nil {
+				t.Fatalf("Handshake failed: %v", err)
+			}
+		})
+	}
+	if len(rejected) != 1 || rejected[0] != "alice" {
+		t.Fatalf("expected only alice to be rejected, got %v", rejected)
+	}
+}
+
+func TestRevocationListResumedSession(t *testing.T) {
+	ca := parseCert(t, "ca")
+	bob := parseCert(t, "bob")
+	key := testutil.LoadCert(t, "ca").PrivateKey.(crypto.Signer)
+	path := filepath.Join(t.TempDir(), "ca.crl")
+	writeFile(t, path, createCRL(t, ca, key))
+
+	crl, err := auth.LoadRevocationList(path)
+	if err != nil {
+		t.Fatalf("LoadRevocationList failed: %v", err)
+	}
+	serverConf, err := auth.ServerTLSConfig(testutil.CACertPEM(t), testutil.LoadCert(t, "server"), crl)
+	if err != nil {
+		t.Fatalf("ServerTLSConfig failed: %v", err)
+	}
+	clientConf := testutil.ClientTLSConfig(t, "bob")
+	clientConf.ClientSessionCache = tls.NewLRUClientSessionCache(1)
+
+	// bob gets a session ticket before his certificate is revoked.
+	if _, err := handshake(t, serverConf, clientConf); err != nil {
+		t.Fatalf("Handshake failed: %v", err)
+	}
+
+	var rejected []string
+	crl.OnReject(func(leaf *x509.Certificate, err error) {
+		rejected = append(rejected, leaf.Subject.CommonName)
+	})
+
+	// Resuming the session must not skip the check of the new CRL.
+	writeFile(t, path, createCRL(t, ca, key, bob.SerialNumber))
+	if err := crl.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if _, err := handshake(t, serverConf, clientConf); !errors.Is(err, auth.ErrCertificateRevoked) {
+		t.Fatalf("expected ErrCertificateRevoked on a resumed session, got %v", err)
+	}
+	if len(rejected) != 1 || rejected[0] != "bob" {
+		t.Fatalf("expected the resumed session to be passed to OnReject, got %v", rejected)
+	}
+}
@@ -23,10 +23,13 @@ const (
 // See: https://pkg.go.dev/context#WithValue
 type identityKey struct{}
 
-// Identity represents the authenticated caller, extracted from a client TLS certificate.
+// Identity represents the authenticated caller, extracted from a client TLS
+// certificate by a Mapper. By default, SubjectMapper takes it from the
+// certificate's subject.
 type Identity struct {
-	Username string // CN from the certificate subject
-	Role     string // First OU from the certificate subject ("admin" or "client")
+	Username string   // CN from the certificate subject
+	Role     string   // First OU from the certificate subject, e.g. "admin" or "client". See Policy.
+	Groups   []string // Further OUs, and the names of "group:<name>" URI SANs. Jobs may be shared with groups, see ACL.
 }
 
 // NewContext returns a new context with the given identity attached.
@@ -50,8 +53,9 @@ func (id Identity) IsAdmin() bool {
 	return id.Role == RoleAdmin
 }
 
-// identityFromTLS extracts the caller's identity from the gRPC peer TLS certificate.
-func identityFromTLS(ctx context.Context) (Identity, error) {
+// identityFromTLS extracts the caller's identity from the gRPC peer TLS
+// certificate with the mapper.
+func identityFromTLS(ctx context.Context, m Mapper) (Identity, error) {
 	p, ok := peer.FromContext(ctx)
 	if !ok {
 		return Identity{}, status.Error(codes.PermissionDenied, "no peer info in context")
@@ -66,17 +70,9 @@ func identityFromTLS(ctx context.Context) (Identity, error) {
 		return Identity{}, status.Error(codes.PermissionDenied, "no verified certificate chain")
 	}
 
-	cert := tlsInfo.State.VerifiedChains[0][0]
-	if len(cert.Subject.OrganizationalUnit) == 0 {
-		return Identity{}, status.Error(codes.PermissionDenied, "certificate has no organizational unit")
+	id, err := m.Identity(tlsInfo.State.VerifiedChains[0][0])
+	if err != nil {
+		return Identity{}, status.Error(codes.PermissionDenied, err.Error())
 	}
-	role := cert.Subject.OrganizationalUnit[0]
-	if role != RoleAdmin && role != RoleClient {
-		return Identity{}, status.Errorf(codes.PermissionDenied, "unrecognized role %q", role)
-	}
-
-	return Identity{
-		Username: cert.Subject.CommonName,
-		Role:     role,
-	}, nil
+	return id, nil
 }
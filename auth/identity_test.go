@@ -6,7 +6,9 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"net/url"
 	"os"
+	"slices"
 	"testing"
 
 	"go.uber.org/goleak"
@@ -91,7 +93,6 @@ func TestUnaryInterceptorPermissionDenied(t *testing.T) {
 		{"no TLS", peer.NewContext(t.Context(), &peer.Peer{})},
 		{"empty chains", tlsCtx(credentials.TLSInfo{})},
 		{"empty OU", certCtx("alice")},
-		{"unrecognized role", certCtx("alice", "superuser")},
 	}
 
 	for _, tt := range tests {
@@ -108,6 +109,42 @@ func TestUnaryInterceptorPermissionDenied(t *testing.T) {
 	}
 }
 
+func TestUnaryInterceptorGroups(t *testing.T) {
+	cert := &x509.Certificate{
+		Subject: pkix.Name{
+			CommonName:         "bob",
+			OrganizationalUnit: []string{"client", "ml", "ops", "ml"},
+		},
+		URIs: []*url.URL{
+			{Scheme: "group", Opaque: "research"},
+			{Scheme: "spiffe", Host: "example.org", Path: "/bob"},
+		},
+	}
+	ctx := peer.NewContext(t.Context(), &peer.Peer{AuthInfo: credentials.TLSInfo{
+		State: tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{{cert}},
+		},
+	}})
+
+	handler := func(ctx context.Context, req any) (any, error) {
+		id, err := auth.FromContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if id.Role != "client" {
+			t.Errorf("expected role %q, got %q", "client", id.Role)
+		}
+		if want := []string{"ml", "ops", "research"}; !slices.Equal(id.Groups, want) {
+			t.Errorf("expected groups %q, got %q", want, id.Groups)
+		}
+		return nil, nil
+	}
+
+	if _, err := auth.UnaryInterceptor(ctx, nil, nil, handler); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
 func TestIsAdmin(t *testing.T) {
 	tests := []struct {
 		role string
@@ -9,24 +9,53 @@ import (
 // Interceptor examples:
 // https://github.com/grpc/grpc-go/blob/master/examples/features/interceptor/server/main.go
 
-// UnaryInterceptor extracts the caller's identity from the TLS certificate and
-// stores it in the context.
+// UnaryInterceptor extracts the caller's identity from the TLS certificate,
+// with SubjectMapper, and stores it in the context.
 func UnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
-	id, err := identityFromTLS(ctx)
-	if err != nil {
-		return nil, err
-	}
-	return handler(NewContext(ctx, id), req)
+	return NewUnaryInterceptor(SubjectMapper{}, nil)(ctx, req, info, handler)
 }
 
-// StreamInterceptor extracts the caller's identity from the TLS certificate and
-// stores it in the context.
+// StreamInterceptor extracts the caller's identity from the TLS certificate,
+// with SubjectMapper, and stores it in the context.
 func StreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
-	id, err := identityFromTLS(ss.Context())
-	if err != nil {
-		return err
+	return NewStreamInterceptor(SubjectMapper{}, nil)(srv, ss, info, handler)
+}
+
+// RejectFunc is called with each RPC that an interceptor rejects because the
+// caller has no identity, e.g. to write it to an audit log. The context has
+// no identity in it. req is nil for streaming RPCs, since the interceptor
+// rejects them before the client's first message is read.
+type RejectFunc func(ctx context.Context, method string, req any, err error)
+
+// NewUnaryInterceptor returns an interceptor that extracts the caller's
+// identity from the TLS certificate with the mapper, and stores it in the
+// context. If there is no identity to extract, the RPC is rejected, and
+// passed to onReject, unless it is nil.
+func NewUnaryInterceptor(m Mapper, onReject RejectFunc) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		id, err := identityFromTLS(ctx, m)
+		if err != nil {
+			if onReject != nil {
+				onReject(ctx, info.FullMethod, req, err)
+			}
+			return nil, err
+		}
+		return handler(NewContext(ctx, id), req)
+	}
+}
+
+// NewStreamInterceptor is like NewUnaryInterceptor, for streaming RPCs.
+func NewStreamInterceptor(m Mapper, onReject RejectFunc) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		id, err := identityFromTLS(ss.Context(), m)
+		if err != nil {
+			if onReject != nil {
+				onReject(ss.Context(), info.FullMethod, nil, err)
+			}
+			return err
+		}
+		return handler(srv, &wrappedStream{ServerStream: ss, ctx: NewContext(ss.Context(), id)})
 	}
-	return handler(srv, &wrappedStream{ServerStream: ss, ctx: NewContext(ss.Context(), id)})
 }
 
 // wrappedStream overrides Context() to return the context with the identity.
@@ -0,0 +1,288 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrNoIdentity is returned by a Mapper when a certificate has no identity it
+// understands.
+var ErrNoIdentity = errors.New("no identity in certificate")
+
+// Mapper maps a verified client certificate to the caller's identity.
+type Mapper interface {
+	Identity(cert *x509.Certificate) (Identity, error)
+}
+
+// SubjectMapper is the default Mapper. The username is the certificate's CN,
+// the role its first OU, and the groups are the other OUs and the names of
+// "group:<name>" URI SANs.
+type SubjectMapper struct{}
+
+// Identity maps the certificate's subject to an identity.
+func (SubjectMapper) Identity(cert *x509.Certificate) (Identity, error) {
+	if len(cert.Subject.OrganizationalUnit) == 0 {
+		return Identity{}, fmt.Errorf("%w: certificate has no organizational unit", ErrNoIdentity)
+	}
+	// Any role is accepted here. What it may do is up to the Policy.
+	return Identity{
+		Username: cert.Subject.CommonName,
+		Role:     cert.Subject.OrganizationalUnit[0],
+		Groups:   certGroups(cert),
+	}, nil
+}
+
+// certGroups returns the groups of a certificate: every OU after the first,
+// which is the role, and the name of every URI SAN of the form
+// "group:<name>".
+func certGroups(cert *x509.Certificate) []string {
+	var groups []string
+	for _, ou := range cert.Subject.OrganizationalUnit[1:] {
+		if ou != "" && !slices.Contains(groups, ou) {
+			groups = append(groups, ou)
+		}
+	}
+	for _, uri := range cert.URIs {
+		if uri.Scheme == "group" && uri.Opaque != "" && !slices.Contains(groups, uri.Opaque) {
+			groups = append(groups, uri.Opaque)
+		}
+	}
+	return groups
+}
+
+// SPIFFEMapper maps the SPIFFE ID of a workload certificate, its one
+// "spiffe://" URI SAN, to an identity. The first rule that matches the ID is
+// used.
+type SPIFFEMapper struct {
+	rules []SPIFFERule
+}
+
+// NewSPIFFEMapper creates a SPIFFEMapper, and checks that its rules are
+// valid.
+func NewSPIFFEMapper(rules []SPIFFERule) (*SPIFFEMapper, error) {
+	rules = slices.Clone(rules)
+	for i := range rules {
+		if err := rules[i].check(); err != nil {
+			return nil, err
+		}
+	}
+	return &SPIFFEMapper{rules: rules}, nil
+}
+
+// SPIFFERule maps the SPIFFE IDs that match a pattern to identities. A
+// pattern is a SPIFFE ID whose trust domain and path segments are either
+// literal, "*" to match any one segment, or one of "{username}", "{role}" and
+// "{group}" to match any one segment and use it as that part of the identity.
+// "{group}" may be used more than once. For example, with the pattern
+//
+//	spiffe://corp/team/{group}/user/{username}
+//
+// "spiffe://corp/team/ci/user/alice" is the user alice, in the group ci.
+type SPIFFERule struct {
+	ID     string   `yaml:"id"`     // Pattern to match. Must capture {username}.
+	Role   string   `yaml:"role"`   // Role, if ID does not capture {role}.
+	Groups []string `yaml:"groups"` // Groups, in addition to those ID captures.
+
+	segments []string // ID split into the trust domain and path segments, by check.
+}
+
+const (
+	captureUsername = "{username}"
+	captureRole     = "{role}"
+	captureGroup    = "{group}"
+)
+
+// check checks that the rule is valid and splits its pattern into segments.
+func (r *SPIFFERule) check() error {
+	rest, ok := strings.CutPrefix(r.ID, "spiffe://")
+	if !ok {
+		return fmt.Errorf("spiffe id pattern %q does not start with spiffe://", r.ID)
+	}
+	r.segments = strings.Split(rest, "/")
+	for _, s := range r.segments {
+		if s == "" {
+			return fmt.Errorf("spiffe id pattern %q has an empty segment", r.ID)
+		}
+	}
+	if n := count(r.segments, captureUsername); n != 1 {
+		return fmt.Errorf("spiffe id pattern %q must capture %s once", r.ID, captureUsername)
+	}
+	switch n := count(r.segments, captureRole); {
+	case n > 1:
+		return fmt.Errorf("spiffe id pattern %q captures %s more than once", r.ID, captureRole)
+	case n == 0 && r.Role == "":
+		return fmt.Errorf("spiffe rule %q sets no role and does not capture %s", r.ID, captureRole)
+	case n == 1 && r.Role != "":
+		return fmt.Errorf("spiffe rule %q sets a role and also captures %s", r.ID, captureRole)
+	}
+	return nil
+}
+
+func count(segments []string, s string) int {
+	n := 0
+	for _, seg := range segments {
+		if seg == s {
+			n++
+		}
+	}
+	return n
+}
+
+// match returns the identity for a SPIFFE ID split into segments, or false
+// if it does not match the rule.
+func (r *SPIFFERule) match(segments []string) (Identity, bool) {
+	if len(segments) != len(r.segments) {
+		return Identity{}, false
+	}
+	id := Identity{Role: r.Role}
+	var groups []string
+	for i, pattern := range r.segments {
+		seg := segments[i]
+		switch pattern {
+		case "*":
+		case captureUsername:
+			id.Username = seg
+		case captureRole:
+			id.Role = seg
+		case captureGroup:
+			groups = append(groups, seg)
+		default:
+			if pattern != seg {
+				return Identity{}, false
+			}
+		}
+	}
+	for _, g := range slices.Concat(groups, r.Groups) {
+		if !slices.Contains(id.Groups, g) {
+			id.Groups = append(id.Groups, g)
+		}
+	}
+	return id, true
+}
+
+// Identity maps the certificate's SPIFFE ID to an identity.
+func (m *SPIFFEMapper) Identity(cert *x509.Certificate) (Identity, error) {
+	var spiffeID string
+	for _, uri := range cert.URIs {
+		if uri.Scheme != "spiffe" {
+			continue
+		}
+		// A SPIFFE certificate has exactly one SPIFFE ID.
+		if spiffeID != "" {
+			return Identity{}, errors.New("certificate has more than one spiffe id")
+		}
+		spiffeID = uri.String()
+	}
+	if spiffeID == "" {
+		return Identity{}, fmt.Errorf("%w: certificate has no spiffe id", ErrNoIdentity)
+	}
+
+	rest := strings.TrimPrefix(spiffeID, "spiffe://")
+	segments := strings.Split(rest, "/")
+	if slices.Contains(segments, "") || strings.ContainsAny(rest, "?#") {
+		return Identity{}, fmt.Errorf("invalid spiffe id %q", spiffeID)
+	}
+	for i := range m.rules {
+		if id, ok := m.rules[i].match(segments); ok {
+			return id, nil
+		}
+	}
+	return Identity{}, fmt.Errorf("%w: no rule matches spiffe id %q", ErrNoIdentity, spiffeID)
+}
+
+// Mappers tries each mapper in order, and uses the first that finds an
+// identity in the certificate. A mapper that fails with any error other than
+// ErrNoIdentity rejects the certificate, without trying the rest.
+type Mappers []Mapper
+
+// Identity returns the identity from the first mapper that finds one.
+func (ms Mappers) Identity(cert *x509.Certificate) (Identity, error) {
+	if len(ms) == 0 {
+		return Identity{}, ErrNoIdentity
+	}
+	var errs []error
+	for _, m := range ms {
+		id, err := m.Identity(cert)
+		if err == nil {
+			return id, nil
+		}
+		if !errors.Is(err, ErrNoIdentity) {
+			return Identity{}, err
+		}
+		errs = append(errs, err)
+	}
+	return Identity{}, errors.Join(errs...)
+}
+
+// mapperConfig is one mapper in an identity mapping file. Exactly one field
+// is set.
+type mapperConfig struct {
+	Subject *struct{}    `yaml:"subject"` // Use SubjectMapper.
+	SPIFFE  []SPIFFERule `yaml:"spiffe"`  // Use a SPIFFEMapper with these rules.
+}
+
+// LoadMapper reads an identity mapping file. See ParseMapper for the format.
+func LoadMapper(path string) (Mapper, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read identity mapping: %w", err)
+	}
+	m, err := ParseMapper(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid identity mapping %s: %w", path, err)
+	}
+	return m, nil
+}
+
+// ParseMapper parses a YAML or JSON identity mapping, which lists mappers to
+// try in order, like so:
+//
+//	mappers:
+//	  - spiffe:
+//	      - id: spiffe://corp/team/{group}/user/{username}
+//	        role: client
+//	      - id: spiffe://corp/admin/{username}
+//	        role: admin
+//	  - subject: {}
+//
+// Here, certificates with a SPIFFE ID that matches neither rule, or with no
+// SPIFFE ID, fall back to the CN and OU, see SubjectMapper.
+func ParseMapper(data []byte) (Mapper, error) {
+	var file struct {
+		Mappers []mapperConfig `yaml:"mappers"`
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	configs := file.Mappers
+	if len(configs) == 0 {
+		return nil, errors.New("identity mapping has no mappers")
+	}
+
+	var mappers Mappers
+	for i, c := range configs {
+		switch {
+		case c.Subject != nil && c.SPIFFE == nil:
+			mappers = append(mappers, SubjectMapper{})
+		case c.SPIFFE != nil && c.Subject == nil:
+			m, err := NewSPIFFEMapper(c.SPIFFE)
+			if err != nil {
+				return nil, fmt.Errorf("mapper %d: %w", i+1, err)
+			}
+			mappers = append(mappers, m)
+		default:
+			return nil, fmt.Errorf("mapper %d must set exactly one of subject and spiffe", i+1)
+		}
+	}
+	return mappers, nil
+}
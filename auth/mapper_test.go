@@ -0,0 +1,187 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net/url"
+	"slices"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/kkloberdanz/teleworker/auth"
+)
+
+// spiffeCert returns a certificate with the given URI SANs, and the subject
+// CN=carol, OU=auditor.
+func spiffeCert(t *testing.T, uris ...string) *x509.Certificate {
+	t.Helper()
+	cert := &x509.Certificate{
+		Subject: pkix.Name{CommonName: "carol", OrganizationalUnit: []string{"auditor"}},
+	}
+	for _, s := range uris {
+		u, err := url.Parse(s)
+		if err != nil {
+			t.Fatalf("failed to parse %s: %v", s, err)
+		}
+		cert.URIs = append(cert.URIs, u)
+	}
+	return cert
+}
+
+func TestParseMapper(t *testing.T) {
+	mapper, err := auth.ParseMapper([]byte(`
+mappers:
+  - spiffe:
+      - id: spiffe://corp/team/{group}/user/{username}
+        role: client
+        groups: [staff]
+      - id: spiffe://*/{role}/{group}/{username}
+  - subject: {}
+`))
+	if err != nil {
+		t.Fatalf("ParseMapper failed: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		cert *x509.Certificate
+		want auth.Identity
+	}{
+		{
+			"team user",
+			spiffeCert(t, "spiffe://corp/team/ci/user/alice"),
+			auth.Identity{Username: "alice", Role: "client", Groups: []string{"ci", "staff"}},
+		},
+		{
+			"captured role",
+			spiffeCert(t, "spiffe://other/operator/sre/bob"),
+			auth.Identity{Username: "bob", Role: "operator", Groups: []string{"sre"}},
+		},
+		{
+			"no rule matches, falls back to the subject",
+			spiffeCert(t, "spiffe://corp/team/ci/user/alice/job"),
+			auth.Identity{Username: "carol", Role: "auditor"},
+		},
+		{
+			"no spiffe id, falls back to the subject",
+			spiffeCert(t, "group:ml"),
+			auth.Identity{Username: "carol", Role: "auditor", Groups: []string{"ml"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := mapper.Identity(tt.cert)
+			if err != nil {
+				t.Fatalf("Identity failed: %v", err)
+			}
+			if id.Username != tt.want.Username || id.Role != tt.want.Role || !slices.Equal(id.Groups, tt.want.Groups) {
+				t.Fatalf("expected %+v, got %+v", tt.want, id)
+			}
+		})
+	}
+
+	// A certificate with two SPIFFE IDs is rejected, without falling back.
+	if _, err := mapper.Identity(spiffeCert(t, "spiffe://corp/team/ci/user/alice", "spiffe://corp/team/ci/user/bob")); err == nil || errors.Is(err, auth.ErrNoIdentity) {
+		t.Fatalf("expected an error other than ErrNoIdentity, got %v", err)
+	}
+}
+
+func TestSPIFFEMapperNoMatch(t *testing.T) {
+	mapper, err := auth.NewSPIFFEMapper([]auth.SPIFFERule{
+		{ID: "spiffe://corp/user/{username}", Role: "client"},
+	})
+	if err != nil {
+		t.Fatalf("NewSPIFFEMapper failed: %v", err)
+	}
+	for _, uri := range []string{
+		"spiffe://other/user/alice",
+		"spiffe://corp/user/alice/extra",
+		"spiffe://corp/user/",
+	} {
+		if _, err := mapper.Identity(spiffeCert(t, uri)); err == nil {
+			t.Errorf("expected %s not to map to an identity", uri)
+		}
+	}
+	if _, err := mapper.Identity(spiffeCert(t)); !errors.Is(err, auth.ErrNoIdentity) {
+		t.Errorf("expected ErrNoIdentity, got %v", err)
+	}
+}
+
+func TestParseMapperErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"empty", ""},
+		{"no mappers", "mappers: []"},
+		{"both", "mappers: [{subject: {}, spiffe: [{id: 'spiffe://corp/{username}', role: client}]}]"},
+		{"neither", "mappers: [{}]"},
+		{"not spiffe", "mappers: [{spiffe: [{id: 'https://corp/{username}', role: client}]}]"},
+		{"no username", "mappers: [{spiffe: [{id: 'spiffe://corp/user', role: client}]}]"},
+		{"no role", "mappers: [{spiffe: [{id: 'spiffe://corp/{username}'}]}]"},
+		{"two roles", "mappers: [{spiffe: [{id: 'spiffe://corp/{role}/{username}', role: client}]}]"},
+		{"empty segment", "mappers: [{spiffe: [{id: 'spiffe://corp//{username}', role: client}]}]"},
+		{"misspelled key", "mappers: [{spiffe: [{pattern: 'spiffe://corp/{username}', role: client}]}]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := auth.ParseMapper([]byte(tt.data)); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestNewUnaryInterceptor(t *testing.T) {
+	mapper, err := auth.NewSPIFFEMapper([]auth.SPIFFERule{
+		{ID: "spiffe://corp/team/{group}/user/{username}", Role: "client"},
+	})
+	if err != nil {
+		t.Fatalf("NewSPIFFEMapper failed: %v", err)
+	}
+	var rejected []string
+	interceptor := auth.NewUnaryInterceptor(mapper, func(ctx context.Context, method string, req any, err error) {
+		if _, idErr := auth.FromContext(ctx); idErr == nil {
+			t.Errorf("expected no identity in the context of a rejected RPC")
+		}
+		rejected = append(rejected, method)
+	})
+	peerCtx := func(cert *x509.Certificate) context.Context {
+		return peer.NewContext(t.Context(), &peer.Peer{AuthInfo: credentials.TLSInfo{
+			State: tls.ConnectionState{
+				VerifiedChains: [][]*x509.Certificate{{cert}},
+			},
+		}})
+	}
+
+	handler := func(ctx context.Context, req any) (any, error) {
+		return auth.FromContext(ctx)
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/teleworker.v1.TeleWorker/GetJobStatus"}
+	got, err := interceptor(peerCtx(spiffeCert(t, "spiffe://corp/team/ci/user/alice")), nil, info, handler)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if id := got.(auth.Identity); id.Username != "alice" || id.Role != "client" {
+		t.Fatalf("expected alice, a client, got %+v", id)
+	}
+
+	// Without the subject mapper to fall back to, a certificate without a
+	// SPIFFE ID is rejected.
+	_, err = interceptor(peerCtx(spiffeCert(t)), nil, info, handler)
+	if s, ok := status.FromError(err); !ok || s.Code() != codes.PermissionDenied {
+		t.Fatalf("expected PermissionDenied, got %v", err)
+	}
+	// Only the rejected RPC is passed to onReject.
+	if len(rejected) != 1 || rejected[0] != info.FullMethod {
+		t.Fatalf("expected the rejected RPC to be passed to onReject, got %v", rejected)
+	}
+}
@@ -0,0 +1,248 @@
+package auth
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	RoleAuditor  = "auditor"
+	RoleOperator = "operator"
+)
+
+// Verb is an action on jobs that a policy rule can allow. Each RPC is one of
+// these verbs, see rpcVerbs.
+type Verb string
+
+const (
+	VerbAll         Verb = "*"           // Every verb.
+	VerbStart       Verb = "start"       // Start a job.
+	VerbStatus      Verb = "status"      // Read a job's status and resource usage, and the caller's quota.
+	VerbLogs        Verb = "logs"        // Read a job's output.
+	VerbStop        Verb = "stop"        // Stop a job.
+	VerbSignal      Verb = "signal"      // Send a signal to a job.
+	VerbList        Verb = "list"        // List jobs.
+	VerbShare       Verb = "share"       // Share a job with other users and groups.
+	VerbAudit       Verb = "audit"       // Query the audit log. Only rules on any job allow it, since the log covers every job.
+	VerbImpersonate Verb = "impersonate" // Start jobs on behalf of other users, with StartJob's on_behalf_of. Only rules on any job allow it, since it acts on other users' jobs.
+)
+
+// knownVerbs are the verbs a rule may allow. signal and list have no RPC yet,
+// but may be granted ahead of time. impersonate is not an RPC of its own, and
+// is checked with AllowsVerb.
+var knownVerbs = []Verb{VerbAll, VerbStart, VerbStatus, VerbLogs, VerbStop, VerbSignal, VerbList, VerbShare, VerbAudit, VerbImpersonate}
+
+// rpcVerbs maps each RPC to its verb.
+var rpcVerbs = map[string]Verb{
+	"StartJob":      VerbStart,
+	"GetJobStatus":  VerbStatus,
+	"StreamOutput":  VerbLogs,
+	"StopJob":       VerbStop,
+	"GetJobStats":   VerbStatus,
+	"WatchJobStats": VerbStatus,
+	"ShareJob":      VerbShare,
+	"UnshareJob":    VerbShare,
+	"GetQuota":      VerbStatus,
+	"QueryAudit":    VerbAudit,
+}
+
+// Scope is the set of jobs a rule applies to.
+type Scope string
+
+const (
+	ScopeOwn Scope = "own" // Only jobs the caller started.
+	ScopeAny Scope = "any" // Every job.
+)
+
+// Rule allows verbs or RPCs on a scope of jobs.
+type Rule struct {
+	Verbs []Verb   `yaml:"verbs"` // Verbs the rule allows.
+	RPCs  []string `yaml:"rpcs"`  // RPCs the rule allows, by method name, e.g. "GetJobStats".
+	Jobs  Scope    `yaml:"jobs"`  // Jobs the rule applies to. Defaults to ScopeOwn.
+}
+
+// Policy decides which RPCs each caller may make, and on which jobs. Rules
+// are granted to roles, taken from the certificate OU, and to usernames, and
+// a caller has the rules of both. A caller whose role and username have no
+// rules may do nothing.
+//
+// A policy file is YAML, or JSON, which is also valid YAML, like so:
+//
+//	roles:
+//	  client:
+//	    - verbs: [start, status, logs, stop]
+//	      jobs: own
+//	  auditor:
+//	    - verbs: [status, logs, list]
+//	      jobs: any
+//	users:
+//	  alice:
+//	    - rpcs: [GetJobStats]
+//	      jobs: any
+//
+// A policy may also restrict which commands each caller may run, see
+// CommandPolicy, limit the jobs of each user, see QuotaPolicy, and limit how
+// often each user may make RPCs, see RateLimitPolicy.
+type Policy struct {
+	Roles      map[string][]Rule `yaml:"roles"`       // Rules for each role.
+	Users      map[string][]Rule `yaml:"users"`       // Rules for each username, in addition to those of their role.
+	Commands   *CommandPolicy    `yaml:"commands"`    // Commands each caller may run. If nil, any command is allowed.
+	Quotas     *QuotaPolicy      `yaml:"quotas"`      // Jobs and resources each user may have. If nil, users are not limited.
+	RateLimits *RateLimitPolicy  `yaml:"rate_limits"` // How often each user may make RPCs. If nil, users are not limited.
+}
+
+// DefaultPolicy is used when no policy file is given. Admins may do anything
+// to any job, and clients anything to their own jobs. Auditors may read any
+// job, and operators may also stop and signal any job, but neither may start
+// jobs.
+func DefaultPolicy() *Policy {
+	return &Policy{
+		Roles: map[string][]Rule{
+			RoleAdmin: {
+				{Verbs: []Verb{VerbAll}, Jobs: ScopeAny},
+			},
+			RoleClient: {
+				{Verbs: []Verb{VerbAll}, Jobs: ScopeOwn},
+			},
+			RoleAuditor: {
+				{Verbs: []Verb{VerbStatus, VerbLogs, VerbList}, Jobs: ScopeAny},
+			},
+			RoleOperator: {
+				{Verbs: []Verb{VerbStatus, VerbLogs, VerbList, VerbStop, VerbSignal}, Jobs: ScopeAny},
+			},
+		},
+	}
+}
+
+// LoadPolicy reads a policy file. See Policy for the format.
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy: %w", err)
+	}
+	p, err := ParsePolicy(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy %s: %w", path, err)
+	}
+	return p, nil
+}
+
+// ParsePolicy parses a YAML or JSON policy, and checks that its verbs, RPCs,
+// scopes, command rules, quotas and rate limits are valid.
+func ParsePolicy(data []byte) (*Policy, error) {
+	var p Policy
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true) // Catch misspelled keys, which would otherwise allow nothing.
+	if err := dec.Decode(&p); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("policy is empty")
+		}
+		return nil, err
+	}
+	for _, rules := range []map[string][]Rule{p.Roles, p.Users} {
+		for name, rules := range rules {
+			for i := range rules {
+				if err := rules[i].check(); err != nil {
+					return nil, fmt.Errorf("rule %d of %s: %w", i+1, name, err)
+				}
+			}
+		}
+	}
+	if p.Commands != nil {
+		for _, rules := range []map[string][]CommandRule{p.Commands.Roles, p.Commands.Users} {
+			for name, rules := range rules {
+				for i := range rules {
+					if err := rules[i].check(); err != nil {
+						return nil, fmt.Errorf("command rule %d of %s: %w", i+1, name, err)
+					}
+				}
+			}
+		}
+	}
+	if p.Quotas != nil {
+		for _, quotas := range []map[string]Quota{p.Quotas.Roles, p.Quotas.Users} {
+			for name, q := range quotas {
+				if err := q.check(); err != nil {
+					return nil, fmt.Errorf("quota of %s: %w", name, err)
+				}
+			}
+		}
+	}
+	if p.RateLimits != nil {
+		for _, limits := range []map[string]RateLimits{p.RateLimits.Roles, p.RateLimits.Users} {
+			for name, l := range limits {
+				if err := l.check(); err != nil {
+					return nil, fmt.Errorf("rate limits of %s: %w", name, err)
+				}
+			}
+		}
+	}
+	return &p, nil
+}
+
+// check fills in the rule's defaults and checks that it is valid.
+func (r *Rule) check() error {
+	if len(r.Verbs) == 0 && len(r.RPCs) == 0 {
+		return fmt.Errorf("rule allows no verbs or rpcs")
+	}
+	for _, verb := range r.Verbs {
+		if !slices.Contains(knownVerbs, verb) {
+			return fmt.Errorf("unknown verb %q", verb)
+		}
+	}
+	for _, rpc := range r.RPCs {
+		if _, ok := rpcVerbs[rpc]; !ok {
+			return fmt.Errorf("unknown rpc %q", rpc)
+		}
+	}
+	switch r.Jobs {
+	case "":
+		r.Jobs = ScopeOwn
+	case ScopeOwn, ScopeAny:
+	default:
+		return fmt.Errorf("unknown jobs scope %q (expected %q or %q)", r.Jobs, ScopeOwn, ScopeAny)
+	}
+	return nil
+}
+
+// Allows returns the jobs on which the caller may make an RPC, given by its
+// full method name, e.g. "/teleworker.v1.TeleWorker/StartJob", or by its
+// method name. If more than one rule allows it, the widest scope is returned.
+// Returns false if no rule allows it.
+func (p *Policy) Allows(id Identity, method string) (Scope, bool) {
+	rpc := path.Base(method)
+	verb, ok := rpcVerbs[rpc]
+	if !ok {
+		return "", false
+	}
+	return p.allows(id, verb, rpc)
+}
+
+// AllowsVerb is like Allows, for a verb that is not an RPC of its own, such as
+// VerbImpersonate.
+func (p *Policy) AllowsVerb(id Identity, verb Verb) (Scope, bool) {
+	return p.allows(id, verb, "")
+}
+
+// allows returns the widest scope of the caller's rules that allow the verb,
+// or the RPC if it is not empty.
+func (p *Policy) allows(id Identity, verb Verb, rpc string) (Scope, bool) {
+	var scope Scope
+	for _, rule := range slices.Concat(p.Roles[id.Role], p.Users[id.Username]) {
+		if !slices.Contains(rule.Verbs, VerbAll) && !slices.Contains(rule.Verbs, verb) && (rpc == "" || !slices.Contains(rule.RPCs, rpc)) {
+			continue
+		}
+		if rule.Jobs == ScopeAny {
+			return ScopeAny, true
+		}
+		scope = ScopeOwn
+	}
+	return scope, scope != ""
+}
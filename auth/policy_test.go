@@ -0,0 +1,146 @@
+package auth_test
+
+import (
+	"testing"
+
+	"github.com/kkloberdanz/teleworker/auth"
+	pb "github.com/kkloberdanz/teleworker/proto/teleworker/v1"
+)
+
+func TestDefaultPolicy(t *testing.T) {
+	policy := auth.DefaultPolicy()
+
+	tests := []struct {
+		role   string
+		method string
+		want   auth.Scope
+		ok     bool
+	}{
+		{auth.RoleAdmin, pb.TeleWorker_StartJob_FullMethodName, auth.ScopeAny, true},
+		{auth.RoleAdmin, pb.TeleWorker_StopJob_FullMethodName, auth.ScopeAny, true},
+		{auth.RoleClient, pb.TeleWorker_StartJob_FullMethodName, auth.ScopeOwn, true},
+		{auth.RoleClient, pb.TeleWorker_StreamOutput_FullMethodName, auth.ScopeOwn, true},
+		{auth.RoleAuditor, pb.TeleWorker_GetJobStatus_FullMethodName, auth.ScopeAny, true},
+		{auth.RoleAuditor, pb.TeleWorker_StreamOutput_FullMethodName, auth.ScopeAny, true},
+		{auth.RoleAuditor, pb.TeleWorker_StartJob_FullMethodName, "", false},
+		{auth.RoleAuditor, pb.TeleWorker_StopJob_FullMethodName, "", false},
+		{auth.RoleOperator, pb.TeleWorker_StopJob_FullMethodName, auth.ScopeAny, true},
+		{auth.RoleOperator, pb.TeleWorker_StartJob_FullMethodName, "", false},
+		// Roles the policy does not know may do nothing.
+		{"superuser", pb.TeleWorker_GetJobStatus_FullMethodName, "", false},
+		{"", pb.TeleWorker_GetJobStatus_FullMethodName, "", false},
+		// Neither may RPCs the policy does not know.
+		{auth.RoleAdmin, "/teleworker.v1.TeleWorker/Unknown", "", false},
+	}
+	for _, tt := range tests {
+		scope, ok := policy.Allows(auth.Identity{Username: "test", Role: tt.role}, tt.method)
+		if scope != tt.want || ok != tt.ok {
+			t.Errorf("Allows(%q, %s) = %q, %v, want %q, %v", tt.role, tt.method, scope, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestAllowsVerb(t *testing.T) {
+	policy, err := auth.ParsePolicy([]byte(`
+roles:
+  admin:
+    - verbs: ["*"]
+      jobs: any
+  client:
+    - verbs: ["*"]
+  operator:
+    - verbs: [impersonate]
+      jobs: any
+  auditor:
+    - rpcs: [StartJob]
+      jobs: any
+`))
+	if err != nil {
+		t.Fatalf("ParsePolicy failed: %v", err)
+	}
+
+	tests := []struct {
+		role string
+		want auth.Scope
+		ok   bool
+	}{
+		{auth.RoleAdmin, auth.ScopeAny, true},
+		{auth.RoleClient, auth.ScopeOwn, true},
+		{auth.RoleOperator, auth.ScopeAny, true},
+		// Rules that allow RPCs do not allow verbs that are not RPCs.
+		{auth.RoleAuditor, "", false},
+	}
+	for _, tt := range tests {
+		scope, ok := policy.AllowsVerb(auth.Identity{Username: "test", Role: tt.role}, auth.VerbImpersonate)
+		if scope != tt.want || ok != tt.ok {
+			t.Errorf("AllowsVerb(%q, impersonate) = %q, %v, want %q, %v", tt.role, scope, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"yaml", `
+roles:
+  client:
+    - verbs: [start, status]
+users:
+  alice:
+    - rpcs: [GetJobStats]
+      jobs: any
+`},
+		{"json", `{
+  "roles": {"client": [{"verbs": ["start", "status"]}]},
+  "users": {"alice": [{"rpcs": ["GetJobStats"], "jobs": "any"}]}
+}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := auth.ParsePolicy([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("ParsePolicy failed: %v", err)
+			}
+
+			alice := auth.Identity{Username: "alice", Role: auth.RoleClient}
+			bob := auth.Identity{Username: "bob", Role: auth.RoleClient}
+			// Rules default to the caller's own jobs.
+			if scope, ok := policy.Allows(bob, pb.TeleWorker_GetJobStatus_FullMethodName); scope != auth.ScopeOwn || !ok {
+				t.Errorf("expected bob to get the status of their own jobs, got %q, %v", scope, ok)
+			}
+			if _, ok := policy.Allows(bob, pb.TeleWorker_StopJob_FullMethodName); ok {
+				t.Error("expected bob not to be allowed to stop jobs")
+			}
+			// User rules add to role rules.
+			if scope, ok := policy.Allows(alice, pb.TeleWorker_GetJobStats_FullMethodName); scope != auth.ScopeAny || !ok {
+				t.Errorf("expected alice to get the stats of any job, got %q, %v", scope, ok)
+			}
+			if scope, ok := policy.Allows(bob, pb.TeleWorker_GetJobStats_FullMethodName); scope != auth.ScopeOwn || !ok {
+				t.Errorf("expected bob to get the stats of their own jobs, got %q, %v", scope, ok)
+			}
+		})
+	}
+}
+
+func TestParsePolicyErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"empty", ""},
+		{"unknown verb", "roles: {client: [{verbs: [delete]}]}"},
+		{"unknown rpc", "roles: {client: [{rpcs: [DeleteJob]}]}"},
+		{"unknown scope", "roles: {client: [{verbs: [status], jobs: some]}]}"},
+		{"no verbs", "roles: {client: [{jobs: any}]}"},
+		{"misspelled key", "role: {client: [{verbs: [status]}]}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := auth.ParsePolicy([]byte(tt.data)); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
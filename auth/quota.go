@@ -0,0 +1,56 @@
+package auth
+
+import "fmt"
+
+// QuotaPolicy limits the jobs and resources of each user. Quotas are given to
+// roles and to usernames. A user's own quota replaces that of their role, and
+// a user whose role and username have no quota is not limited.
+//
+// In a policy file, it is the "quotas" key:
+//
+//	quotas:
+//	  roles:
+//	    client:
+//	      jobs: 4
+//	      cpus: 2
+//	      memory: 1073741824
+//	      retained_jobs: 100
+//	      log_bytes: 104857600
+//	  users:
+//	    alice:
+//	      jobs: 16
+//	      cpus: 8
+type QuotaPolicy struct {
+	Roles map[string]Quota `yaml:"roles"` // Quota of each role.
+	Users map[string]Quota `yaml:"users"` // Quota of each username, instead of that of their role.
+}
+
+// Quota limits the jobs of one user. Each limit applies to the user's jobs
+// together, and 0 does not limit.
+type Quota struct {
+	Jobs         int     `yaml:"jobs"`          // Jobs that are queued or running.
+	CPUs         float64 `yaml:"cpus"`          // CPUs reserved by queued and running jobs, from their CPU limit or exclusive CPUs.
+	Memory       int64   `yaml:"memory"`        // Memory in bytes reserved by queued and running jobs, from their memory limit.
+	RetainedJobs int     `yaml:"retained_jobs"` // Jobs the server keeps, including finished jobs.
+	LogBytes     int64   `yaml:"log_bytes"`     // Output in bytes the server keeps, over every retained job.
+}
+
+// check checks that the quota is valid.
+func (q Quota) check() error {
+	if q.Jobs < 0 || q.CPUs < 0 || q.Memory < 0 || q.RetainedJobs < 0 || q.LogBytes < 0 {
+		return fmt.Errorf("quota limits must not be negative")
+	}
+	return nil
+}
+
+// Quota returns the caller's quota. If the policy has no quotas, or none for
+// the caller, the quota is zero, which does not limit anything.
+func (p *Policy) Quota(id Identity) Quota {
+	if p.Quotas == nil {
+		return Quota{}
+	}
+	if q, ok := p.Quotas.Users[id.Username]; ok {
+		return q
+	}
+	return p.Quotas.Roles[id.Role]
+}
@@ -0,0 +1,66 @@
+package auth_test
+
+import (
+	"testing"
+
+	"github.com/kkloberdanz/teleworker/auth"
+)
+
+func TestPolicyQuota(t *testing.T) {
+	policy, err := auth.ParsePolicy([]byte(`
+roles:
+  client:
+    - verbs: ["*"]
+quotas:
+  roles:
+    client:
+      jobs: 4
+      cpus: 2
+      memory: 1073741824
+  users:
+    alice:
+      jobs: 16
+`))
+	if err != nil {
+		t.Fatalf("ParsePolicy failed: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		id   auth.Identity
+		want auth.Quota
+	}{
+		{"role quota", auth.Identity{Username: "bob", Role: auth.RoleClient}, auth.Quota{Jobs: 4, CPUs: 2, Memory: 1 << 30}},
+		// A user's quota replaces their role's, rather than adding to it.
+		{"user quota", auth.Identity{Username: "alice", Role: auth.RoleClient}, auth.Quota{Jobs: 16}},
+		{"no quota", auth.Identity{Username: "carol", Role: auth.RoleAuditor}, auth.Quota{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.Quota(tt.id); got != tt.want {
+				t.Fatalf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+
+	if got := auth.DefaultPolicy().Quota(auth.Identity{Username: "bob", Role: auth.RoleClient}); got != (auth.Quota{}) {
+		t.Fatalf("expected the default policy to have no quotas, got %+v", got)
+	}
+}
+
+func TestParsePolicyQuotaErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"negative", "quotas: {roles: {client: {jobs: -1}}}"},
+		{"misspelled key", "quotas: {roles: {client: {max_jobs: 1}}}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := auth.ParsePolicy([]byte(tt.data)); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package auth
+
+import "fmt"
+
+// RateLimitPolicy limits how often each user may make RPCs. Like quotas, rate
+// limits are given to roles and to usernames, a user's own limits replace
+// those of their role, and a user whose role and username have no limits is
+// not limited.
+//
+// In a policy file, it is the "rate_limits" key:
+//
+//	rate_limits:
+//	  roles:
+//	    client:
+//	      start: {rate: 1, burst: 10}
+//	      status: {rate: 20, burst: 50}
+//	      stream: {rate: 2, burst: 5}
+//	      streams: 8
+//	  users:
+//	    ci:
+//	      status: {rate: 100}
+type RateLimitPolicy struct {
+	Roles map[string]RateLimits `yaml:"roles"` // Limits of each role.
+	Users map[string]RateLimits `yaml:"users"` // Limits of each username, instead of those of their role.
+}
+
+// RateLimits limits the RPCs of one user. Each class of RPC has its own token
+// bucket, see RPCClass.
+type RateLimits struct {
+	Start   Rate `yaml:"start"`   // Rate of StartJob.
+	Status  Rate `yaml:"status"`  // Rate of the other unary RPCs, such as GetJobStatus.
+	Stream  Rate `yaml:"stream"`  // Rate at which streams, such as StreamOutput, are opened.
+	Streams int  `yaml:"streams"` // StreamOutput subscriptions the user may have open at once. If 0, not limited.
+}
+
+// Rate is a token bucket, which holds Burst tokens and is refilled with Rate
+// tokens a second. Each RPC takes a token.
+type Rate struct {
+	Rate  float64 `yaml:"rate"`  // Tokens added each second. If 0, not limited.
+	Burst int     `yaml:"burst"` // Tokens the bucket holds. If 0, the rate rounded up, and at least 1.
+}
+
+// RPCClass is the class of RPCs that a rate limit applies to.
+type RPCClass string
+
+const (
+	ClassStart  RPCClass = "start"  // StartJob.
+	ClassStatus RPCClass = "status" // Every other unary RPC.
+	ClassStream RPCClass = "stream" // Streaming RPCs.
+)
+
+// rpcClasses maps the RPCs that are not in ClassStatus to their class.
+var rpcClasses = map[string]RPCClass{
+	"StartJob":      ClassStart,
+	"StreamOutput":  ClassStream,
+	"WatchJobStats": ClassStream,
+}
+
+// ClassOf returns the class of an RPC, given by its method name, e.g.
+// "StartJob".
+func ClassOf(rpc string) RPCClass {
+	if c, ok := rpcClasses[rpc]; ok {
+		return c
+	}
+	return ClassStatus
+}
+
+// Rate returns the limit of a class of RPCs.
+func (l RateLimits) Rate(c RPCClass) Rate {
+	switch c {
+	case ClassStart:
+		return l.Start
+	case ClassStream:
+		return l.Stream
+	}
+	return l.Status
+}
+
+// check checks that the limits are valid.
+func (l RateLimits) check() error {
+	for _, r := range []Rate{l.Start, l.Status, l.Stream} {
+		if r.Rate < 0 || r.Burst < 0 {
+			return fmt.Errorf("rate limits must not be negative")
+		}
+	}
+	if l.Streams < 0 {
+		return fmt.Errorf("stream limit must not be negative")
+	}
+	return nil
+}
+
+// RateLimit returns the caller's rate limits. If the policy has no rate
+// limits, or none for the caller, the limits are zero, which do not limit
+// anything.
+func (p *Policy) RateLimit(id Identity) RateLimits {
+	if p.RateLimits == nil {
+		return RateLimits{}
+	}
+	if l, ok := p.RateLimits.Users[id.Username]; ok {
+		return l
+	}
+	return p.RateLimits.Roles[id.Role]
+}
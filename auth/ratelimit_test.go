@@ -0,0 +1,92 @@
+package auth_test
+
+import (
+	"testing"
+
+	"github.com/kkloberdanz/teleworker/auth"
+)
+
+func TestPolicyRateLimit(t *testing.T) {
+	policy, err := auth.ParsePolicy([]byte(`
+roles:
+  client:
+    - verbs: ["*"]
+rate_limits:
+  roles:
+    client:
+      start: {rate: 1, burst: 10}
+      status: {rate: 20}
+      streams: 4
+  users:
+    ci:
+      status: {rate: 100}
+`))
+	if err != nil {
+		t.Fatalf("ParsePolicy failed: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		id   auth.Identity
+		want auth.RateLimits
+	}{
+		{"role limits", auth.Identity{Username: "bob", Role: auth.RoleClient}, auth.RateLimits{
+			Start:   auth.Rate{Rate: 1, Burst: 10},
+			Status:  auth.Rate{Rate: 20},
+			Streams: 4,
+		}},
+		// A user's limits replace their role's, rather than adding to them.
+		{"user limits", auth.Identity{Username: "ci", Role: auth.RoleClient}, auth.RateLimits{Status: auth.Rate{Rate: 100}}},
+		{"no limits", auth.Identity{Username: "carol", Role: auth.RoleAuditor}, auth.RateLimits{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.RateLimit(tt.id); got != tt.want {
+				t.Fatalf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+
+	if got := auth.DefaultPolicy().RateLimit(auth.Identity{Username: "bob", Role: auth.RoleClient}); got != (auth.RateLimits{}) {
+		t.Fatalf("expected the default policy to have no rate limits, got %+v", got)
+	}
+}
+
+func TestParsePolicyRateLimitErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"negative rate", "rate_limits: {roles: {client: {status: {rate: -1}}}}"},
+		{"negative burst", "rate_limits: {roles: {client: {start: {rate: 1, burst: -1}}}}"},
+		{"negative streams", "rate_limits: {users: {alice: {streams: -1}}}"},
+		{"misspelled key", "rate_limits: {roles: {client: {stauts: {rate: 1}}}}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := auth.ParsePolicy([]byte(tt.data)); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestClassOf(t *testing.T) {
+	tests := []struct {
+		rpc  string
+		want auth.RPCClass
+	}{
+		{"StartJob", auth.ClassStart},
+		{"GetJobStatus", auth.ClassStatus},
+		{"QueryAudit", auth.ClassStatus},
+		{"StreamOutput", auth.ClassStream},
+		{"WatchJobStats", auth.ClassStream},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rpc, func(t *testing.T) {
+			if got := auth.ClassOf(tt.rpc); got != tt.want {
+				t.Fatalf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// ServerTLS is a server TLS config whose key pair and client CA pool are
+// reread from disk by Reload, so that certificates can be rotated without
+// restarting the server. Connections that are already open keep the config
+// they were made with.
+type ServerTLS struct {
+	caPath   string
+	certPath string
+	keyPath  string
+	crl      *RevocationList
+
+	mu      sync.RWMutex
+	conf    *tls.Config // Config for new connections.
+	tried   [][]byte    // Contents of the files the last Reload read, whether or not they were valid.
+	readErr string      // Error ReloadIfChanged last failed to read the files with, so that it is only returned once.
+	expires time.Time   // When the current server certificate expires.
+}
+
+// LoadServerTLS reads the CA certificate, and the server's certificate and
+// key, from disk. If crl is not nil, client certificates it revokes are
+// rejected.
+func LoadServerTLS(caPath, certPath, keyPath string, crl *RevocationList) (*ServerTLS, error) {
+	s := &ServerTLS{caPath: caPath, certPath: certPath, keyPath: keyPath, crl: crl}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload rereads the CA certificate and the server's certificate and key. If
+// any of them can not be read or is invalid, the ones loaded before are kept,
+// and an error is returned.
+func (s *ServerTLS) Reload() error {
+	files, err := s.read()
+	if err != nil {
+		return err
+	}
+	return s.load(files)
+}
+
+// ReloadIfChanged reloads the files if they have changed since they were last
+// read. It returns true if it tried to reload them. Files that failed to load,
+// or to be read, are not tried again until they change.
+func (s *ServerTLS) ReloadIfChanged() (bool, error) {
+	files, err := s.read()
+	s.mu.Lock()
+	if err != nil {
+		repeated := err.Error() == s.readErr
+		s.readErr = err.Error()
+		s.mu.Unlock()
+		return !repeated, err
+	}
+	s.readErr = ""
+	changed := false
+	for i := range files {
+		if !bytes.Equal(files[i], s.tried[i]) {
+			changed = true
+		}
+	}
+	s.mu.Unlock()
+	if !changed {
+		return false, nil
+	}
+	return true, s.load(files)
+}
+
+// read returns the contents of the CA certificate, certificate and key.
+func (s *ServerTLS) read() ([][]byte, error) {
+	var files [][]byte
+	for _, path := range []string{s.caPath, s.certPath, s.keyPath} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		files = append(files, data)
+	}
+	return files, nil
+}
+
+func (s *ServerTLS) load(files [][]byte) error {
+	s.mu.Lock()
+	s.tried = files
+	s.mu.Unlock()
+
+	caPEM, certPEM, keyPEM := files[0], files[1], files[2]
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return fmt.Errorf("failed to load server certificate %s: %w", s.certPath, err)
+	}
+	if time.Now().After(cert.Leaf.NotAfter) {
+		return fmt.Errorf("server certificate %s expired at %s", s.certPath, cert.Leaf.NotAfter.Format(time.RFC3339))
+	}
+	conf, err := ServerTLSConfig(caPEM, cert, s.crl)
+	if err != nil {
+		return fmt.Errorf("invalid CA certificate %s: %w", s.caPath, err)
+	}
+	// The config is returned from GetConfigForClient, which replaces the one
+	// gRPC set up, so it must offer HTTP/2 itself.
+	conf.NextProtos = []string{"h2"}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conf = conf
+	s.expires = cert.Leaf.NotAfter
+	return nil
+}
+
+// Config returns a TLS config for the server, which makes each new connection
+// with the key pair and CA pool loaded last. It is meant for
+// credentials.NewTLS.
+func (s *ServerTLS) Config() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS13,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			s.mu.RLock()
+			defer s.mu.RUnlock()
+			return s.conf, nil
+		},
+	}
+}
+
+// Expires returns when the server certificate loaded last expires.
+func (s *ServerTLS) Expires() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.expires
+}
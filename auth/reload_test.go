@@ -0,0 +1,218 @@
+package auth_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kkloberdanz/teleworker/auth"
+	"github.com/kkloberdanz/teleworker/testutil"
+)
+
+// handshake runs a TLS handshake between a server and a client over a
+// loopback connection, and returns the certificate the server presented and
+// the server's error. The connection is buffered, unlike a pipe, so that the
+// server can send session tickets while the client writes.
+func handshake(t *testing.T, serverConf, clientConf *tls.Config) (*x509.Certificate, error) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+	clientConn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer clientConn.Close()
+	serverConn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("failed to accept: %v", err)
+	}
+	defer serverConn.Close()
+
+	client := tls.Client(clientConn, clientConf)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		client.Handshake()
+		// TLS 1.3 clients finish their handshake before the server checks
+		// their certificate, so read to see the server's alert.
+		client.Read(make([]byte, 1))
+	}()
+
+	err = tls.Server(serverConn, serverConf).Handshake()
+	serverConn.Close()
+	<-done
+	var cert *x509.Certificate
+	if certs := client.ConnectionState().PeerCertificates; len(certs) > 0 {
+		cert = certs[0]
+	}
+	return cert, err
+}
+
+// newCA creates a self-signed CA.
+func newCA(t *testing.T) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	return issue(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "teleworker-ca-2"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, nil)
+}
+
+// issue creates a certificate from template, signed by parent, or
+// self-signed if parent is nil.
+func issue(t *testing.T, template, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Minute)
+	template.NotAfter = time.Now().Add(time.Hour)
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+	return cert, key
+}
+
+func certPEM(cert *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+}
+
+func keyPEM(t *testing.T, key *ecdsa.PrivateKey) []byte {
+	t.Helper()
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+func copyCert(t *testing.T, name, dst string) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(testutil.CertsDir(t), name))
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", name, err)
+	}
+	writeFile(t, dst, data)
+}
+
+func TestServerTLSReload(t *testing.T) {
+	dir := t.TempDir()
+	caPath := filepath.Join(dir, "ca.crt")
+	certPath := filepath.Join(dir, "server.crt")
+	keyPath := filepath.Join(dir, "server.key")
+	copyCert(t, "ca.crt", caPath)
+	copyCert(t, "server.crt", certPath)
+	copyCert(t, "server.key", keyPath)
+
+	serverTLS, err := auth.LoadServerTLS(caPath, certPath, keyPath, nil)
+	if err != nil {
+		t.Fatalf("LoadServerTLS failed: %v", err)
+	}
+	conf := serverTLS.Config()
+	oldCert := parseCert(t, "server")
+
+	cert, err := handshake(t, conf, testutil.ClientTLSConfig(t, "alice"))
+	if err != nil {
+		t.Fatalf("Handshake failed: %v", err)
+	}
+	if !cert.Equal(oldCert) {
+		t.Fatalf("expected the server certificate, got %s", cert.Subject)
+	}
+	if tried, err := serverTLS.ReloadIfChanged(); tried || err != nil {
+		t.Fatalf("expected no reload, got %v, %v", tried, err)
+	}
+
+	// A bad certificate is not loaded, or tried again until it changes.
+	writeFile(t, certPath, []byte("not a certificate"))
+	if tried, err := serverTLS.ReloadIfChanged(); !tried || err == nil {
+		t.Fatalf("expected a failed reload, got %v, %v", tried, err)
+	}
+	if tried, err := serverTLS.ReloadIfChanged(); tried || err != nil {
+		t.Fatalf("expected no reload, got %v, %v", tried, err)
+	}
+	if cert, err := handshake(t, conf, testutil.ClientTLSConfig(t, "alice")); err != nil || !cert.Equal(oldCert) {
+		t.Fatalf("expected the old certificate to be kept, got %v", err)
+	}
+
+	// Rotate to a new CA, with a new server and client certificate.
+	ca, caKey := newCA(t)
+	server, serverKey := issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "teleworker"},
+		DNSNames:    []string{"teleworker"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca, caKey)
+	client, clientKey := issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "alice", OrganizationalUnit: []string{"client"}},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, caKey)
+	writeFile(t, caPath, certPEM(ca))
+	writeFile(t, certPath, certPEM(server))
+	writeFile(t, keyPath, keyPEM(t, serverKey))
+	if err := serverTLS.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if !serverTLS.Expires().Equal(server.NotAfter) {
+		t.Fatalf("expected the certificate to expire at %v, got %v", server.NotAfter, serverTLS.Expires())
+	}
+
+	clientCert, err := tls.X509KeyPair(certPEM(client), keyPEM(t, clientKey))
+	if err != nil {
+		t.Fatalf("failed to load client certificate: %v", err)
+	}
+	clientConf, err := auth.ClientTLSConfig(certPEM(ca), clientCert, "teleworker")
+	if err != nil {
+		t.Fatalf("ClientTLSConfig failed: %v", err)
+	}
+	cert, err = handshake(t, conf, clientConf)
+	if err != nil {
+		t.Fatalf("Handshake failed: %v", err)
+	}
+	if !cert.Equal(server) {
+		t.Fatalf("expected the new server certificate, got %s", cert.Subject)
+	}
+	// Clients of the old CA are no longer trusted.
+	if _, err := handshake(t, conf, testutil.ClientTLSConfig(t, "alice")); err == nil {
+		t.Fatal("expected the old client certificate to be rejected")
+	}
+
+	// A key that does not match the certificate is not loaded either.
+	_, otherKey := newCA(t)
+	writeFile(t, keyPath, keyPEM(t, otherKey))
+	if err := serverTLS.Reload(); err == nil {
+		t.Fatal("expected Reload to fail")
+	}
+	if cert, err := handshake(t, conf, clientConf); err != nil || !cert.Equal(server) {
+		t.Fatalf("expected the new certificate to be kept, got %v", err)
+	}
+}
+
+func TestLoadServerTLSMissingFile(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := auth.LoadServerTLS(filepath.Join(dir, "ca.crt"), filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"), nil); err == nil {
+		t.Fatal("expected an error")
+	}
+}
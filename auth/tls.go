@@ -7,18 +7,23 @@ import (
 )
 
 // ServerTLSConfig builds a TLS config for the server that requires and verifies
-// client certificates signed by the given CA.
-func ServerTLSConfig(caCertPEM []byte, cert tls.Certificate) (*tls.Config, error) {
+// client certificates signed by the given CA. If crl is not nil, client
+// certificates it revokes are rejected.
+func ServerTLSConfig(caCertPEM []byte, cert tls.Certificate, crl *RevocationList) (*tls.Config, error) {
 	caPool := x509.NewCertPool()
 	if !caPool.AppendCertsFromPEM(caCertPEM) {
 		return nil, fmt.Errorf("failed to parse CA certificate")
 	}
-	return &tls.Config{
+	conf := &tls.Config{
 		Certificates: []tls.Certificate{cert},
 		ClientCAs:    caPool,
 		ClientAuth:   tls.RequireAndVerifyClientCert,
 		MinVersion:   tls.VersionTLS13,
-	}, nil
+	}
+	if crl != nil {
+		conf.VerifyConnection = crl.verifyConnection
+	}
+	return conf, nil
 }
 
 // ClientTLSConfig builds a TLS config for a client that verifies the server
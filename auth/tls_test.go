@@ -9,7 +9,7 @@ import (
 )
 
 func TestServerTLSConfig(t *testing.T) {
-	conf, err := auth.ServerTLSConfig(testutil.CACertPEM(t), testutil.LoadCert(t, "server"))
+	conf, err := auth.ServerTLSConfig(testutil.CACertPEM(t), testutil.LoadCert(t, "server"), nil)
 	if err != nil {
 		t.Fatalf("failed to load server tls config: %v", err)
 	}
@@ -38,7 +38,7 @@ func TestClientTLSConfig(t *testing.T) {
 
 func TestServerTLSConfigInvalidCA(t *testing.T) {
 	cert := tls.Certificate{}
-	_, err := auth.ServerTLSConfig([]byte("not-a-cert"), cert)
+	_, err := auth.ServerTLSConfig([]byte("not-a-cert"), cert, nil)
 	if err == nil {
 		t.Fatal("expected error for invalid CA PEM, got nil")
 	}
@@ -7,12 +7,16 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"time"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 
+	"github.com/kkloberdanz/teleworker/audit"
+	"github.com/kkloberdanz/teleworker/auth"
 	"github.com/kkloberdanz/teleworker/job"
 	pb "github.com/kkloberdanz/teleworker/proto/teleworker/v1"
+	"github.com/kkloberdanz/teleworker/resources"
 )
 
 // Client wraps a gRPC connection to the teleworker service.
@@ -40,11 +44,42 @@ func (c *Client) Close() error {
 	return c.conn.Close()
 }
 
+// StartOptions holds the optional settings for starting a job.
+type StartOptions struct {
+	Image     string           // Path to an OCI image on the server. If empty, the command runs on the host.
+	Rlimits   job.Rlimits      // POSIX resource limits for the job. Unset limits default to the server's ceilings.
+	PidsMax   int64            // Maximum number of processes in the job. If 0, the server's default is used.
+	Cpuset    resources.Cpuset // CPUs and memory nodes to pin the job to.
+	Exclusive uint32           // Number of CPUs to dedicate to the job. Can not be combined with Cpuset.CPUs.
+
+	MemoryHigh int64  // Memory in bytes above which the job is throttled. If 0, the job is not throttled.
+	SwapMax    *int64 // Swap in bytes the job may use: `nil` uses the server's default.
+	OOMGroup   *bool  // If true, an OOM kill kills the whole job: `nil` uses the server's default.
+
+	OnBehalfOf string // User to start the job for, who then owns it. Only admins may set it.
+}
+
 // StartJob starts a job on the teleworker server and returns the job ID.
-func (c *Client) StartJob(ctx context.Context, command string, args []string) (string, error) {
+func (c *Client) StartJob(ctx context.Context, command string, args []string, opts StartOptions) (string, error) {
 	resp, err := c.client.StartJob(ctx, &pb.StartJobRequest{
 		Command: command,
 		Args:    args,
+		Image:   opts.Image,
+		Rlimits: &pb.Rlimits{
+			Nofile: opts.Rlimits.NoFile,
+			Core:   opts.Rlimits.Core,
+			Fsize:  opts.Rlimits.FSize,
+			Stack:  opts.Rlimits.Stack,
+			Nproc:  opts.Rlimits.NProc,
+		},
+		PidsMax:        opts.PidsMax,
+		Cpus:           opts.Cpuset.CPUs,
+		Mems:           opts.Cpuset.Mems,
+		ExclusiveCpus:  opts.Exclusive,
+		MemoryHigh:     opts.MemoryHigh,
+		MemorySwapMax:  opts.SwapMax,
+		MemoryOomGroup: opts.OOMGroup,
+		OnBehalfOf:     opts.OnBehalfOf,
 	})
 	if err != nil {
 		return "", fmt.Errorf("failed to start job: %w", err)
@@ -53,16 +88,74 @@ func (c *Client) StartJob(ctx context.Context, command string, args []string) (s
 	return resp.GetJobId(), nil
 }
 
-// GetJobStatus returns the job's status and optional exit code.
-func (c *Client) GetJobStatus(ctx context.Context, jobID string) (job.Status, *int32, error) {
+// JobStatus is the status of a job as reported by the server.
+type JobStatus struct {
+	Status      job.Status
+	ExitCode    *int32                // nil while the job is running or if the exit code is unknown.
+	Reason      job.TerminationReason // Why the job stopped running.
+	PidsMaxHits int64                 // Number of times a process in the job failed to fork because of the job's process limit.
+	Usage       *resources.Usage      // Resources the job used over its lifetime: `nil` while it is running, or if it ran without a cgroup.
+	Cpuset      resources.Cpuset      // CPUs and memory nodes the job is pinned to.
+	Owner       string                // User the job belongs to.
+	StartedBy   string                // Admin who started the job on its owner's behalf, or empty if the owner started it.
+}
+
+// GetJobStatus returns the job's status.
+func (c *Client) GetJobStatus(ctx context.Context, jobID string) (JobStatus, error) {
 	resp, err := c.client.GetJobStatus(ctx, &pb.GetJobStatusRequest{
 		JobId: jobID,
 	})
 	if err != nil {
-		return job.StatusUnspecified, nil, fmt.Errorf("failed to get job status: %w", err)
+		return JobStatus{}, fmt.Errorf("failed to get job status: %w", err)
+	}
+
+	return JobStatus{
+		Status:      mapStatus(resp.GetStatus()),
+		ExitCode:    resp.ExitCode,
+		Reason:      mapTerminationReason(resp.GetTerminationReason()),
+		PidsMaxHits: resp.GetPidsMaxHits(),
+		Usage:       mapUsage(resp.GetUsage()),
+		Cpuset: resources.Cpuset{
+			CPUs: resp.GetCpus(),
+			Mems: resp.GetMems(),
+		},
+		Owner:     resp.GetOwner(),
+		StartedBy: resp.GetStartedBy(),
+	}, nil
+}
+
+func mapUsage(u *pb.JobUsage) *resources.Usage {
+	if u == nil {
+		return nil
 	}
+	return &resources.Usage{
+		CPUUsec:       u.GetCpuUsec(),
+		UserUsec:      u.GetUserUsec(),
+		SystemUsec:    u.GetSystemUsec(),
+		MemoryPeak:    u.GetMemoryPeak(),
+		ReadBytes:     u.GetReadBytes(),
+		WriteBytes:    u.GetWriteBytes(),
+		PidsPeak:      u.GetPidsPeak(),
+		NrThrottled:   u.GetNrThrottled(),
+		ThrottledUsec: u.GetThrottledUsec(),
+	}
+}
 
-	return mapStatus(resp.GetStatus()), resp.ExitCode, nil
+func mapTerminationReason(r pb.TerminationReason) job.TerminationReason {
+	switch r {
+	case pb.TerminationReason_TERMINATION_REASON_EXITED:
+		return job.TerminationExited
+	case pb.TerminationReason_TERMINATION_REASON_SIGNALED:
+		return job.TerminationSignaled
+	case pb.TerminationReason_TERMINATION_REASON_OOM_KILLED:
+		return job.TerminationOOMKilled
+	case pb.TerminationReason_TERMINATION_REASON_TIMED_OUT:
+		return job.TerminationTimedOut
+	case pb.TerminationReason_TERMINATION_REASON_STOPPED_BY_USER:
+		return job.TerminationStoppedByUser
+	default:
+		return job.TerminationUnspecified
+	}
 }
 
 func mapStatus(s pb.JobStatus) job.Status {
@@ -117,6 +210,96 @@ func (c *Client) StreamOutput(ctx context.Context, jobID string, w io.Writer) er
 	}
 }
 
+// GetJobStats returns the current resource usage of a running job.
+func (c *Client) GetJobStats(ctx context.Context, jobID string) (*resources.Stats, error) {
+	resp, err := c.client.GetJobStats(ctx, &pb.GetJobStatsRequest{
+		JobId: jobID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job stats: %w", err)
+	}
+	return mapStats(resp.GetStats()), nil
+}
+
+// WatchJobStats samples the resource usage of a job every interval, calling fn
+// with each sample, until the job exits or fn returns an error. If interval is
+// 0, the server's default is used.
+func (c *Client) WatchJobStats(ctx context.Context, jobID string, interval time.Duration, fn func(*resources.Stats) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := c.client.WatchJobStats(ctx, &pb.WatchJobStatsRequest{
+		JobId:      jobID,
+		IntervalMs: uint32(interval.Milliseconds()),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to watch job stats: %w", err)
+	}
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("stream recv error: %w", err)
+		}
+		if err := fn(mapStats(resp.GetStats())); err != nil {
+			return err
+		}
+	}
+}
+
+func mapStats(s *pb.JobStats) *resources.Stats {
+	out := &resources.Stats{
+		CPU: resources.CPUStats{
+			UsageUsec:     s.GetCpu().GetUsageUsec(),
+			UserUsec:      s.GetCpu().GetUserUsec(),
+			SystemUsec:    s.GetCpu().GetSystemUsec(),
+			NrPeriods:     s.GetCpu().GetNrPeriods(),
+			NrThrottled:   s.GetCpu().GetNrThrottled(),
+			ThrottledUsec: s.GetCpu().GetThrottledUsec(),
+		},
+		Memory: resources.MemoryStats{
+			Current: s.GetMemory().GetCurrent(),
+			Peak:    s.GetMemory().GetPeak(),
+			Stat:    s.GetMemory().GetStat(),
+		},
+		PidsCurrent: s.GetPidsCurrent(),
+	}
+	for _, dev := range s.GetIo() {
+		out.IO = append(out.IO, resources.IOStats{
+			Major:  dev.GetMajor(),
+			Minor:  dev.GetMinor(),
+			RBytes: dev.GetRbytes(),
+			WBytes: dev.GetWbytes(),
+			RIOs:   dev.GetRios(),
+			WIOs:   dev.GetWios(),
+			DBytes: dev.GetDbytes(),
+			DIOs:   dev.GetDios(),
+		})
+	}
+	if p := s.GetPressure(); p != nil {
+		out.Pressure = &resources.Pressure{
+			CPU:    mapPressureStats(p.GetCpu()),
+			Memory: mapPressureStats(p.GetMemory()),
+			IO:     mapPressureStats(p.GetIo()),
+		}
+	}
+	return out
+}
+
+func mapPressureStats(p *pb.PressureStats) resources.PressureStats {
+	line := func(l *pb.PressureLine) resources.PressureLine {
+		return resources.PressureLine{
+			Avg10:  l.GetAvg10(),
+			Avg60:  l.GetAvg60(),
+			Avg300: l.GetAvg300(),
+			Total:  l.GetTotalUsec(),
+		}
+	}
+	return resources.PressureStats{Some: line(p.GetSome()), Full: line(p.GetFull())}
+}
+
 // StopJob stops a running job.
 func (c *Client) StopJob(ctx context.Context, jobID string) error {
 	_, err := c.client.StopJob(ctx, &pb.StopJobRequest{
@@ -127,3 +310,124 @@ func (c *Client) StopJob(ctx context.Context, jobID string) error {
 	}
 	return nil
 }
+
+// ShareJob grants a user or group permissions on a job, and returns everyone
+// the job is now shared with.
+func (c *Client) ShareJob(ctx context.Context, jobID string, grantee auth.Grantee, perms []auth.Permission) (auth.ACL, error) {
+	resp, err := c.client.ShareJob(ctx, &pb.ShareJobRequest{
+		JobId:       jobID,
+		User:        grantee.User,
+		Group:       grantee.Group,
+		Permissions: toPBPermissions(perms),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to share job: %w", err)
+	}
+	return mapGrants(resp.GetGrants()), nil
+}
+
+// UnshareJob revokes permissions on a job from a user or group, or all of
+// them if perms is empty, and returns everyone the job is still shared with.
+func (c *Client) UnshareJob(ctx context.Context, jobID string, grantee auth.Grantee, perms []auth.Permission) (auth.ACL, error) {
+	resp, err := c.client.UnshareJob(ctx, &pb.UnshareJobRequest{
+		JobId:       jobID,
+		User:        grantee.User,
+		Group:       grantee.Group,
+		Permissions: toPBPermissions(perms),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to unshare job: %w", err)
+	}
+	return mapGrants(resp.GetGrants()), nil
+}
+
+// GetQuota returns the caller's quota, and how much of each of its limits they
+// use. A limit of 0 is not enforced.
+func (c *Client) GetQuota(ctx context.Context) (limits, usage auth.Quota, err error) {
+	resp, err := c.client.GetQuota(ctx, &pb.GetQuotaRequest{})
+	if err != nil {
+		return auth.Quota{}, auth.Quota{}, fmt.Errorf("failed to get quota: %w", err)
+	}
+	return mapQuota(resp.GetLimits()), mapQuota(resp.GetUsage()), nil
+}
+
+func mapQuota(q *pb.Quota) auth.Quota {
+	return auth.Quota{
+		Jobs:         int(q.GetJobs()),
+		CPUs:         q.GetCpus(),
+		Memory:       q.GetMemoryBytes(),
+		RetainedJobs: int(q.GetRetainedJobs()),
+		LogBytes:     q.GetLogBytes(),
+	}
+}
+
+// QueryAudit returns the newest records of the server's audit log that match
+// the filter, oldest first. If filter.Limit is 0, the server's default is
+// used.
+func (c *Client) QueryAudit(ctx context.Context, filter audit.Filter) ([]audit.Record, error) {
+	req := &pb.QueryAuditRequest{
+		User:  filter.User,
+		Rpc:   filter.RPC,
+		JobId: filter.JobID,
+		Limit: uint32(filter.Limit),
+	}
+	if !filter.Since.IsZero() {
+		req.Since = filter.Since.Format(time.RFC3339)
+	}
+	resp, err := c.client.QueryAudit(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit log: %w", err)
+	}
+
+	records := make([]audit.Record, 0, len(resp.GetRecords()))
+	for _, r := range resp.GetRecords() {
+		t, err := time.Parse(time.RFC3339Nano, r.GetTime())
+		if err != nil {
+			return nil, fmt.Errorf("invalid audit record time %q: %w", r.GetTime(), err)
+		}
+		records = append(records, audit.Record{
+			Time:       t,
+			User:       r.GetUser(),
+			Role:       r.GetRole(),
+			RPC:        r.GetRpc(),
+			JobID:      r.GetJobId(),
+			Request:    r.GetRequest(),
+			Code:       r.GetCode(),
+			Error:      r.GetError(),
+			LatencyMS:  r.GetLatencyMs(),
+			PrevHash:   r.GetPrevHash(),
+			Hash:       r.GetHash(),
+			OnBehalfOf: r.GetOnBehalfOf(),
+		})
+	}
+	return records, nil
+}
+
+var permissions = map[auth.Permission]pb.Permission{
+	auth.PermissionView: pb.Permission_PERMISSION_VIEW,
+	auth.PermissionLogs: pb.Permission_PERMISSION_LOGS,
+	auth.PermissionStop: pb.Permission_PERMISSION_STOP,
+}
+
+func toPBPermissions(perms []auth.Permission) []pb.Permission {
+	out := make([]pb.Permission, 0, len(perms))
+	for _, p := range perms {
+		out = append(out, permissions[p])
+	}
+	return out
+}
+
+func mapGrants(grants []*pb.JobGrant) auth.ACL {
+	acl := make(auth.ACL, len(grants))
+	for _, grant := range grants {
+		g := auth.Grantee{User: grant.GetUser(), Group: grant.GetGroup()}
+		for _, p := range grant.GetPermissions() {
+			for perm, pbPerm := range permissions {
+				if pbPerm == p {
+					acl.Grant(g, perm)
+				}
+			}
+		}
+	}
+	return acl
+}
@@ -16,16 +16,21 @@ import (
 	"github.com/kkloberdanz/teleworker/client"
 	"github.com/kkloberdanz/teleworker/job"
 	pb "github.com/kkloberdanz/teleworker/proto/teleworker/v1"
+	"github.com/kkloberdanz/teleworker/resources/fake"
 	"github.com/kkloberdanz/teleworker/server"
 	"github.com/kkloberdanz/teleworker/testutil"
 	"github.com/kkloberdanz/teleworker/worker"
 )
 
 func TestMain(m *testing.M) {
+	// Jobs on a backend without cgroup fds, such as the fake, are started
+	// through the job init process.
+	job.Init()
 	goleak.VerifyTestMain(m)
 }
 
 // startTestServer starts a gRPC server with mTLS and returns its address.
+// Tests that start jobs need root for their PID namespace.
 func startTestServer(t *testing.T) string {
 	t.Helper()
 
@@ -34,9 +39,8 @@ func startTestServer(t *testing.T) string {
 		t.Fatalf("failed to listen: %v", err)
 	}
 
-	mgr := testutil.RequireManager(t)
-	w := worker.New(worker.Options{CgroupMgr: mgr})
-	srv := server.New(w)
+	w := worker.New(worker.Options{CgroupMgr: fake.NewBackend()})
+	srv := server.New(w, server.Options{})
 
 	grpcServer := grpc.NewServer(
 		grpc.Creds(credentials.NewTLS(testutil.ServerTLSConfig(t))),
@@ -56,6 +60,7 @@ func startTestServer(t *testing.T) string {
 }
 
 func TestStartJobReturnsValidUUID(t *testing.T) {
+	testutil.RequireRoot(t)
 	addr := startTestServer(t)
 
 	c, err := client.New(addr, testutil.ClientTLSConfig(t, "alice"))
@@ -64,7 +69,7 @@ func TestStartJobReturnsValidUUID(t *testing.T) {
 	}
 	t.Cleanup(func() { c.Close() })
 
-	jobID, err := c.StartJob(t.Context(), "echo", []string{"hello"})
+	jobID, err := c.StartJob(t.Context(), "echo", []string{"hello"}, client.StartOptions{})
 	if err != nil {
 		t.Fatalf("StartJob failed: %v", err)
 	}
@@ -80,13 +85,14 @@ func TestStartJobBadAddress(t *testing.T) {
 	}
 	t.Cleanup(func() { c.Close() })
 
-	_, err = c.StartJob(t.Context(), "echo", []string{"hello"})
+	_, err = c.StartJob(t.Context(), "echo", []string{"hello"}, client.StartOptions{})
 	if err == nil {
 		t.Fatal("expected error for bad address, got nil")
 	}
 }
 
 func TestGetJobStatus(t *testing.T) {
+	testutil.RequireRoot(t)
 	addr := startTestServer(t)
 
 	c, err := client.New(addr, testutil.ClientTLSConfig(t, "alice"))
@@ -95,18 +101,18 @@ func TestGetJobStatus(t *testing.T) {
 	}
 	t.Cleanup(func() { c.Close() })
 
-	jobID, err := c.StartJob(t.Context(), "true", nil)
+	jobID, err := c.StartJob(t.Context(), "true", nil, client.StartOptions{})
 	if err != nil {
 		t.Fatalf("StartJob failed: %v", err)
 	}
 
 	var st job.Status
 	testutil.PollUntil(t, "job to finish", func() bool {
-		var err error
-		st, _, err = c.GetJobStatus(t.Context(), jobID)
+		js, err := c.GetJobStatus(t.Context(), jobID)
 		if err != nil {
 			t.Fatalf("GetJobStatus failed: %v", err)
 		}
+		st = js.Status
 		return st != job.StatusRunning
 	})
 	if st != job.StatusSuccess {
@@ -115,6 +121,7 @@ func TestGetJobStatus(t *testing.T) {
 }
 
 func TestStreamOutput(t *testing.T) {
+	testutil.RequireRoot(t)
 	addr := startTestServer(t)
 
 	c, err := client.New(addr, testutil.ClientTLSConfig(t, "alice"))
@@ -123,7 +130,7 @@ func TestStreamOutput(t *testing.T) {
 	}
 	t.Cleanup(func() { c.Close() })
 
-	jobID, err := c.StartJob(t.Context(), "echo", []string{"client-stream"})
+	jobID, err := c.StartJob(t.Context(), "echo", []string{"client-stream"}, client.StartOptions{})
 	if err != nil {
 		t.Fatalf("StartJob failed: %v", err)
 	}
@@ -141,6 +148,7 @@ func TestStreamOutput(t *testing.T) {
 // TestStreamOutputIncremental verifies that output arrives at the client
 // incrementally while the job is still running, not all at once after exit.
 func TestStreamOutputIncremental(t *testing.T) {
+	testutil.RequireRoot(t)
 	addr := startTestServer(t)
 
 	c, err := client.New(addr, testutil.ClientTLSConfig(t, "alice"))
@@ -152,7 +160,7 @@ func TestStreamOutputIncremental(t *testing.T) {
 	// Start a job that prints "first", sleeps, then prints "second".
 	jobID, err := c.StartJob(t.Context(), "sh", []string{
 		"-c", "echo first; sleep 2; echo second",
-	})
+	}, client.StartOptions{})
 	if err != nil {
 		t.Fatalf("StartJob failed: %v", err)
 	}
@@ -178,12 +186,12 @@ func TestStreamOutputIncremental(t *testing.T) {
 	}
 
 	// The job should still be running because of the sleep.
-	st, _, err := c.GetJobStatus(t.Context(), jobID)
+	js, err := c.GetJobStatus(t.Context(), jobID)
 	if err != nil {
 		t.Fatalf("GetJobStatus failed: %v", err)
 	}
-	if st != job.StatusRunning {
-		t.Fatalf("expected job to still be running after first chunk, got %v", st)
+	if js.Status != job.StatusRunning {
+		t.Fatalf("expected job to still be running after first chunk, got %v", js.Status)
 	}
 
 	// Read remaining output until EOF.
@@ -200,6 +208,7 @@ func TestStreamOutputIncremental(t *testing.T) {
 }
 
 func TestStopJob(t *testing.T) {
+	testutil.RequireRoot(t)
 	addr := startTestServer(t)
 
 	c, err := client.New(addr, testutil.ClientTLSConfig(t, "alice"))
@@ -208,7 +217,7 @@ func TestStopJob(t *testing.T) {
 	}
 	t.Cleanup(func() { c.Close() })
 
-	jobID, err := c.StartJob(t.Context(), "sleep", []string{"60"})
+	jobID, err := c.StartJob(t.Context(), "sleep", []string{"60"}, client.StartOptions{})
 	if err != nil {
 		t.Fatalf("StartJob failed: %v", err)
 	}
@@ -219,11 +228,11 @@ func TestStopJob(t *testing.T) {
 
 	var st job.Status
 	testutil.PollUntil(t, "job to be killed", func() bool {
-		var err error
-		st, _, err = c.GetJobStatus(t.Context(), jobID)
+		js, err := c.GetJobStatus(t.Context(), jobID)
 		if err != nil {
 			t.Fatalf("GetJobStatus failed: %v", err)
 		}
+		st = js.Status
 		return st != job.StatusRunning
 	})
 	if st != job.StatusKilled {
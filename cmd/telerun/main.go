@@ -7,18 +7,24 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"maps"
 	"os"
 	"os/signal"
+	"slices"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
+	"github.com/kkloberdanz/teleworker/audit"
 	"github.com/kkloberdanz/teleworker/auth"
 	"github.com/kkloberdanz/teleworker/client"
 	"github.com/kkloberdanz/teleworker/job"
 	"github.com/kkloberdanz/teleworker/logging"
+	"github.com/kkloberdanz/teleworker/resources"
 )
 
 var (
@@ -26,6 +32,28 @@ var (
 	caPath   string
 	certPath string
 	keyPath  string
+	image    string
+	rlimits  []string
+	pidsMax  int64
+	interval time.Duration
+
+	cpus          string
+	mems          string
+	exclusiveCPUs uint32
+
+	memoryHigh int64
+	swapMax    int64
+	oomGroup   bool
+
+	shareUser  string
+	shareGroup string
+	sharePerms []string
+	revoke     bool
+
+	onBehalfOf string
+
+	auditFilter audit.Filter
+	auditSince  string
 )
 
 func main() {
@@ -46,13 +74,29 @@ func main() {
 	// We default to running `telerun` as the user alice using the alice key and cert.
 	rootCmd.PersistentFlags().StringVar(&certPath, "cert", "certs/alice.crt", "Path to client certificate PEM")
 	rootCmd.PersistentFlags().StringVar(&keyPath, "key", "certs/alice.key", "Path to client private key PEM")
+	rootCmd.PersistentFlags().StringVar(&onBehalfOf, "as", "", "User to start jobs on behalf of, who then owns them (admins, or callers the policy allows to impersonate)")
 
 	startCmd := &cobra.Command{
-		Use:   "start -- <command> [args...]",
+		Use:   "start [--image <name>] [--rlimit <name>=<value>] -- <command> [args...]",
 		Short: "Run a command via telerun",
-		Args:  cobra.MinimumNArgs(1),
-		RunE:  cmdStart,
+		Args: func(cmd *cobra.Command, args []string) error {
+			// Images have a default command, so it may be omitted.
+			if image != "" {
+				return nil
+			}
+			return cobra.MinimumNArgs(1)(cmd, args)
+		},
+		RunE: cmdStart,
 	}
+	startCmd.Flags().StringVar(&image, "image", "", "Name of an OCI image layout directory or tarball in the server's image directory")
+	startCmd.Flags().Int64Var(&pidsMax, "pids-max", 0, "Maximum number of processes in the job (server default if 0)")
+	startCmd.Flags().StringVar(&cpus, "cpus", "", "CPUs to pin the job to, e.g. 0-3,6")
+	startCmd.Flags().StringVar(&mems, "mems", "", "NUMA memory nodes to pin the job to, e.g. 0")
+	startCmd.Flags().Uint32Var(&exclusiveCPUs, "exclusive-cpus", 0, "Number of CPUs to dedicate to the job, from the server's exclusive pool")
+	startCmd.Flags().Int64Var(&memoryHigh, "memory-high", 0, "Memory in bytes above which the job is throttled (not throttled if 0)")
+	startCmd.Flags().Int64Var(&swapMax, "swap-max", 0, "Swap in bytes the job may use, 0 to disable swap (server default if not set)")
+	startCmd.Flags().BoolVar(&oomGroup, "oom-group", true, "Kill the whole job when it runs out of memory, rather than one process")
+	startCmd.Flags().StringSliceVar(&rlimits, "rlimit", nil, "Resource limits for the job, e.g. nofile=1024,core=0 (any of nofile, core, fsize, stack and nproc)")
 
 	statusCmd := &cobra.Command{
 		Use:   "status <job_id>",
@@ -75,7 +119,54 @@ func main() {
 		RunE:  cmdLogs,
 	}
 
-	rootCmd.AddCommand(startCmd, statusCmd, stopCmd, logsCmd)
+	statsCmd := &cobra.Command{
+		Use:   "stats <job_id>",
+		Short: "Show the resource usage of a running job",
+		Args:  cobra.ExactArgs(1),
+		RunE:  cmdStats,
+	}
+
+	topCmd := &cobra.Command{
+		Use:   "top <job_id>",
+		Short: "Watch the resource usage of a running job until it exits",
+		Args:  cobra.ExactArgs(1),
+		RunE:  cmdTop,
+	}
+	topCmd.Flags().DurationVar(&interval, "interval", time.Second, "Time between samples")
+
+	shareCmd := &cobra.Command{
+		Use:   "share <job_id> (--user <name> | --group <name>) [--perm view,logs,stop] [--revoke]",
+		Short: "Share a job with another user or group, or stop sharing it",
+		Args:  cobra.ExactArgs(1),
+		RunE:  cmdShare,
+	}
+	shareCmd.Flags().StringVar(&shareUser, "user", "", "User to share the job with")
+	shareCmd.Flags().StringVar(&shareGroup, "group", "", "Group to share the job with")
+	shareCmd.Flags().StringSliceVar(&sharePerms, "perm", nil, "Permissions to grant or revoke: view, logs and stop (grants view,logs, or revokes all, if not set)")
+	shareCmd.Flags().BoolVar(&revoke, "revoke", false, "Revoke the permissions rather than grant them")
+	shareCmd.MarkFlagsOneRequired("user", "group")
+	shareCmd.MarkFlagsMutuallyExclusive("user", "group")
+
+	quotaCmd := &cobra.Command{
+		Use:   "quota",
+		Short: "Show your quota and how much of it you use",
+		Args:  cobra.NoArgs,
+		RunE:  cmdQuota,
+	}
+
+	auditCmd := &cobra.Command{
+		Use:   "audit [--user <name>] [--rpc <method>] [--job <job_id>] [--since <time>] [--limit <n>]",
+		Short: "Show the server's audit log of RPCs (admins only)",
+		Args:  cobra.NoArgs,
+		RunE:  cmdAudit,
+	}
+	auditCmd.Flags().StringVar(&auditFilter.User, "user", "", "Only show RPCs made by this user")
+	auditCmd.Flags().StringVar(&auditFilter.RPC, "rpc", "", "Only show calls of this method, e.g. StopJob")
+	auditCmd.Flags().StringVar(&auditFilter.JobID, "job", "", "Only show RPCs on this job")
+	auditCmd.Flags().StringVar(&auditSince, "since", "", "Only show RPCs made at or after this time, in RFC 3339, e.g. 2026-01-02T15:04:05Z")
+	auditCmd.Flags().IntVar(&auditFilter.Limit, "limit", 0, "Show at most this many of the newest records (server default if 0)")
+
+	rootCmd.AddCommand(startCmd, statusCmd, stopCmd, logsCmd, statsCmd, topCmd, shareCmd, quotaCmd, auditCmd)
 
 	if err := rootCmd.Execute(); err != nil {
 		os.Exit(1)
@@ -84,6 +175,11 @@ func main() {
 
 // cmdStart sends the command to the gRPC server.
 func cmdStart(cmd *cobra.Command, args []string) error {
+	limits, err := job.ParseRlimits(rlimits)
+	if err != nil {
+		return err
+	}
+
 	slog.Info(
 		"connecting",
 		"addr", address,
@@ -95,15 +191,35 @@ func cmdStart(cmd *cobra.Command, args []string) error {
 	}
 	defer teleClient.Close()
 
-	command := args[0]
-	commandArgs := args[1:]
+	var command string
+	var commandArgs []string
+	if len(args) > 0 {
+		command = args[0]
+		commandArgs = args[1:]
+	}
 	slog.Info(
 		"starting job",
 		"command", command,
 		"arguments", commandArgs,
+		"image", image,
 	)
 
-	jobID, err := teleClient.StartJob(cmd.Context(), command, commandArgs)
+	opts := client.StartOptions{
+		Image:      image,
+		Rlimits:    limits,
+		PidsMax:    pidsMax,
+		Cpuset:     resources.Cpuset{CPUs: cpus, Mems: mems},
+		Exclusive:  exclusiveCPUs,
+		MemoryHigh: memoryHigh,
+		OnBehalfOf: onBehalfOf,
+	}
+	if cmd.Flags().Changed("swap-max") {
+		opts.SwapMax = &swapMax
+	}
+	if cmd.Flags().Changed("oom-group") {
+		opts.OOMGroup = &oomGroup
+	}
+	jobID, err := teleClient.StartJob(cmd.Context(), command, commandArgs, opts)
 	if err != nil {
 		return err
 	}
@@ -133,19 +249,33 @@ func cmdStatus(cmd *cobra.Command, args []string) error {
 	}
 	defer teleClient.Close()
 
-	jobStatus, exitCode, err := teleClient.GetJobStatus(cmd.Context(), args[0])
+	jobStatus, err := teleClient.GetJobStatus(cmd.Context(), args[0])
 	if err != nil {
 		return err
 	}
 
 	output := struct {
-		JobID    string `json:"job_id"`
-		Status   string `json:"status"`
-		ExitCode *int32 `json:"exit_code,omitempty"`
+		JobID             string           `json:"job_id"`
+		Owner             string           `json:"owner,omitempty"`
+		StartedBy         string           `json:"started_by,omitempty"`
+		Status            string           `json:"status"`
+		ExitCode          *int32           `json:"exit_code,omitempty"`
+		TerminationReason string           `json:"termination_reason,omitempty"`
+		PidsMaxHits       int64            `json:"pids_max_hits,omitempty"`
+		Usage             *resources.Usage `json:"usage,omitempty"`
+		CPUs              string           `json:"cpus,omitempty"`
+		Mems              string           `json:"mems,omitempty"`
 	}{
-		JobID:    args[0],
-		Status:   statusString(jobStatus),
-		ExitCode: exitCode,
+		JobID:             args[0],
+		Owner:             jobStatus.Owner,
+		StartedBy:         jobStatus.StartedBy,
+		Status:            statusString(jobStatus.Status),
+		ExitCode:          jobStatus.ExitCode,
+		TerminationReason: reasonString(jobStatus.Reason),
+		PidsMaxHits:       jobStatus.PidsMaxHits,
+		Usage:             jobStatus.Usage,
+		CPUs:              jobStatus.Cpuset.CPUs,
+		Mems:              jobStatus.Cpuset.Mems,
 	}
 
 	b, err := json.MarshalIndent(output, "", "  ")
@@ -182,6 +312,197 @@ func cmdStop(cmd *cobra.Command, args []string) error {
 	return teleClient.StopJob(cmd.Context(), args[0])
 }
 
+// cmdShare grants or revokes permissions on a job, then prints everyone the
+// job is shared with.
+func cmdShare(cmd *cobra.Command, args []string) error {
+	var perms []auth.Permission
+	for _, s := range sharePerms {
+		p, err := auth.ParsePermission(s)
+		if err != nil {
+			return err
+		}
+		perms = append(perms, p)
+	}
+	if len(perms) == 0 && !revoke {
+		perms = []auth.Permission{auth.PermissionView, auth.PermissionLogs}
+	}
+
+	teleClient, err := newTLSClient()
+	if err != nil {
+		return err
+	}
+	defer teleClient.Close()
+
+	grantee := auth.Grantee{User: shareUser, Group: shareGroup}
+	var acl auth.ACL
+	if revoke {
+		acl, err = teleClient.UnshareJob(cmd.Context(), args[0], grantee, perms)
+	} else {
+		acl, err = teleClient.ShareJob(cmd.Context(), args[0], grantee, perms)
+	}
+	if err != nil {
+		return err
+	}
+
+	grantees := slices.SortedFunc(maps.Keys(acl), func(a, b auth.Grantee) int {
+		return strings.Compare(a.String(), b.String())
+	})
+	for _, g := range grantees {
+		names := make([]string, 0, len(acl[g]))
+		for _, p := range acl[g] {
+			names = append(names, string(p))
+		}
+		fmt.Printf("%s\t%s\n", g, strings.Join(names, ","))
+	}
+	return nil
+}
+
+// cmdQuota prints a line for each limit of the caller's quota, with how much
+// of it they use. Limits that are not enforced are shown as "-".
+func cmdQuota(cmd *cobra.Command, args []string) error {
+	teleClient, err := newTLSClient()
+	if err != nil {
+		return err
+	}
+	defer teleClient.Close()
+
+	limits, usage, err := teleClient.GetQuota(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	limit := func(set bool, s string) string {
+		if !set {
+			return "-"
+		}
+		return s
+	}
+	fmt.Printf("%-14s %-10s %s\n", "QUOTA", "USED", "LIMIT")
+	fmt.Printf("%-14s %-10d %s\n", "jobs", usage.Jobs, limit(limits.Jobs > 0, fmt.Sprint(limits.Jobs)))
+	fmt.Printf("%-14s %-10g %s\n", "cpus", usage.CPUs, limit(limits.CPUs > 0, fmt.Sprint(limits.CPUs)))
+	fmt.Printf("%-14s %-10s %s\n", "memory", formatBytes(uint64(usage.Memory)), limit(limits.Memory > 0, formatBytes(uint64(limits.Memory))))
+	fmt.Printf("%-14s %-10d %s\n", "retained jobs", usage.RetainedJobs, limit(limits.RetainedJobs > 0, fmt.Sprint(limits.RetainedJobs)))
+	fmt.Printf("%-14s %-10s %s\n", "logs", formatBytes(uint64(usage.LogBytes)), limit(limits.LogBytes > 0, formatBytes(uint64(limits.LogBytes))))
+	return nil
+}
+
+// cmdAudit prints the matching audit records as JSON lines, as they are in the
+// server's audit log.
+func cmdAudit(cmd *cobra.Command, args []string) error {
+	if auditSince != "" {
+		since, err := time.Parse(time.RFC3339, auditSince)
+		if err != nil {
+			return fmt.Errorf("invalid --since: %w", err)
+		}
+		auditFilter.Since = since
+	}
+
+	teleClient, err := newTLSClient()
+	if err != nil {
+		return err
+	}
+	defer teleClient.Close()
+
+	records, err := teleClient.QueryAudit(cmd.Context(), auditFilter)
+	if err != nil {
+		return err
+	}
+	for _, r := range records {
+		b, err := json.Marshal(r)
+		if err != nil {
+			return fmt.Errorf("failed to marshal audit record: %w", err)
+		}
+		fmt.Println(string(b))
+	}
+	return nil
+}
+
+func cmdStats(cmd *cobra.Command, args []string) error {
+	teleClient, err := newTLSClient()
+	if err != nil {
+		return err
+	}
+	defer teleClient.Close()
+
+	stats, err := teleClient.GetJobStats(cmd.Context(), args[0])
+	if err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal stats: %w", err)
+	}
+	fmt.Println(string(b))
+
+	return nil
+}
+
+// cmdTop prints a line of resource usage for each sample of a running job.
+// CPU usage is shown as a percentage of one core over the last interval, so a
+// job using two cores shows 200%.
+func cmdTop(cmd *cobra.Command, args []string) error {
+	teleClient, err := newTLSClient()
+	if err != nil {
+		return err
+	}
+	defer teleClient.Close()
+
+	fmt.Printf("%-8s %-10s %-10s %-10s %-10s %-6s %-8s %s\n", "CPU%", "MEM", "PEAK", "READ", "WRITE", "PIDS", "MEM PSI", "THROTTLED")
+	var prev *resources.Stats
+	var prevTime time.Time
+	err = teleClient.WatchJobStats(cmd.Context(), args[0], interval, func(stats *resources.Stats) error {
+		now := time.Now()
+		cpu := "-"
+		if prev != nil {
+			used := time.Duration(stats.CPU.UsageUsec-prev.CPU.UsageUsec) * time.Microsecond
+			cpu = fmt.Sprintf("%.1f", 100*used.Seconds()/now.Sub(prevTime).Seconds())
+		}
+		var read, write uint64
+		for _, dev := range stats.IO {
+			read += dev.RBytes
+			write += dev.WBytes
+		}
+		// Share of the last 10 seconds in which some of the job's tasks
+		// were stalled waiting for memory.
+		psi := "-"
+		if stats.Pressure != nil {
+			psi = fmt.Sprintf("%.2f", stats.Pressure.Memory.Some.Avg10)
+		}
+		fmt.Printf("%-8s %-10s %-10s %-10s %-10s %-6d %-8s %s\n",
+			cpu,
+			formatBytes(stats.Memory.Current),
+			formatBytes(stats.Memory.Peak),
+			formatBytes(read),
+			formatBytes(write),
+			stats.PidsCurrent,
+			psi,
+			time.Duration(stats.CPU.ThrottledUsec)*time.Microsecond,
+		)
+		prev, prevTime = stats, now
+		return nil
+	})
+	if status.Code(err) == codes.Canceled {
+		// If the user cancel's with Ctrl-C, then don't return an error.
+		return nil
+	}
+	return err
+}
+
+// formatBytes formats a byte count using binary units, e.g. "1.5MiB".
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
 func newTLSClient() (*client.Client, error) {
 	caCert, err := os.ReadFile(caPath)
 	if err != nil {
@@ -219,3 +540,22 @@ func statusString(s job.Status) string {
 		return "unknown"
 	}
 }
+
+// reasonString returns the termination reason as printed by `telerun status`.
+// It is empty while the job is running, so that it is left out of the output.
+func reasonString(r job.TerminationReason) string {
+	switch r {
+	case job.TerminationExited:
+		return "exited"
+	case job.TerminationSignaled:
+		return "signaled"
+	case job.TerminationOOMKilled:
+		return "oom_killed"
+	case job.TerminationTimedOut:
+		return "timed_out"
+	case job.TerminationStoppedByUser:
+		return "stopped_by_user"
+	default:
+		return ""
+	}
+}
@@ -2,24 +2,30 @@
 package main
 
 import (
-	"crypto/tls"
 	"fmt"
 	"log/slog"
 	"net"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"slices"
 	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 
+	"github.com/kkloberdanz/teleworker/audit"
 	"github.com/kkloberdanz/teleworker/auth"
+	"github.com/kkloberdanz/teleworker/job"
 	"github.com/kkloberdanz/teleworker/logging"
 	pb "github.com/kkloberdanz/teleworker/proto/teleworker/v1"
+	"github.com/kkloberdanz/teleworker/ratelimit"
 	"github.com/kkloberdanz/teleworker/resources"
 	"github.com/kkloberdanz/teleworker/server"
 	"github.com/kkloberdanz/teleworker/worker"
+	"github.com/kkloberdanz/teleworker/workspace"
 )
 
 var (
@@ -27,9 +33,46 @@ var (
 	caPath   string
 	certPath string
 	keyPath  string
+	dataDir  string
+	imageDir string
+
+	workspaceBase      string
+	workspaceSize      int64
+	workspaceRetention string
+
+	isolate []string
+
+	landlockRO         []string
+	landlockRW         []string
+	landlockExec       []string
+	landlockBestEffort bool
+
+	rlimitCeilings []string
+
+	pidsMax  int64
+	ioLimits []string
+
+	exclusiveCPUs      string
+	exclusiveCPUsQueue bool
+
+	policyPath   string
+	identityPath string
+
+	crlPaths   []string
+	crlRefresh time.Duration
+
+	tlsReload time.Duration
+
+	auditPath     string
+	auditMaxSize  int64
+	auditMaxFiles int
+	auditChain    bool
 )
 
 func main() {
+	// If this process is a job init process, Init execs the job's command
+	// and never returns.
+	job.Init()
 	logging.Init()
 
 	rootCmd := &cobra.Command{
@@ -42,6 +85,33 @@ func main() {
 	rootCmd.PersistentFlags().StringVar(&caPath, "ca", "certs/ca.crt", "Path to CA certificate PEM")
 	rootCmd.PersistentFlags().StringVar(&certPath, "cert", "certs/server.crt", "Path to server certificate PEM")
 	rootCmd.PersistentFlags().StringVar(&keyPath, "key", "certs/server.key", "Path to server private key PEM")
+	rootCmd.PersistentFlags().StringVar(&policyPath, "policy", "", "Path to a YAML or JSON access control policy (defaults to the built-in admin, client, auditor and operator roles)")
+	rootCmd.PersistentFlags().StringVar(&identityPath, "identity", "", "Path to a YAML or JSON identity mapping, e.g. from SPIFFE IDs (defaults to the username from the certificate CN and the role from its first OU)")
+	rootCmd.PersistentFlags().DurationVar(&tlsReload, "tls-reload", 10*time.Second, "How often to check the CA certificate and the server's certificate and key for changes, which are also reloaded on SIGHUP (only on SIGHUP if 0)")
+	rootCmd.PersistentFlags().StringSliceVar(&crlPaths, "crl", nil, "Paths to PEM or DER certificate revocation lists. Client certificates they revoke are rejected")
+	rootCmd.PersistentFlags().DurationVar(&crlRefresh, "crl-refresh", 5*time.Minute, "How often to reread the certificate revocation lists, which are also reread on SIGHUP (only on SIGHUP if 0)")
+	rootCmd.PersistentFlags().StringVar(&auditPath, "audit-log", "", "Path to append a JSON line for every RPC to (no audit log if empty)")
+	rootCmd.PersistentFlags().Int64Var(&auditMaxSize, "audit-max-size", 100*1024*1024, "Size in bytes above which the audit log is rotated (never rotated if 0)")
+	rootCmd.PersistentFlags().IntVar(&auditMaxFiles, "audit-max-files", 10, "Number of rotated audit log files to keep (at least 1 unless --audit-max-size is 0)")
+	rootCmd.PersistentFlags().BoolVar(&auditChain, "audit-chain", false, "Add the hash of the record before to each audit record, so that changes to the log can be detected")
+	rootCmd.PersistentFlags().StringVar(&dataDir, "data-dir", "/var/lib/teleworker", "Directory for unpacked image layers and job root filesystems")
+	rootCmd.PersistentFlags().StringVar(&imageDir, "image-dir", "", "Directory of the OCI images jobs may run, which they name relative to it (defaults to <data-dir>/images)")
+	rootCmd.PersistentFlags().StringVar(&workspaceBase, "workspace-base", "", "Base directory for per-job copy-on-write workspaces (disabled if empty)")
+	rootCmd.PersistentFlags().Int64Var(&workspaceSize, "workspace-size", 0, "Maximum bytes each job may write to its workspace (unlimited if 0)")
+	rootCmd.PersistentFlags().StringVar(&workspaceRetention, "workspace-retention", "discard", "What to do with a job's workspace when it finishes: \"discard\" or \"keep\"")
+
+	rootCmd.PersistentFlags().StringSliceVar(&isolate, "isolate", nil, "Extra namespaces to run every job in: any of \"uts\", \"ipc\" and \"mount\"")
+
+	rootCmd.PersistentFlags().StringSliceVar(&landlockRO, "landlock-ro", nil, "Paths jobs may read (enables Landlock)")
+	rootCmd.PersistentFlags().StringSliceVar(&landlockRW, "landlock-rw", nil, "Paths jobs may read and write (enables Landlock)")
+	rootCmd.PersistentFlags().StringSliceVar(&landlockExec, "landlock-exec", nil, "Paths jobs may read and execute files from (enables Landlock)")
+	rootCmd.PersistentFlags().BoolVar(&landlockBestEffort, "landlock-best-effort", false, "Run jobs without Landlock if the kernel does not support it, instead of failing them")
+
+	rootCmd.PersistentFlags().StringArrayVar(&ioLimits, "io-limit", nil, "IO limit for each job on a device, given by path or major:minor, e.g. \"/var/lib rbps=1048576 wiops=100\" (repeatable; defaults to 5 MB/s read and write on the root filesystem's disk)")
+	rootCmd.PersistentFlags().StringVar(&exclusiveCPUs, "exclusive-cpus", "", "Pool of CPUs to dedicate to jobs that ask for exclusive CPUs, e.g. 4-7. Other jobs do not run on these CPUs")
+	rootCmd.PersistentFlags().BoolVar(&exclusiveCPUsQueue, "exclusive-cpus-queue", false, "Queue jobs until enough exclusive CPUs are free, instead of refusing them")
+	rootCmd.PersistentFlags().Int64Var(&pidsMax, "pids-max", resources.DefaultPidsMax, "Default, and highest, maximum number of processes in each job")
+	rootCmd.PersistentFlags().StringSliceVar(&rlimitCeilings, "rlimit-ceiling", nil, "Highest resource limits a job may ask for, also used as defaults, e.g. nofile=4096,nproc=512")
 
 	if err := rootCmd.Execute(); err != nil {
 		os.Exit(1)
@@ -49,28 +119,156 @@ func main() {
 }
 
 func runServer(cmd *cobra.Command, args []string) error {
-	cgroupMgr, err := resources.NewManager("/sys/fs/cgroup/teleworker")
+	var limits []resources.IOLimit
+	for _, spec := range ioLimits {
+		limit, err := resources.ParseIOLimit(spec)
+		if err != nil {
+			return err
+		}
+		limits = append(limits, limit)
+	}
+
+	policy := auth.DefaultPolicy()
+	if policyPath != "" {
+		p, err := auth.LoadPolicy(policyPath)
+		if err != nil {
+			return err
+		}
+		policy = p
+	}
+
+	var mapper auth.Mapper = auth.SubjectMapper{}
+	if identityPath != "" {
+		m, err := auth.LoadMapper(identityPath)
+		if err != nil {
+			return err
+		}
+		mapper = m
+	}
+
+	var auditLog *audit.Log
+	if auditPath != "" {
+		if auditMaxSize > 0 && auditMaxFiles < 1 {
+			return fmt.Errorf("--audit-max-files must be at least 1 when --audit-max-size is set")
+		}
+		l, err := audit.Open(auditPath, audit.Options{
+			MaxSize:  auditMaxSize,
+			MaxFiles: auditMaxFiles,
+			Chain:    auditChain,
+		})
+		if err != nil {
+			return err
+		}
+		defer l.Close()
+		auditLog = l
+	}
+
+	cgroupMgr, err := resources.NewBackend("/sys/fs/cgroup", "teleworker", resources.Options{
+		PidsMax:  pidsMax,
+		IOLimits: limits,
+	})
 	if err != nil {
 		return fmt.Errorf("failed to configure cgroups (requires root): %w", err)
 	}
 
-	w := worker.New(worker.Options{CgroupMgr: *cgroupMgr})
-	srv := server.New(w)
+	var ws *workspace.Config
+	if workspaceBase != "" {
+		retention, err := workspace.ParseRetention(workspaceRetention)
+		if err != nil {
+			return err
+		}
+		ws = &workspace.Config{
+			Base:      workspaceBase,
+			Dir:       filepath.Join(dataDir, "workspaces"),
+			Size:      workspaceSize,
+			Retention: retention,
+		}
+	}
+
+	isolation, err := job.ParseIsolation(isolate)
+	if err != nil {
+		return err
+	}
+
+	ceilings, err := job.ParseRlimits(rlimitCeilings)
+	if err != nil {
+		return err
+	}
+
+	var ll *job.Landlock
+	if len(landlockRO) > 0 || len(landlockRW) > 0 || len(landlockExec) > 0 {
+		ll = &job.Landlock{
+			ReadOnly:   landlockRO,
+			ReadWrite:  landlockRW,
+			Exec:       landlockExec,
+			BestEffort: landlockBestEffort,
+		}
+	}
+
+	cpus, err := cpuAllocator(cgroupMgr)
+	if err != nil {
+		return err
+	}
+
+	if imageDir == "" {
+		imageDir = filepath.Join(dataDir, "images")
+	}
+	w := worker.New(worker.Options{
+		CgroupMgr: cgroupMgr,
+		DataDir:   dataDir,
+		ImageDir:  imageDir,
+		Workspace: ws,
+		Isolation: isolation,
+		Landlock:  ll,
+		Ceilings:  ceilings,
+		CPUs:      cpus,
+		Quotas:    policy.Quota,
+	})
+	srv := server.New(w, server.Options{Policy: policy, Audit: auditLog})
 
 	listen, err := net.Listen("tcp", address)
 	if err != nil {
 		return fmt.Errorf("failed to listen: %w", err)
 	}
 
-	tlsConf, err := loadServerTLS()
+	var crl *auth.RevocationList
+	if len(crlPaths) > 0 {
+		crl, err = auth.LoadRevocationList(crlPaths...)
+		if err != nil {
+			return err
+		}
+		if auditLog != nil {
+			crl.OnReject(auditLog.RejectCertificate)
+		}
+	}
+
+	serverTLS, err := auth.LoadServerTLS(caPath, certPath, keyPath, crl)
 	if err != nil {
 		return err
 	}
+	go watchTLS(serverTLS, crl)
 
+	// The audit and rate limit interceptors come after the auth interceptors,
+	// which put the caller's identity in the context, and which pass the RPCs
+	// they reject to the audit log. The audit interceptors come before the
+	// rate limit ones, so that RPCs that are rate limited are recorded too.
+	limiter := ratelimit.New(policy.RateLimit)
+	var onReject auth.RejectFunc
+	if auditLog != nil {
+		onReject = auditLog.Reject
+	}
+	unary := []grpc.UnaryServerInterceptor{auth.NewUnaryInterceptor(mapper, onReject)}
+	stream := []grpc.StreamServerInterceptor{auth.NewStreamInterceptor(mapper, onReject)}
+	if auditLog != nil {
+		unary = append(unary, audit.NewUnaryInterceptor(auditLog))
+		stream = append(stream, audit.NewStreamInterceptor(auditLog))
+	}
+	unary = append(unary, ratelimit.NewUnaryInterceptor(limiter))
+	stream = append(stream, ratelimit.NewStreamInterceptor(limiter))
 	grpcServer := grpc.NewServer(
-		grpc.Creds(credentials.NewTLS(tlsConf)),
-		grpc.UnaryInterceptor(auth.UnaryInterceptor),
-		grpc.StreamInterceptor(auth.StreamInterceptor),
+		grpc.Creds(credentials.NewTLS(serverTLS.Config())),
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
 	)
 	pb.RegisterTeleWorkerServer(grpcServer, srv)
 
@@ -99,20 +297,96 @@ func runServer(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-func loadServerTLS() (*tls.Config, error) {
-	caCert, err := os.ReadFile(caPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+// watchTLS reloads the CA certificate and the server's certificate and key
+// when they change, checking every --tls-reload, and the certificate
+// revocation lists, if any, every --crl-refresh. Both are reloaded on SIGHUP.
+// Files that can not be loaded are logged and ignored, and the ones loaded
+// before are kept.
+func watchTLS(serverTLS *auth.ServerTLS, crl *auth.RevocationList) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	var tlsTick, crlTick <-chan time.Time
+	if tlsReload > 0 {
+		ticker := time.NewTicker(tlsReload)
+		defer ticker.Stop()
+		tlsTick = ticker.C
+	}
+	if crl != nil && crlRefresh > 0 {
+		ticker := time.NewTicker(crlRefresh)
+		defer ticker.Stop()
+		crlTick = ticker.C
 	}
+	for {
+		select {
+		case <-hup:
+			slog.Info("received SIGHUP, reloading certificates")
+			reloadTLS(serverTLS, serverTLS.Reload())
+			if crl != nil {
+				reloadCRL(crl)
+			}
+		case <-tlsTick:
+			if tried, err := serverTLS.ReloadIfChanged(); tried {
+				reloadTLS(serverTLS, err)
+			}
+		case <-crlTick:
+			reloadCRL(crl)
+		}
+	}
+}
 
-	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+// reloadTLS logs the result of reloading the server's certificates.
+func reloadTLS(serverTLS *auth.ServerTLS, err error) {
 	if err != nil {
-		return nil, fmt.Errorf("failed to load server certificate: %w", err)
+		slog.Warn(
+			"failed to reload server certificates, keeping the old ones",
+			"error", err,
+		)
+		return
 	}
+	slog.Info(
+		"reloaded server certificates",
+		"ca", caPath,
+		"cert", certPath,
+		"expires", serverTLS.Expires(),
+	)
+}
 
-	tlsConf, err := auth.ServerTLSConfig(caCert, cert)
+func reloadCRL(crl *auth.RevocationList) {
+	if err := crl.Reload(); err != nil {
+		slog.Warn(
+			"failed to reload certificate revocation lists, keeping the old ones",
+			"error", err,
+		)
+		return
+	}
+	slog.Info(
+		"reloaded certificate revocation lists",
+		"paths", crlPaths,
+	)
+}
+
+// cpuAllocator returns an allocator for the --exclusive-cpus pool, or nil if
+// it is not set. The pool must leave at least one CPU for other jobs.
+func cpuAllocator(mgr resources.Backend) (*resources.CPUAllocator, error) {
+	if exclusiveCPUs == "" {
+		return nil, nil
+	}
+	pool, err := resources.ParseCPUList(exclusiveCPUs)
 	if err != nil {
-		return nil, fmt.Errorf("failed to build TLS config: %w", err)
+		return nil, err
+	}
+	all, err := mgr.EffectiveCPUs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cpus: %w", err)
+	}
+	for _, cpu := range pool {
+		if !slices.Contains(all, cpu) {
+			return nil, fmt.Errorf("exclusive cpu %d is not available to teleworker (available: %s)", cpu, resources.FormatCPUList(all))
+		}
+	}
+	if len(pool) == len(all) {
+		return nil, fmt.Errorf("exclusive cpus %s must leave at least one cpu for other jobs", exclusiveCPUs)
 	}
-	return tlsConf, nil
+	return resources.NewCPUAllocator(pool, exclusiveCPUsQueue), nil
 }
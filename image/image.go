@@ -0,0 +1,287 @@
+// Package image reads OCI images from local disk and unpacks their layers so
+// that they can be mounted as a job's root filesystem.
+//
+// See: https://github.com/opencontainers/image-spec/blob/main/image-layout.md
+package image
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+const (
+	mediaTypeIndex      = "application/vnd.oci.image.index.v1+json"
+	mediaTypeDockerList = "application/vnd.docker.distribution.manifest.list.v2+json"
+
+	// maxMetadataSize caps how much of an index, manifest, or config blob we
+	// are willing to read into memory.
+	maxMetadataSize = 4 << 20
+)
+
+// Config holds the subset of the OCI image configuration that is needed to run
+// a job.
+// See: https://github.com/opencontainers/image-spec/blob/main/config.md
+type Config struct {
+	Entrypoint []string `json:"Entrypoint"`
+	Cmd        []string `json:"Cmd"`
+	Env        []string `json:"Env"`
+	WorkingDir string   `json:"WorkingDir"`
+	User       string   `json:"User"`
+}
+
+// Image is an OCI image whose layers have been unpacked to disk.
+type Image struct {
+	Layers []string // Unpacked layer directories, ordered from the top-most layer to the bottom-most layer.
+	Config Config   // Runtime configuration from the image config blob.
+}
+
+type platform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+}
+
+type descriptor struct {
+	MediaType string    `json:"mediaType"`
+	Digest    string    `json:"digest"`
+	Platform  *platform `json:"platform,omitempty"`
+}
+
+type index struct {
+	Manifests []descriptor `json:"manifests"`
+}
+
+type manifest struct {
+	Config descriptor   `json:"config"`
+	Layers []descriptor `json:"layers"`
+}
+
+// ErrInvalidName is returned by Resolve for image names that could name a
+// path outside of the image directory.
+var ErrInvalidName = errors.New("invalid image name")
+
+// Resolve returns the path of the image with the given name in dir. Names are
+// relative to dir, and may not be absolute or contain "..", so that callers
+// can only run the images an admin has put in dir. Symlinks in dir are
+// resolved as if dir were the root of the filesystem, so they can not lead
+// out of it either.
+func Resolve(dir, name string) (string, error) {
+	if name == "" || filepath.IsAbs(name) || slices.Contains(strings.Split(filepath.ToSlash(name), "/"), "..") {
+		return "", fmt.Errorf("%w: %q must be a path relative to the image directory, without \"..\"", ErrInvalidName, name)
+	}
+	return secureJoin(dir, name)
+}
+
+// Unpack reads the OCI image at src, which may either be an image layout
+// directory or a tarball of one, and unpacks each of its layers into cacheDir.
+// Unpacked layers are keyed by digest, so layers that are shared between images
+// are only unpacked once.
+func Unpack(src, cacheDir string) (*Image, error) {
+	l, err := openLayout(src)
+	if err != nil {
+		return nil, err
+	}
+	defer l.Close()
+
+	var idx index
+	if err := readJSON(l, "index.json", "", &idx); err != nil {
+		return nil, err
+	}
+
+	desc, err := selectManifest(l, idx.Manifests)
+	if err != nil {
+		return nil, err
+	}
+
+	var m manifest
+	if err := readBlobJSON(l, desc, &m); err != nil {
+		return nil, fmt.Errorf("failed to read image manifest: %w", err)
+	}
+
+	var cfg struct {
+		Config Config `json:"config"`
+	}
+	if err := readBlobJSON(l, m.Config, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to read image config: %w", err)
+	}
+
+	if len(m.Layers) == 0 {
+		return nil, errors.New("image has no layers")
+	}
+
+	if err := os.MkdirAll(cacheDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create layer cache directory: %w", err)
+	}
+
+	// Manifests list layers from the bottom-most to the top-most, while
+	// overlayfs expects the reverse.
+	layers := make([]string, len(m.Layers))
+	for i, d := range m.Layers {
+		dir, err := unpackLayer(l, d, cacheDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unpack layer %s: %w", d.Digest, err)
+		}
+		layers[len(m.Layers)-1-i] = dir
+	}
+
+	return &Image{Layers: layers, Config: cfg.Config}, nil
+}
+
+// selectManifest picks the image manifest to run from the descriptors of an
+// image index. Nested indexes (e.g. multi-platform images) are followed, and
+// a manifest for this host's platform is preferred.
+func selectManifest(l layout, descs []descriptor) (descriptor, error) {
+	var candidates []descriptor
+	for _, d := range descs {
+		if d.Platform != nil && (d.Platform.OS != "linux" || d.Platform.Architecture != runtime.GOARCH) {
+			continue
+		}
+		candidates = append(candidates, d)
+	}
+	if len(candidates) == 0 {
+		return descriptor{}, fmt.Errorf("image has no manifest for linux/%s", runtime.GOARCH)
+	}
+
+	d := candidates[0]
+	if d.MediaType == mediaTypeIndex || d.MediaType == mediaTypeDockerList {
+		var nested index
+		if err := readBlobJSON(l, d, &nested); err != nil {
+			return descriptor{}, fmt.Errorf("failed to read nested image index: %w", err)
+		}
+		return selectManifest(l, nested.Manifests)
+	}
+	return d, nil
+}
+
+// blobPath returns the path of a blob within an image layout, rejecting
+// digests that are not well formed sha256 digests.
+func blobPath(digest string) (string, error) {
+	algo, encoded, ok := strings.Cut(digest, ":")
+	if !ok || algo != "sha256" {
+		return "", fmt.Errorf("unsupported digest %q", digest)
+	}
+	if b, err := hex.DecodeString(encoded); err != nil || len(b) != sha256.Size {
+		return "", fmt.Errorf("malformed digest %q", digest)
+	}
+	return path.Join("blobs", algo, encoded), nil
+}
+
+// readBlobJSON reads the blob for d, verifies its digest, and decodes it into v.
+func readBlobJSON(l layout, d descriptor, v any) error {
+	name, err := blobPath(d.Digest)
+	if err != nil {
+		return err
+	}
+	return readJSON(l, name, d.Digest, v)
+}
+
+// readJSON decodes the file name from the layout into v. If digest is not
+// empty, the file's contents must match it.
+func readJSON(l layout, name, digest string, v any) error {
+	rc, err := l.open(name)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, maxMetadataSize+1))
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	if len(data) > maxMetadataSize {
+		return fmt.Errorf("%s exceeds %d bytes", name, maxMetadataSize)
+	}
+	if digest != "" {
+		sum := sha256.Sum256(data)
+		if "sha256:"+hex.EncodeToString(sum[:]) != digest {
+			return fmt.Errorf("%s does not match its digest", name)
+		}
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	return nil
+}
+
+// layout provides access to the files of an OCI image layout.
+type layout interface {
+	// open returns a reader for the file at name, which is a slash separated
+	// path relative to the root of the layout. Only one reader may be open at
+	// a time.
+	open(name string) (io.ReadCloser, error)
+	Close() error
+}
+
+// openLayout returns a layout for src, which is either a directory or a tar
+// archive of an image layout, such as one produced by `skopeo copy
+// oci-archive:...` or `docker save`.
+func openLayout(src string) (layout, error) {
+	fi, err := os.Stat(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open image: %w", err)
+	}
+	if fi.IsDir() {
+		return dirLayout(src), nil
+	}
+	f, err := os.Open(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open image: %w", err)
+	}
+	return &tarLayout{f: f}, nil
+}
+
+// dirLayout is an image layout stored as a directory.
+type dirLayout string
+
+func (d dirLayout) open(name string) (io.ReadCloser, error) {
+	f, err := os.Open(filepath.Join(string(d), filepath.FromSlash(name)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	return f, nil
+}
+
+func (d dirLayout) Close() error {
+	return nil
+}
+
+// tarLayout is an image layout stored as an uncompressed tar archive. Rather
+// than extracting the archive to a temporary directory, each call to open scans
+// the archive from the start for the requested entry. An image only has a
+// handful of blobs, so this is cheaper than copying every layer to disk twice.
+type tarLayout struct {
+	f *os.File
+}
+
+func (t *tarLayout) open(name string) (io.ReadCloser, error) {
+	if _, err := t.f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(t.f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s not found in image archive", name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read image archive: %w", err)
+		}
+		if path.Clean(strings.TrimPrefix(hdr.Name, "./")) == name && hdr.Typeflag == tar.TypeReg {
+			return io.NopCloser(tr), nil
+		}
+	}
+}
+
+func (t *tarLayout) Close() error {
+	return t.f.Close()
+}
@@ -0,0 +1,283 @@
+package image_test
+
+import (
+	"archive/tar"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"go.uber.org/goleak"
+	"golang.org/x/sys/unix"
+
+	"github.com/kkloberdanz/teleworker/image"
+	"github.com/kkloberdanz/teleworker/testutil"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+func TestUnpackLayoutDir(t *testing.T) {
+	cfg := image.Config{
+		Entrypoint: []string{"/bin/app"},
+		Cmd:        []string{"--serve"},
+		Env:        []string{"PATH=/bin"},
+		WorkingDir: "/srv",
+		User:       "app",
+	}
+	src := testutil.WriteImage(t, cfg,
+		[]testutil.ImageFile{
+			{Name: "bin/", Typeflag: tar.TypeDir, Mode: 0755},
+			{Name: "bin/app", Body: []byte("base"), Mode: 0755},
+		},
+		[]testutil.ImageFile{
+			{Name: "bin/app", Body: []byte("top"), Mode: 0755},
+			{Name: "bin/sh", Typeflag: tar.TypeSymlink, Linkname: "app"},
+		},
+	)
+
+	img, err := image.Unpack(src, t.TempDir())
+	if err != nil {
+		t.Fatalf("Unpack failed: %v", err)
+	}
+
+	if len(img.Layers) != 2 {
+		t.Fatalf("expected 2 layers, got %d", len(img.Layers))
+	}
+	// Layers are returned top-most first.
+	top, err := os.ReadFile(filepath.Join(img.Layers[0], "bin", "app"))
+	if err != nil {
+		t.Fatalf("failed to read top layer: %v", err)
+	}
+	if string(top) != "top" {
+		t.Fatalf("expected top layer first, got %q", top)
+	}
+	if link, err := os.Readlink(filepath.Join(img.Layers[0], "bin", "sh")); err != nil || link != "app" {
+		t.Fatalf("expected symlink to %q, got %q (%v)", "app", link, err)
+	}
+
+	if !slices.Equal(img.Config.Entrypoint, cfg.Entrypoint) || !slices.Equal(img.Config.Cmd, cfg.Cmd) {
+		t.Fatalf("config mismatch: got %+v", img.Config)
+	}
+	if img.Config.WorkingDir != "/srv" || img.Config.User != "app" {
+		t.Fatalf("config mismatch: got %+v", img.Config)
+	}
+}
+
+func TestUnpackTarball(t *testing.T) {
+	src := testutil.TarDir(t, testutil.WriteImage(t, image.Config{Cmd: []string{"true"}},
+		[]testutil.ImageFile{{Name: "hello", Body: []byte("world")}},
+	))
+
+	img, err := image.Unpack(src, t.TempDir())
+	if err != nil {
+		t.Fatalf("Unpack failed: %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join(img.Layers[0], "hello"))
+	if err != nil {
+		t.Fatalf("failed to read unpacked file: %v", err)
+	}
+	if string(got) != "world" {
+		t.Fatalf("expected %q, got %q", "world", got)
+	}
+}
+
+func TestUnpackReusesCachedLayers(t *testing.T) {
+	cacheDir := t.TempDir()
+	layer := []testutil.ImageFile{{Name: "shared", Body: []byte("data")}}
+
+	first, err := image.Unpack(testutil.WriteImage(t, image.Config{Cmd: []string{"a"}}, layer), cacheDir)
+	if err != nil {
+		t.Fatalf("Unpack failed: %v", err)
+	}
+	second, err := image.Unpack(testutil.WriteImage(t, image.Config{Cmd: []string{"b"}}, layer), cacheDir)
+	if err != nil {
+		t.Fatalf("Unpack failed: %v", err)
+	}
+	if first.Layers[0] != second.Layers[0] {
+		t.Fatalf("expected shared layer to be reused, got %q and %q", first.Layers[0], second.Layers[0])
+	}
+}
+
+func TestUnpackDigestMismatch(t *testing.T) {
+	src := testutil.WriteImage(t, image.Config{}, []testutil.ImageFile{{Name: "f", Body: []byte("x")}})
+
+	// Corrupt every blob so that the manifest no longer matches its digest.
+	blobs, err := filepath.Glob(filepath.Join(src, "blobs", "sha256", "*"))
+	if err != nil {
+		t.Fatalf("glob failed: %v", err)
+	}
+	for _, blob := range blobs {
+		if err := os.WriteFile(blob, []byte("{}"), 0644); err != nil {
+			t.Fatalf("failed to corrupt blob: %v", err)
+		}
+	}
+
+	if _, err := image.Unpack(src, t.TempDir()); err == nil {
+		t.Fatal("expected error for corrupted image, got nil")
+	}
+}
+
+func TestUnpackSymlinkCannotEscape(t *testing.T) {
+	outside := t.TempDir()
+	src := testutil.WriteImage(t, image.Config{},
+		[]testutil.ImageFile{
+			{Name: "escape", Typeflag: tar.TypeSymlink, Linkname: outside},
+			{Name: "escape/pwned", Body: []byte("oops")},
+		},
+	)
+
+	img, err := image.Unpack(src, t.TempDir())
+	if err != nil {
+		t.Fatalf("Unpack failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "pwned")); err == nil {
+		t.Fatal("layer wrote through a symlink outside of the layer directory")
+	}
+	if _, err := os.Stat(filepath.Join(img.Layers[0], outside, "pwned")); err != nil {
+		t.Fatalf("expected file to be written inside the layer: %v", err)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	dir := t.TempDir()
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(dir, "link")); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		image   string
+		want    string
+		wantErr bool
+	}{
+		{"name", "alpine.tar", filepath.Join(dir, "alpine.tar"), false},
+		{"nested name", "team/alpine", filepath.Join(dir, "team", "alpine"), false},
+		// A symlink is resolved inside dir, rather than leading out of it.
+		{"symlink", "link/alpine.tar", filepath.Join(dir, outside, "alpine.tar"), false},
+		{"empty", "", "", true},
+		{"absolute", "/srv/images/alpine.tar", "", true},
+		{"parent", "../alpine.tar", "", true},
+		{"inner parent", "team/../../alpine.tar", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := image.Resolve(dir, tt.image)
+			if tt.wantErr {
+				if !errors.Is(err, image.ErrInvalidName) {
+					t.Fatalf("expected ErrInvalidName, got %q, %v", got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("expected %q, got %q, %v", tt.want, got, err)
+			}
+		})
+	}
+}
+
+func TestUnpackWhiteouts(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("skipping: requires root")
+	}
+
+	src := testutil.WriteImage(t, image.Config{},
+		[]testutil.ImageFile{
+			{Name: "gone", Body: []byte("x")},
+			{Name: "dir/old", Body: []byte("x")},
+		},
+		[]testutil.ImageFile{
+			{Name: ".wh.gone"},
+			{Name: "dir/.wh..wh..opq"},
+			{Name: "dir/new", Body: []byte("x")},
+		},
+	)
+
+	img, err := image.Unpack(src, t.TempDir())
+	if err != nil {
+		t.Fatalf("Unpack failed: %v", err)
+	}
+
+	var st unix.Stat_t
+	if err := unix.Lstat(filepath.Join(img.Layers[0], "gone"), &st); err != nil {
+		t.Fatalf("expected whiteout device: %v", err)
+	}
+	if st.Mode&unix.S_IFMT != unix.S_IFCHR || st.Rdev != 0 {
+		t.Fatalf("expected 0:0 character device, got mode %o rdev %d", st.Mode, st.Rdev)
+	}
+
+	buf := make([]byte, 1)
+	if _, err := unix.Getxattr(filepath.Join(img.Layers[0], "dir"), "trusted.overlay.opaque", buf); err != nil || buf[0] != 'y' {
+		t.Fatalf("expected opaque xattr on dir: %v", err)
+	}
+}
+
+func TestResolveUser(t *testing.T) {
+	rootfs := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(rootfs, "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	passwd := "root:x:0:0:root:/root:/bin/sh\napp:x:1000:1001::/home/app:/bin/sh\n"
+	group := "root:x:0:\nstaff:x:50:\n"
+	if err := os.WriteFile(filepath.Join(rootfs, "etc", "passwd"), []byte(passwd), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(rootfs, "etc", "group"), []byte(group), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		spec    string
+		uid     uint32
+		gid     uint32
+		wantErr bool
+	}{
+		{"", 0, 0, false},
+		{"app", 1000, 1001, false},
+		{"1000", 1000, 1001, false},
+		{"2000", 2000, 0, false},
+		{"app:staff", 1000, 50, false},
+		{"app:7", 1000, 7, false},
+		{"nobody", 0, 0, true},
+		{"app:nogroup", 0, 0, true},
+	}
+	for _, tt := range tests {
+		uid, gid, err := image.ResolveUser(rootfs, tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ResolveUser(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if uid != tt.uid || gid != tt.gid {
+			t.Errorf("ResolveUser(%q) = %d:%d, want %d:%d", tt.spec, uid, gid, tt.uid, tt.gid)
+		}
+	}
+}
+
+func TestLookPath(t *testing.T) {
+	rootfs := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(rootfs, "usr", "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(rootfs, "usr", "bin", "tool"), nil, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// Absolute symlinks must resolve within the rootfs, not on the host.
+	if err := os.Symlink("/usr/bin", filepath.Join(rootfs, "bin")); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := image.LookPath(rootfs, "tool", "/bin")
+	if err != nil {
+		t.Fatalf("LookPath failed: %v", err)
+	}
+	if got != "/bin/tool" {
+		t.Fatalf("expected %q, got %q", "/bin/tool", got)
+	}
+
+	if _, err := image.LookPath(rootfs, "missing", "/bin:/usr/bin"); err == nil {
+		t.Fatal("expected error for missing executable, got nil")
+	}
+}
@@ -0,0 +1,133 @@
+package image
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// LookPath searches for file in the directories listed in pathEnv, resolving
+// paths within rootfs rather than on the host. If file contains a slash, it is
+// returned as is. The returned path is relative to rootfs, so it can be used
+// once the process has been chrooted into rootfs.
+func LookPath(rootfs, file, pathEnv string) (string, error) {
+	if strings.Contains(file, "/") {
+		return file, nil
+	}
+	for _, dir := range filepath.SplitList(pathEnv) {
+		if dir == "" {
+			dir = "."
+		}
+		candidate := filepath.Join(dir, file)
+		resolved, err := secureJoin(rootfs, candidate)
+		if err != nil {
+			continue
+		}
+		fi, err := os.Stat(resolved)
+		if err != nil || !fi.Mode().IsRegular() || fi.Mode()&0111 == 0 {
+			continue
+		}
+		return candidate, nil
+	}
+	return "", fmt.Errorf("%s: executable file not found in image $PATH", file)
+}
+
+// ResolveUser converts an image config User field into a uid and gid. The
+// field may be empty (root), "user", "user:group", "uid" or "uid:gid", where
+// names are looked up in rootfs's /etc/passwd and /etc/group.
+func ResolveUser(rootfs, spec string) (uid, gid uint32, err error) {
+	if spec == "" {
+		return 0, 0, nil
+	}
+	user, group, hasGroup := strings.Cut(spec, ":")
+
+	// Each /etc/passwd line is name:password:uid:gid:gecos:home:shell.
+	passwd, err := readColonFile(rootfs, "/etc/passwd")
+	if err != nil {
+		return 0, 0, err
+	}
+	found := false
+	if n, err := strconv.ParseUint(user, 10, 32); err == nil {
+		// A numeric uid does not need to exist in /etc/passwd, but if it
+		// does, use its primary group.
+		uid = uint32(n)
+		found = true
+		for _, fields := range passwd {
+			if len(fields) > 3 && fields[2] == user {
+				gid, _ = parseID(fields[3])
+				break
+			}
+		}
+	} else {
+		for _, fields := range passwd {
+			if len(fields) > 3 && fields[0] == user {
+				var uidOK, gidOK bool
+				uid, uidOK = parseID(fields[2])
+				gid, gidOK = parseID(fields[3])
+				found = uidOK && gidOK
+				break
+			}
+		}
+	}
+	if !found {
+		return 0, 0, fmt.Errorf("user %q not found in image", user)
+	}
+
+	if !hasGroup {
+		return uid, gid, nil
+	}
+	if n, err := strconv.ParseUint(group, 10, 32); err == nil {
+		return uid, uint32(n), nil
+	}
+
+	// Each /etc/group line is name:password:gid:members.
+	groups, err := readColonFile(rootfs, "/etc/group")
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, fields := range groups {
+		if len(fields) > 2 && fields[0] == group {
+			if gid, ok := parseID(fields[2]); ok {
+				return uid, gid, nil
+			}
+		}
+	}
+	return 0, 0, fmt.Errorf("group %q not found in image", group)
+}
+
+func parseID(s string) (uint32, bool) {
+	n, err := strconv.ParseUint(s, 10, 32)
+	return uint32(n), err == nil
+}
+
+// readColonFile reads a colon separated database such as /etc/passwd from
+// rootfs. A missing file is treated as empty.
+func readColonFile(rootfs, name string) ([][]string, error) {
+	resolved, err := secureJoin(rootfs, name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(resolved)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries [][]string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entries = append(entries, strings.Split(line, ":"))
+	}
+	return entries, scanner.Err()
+}
@@ -0,0 +1,276 @@
+package image
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// Whiteout files mark deletions of files in lower layers. See:
+	// https://github.com/opencontainers/image-spec/blob/main/layer.md#whiteouts
+	whiteoutPrefix = ".wh."
+	whiteoutOpaque = ".wh..wh..opq"
+
+	// maxSymlinks bounds how many symlinks secureJoin will follow, matching
+	// the limit used by the Linux kernel (MAXSYMLINKS).
+	maxSymlinks = 40
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// unpackLayer extracts the layer described by d into a directory under
+// cacheDir named after its digest, and returns that directory. If the layer has
+// already been unpacked, the existing directory is returned.
+func unpackLayer(l layout, d descriptor, cacheDir string) (string, error) {
+	name, err := blobPath(d.Digest)
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(cacheDir, filepath.Base(name))
+	if _, err := os.Stat(dir); err == nil {
+		return dir, nil
+	}
+
+	// Unpack into a temporary directory and rename it into place once it is
+	// complete, so that a partially unpacked layer is never used, and so that
+	// concurrent jobs using the same image do not trample each other.
+	tmp, err := os.MkdirTemp(cacheDir, ".unpack-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+
+	rc, err := l.open(name)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	h := sha256.New()
+	br := bufio.NewReader(io.TeeReader(rc, h))
+	magic, _ := br.Peek(4)
+
+	var r io.Reader = br
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return "", err
+		}
+		defer gz.Close()
+		r = gz
+	case bytes.HasPrefix(magic, zstdMagic):
+		return "", errors.New("zstd compressed layers are not supported")
+	}
+
+	if err := extract(tar.NewReader(r), tmp); err != nil {
+		return "", err
+	}
+
+	// The tar stream may end before the end of the blob (e.g. padding or the
+	// gzip trailer), so drain the rest of it to finish computing the digest.
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(io.Discard, br); err != nil {
+		return "", err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != filepath.Base(name) {
+		return "", fmt.Errorf("layer does not match its digest (got sha256:%s)", got)
+	}
+
+	if err := os.Rename(tmp, dir); err != nil {
+		// Another job may have unpacked the same layer concurrently.
+		if _, statErr := os.Stat(dir); statErr == nil {
+			return dir, nil
+		}
+		return "", err
+	}
+	return dir, nil
+}
+
+// extract writes the entries of tr under root. Whiteout entries are converted
+// to the representation used by overlayfs so that the unpacked layer can be
+// used directly as an overlay lower directory.
+func extract(tr *tar.Reader, root string) error {
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read layer: %w", err)
+		}
+
+		clean := filepath.Clean(string(filepath.Separator) + hdr.Name)
+		if clean == string(filepath.Separator) {
+			continue
+		}
+		parent, err := secureJoin(root, filepath.Dir(clean))
+		if err != nil {
+			return err
+		}
+		base := filepath.Base(clean)
+		target := filepath.Join(parent, base)
+
+		if err := os.MkdirAll(parent, 0755); err != nil {
+			return err
+		}
+
+		// An opaque whiteout hides everything from lower layers in this
+		// directory, and a regular whiteout hides a single file. overlayfs
+		// represents these as an xattr and a 0:0 character device.
+		if base == whiteoutOpaque {
+			if err := unix.Setxattr(parent, "trusted.overlay.opaque", []byte("y"), 0); err != nil {
+				return fmt.Errorf("failed to mark %s opaque: %w", hdr.Name, err)
+			}
+			continue
+		}
+		if strings.HasPrefix(base, whiteoutPrefix) {
+			hidden := filepath.Join(parent, strings.TrimPrefix(base, whiteoutPrefix))
+			if err := unix.Mknod(hidden, unix.S_IFCHR, 0); err != nil {
+				return fmt.Errorf("failed to create whiteout for %s: %w", hdr.Name, err)
+			}
+			continue
+		}
+
+		// Later entries replace earlier ones with the same name, except that
+		// a directory entry for an existing directory only updates metadata.
+		if fi, err := os.Lstat(target); err == nil && !(fi.IsDir() && hdr.Typeflag == tar.TypeDir) {
+			if err := os.RemoveAll(target); err != nil {
+				return err
+			}
+		}
+
+		mode := uint32(hdr.Mode) & 07777
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.Mkdir(target, 0755); err != nil && !errors.Is(err, os.ErrExist) {
+				return err
+			}
+		case tar.TypeReg:
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			// The link target is deliberately not validated. It is only
+			// interpreted once the job has been chrooted into the rootfs.
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+		case tar.TypeLink:
+			linkClean := filepath.Clean(string(filepath.Separator) + hdr.Linkname)
+			linkParent, err := secureJoin(root, filepath.Dir(linkClean))
+			if err != nil {
+				return err
+			}
+			if err := os.Link(filepath.Join(linkParent, filepath.Base(linkClean)), target); err != nil {
+				return err
+			}
+		case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+			var typ uint32
+			switch hdr.Typeflag {
+			case tar.TypeChar:
+				typ = unix.S_IFCHR
+			case tar.TypeBlock:
+				typ = unix.S_IFBLK
+			default:
+				typ = unix.S_IFIFO
+			}
+			dev := int(unix.Mkdev(uint32(hdr.Devmajor), uint32(hdr.Devminor)))
+			if err := unix.Mknod(target, typ|mode, dev); err != nil {
+				return err
+			}
+		default:
+			// Other entry types (e.g. GNU sparse files) are not expected in
+			// image layers, so skip them.
+			continue
+		}
+
+		if err := os.Lchown(target, hdr.Uid, hdr.Gid); err != nil {
+			return err
+		}
+		// Set the mode after changing the owner, since chown clears the
+		// setuid and setgid bits. Symlinks do not have a mode of their own.
+		if hdr.Typeflag != tar.TypeSymlink {
+			if err := unix.Chmod(target, mode); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// secureJoin joins name onto root, resolving any symlinks along the way as if
+// root were the root of the filesystem. Without this, a layer could contain a
+// symlink that points outside of root followed by an entry that writes through
+// that symlink onto the host.
+func secureJoin(root, name string) (string, error) {
+	pending := strings.Split(filepath.ToSlash(name), "/")
+	var resolved []string
+	links := 0
+	for len(pending) > 0 {
+		part := pending[0]
+		pending = pending[1:]
+
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			if len(resolved) > 0 {
+				resolved = resolved[:len(resolved)-1]
+			}
+			continue
+		}
+
+		next := filepath.Join(root, filepath.Join(resolved...), part)
+		fi, err := os.Lstat(next)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				resolved = append(resolved, part)
+				continue
+			}
+			return "", err
+		}
+		if fi.Mode()&os.ModeSymlink == 0 {
+			resolved = append(resolved, part)
+			continue
+		}
+
+		links++
+		if links > maxSymlinks {
+			return "", fmt.Errorf("too many levels of symbolic links in %s", name)
+		}
+		dest, err := os.Readlink(next)
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(dest) {
+			resolved = resolved[:0]
+		}
+		pending = append(strings.Split(filepath.ToSlash(dest), "/"), pending...)
+	}
+	return filepath.Join(append([]string{root}, resolved...)...), nil
+}
@@ -0,0 +1,209 @@
+package job
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// initArg is the argv[0] teleworker uses when it re-executes itself as a job
+// init process.
+const initArg = "teleworker-init"
+
+// Go's os/exec can not run code between fork and exec, so setup that the
+// kernel only allows from inside the job's namespaces, such as setting its
+// hostname, is done by a job init process. This is teleworker itself,
+// re-executed from /proc/self/exe, which reads an initConfig from a pipe,
+// applies it and then execs the job's command. The init process is only used
+// when a job needs it, otherwise the command is started directly.
+//
+// The init process reports errors on a second pipe, which is closed on exec,
+// so that Start fails the same way it would if the command could not be
+// started.
+
+// initConfig is sent from teleworker to the job init process.
+type initConfig struct {
+	Path          string              // Executable path, relative to Root if set.
+	SHA256        string              // Hex SHA-256 hash the executable must have: empty for any. See pinExecutable.
+	Args          []string            // Command line, including argv[0].
+	Env           []string            // Environment for the command: `nil` inherits the teleworker environment.
+	Root          string              // Directory to chroot into: empty to run on the host filesystem.
+	Dir           string              // Working directory, relative to Root if set.
+	Cred          *syscall.Credential // User and group to run as: `nil` runs as the teleworker user.
+	Hostname      string              // Hostname to set: empty to keep the current hostname.
+	PrivateMounts bool                // If true, stop mounts made by the job from propagating back to the host.
+	Rlimits       Rlimits             // Resource limits to set.
+	Landlock      *Landlock           // Landlock ruleset to enforce: `nil` for none.
+	LandlockABI   int                 // Landlock ABI version supported by the kernel.
+}
+
+const (
+	initConfigFD = 3 // cmd.ExtraFiles[0]
+	initErrorFD  = 4 // cmd.ExtraFiles[1]
+)
+
+// Init runs the job init process if the current process was started as one.
+// In that case Init does not return. Programs that start jobs which use the
+// init process must call Init at the start of main, and tests must call it at
+// the start of TestMain.
+func Init() {
+	if len(os.Args) == 0 || os.Args[0] != initArg {
+		return
+	}
+
+	errPipe := os.NewFile(initErrorFD, "init-error")
+	if err := runInit(); err != nil {
+		fmt.Fprint(errPipe, err.Error())
+		os.Exit(127)
+	}
+	// runInit only returns if exec failed.
+	os.Exit(127)
+}
+
+func runInit() error {
+	unix.CloseOnExec(initErrorFD)
+
+	var cfg initConfig
+	if err := json.NewDecoder(os.NewFile(initConfigFD, "init-config")).Decode(&cfg); err != nil {
+		return fmt.Errorf("failed to read init config: %w", err)
+	}
+	unix.Close(initConfigFD)
+
+	if cfg.Hostname != "" {
+		if err := unix.Sethostname([]byte(cfg.Hostname)); err != nil {
+			return fmt.Errorf("failed to set hostname: %w", err)
+		}
+	}
+	if cfg.PrivateMounts {
+		if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_SLAVE, ""); err != nil {
+			return fmt.Errorf("failed to make mounts private: %w", err)
+		}
+	}
+	if cfg.Root != "" {
+		if err := unix.Chroot(cfg.Root); err != nil {
+			return fmt.Errorf("failed to chroot: %w", err)
+		}
+		if err := unix.Chdir("/"); err != nil {
+			return fmt.Errorf("failed to chdir: %w", err)
+		}
+	}
+	if cfg.Dir != "" {
+		if err := unix.Chdir(cfg.Dir); err != nil {
+			return fmt.Errorf("failed to chdir: %w", err)
+		}
+	}
+	// The executable is copied before rlimits, such as fsize, and Landlock
+	// could stop the copy.
+	var exe *os.File
+	if cfg.SHA256 != "" {
+		var err error
+		if exe, err = pinExecutable(cfg.Path, cfg.SHA256); err != nil {
+			return err
+		}
+	}
+	if err := cfg.Rlimits.apply(); err != nil {
+		return err
+	}
+	if cfg.Landlock != nil {
+		if err := cfg.Landlock.restrict(cfg.LandlockABI); err != nil {
+			return err
+		}
+	}
+	if cfg.Cred != nil {
+		if !cfg.Cred.NoSetGroups {
+			groups := make([]int, len(cfg.Cred.Groups))
+			for i, g := range cfg.Cred.Groups {
+				groups[i] = int(g)
+			}
+			if err := syscall.Setgroups(groups); err != nil {
+				return fmt.Errorf("failed to set groups: %w", err)
+			}
+		}
+		if err := syscall.Setgid(int(cfg.Cred.Gid)); err != nil {
+			return fmt.Errorf("failed to set gid: %w", err)
+		}
+		if err := syscall.Setuid(int(cfg.Cred.Uid)); err != nil {
+			return fmt.Errorf("failed to set uid: %w", err)
+		}
+		// Changing credentials clears the parent death signal, so set it
+		// again.
+		if err := unix.Prctl(unix.PR_SET_PDEATHSIG, uintptr(syscall.SIGKILL), 0, 0, 0); err != nil {
+			return fmt.Errorf("failed to set parent death signal: %w", err)
+		}
+	}
+
+	env := cfg.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	if exe != nil {
+		return fmt.Errorf("failed to exec %s: %w", cfg.Path, execveat(exe.Fd(), cfg.Args, env))
+	}
+	if err := syscall.Exec(cfg.Path, cfg.Args, env); err != nil {
+		return fmt.Errorf("failed to exec %s: %w", cfg.Path, err)
+	}
+	return nil
+}
+
+// startWithInit starts cmd through the job init process, which applies cfg
+// before executing the command. The root, working directory and credentials
+// are applied by the init process, so they must not be set on cmd. started is
+// called once the init process is running, before it executes the command.
+func startWithInit(cmd *exec.Cmd, cfg initConfig, started func(*os.Process) error) error {
+	if cmd.Err != nil {
+		return cmd.Err
+	}
+	configR, configW, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer configR.Close()
+	defer configW.Close()
+	errR, errW, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer errR.Close()
+	defer errW.Close()
+
+	cmd.Path = "/proc/self/exe"
+	cmd.Args = []string{initArg}
+	cmd.ExtraFiles = []*os.File{configR, errW}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	// Close our copies of the child's ends, so that reading errR returns
+	// once the child has exec'd or exited.
+	configR.Close()
+	errW.Close()
+
+	// The init process waits for its config, so the command can not run
+	// before started returns.
+	if err := started(cmd.Process); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+
+	encodeErr := json.NewEncoder(configW).Encode(cfg)
+	configW.Close()
+
+	msg, readErr := io.ReadAll(errR)
+	if len(msg) == 0 && encodeErr == nil && readErr == nil {
+		return nil
+	}
+
+	// The init process failed, so reap it before reporting the error.
+	cmd.Process.Kill()
+	cmd.Wait()
+	if len(msg) > 0 {
+		return errors.New(string(msg))
+	}
+	return errors.Join(encodeErr, readErr)
+}
@@ -0,0 +1,52 @@
+package job
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+)
+
+// Isolation is the isolation profile for a job. It selects the namespaces the
+// job runs in, in addition to the PID namespace that every job runs in. The
+// zero value shares the hostname, SysV IPC and mounts with teleworker.
+type Isolation struct {
+	UTS      bool   // Run in a new UTS namespace with its own hostname.
+	Hostname string // Hostname of the job when UTS is set. Defaults to the job ID.
+	IPC      bool   // Run in a new IPC namespace, so that the job cannot see SysV IPC objects or POSIX message queues of teleworker or other jobs.
+	Mount    bool   // Run in a new mount namespace, so that mounts made by the job are not visible to teleworker or other jobs.
+}
+
+// ParseIsolation builds an isolation profile from a list of namespace names:
+// "uts", "ipc" and "mount".
+func ParseIsolation(names []string) (Isolation, error) {
+	var iso Isolation
+	for _, name := range names {
+		switch strings.TrimSpace(name) {
+		case "uts":
+			iso.UTS = true
+		case "ipc":
+			iso.IPC = true
+		case "mount":
+			iso.Mount = true
+		default:
+			return Isolation{}, fmt.Errorf("unknown namespace %q (expected \"uts\", \"ipc\" or \"mount\")", name)
+		}
+	}
+	return iso, nil
+}
+
+// cloneflags returns the namespace flags for the profile, including
+// CLONE_NEWPID.
+func (iso Isolation) cloneflags() uintptr {
+	flags := uintptr(syscall.CLONE_NEWPID)
+	if iso.UTS {
+		flags |= syscall.CLONE_NEWUTS
+	}
+	if iso.IPC {
+		flags |= syscall.CLONE_NEWIPC
+	}
+	if iso.Mount {
+		flags |= syscall.CLONE_NEWNS
+	}
+	return flags
+}
@@ -7,11 +7,16 @@ import (
 
 	"github.com/kkloberdanz/teleworker/output"
 	"github.com/kkloberdanz/teleworker/resources"
+	"github.com/kkloberdanz/teleworker/workspace"
 )
 
 // ErrJobNotRunning is returned when attempting to stop a non-running job.
 var ErrJobNotRunning = errors.New("job not running")
 
+// ErrNoCgroup is returned when asking for the resource usage of a job that is
+// running without a cgroup.
+var ErrNoCgroup = errors.New("job has no cgroup")
+
 // Status represents the current state of a job.
 type Status int
 
@@ -28,17 +33,45 @@ const (
 	StatusKilled
 )
 
+// TerminationReason describes why a job stopped running.
+type TerminationReason int
+
+const (
+	// TerminationUnspecified is used while a job has not yet terminated.
+	TerminationUnspecified TerminationReason = iota
+	// TerminationExited means the job's process exited on its own, whether
+	// or not it succeeded.
+	TerminationExited
+	// TerminationSignaled means the job's process was killed by a signal
+	// that did not come from teleworker.
+	TerminationSignaled
+	// TerminationOOMKilled means the kernel's OOM killer killed a process
+	// in the job because the job reached its memory limit.
+	TerminationOOMKilled
+	// TerminationTimedOut means the job ran past its time limit.
+	//
+	// TODO: Jobs do not have time limits yet, so this is never set.
+	TerminationTimedOut
+	// TerminationStoppedByUser means the job was stopped through StopJob.
+	TerminationStoppedByUser
+)
+
 // JobType identifies the kind of job to run.
 type JobType int
 
 const (
 	JobTypeLocal JobType = 1
+	JobTypeOCI   JobType = 2
 )
 
 // StatusResult holds the status and optional exit code for a job.
 type StatusResult struct {
-	Status   Status
-	ExitCode *int
+	Status      Status
+	ExitCode    *int
+	Reason      TerminationReason // Why the job stopped running. TerminationUnspecified while it is running.
+	PidsMaxHits int64             // Number of times a process in the job failed to fork because the job reached its pids.max limit.
+	Usage       *resources.Usage  // Resources the job used over its lifetime: `nil` while it is running, or if it ran without a cgroup.
+	Cpuset      resources.Cpuset  // CPUs and memory nodes the job is pinned to: empty if it is not pinned or has not started.
 }
 
 // Job is the interface that all job types must implement.
@@ -49,21 +82,34 @@ type Job interface {
 	Stop() error
 	Wait()
 	Output() *output.Buffer
+	Stats() (*resources.Stats, error)
 }
 
 // Options configures job construction.
 type Options struct {
 	NoCleanup bool              // If true, skip cgroup cleanup when the job exits. This is used for testing purposes.
-	Cgroup    *resources.Cgroup // Resource limits for the job. nil if running without cgroups.
+	Cgroup    resources.Cgroup  // Resource limits for the job. nil if running without cgroups.
+	Image     string            // Path to an OCI image layout directory or tarball. Only used by JobTypeOCI.
+	DataDir   string            // Directory for unpacked image layers and per-job root filesystems. Only used by JobTypeOCI.
+	Workspace *workspace.Config // Copy-on-write working directory for the job. nil runs in teleworker's working directory. Only used by JobTypeLocal, since OCI jobs already have a copy-on-write root filesystem.
+	Isolation Isolation         // Namespaces to run the job in, in addition to its PID namespace.
+	Landlock  *Landlock         // Filesystem access rules for the job. nil allows access to any file the job's user can access.
+	Rlimits   Rlimits           // POSIX resource limits for each process in the job.
+	SHA256    string            // Hex SHA-256 hash the executable must have, checked on the copy that is executed, e.g. from auth.Policy.CheckCommand. Only used by JobTypeLocal.
+	Limits    resources.Limits  // Cgroup limits for the job. Unset limits use the worker's defaults. Applied by the worker when it creates the cgroup.
+	Exclusive int               // Number of CPUs to dedicate to the job, from the worker's exclusive CPU pool. Can not be combined with Limits.Cpuset.CPUs.
 }
 
-// NewJob will return a job type that implements the Job interface. Currently,
-// only local jobs are supported, but this can be extended to support Docker
-// jobs.
+// NewJob will return a job type that implements the Job interface. Local jobs
+// run programs installed on the host, while OCI jobs run programs from an OCI
+// image that is already on the host's disk.
+//
+// For OCI jobs, command and args override the image's Cmd, and are appended to
+// the image's Entrypoint. If command is empty, the image's Cmd is used.
 func NewJob(jobType JobType, id, command string, args []string, opts Options) (Job, error) {
 	switch jobType {
 	case JobTypeLocal:
-		return &localJob{
+		l := &localJob{
 			id:        id,
 			command:   command,
 			args:      args,
@@ -71,7 +117,22 @@ func NewJob(jobType JobType, id, command string, args []string, opts Options) (J
 			cgroup:    opts.Cgroup,
 			noCleanup: opts.NoCleanup,
 			output:    output.NewBuffer(),
-		}, nil
+			isolation: opts.Isolation,
+			landlock:  opts.Landlock,
+			rlimits:   opts.Rlimits,
+			sha256:    opts.SHA256,
+		}
+		if opts.Workspace != nil {
+			ws, err := workspace.New(*opts.Workspace, id)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create workspace: %w", err)
+			}
+			l.workspace = ws
+			l.dir = ws.Path()
+		}
+		return l, nil
+	case JobTypeOCI:
+		return newOCIJob(id, command, args, opts)
 	default:
 		return nil, fmt.Errorf("unknown job type: %d", jobType)
 	}
@@ -1,12 +1,30 @@
 package job
 
 import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 
 	"go.uber.org/goleak"
+
+	"github.com/kkloberdanz/teleworker/image"
+	"github.com/kkloberdanz/teleworker/resources"
+	"github.com/kkloberdanz/teleworker/resources/fake"
+	"github.com/kkloberdanz/teleworker/testutil"
+	"github.com/kkloberdanz/teleworker/workspace"
 )
 
 func TestMain(m *testing.M) {
+	Init()
 	goleak.VerifyTestMain(m)
 }
 
@@ -43,9 +61,520 @@ func TestStartCalledTwice(t *testing.T) {
 	j.Wait()
 }
 
+func TestStopBeforeStart(t *testing.T) {
+	j, err := NewJob(JobTypeLocal, "test-id", "echo", []string{"hello"}, Options{})
+	if err != nil {
+		t.Fatalf("NewJob failed: %v", err)
+	}
+	if err := j.Stop(); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+	st := j.Status()
+	if st.Status != StatusKilled || st.Reason != TerminationStoppedByUser {
+		t.Fatalf("expected StatusKilled and TerminationStoppedByUser, got %v and %v", st.Status, st.Reason)
+	}
+	if err := j.Start(); !errors.Is(err, errJobStopped) {
+		t.Fatalf("expected errJobStopped, got %v", err)
+	}
+	if err := j.Stop(); !errors.Is(err, ErrJobNotRunning) {
+		t.Fatalf("expected ErrJobNotRunning on second Stop, got %v", err)
+	}
+}
+
+func TestTerminationReason(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		stop func(j Job) // Called once the job is running, or nil to let it exit.
+		want TerminationReason
+	}{
+		{name: "exited", args: []string{"-c", "exit 0"}, want: TerminationExited},
+		{name: "exited non-zero", args: []string{"-c", "exit 3"}, want: TerminationExited},
+		{
+			name: "stopped by user",
+			args: []string{"-c", "sleep 60"},
+			stop: func(j Job) { j.Stop() },
+			want: TerminationStoppedByUser,
+		},
+		{
+			name: "signaled",
+			args: []string{"-c", "sleep 60"},
+			// The job is PID 1 of its namespace, which ignores signals sent
+			// from inside the namespace, so signal it from here.
+			stop: func(j Job) { j.(*localJob).cmd.Process.Signal(syscall.SIGKILL) },
+			want: TerminationSignaled,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j, err := NewJob(JobTypeLocal, "reason-job", "sh", tt.args, Options{})
+			if err != nil {
+				t.Fatalf("NewJob failed: %v", err)
+			}
+			if err := j.Start(); err != nil {
+				t.Fatalf("Start failed: %v", err)
+			}
+			if got := j.Status().Reason; got != TerminationUnspecified {
+				t.Fatalf("expected TerminationUnspecified while running, got %v", got)
+			}
+			if tt.stop != nil {
+				tt.stop(j)
+			}
+			j.Wait()
+			if got := j.Status().Reason; got != tt.want {
+				t.Fatalf("expected reason %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestOOMKillRecordedFromEvents(t *testing.T) {
+	backend := fake.NewBackend()
+	cg, err := backend.CreateCgroup("oom-job", resources.Limits{})
+	if err != nil {
+		t.Fatalf("CreateCgroup failed: %v", err)
+	}
+	j, err := NewJob(JobTypeLocal, "oom-job", "sleep", []string{"60"}, Options{Cgroup: cg})
+	if err != nil {
+		t.Fatalf("NewJob failed: %v", err)
+	}
+	if err := j.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	backend.Cgroup("oom-job").OOMKill()
+
+	// The kill is recorded from the cgroup's events, before Wait reads the
+	// cgroup.
+	l := j.(*localJob)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		l.mu.Lock()
+		kills := l.oomKills
+		l.mu.Unlock()
+		if kills == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the OOM kill to be recorded, got %d kills", kills)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	j.Wait()
+	if got := j.Status().Reason; got != TerminationOOMKilled {
+		t.Fatalf("expected reason %v, got %v", TerminationOOMKilled, got)
+	}
+}
+
 func TestNewJobUnknownType(t *testing.T) {
 	_, err := NewJob(JobType(999), "test-id", "echo", nil, Options{})
 	if err == nil {
 		t.Fatal("expected error for unknown job type, got nil")
 	}
 }
+
+func TestOCIJob(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("skipping: requires root")
+	}
+
+	src := testutil.WriteImage(t,
+		image.Config{
+			Entrypoint: []string{"helper"},
+			Cmd:        []string{"default"},
+			Env:        []string{"PATH=/bin"},
+			WorkingDir: "/work",
+			User:       "1000:1000",
+		},
+		[]testutil.ImageFile{
+			{Name: "bin/", Typeflag: tar.TypeDir, Mode: 0755},
+			{Name: "bin/helper", Body: testutil.ImageHelper(t), Mode: 0755},
+			{Name: "work/", Typeflag: tar.TypeDir, Mode: 0755},
+		},
+	)
+
+	tests := []struct {
+		name      string
+		command   string
+		args      []string
+		isolation Isolation
+		want      string
+	}{
+		{"image cmd", "", nil, Isolation{}, "args=[default] wd=/work user=1000:1000"},
+		{"override cmd", "hello", []string{"world"}, Isolation{}, "args=[hello world] wd=/work user=1000:1000"},
+		// The job init process applies the root, working directory and
+		// user instead of os/exec.
+		{"isolated", "", nil, Isolation{UTS: true, IPC: true, Mount: true}, "args=[default] wd=/work user=1000:1000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataDir := t.TempDir()
+			j, err := NewJob(JobTypeOCI, "oci-job", tt.command, tt.args, Options{Image: src, DataDir: dataDir, Isolation: tt.isolation})
+			if err != nil {
+				t.Fatalf("NewJob failed: %v", err)
+			}
+			if err := j.Start(); err != nil {
+				t.Fatalf("Start failed: %v", err)
+			}
+			j.Wait()
+
+			if st := j.Status(); st.Status != StatusSuccess {
+				t.Fatalf("expected StatusSuccess, got %v", st.Status)
+			}
+			got, err := io.ReadAll(j.Output().Subscribe())
+			if err != nil {
+				t.Fatalf("failed to read output: %v", err)
+			}
+			if strings.TrimSpace(string(got)) != tt.want {
+				t.Fatalf("expected output %q, got %q", tt.want, got)
+			}
+
+			// The job's rootfs should be unmounted and removed on exit.
+			if _, err := os.Stat(filepath.Join(dataDir, "jobs", "oci-job")); !os.IsNotExist(err) {
+				t.Fatalf("expected job directory to be removed, got %v", err)
+			}
+		})
+	}
+}
+
+func TestOCIJobRequiresImage(t *testing.T) {
+	_, err := NewJob(JobTypeOCI, "test-id", "echo", nil, Options{DataDir: t.TempDir()})
+	if err == nil {
+		t.Fatal("expected error for missing image, got nil")
+	}
+}
+
+func TestLocalJobWorkspace(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("skipping: requires root")
+	}
+
+	base := t.TempDir()
+	if err := os.WriteFile(filepath.Join(base, "input.txt"), []byte("input"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ws := &workspace.Config{Base: base, Dir: t.TempDir(), Retention: workspace.RetainKeep}
+
+	j, err := NewJob(JobTypeLocal, "ws-job", "sh", []string{"-c", "cat input.txt > output.txt"}, Options{Workspace: ws})
+	if err != nil {
+		t.Fatalf("NewJob failed: %v", err)
+	}
+	if err := j.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	j.Wait()
+
+	if st := j.Status(); st.Status != StatusSuccess {
+		t.Fatalf("expected StatusSuccess, got %v", st.Status)
+	}
+	if _, err := os.Stat(filepath.Join(base, "output.txt")); !os.IsNotExist(err) {
+		t.Fatalf("expected job writes to stay out of the base directory, got %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join(ws.Dir, "ws-job", "upper", "output.txt"))
+	if err != nil || string(got) != "input" {
+		t.Fatalf("expected kept workspace to contain the job's output, got %q (%v)", got, err)
+	}
+}
+
+func TestLocalJobSHA256(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("skipping: requires root")
+	}
+
+	echo, err := exec.LookPath("echo")
+	if err != nil {
+		t.Skip("skipping: echo not available")
+	}
+	script := filepath.Join(t.TempDir(), "script")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho script \"$@\"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		command string
+		args    []string
+		sha256  string
+		want    string
+		wantErr bool
+	}{
+		{"binary", echo, []string{"binary"}, hashOf(t, echo), "binary", false},
+		// A script is run by its interpreter through /dev/fd.
+		{"script", script, []string{"arg"}, hashOf(t, script), "script arg", false},
+		{"hash does not match", echo, []string{"binary"}, hashOf(t, script), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j, err := NewJob(JobTypeLocal, "sha256-job", tt.command, tt.args, Options{SHA256: tt.sha256})
+			if err != nil {
+				t.Fatalf("NewJob failed: %v", err)
+			}
+			err = j.Start()
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "has sha256") {
+					j.Wait()
+					t.Fatalf("expected a hash mismatch, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Start failed: %v", err)
+			}
+			j.Wait()
+
+			if st := j.Status(); st.Status != StatusSuccess {
+				t.Fatalf("expected StatusSuccess, got %v", st.Status)
+			}
+			got, err := io.ReadAll(j.Output().Subscribe())
+			if err != nil {
+				t.Fatalf("failed to read output: %v", err)
+			}
+			if strings.TrimSpace(string(got)) != tt.want {
+				t.Fatalf("expected output %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+// hashOf returns the hex SHA-256 hash of the file at path.
+func hashOf(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestIsolationHostname(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("skipping: requires root")
+	}
+
+	tests := []struct {
+		name      string
+		isolation Isolation
+		want      string
+	}{
+		{"defaults to job ID", Isolation{UTS: true}, "uts-job"},
+		{"explicit hostname", Isolation{UTS: true, Hostname: "builder"}, "builder"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j, err := NewJob(JobTypeLocal, "uts-job", "uname", []string{"-n"}, Options{Isolation: tt.isolation})
+			if err != nil {
+				t.Fatalf("NewJob failed: %v", err)
+			}
+			if err := j.Start(); err != nil {
+				t.Fatalf("Start failed: %v", err)
+			}
+			j.Wait()
+
+			got, err := io.ReadAll(j.Output().Subscribe())
+			if err != nil {
+				t.Fatalf("failed to read output: %v", err)
+			}
+			if strings.TrimSpace(string(got)) != tt.want {
+				t.Fatalf("expected hostname %q, got %q", tt.want, got)
+			}
+		})
+	}
+
+	host, err := os.Hostname()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host == "uts-job" || host == "builder" {
+		t.Fatalf("job changed the host's hostname to %q", host)
+	}
+}
+
+func TestIsolationIPC(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("skipping: requires root")
+	}
+	if _, err := exec.LookPath("ipcmk"); err != nil {
+		t.Skip("skipping: ipcmk not available")
+	}
+
+	opts := Options{Isolation: Isolation{IPC: true}}
+
+	// The first job creates a shared memory segment and keeps running, so
+	// that its IPC namespace stays alive while the second job looks for it.
+	owner, err := NewJob(JobTypeLocal, "ipc-owner", "sh", []string{"-c", "ipcmk -M 4096 && sleep 30"}, opts)
+	if err != nil {
+		t.Fatalf("NewJob failed: %v", err)
+	}
+	if err := owner.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer func() {
+		owner.Stop()
+		owner.Wait()
+	}()
+	testutil.PollUntil(t, "shared memory segment to be created", func() bool {
+		out, _ := readAvailable(owner)
+		return strings.Contains(out, "Shared memory id")
+	})
+
+	// Each line after the header of /proc/sysvipc/shm is a segment.
+	observer, err := NewJob(JobTypeLocal, "ipc-observer", "cat", []string{"/proc/sysvipc/shm"}, opts)
+	if err != nil {
+		t.Fatalf("NewJob failed: %v", err)
+	}
+	if err := observer.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	observer.Wait()
+
+	got, err := io.ReadAll(observer.Output().Subscribe())
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(got)), "\n"); len(lines) != 1 {
+		t.Fatalf("expected no visible shared memory segments, got:\n%s", got)
+	}
+}
+
+// readAvailable returns the output a running job has written so far.
+func readAvailable(j Job) (string, error) {
+	r := j.Output().Subscribe()
+	defer r.Close()
+	buf := make([]byte, 4096)
+	n, err := r.Read(buf)
+	return string(buf[:n]), err
+}
+
+func TestParseIsolation(t *testing.T) {
+	iso, err := ParseIsolation([]string{"uts", "ipc"})
+	if err != nil {
+		t.Fatalf("ParseIsolation failed: %v", err)
+	}
+	if iso != (Isolation{UTS: true, IPC: true}) {
+		t.Fatalf("unexpected isolation profile: %+v", iso)
+	}
+	if _, err := ParseIsolation([]string{"net"}); err == nil {
+		t.Fatal("expected error for unknown namespace, got nil")
+	}
+}
+
+func TestLandlock(t *testing.T) {
+	if _, err := landlockABI(); err != nil {
+		t.Skipf("skipping: %v", err)
+	}
+
+	ro := t.TempDir()
+	rw := t.TempDir()
+	ll := &Landlock{
+		ReadOnly:  []string{ro},
+		ReadWrite: []string{rw},
+		Exec:      []string{"/"},
+	}
+	script := "echo ok > " + rw + "/out && ! echo bad 2>/dev/null > " + ro + "/out"
+	j, err := NewJob(JobTypeLocal, "landlock-job", "sh", []string{"-c", script}, Options{Landlock: ll})
+	if err != nil {
+		t.Fatalf("NewJob failed: %v", err)
+	}
+	if err := j.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	j.Wait()
+
+	if st := j.Status(); st.Status != StatusSuccess {
+		t.Fatalf("expected StatusSuccess, got %v (exit code %v)", st.Status, *st.ExitCode)
+	}
+	if _, err := os.Stat(filepath.Join(rw, "out")); err != nil {
+		t.Fatalf("expected write to read-write path to succeed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(ro, "out")); !os.IsNotExist(err) {
+		t.Fatalf("expected write to read-only path to be denied, got %v", err)
+	}
+}
+
+func TestLandlockUnsupported(t *testing.T) {
+	orig := landlockABI
+	landlockABI = func() (int, error) { return 0, errLandlockUnsupported }
+	t.Cleanup(func() { landlockABI = orig })
+
+	tests := []struct {
+		name       string
+		bestEffort bool
+		wantErr    bool
+	}{
+		{"fails by default", false, true},
+		{"best effort runs without ruleset", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ll := &Landlock{ReadOnly: []string{"/"}, BestEffort: tt.bestEffort}
+			j, err := NewJob(JobTypeLocal, "landlock-job", "true", nil, Options{Landlock: ll})
+			if err != nil {
+				t.Fatalf("NewJob failed: %v", err)
+			}
+			err = j.Start()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Start error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				j.Wait()
+				if st := j.Status(); st.Status != StatusSuccess {
+					t.Fatalf("expected StatusSuccess, got %v", st.Status)
+				}
+			}
+		})
+	}
+}
+
+func TestRlimits(t *testing.T) {
+	nofile, core := uint64(64), uint64(0)
+	opts := Options{Rlimits: Rlimits{NoFile: &nofile, Core: &core}}
+	j, err := NewJob(JobTypeLocal, "rlimit-job", "sh", []string{"-c", "ulimit -n; ulimit -c; ulimit -Hn"}, opts)
+	if err != nil {
+		t.Fatalf("NewJob failed: %v", err)
+	}
+	if err := j.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	j.Wait()
+
+	got, err := io.ReadAll(j.Output().Subscribe())
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	if want := "64\n0\n64\n"; string(got) != want {
+		t.Fatalf("expected limits %q, got %q", want, got)
+	}
+}
+
+func TestRlimitsWithin(t *testing.T) {
+	u := func(v uint64) *uint64 { return &v }
+	ceilings := Rlimits{NoFile: u(1024), NProc: u(100)}
+
+	got, err := Rlimits{NoFile: u(512), Core: u(0)}.Within(ceilings)
+	if err != nil {
+		t.Fatalf("Within failed: %v", err)
+	}
+	if *got.NoFile != 512 || *got.Core != 0 || *got.NProc != 100 || got.Stack != nil {
+		t.Fatalf("unexpected limits: nofile=%d core=%d nproc=%d stack=%v", *got.NoFile, *got.Core, *got.NProc, got.Stack)
+	}
+
+	if _, err := (Rlimits{NoFile: u(2048)}).Within(ceilings); !errors.Is(err, ErrRlimitExceedsCeiling) {
+		t.Fatalf("expected ErrRlimitExceedsCeiling, got %v", err)
+	}
+}
+
+func TestParseRlimits(t *testing.T) {
+	r, err := ParseRlimits([]string{"nofile=1024", "core=0"})
+	if err != nil {
+		t.Fatalf("ParseRlimits failed: %v", err)
+	}
+	if r.NoFile == nil || *r.NoFile != 1024 || r.Core == nil || *r.Core != 0 || r.Stack != nil {
+		t.Fatalf("unexpected limits: %+v", r)
+	}
+	for _, bad := range []string{"nofile", "nofile=-1", "cpu=10"} {
+		if _, err := ParseRlimits([]string{bad}); err == nil {
+			t.Fatalf("expected error for %q, got nil", bad)
+		}
+	}
+}
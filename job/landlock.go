@@ -0,0 +1,150 @@
+package job
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Landlock is a Landlock ruleset for a job. Once a job has a ruleset, it can
+// only access files beneath the listed paths, in the ways each list allows.
+// Paths are resolved inside the job's root filesystem.
+//
+// Landlock needs no privileges or mount namespace, but is only available on
+// Linux 5.13 and later, with Landlock enabled in the kernel.
+// See: https://docs.kernel.org/userspace-api/landlock.html
+type Landlock struct {
+	ReadOnly   []string // Paths the job may read.
+	ReadWrite  []string // Paths the job may read, write, create and remove files in.
+	Exec       []string // Paths the job may read and execute files from.
+	BestEffort bool     // If true, run jobs without the ruleset when the kernel does not support Landlock. Otherwise, such jobs fail to start.
+}
+
+// errLandlockUnsupported is returned when the kernel does not support Landlock.
+var errLandlockUnsupported = errors.New("landlock is not supported by the kernel")
+
+// Access rights, by the Landlock ABI version that introduced them.
+const (
+	landlockAccessV1 = unix.LANDLOCK_ACCESS_FS_EXECUTE |
+		unix.LANDLOCK_ACCESS_FS_WRITE_FILE |
+		unix.LANDLOCK_ACCESS_FS_READ_FILE |
+		unix.LANDLOCK_ACCESS_FS_READ_DIR |
+		unix.LANDLOCK_ACCESS_FS_REMOVE_DIR |
+		unix.LANDLOCK_ACCESS_FS_REMOVE_FILE |
+		unix.LANDLOCK_ACCESS_FS_MAKE_CHAR |
+		unix.LANDLOCK_ACCESS_FS_MAKE_DIR |
+		unix.LANDLOCK_ACCESS_FS_MAKE_REG |
+		unix.LANDLOCK_ACCESS_FS_MAKE_SOCK |
+		unix.LANDLOCK_ACCESS_FS_MAKE_FIFO |
+		unix.LANDLOCK_ACCESS_FS_MAKE_BLOCK |
+		unix.LANDLOCK_ACCESS_FS_MAKE_SYM
+	landlockAccessV2 = landlockAccessV1 | unix.LANDLOCK_ACCESS_FS_REFER
+	landlockAccessV3 = landlockAccessV2 | unix.LANDLOCK_ACCESS_FS_TRUNCATE
+	landlockAccessV5 = landlockAccessV3 | unix.LANDLOCK_ACCESS_FS_IOCTL_DEV
+
+	// Rights that apply to files, as opposed to directories. A rule for a
+	// file may only grant these.
+	landlockFileAccess = unix.LANDLOCK_ACCESS_FS_EXECUTE |
+		unix.LANDLOCK_ACCESS_FS_WRITE_FILE |
+		unix.LANDLOCK_ACCESS_FS_READ_FILE |
+		unix.LANDLOCK_ACCESS_FS_TRUNCATE |
+		unix.LANDLOCK_ACCESS_FS_IOCTL_DEV
+
+	landlockReadOnly  = unix.LANDLOCK_ACCESS_FS_READ_FILE | unix.LANDLOCK_ACCESS_FS_READ_DIR
+	landlockReadWrite = landlockAccessV5 &^ unix.LANDLOCK_ACCESS_FS_EXECUTE
+	landlockExec      = landlockReadOnly | unix.LANDLOCK_ACCESS_FS_EXECUTE
+)
+
+// landlockABI returns the Landlock ABI version supported by the kernel, or
+// errLandlockUnsupported. The result is cached, since it can not change while
+// teleworker is running.
+var landlockABI = sync.OnceValues(func() (int, error) {
+	abi, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, 0, 0, unix.LANDLOCK_CREATE_RULESET_VERSION)
+	if errno != 0 {
+		if errors.Is(errno, unix.ENOSYS) || errors.Is(errno, unix.EOPNOTSUPP) {
+			return 0, errLandlockUnsupported
+		}
+		return 0, fmt.Errorf("failed to get landlock ABI version: %w", errno)
+	}
+	return int(abi), nil
+})
+
+// handledAccess returns every access right the given ABI version can
+// restrict.
+func handledAccess(abi int) uint64 {
+	switch {
+	case abi >= 5:
+		return landlockAccessV5
+	case abi >= 3:
+		return landlockAccessV3
+	case abi == 2:
+		return landlockAccessV2
+	default:
+		return landlockAccessV1
+	}
+}
+
+// restrict applies the ruleset to the calling process. It is called by the
+// job init process, after any chroot, so that paths are resolved inside the
+// job's root filesystem.
+func (ll *Landlock) restrict(abi int) error {
+	handled := handledAccess(abi)
+	attr := unix.LandlockRulesetAttr{Access_fs: handled}
+	fd, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr), 0)
+	if errno != 0 {
+		return fmt.Errorf("failed to create landlock ruleset: %w", errno)
+	}
+	defer unix.Close(int(fd))
+
+	rules := []struct {
+		paths  []string
+		access uint64
+	}{
+		{ll.ReadOnly, landlockReadOnly},
+		{ll.ReadWrite, landlockReadWrite},
+		{ll.Exec, landlockExec},
+	}
+	for _, rule := range rules {
+		for _, path := range rule.paths {
+			if err := addLandlockRule(int(fd), path, rule.access&handled); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Landlock requires no_new_privs, so that the job can not escape the
+	// ruleset by running a set-user-ID program.
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("failed to set no_new_privs: %w", err)
+	}
+	if _, _, errno := unix.Syscall(unix.SYS_LANDLOCK_RESTRICT_SELF, fd, 0, 0); errno != 0 {
+		return fmt.Errorf("failed to enforce landlock ruleset: %w", errno)
+	}
+	return nil
+}
+
+func addLandlockRule(rulesetFD int, path string, access uint64) error {
+	fd, err := unix.Open(path, unix.O_PATH|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open landlock path %s: %w", path, err)
+	}
+	defer unix.Close(fd)
+
+	var st unix.Stat_t
+	if err := unix.Fstat(fd, &st); err != nil {
+		return fmt.Errorf("failed to stat landlock path %s: %w", path, err)
+	}
+	if st.Mode&unix.S_IFMT != unix.S_IFDIR {
+		access &= landlockFileAccess
+	}
+
+	attr := unix.LandlockPathBeneathAttr{Allowed_access: access, Parent_fd: int32(fd)}
+	_, _, errno := unix.Syscall6(unix.SYS_LANDLOCK_ADD_RULE, uintptr(rulesetFD), unix.LANDLOCK_RULE_PATH_BENEATH, uintptr(unsafe.Pointer(&attr)), 0, 0, 0)
+	if errno != 0 {
+		return fmt.Errorf("failed to add landlock rule for %s: %w", path, errno)
+	}
+	return nil
+}
@@ -1,31 +1,57 @@
 package job
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log/slog"
+	"os"
 	"os/exec"
 	"sync"
 	"syscall"
 
 	"github.com/kkloberdanz/teleworker/output"
 	"github.com/kkloberdanz/teleworker/resources"
+	"github.com/kkloberdanz/teleworker/workspace"
 )
 
+// errJobAlreadyStarted is returned when Start is called more than once.
+var errJobAlreadyStarted = errors.New("job already started")
+
+// errJobStopped is returned when Start is called on a job that was stopped
+// before it started.
+var errJobStopped = errors.New("job was stopped before it started")
+
 // localJob manages the lifetime of the job, and therefore the job's cgroup.
 // Once properly constructed, localJob will be responsible for cleaning up the
 // cgroup it was provided.
 type localJob struct {
-	mu        sync.Mutex        // Guards status and exitCode.
-	id        string            // Unique job identifier.
-	command   string            // Executable path.
-	args      []string          // Command line arguments.
-	status    Status            // Current job status.
-	exitCode  *int              // Process exit code: `nil` if not yet exited or unknown.
-	cmd       *exec.Cmd         // Underlying OS process.
-	cgroup    *resources.Cgroup // Resource limits: `nil` if running without cgroups.
-	noCleanup bool              // If true, skip cgroup cleanup on exit.
-	output    *output.Buffer    // Combined stdout/stderr capture.
+	mu          sync.Mutex        // Guards status, exitCode, reason, pidsMaxHits, oomKills, usage, cpuset and stopEvents.
+	id          string            // Unique job identifier.
+	command     string            // Executable path.
+	args        []string          // Command line arguments.
+	status      Status            // Current job status.
+	exitCode    *int              // Process exit code: `nil` if not yet exited or unknown.
+	reason      TerminationReason // Why the job stopped running.
+	pidsMaxHits int64             // pids.events max count, recorded before the cgroup is removed.
+	oomKills    uint64            // memory.events oom_kill count, recorded from the cgroup's events as the job runs.
+	stopEvents  func()            // Stops watching the cgroup's events and waits for the watcher to return: `nil` if it is not watched.
+	usage       *resources.Usage  // Final resource accounting, recorded before the cgroup is removed.
+	cpuset      resources.Cpuset  // CPUs and memory nodes the job is pinned to, recorded when it starts.
+	cmd         *exec.Cmd         // Underlying OS process.
+	cgroup      resources.Cgroup  // Resource limits: `nil` if running without cgroups.
+	noCleanup   bool              // If true, skip cgroup cleanup on exit.
+	output      *output.Buffer    // Combined stdout/stderr capture.
+
+	root      string               // Directory to chroot into before running the command: empty to run on the host filesystem.
+	dir       string               // Working directory, relative to root if set: empty inherits the teleworker working directory.
+	env       []string             // Environment for the command: `nil` inherits the teleworker environment.
+	cred      *syscall.Credential  // User and group to run the command as: `nil` runs as the teleworker user.
+	workspace *workspace.Workspace // Copy-on-write working directory: `nil` if the job has none.
+	isolation Isolation            // Namespaces to run the job in, in addition to its PID namespace.
+	landlock  *Landlock            // Filesystem access rules: `nil` if the job may access any file its user can.
+	rlimits   Rlimits              // POSIX resource limits for each process in the job.
+	sha256    string               // Hex SHA-256 hash the executable must have when it is executed: empty for any.
 }
 
 // TODO: Ideally we would be running jobs as a different user. For simplicity,
@@ -49,36 +75,120 @@ func (l *localJob) buildCmd() *exec.Cmd {
 		// in a new PID namespace, which means it will start with a PID of 1.
 		// once it dies, the kernel will ensure that all child procs of PID 1
 		// will be SIGKILLed.
-		Cloneflags: syscall.CLONE_NEWPID,
+		//
+		// The isolation profile may add further namespaces.
+		Cloneflags: l.isolation.cloneflags(),
 	}
-	if l.cgroup != nil {
+	// When the job init process is used, it applies these instead.
+	if !l.needsInit() {
+		cmd.SysProcAttr.Chroot = l.root
+		cmd.SysProcAttr.Credential = l.cred
+		cmd.Dir = l.dir
+		cmd.Env = l.env
+	}
+	if l.cgroup != nil && l.cgroup.FD() >= 0 {
 		cmd.SysProcAttr.CgroupFD = l.cgroup.FD() // Ensure the process is added to the cgroup when it is created.
 		cmd.SysProcAttr.UseCgroupFD = true
 	}
 	return cmd
 }
 
+// needsInit returns true if the job must be started through the job init
+// process, because it needs setup that os/exec can not do between fork and
+// exec. That includes joining a cgroup that has no fd to start it in.
+func (l *localJob) needsInit() bool {
+	return l.isolation.UTS || l.isolation.Mount || l.landlock != nil || !l.rlimits.IsZero() || l.sha256 != "" ||
+		(l.cgroup != nil && l.cgroup.FD() < 0)
+}
+
+// joinCgroup adds the job init process to the job's cgroup, if the cgroup has
+// no fd to start it in.
+func (l *localJob) joinCgroup(p *os.Process) error {
+	if l.cgroup == nil || l.cgroup.FD() >= 0 {
+		return nil
+	}
+	if err := l.cgroup.AddProcess(p.Pid); err != nil {
+		return fmt.Errorf("failed to add job to its cgroup: %w", err)
+	}
+	return nil
+}
+
+// initConfig returns the setup the job init process applies before executing
+// cmd. If the job has a Landlock ruleset that the kernel does not support, the
+// ruleset is dropped if it is best effort, otherwise an error is returned.
+func (l *localJob) initConfig(cmd *exec.Cmd) (initConfig, error) {
+	cfg := initConfig{
+		Path:          cmd.Path,
+		SHA256:        l.sha256,
+		Args:          cmd.Args,
+		Env:           l.env,
+		Root:          l.root,
+		Dir:           l.dir,
+		Cred:          l.cred,
+		PrivateMounts: l.isolation.Mount,
+		Rlimits:       l.rlimits,
+	}
+	if l.isolation.UTS {
+		cfg.Hostname = l.isolation.Hostname
+		if cfg.Hostname == "" {
+			cfg.Hostname = l.id
+		}
+	}
+	if l.landlock != nil {
+		abi, err := landlockABI()
+		switch {
+		case errors.Is(err, errLandlockUnsupported) && l.landlock.BestEffort:
+			slog.Warn(
+				"running job without landlock ruleset",
+				"jobID", l.id,
+				"error", err,
+			)
+		case err != nil:
+			return initConfig{}, err
+		default:
+			cfg.Landlock = l.landlock
+			cfg.LandlockABI = abi
+		}
+	}
+	return cfg, nil
+}
+
 // Start starts the local process. It transitions the job from StatusSubmitted
 // to StatusRunning.
 func (l *localJob) Start() error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
+	if l.status == StatusKilled {
+		return errJobStopped
+	}
 	if l.status != StatusSubmitted {
-		return errors.New("job already started")
+		return errJobAlreadyStarted
 	}
 
 	cmd := l.buildCmd()
 	cmd.Stdout = l.output
 	cmd.Stderr = l.output
-	if err := cmd.Start(); err != nil {
+	var err error
+	if l.needsInit() {
+		var cfg initConfig
+		if cfg, err = l.initConfig(cmd); err == nil {
+			err = startWithInit(cmd, cfg, l.joinCgroup)
+		}
+	} else {
+		err = cmd.Start()
+	}
+	if err != nil {
 		if l.cgroup != nil {
 			l.cgroup.Cleanup()
 		}
+		l.closeWorkspace()
 		return fmt.Errorf("failed to start command: %w", err)
 	}
 	if l.cgroup != nil {
 		l.cgroup.CloseFD()
+		l.recordCpuset()
+		l.watchEvents()
 	}
 
 	l.cmd = cmd
@@ -86,6 +196,54 @@ func (l *localJob) Start() error {
 	return nil
 }
 
+// watchEvents follows the events of the job's cgroup until Wait stops it, or
+// every process in the cgroup has exited, so that OOM kills are recorded and
+// logged as they happen rather than only once the job has exited. The caller
+// must hold l.mu.
+func (l *localJob) watchEvents() {
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := l.cgroup.Events(ctx)
+	if err != nil {
+		cancel()
+		slog.Warn(
+			"failed to watch cgroup events",
+			"jobID", l.id,
+			"error", err,
+		)
+		return
+	}
+	done := make(chan struct{})
+	l.stopEvents = func() {
+		cancel()
+		<-done
+	}
+
+	go func() {
+		defer close(done)
+		populated := false
+		for ev := range events {
+			l.mu.Lock()
+			if ev.OOMKills > l.oomKills {
+				slog.Warn(
+					"OOM killer killed a process in job",
+					"jobID", l.id,
+					"oomKills", ev.OOMKills,
+				)
+				l.oomKills = ev.OOMKills
+			}
+			l.mu.Unlock()
+
+			// Once the cgroup is depopulated, no process is left to be
+			// killed.
+			if ev.Populated {
+				populated = true
+			} else if populated {
+				return
+			}
+		}
+	}()
+}
+
 // ID returns the unique job identifier.
 func (l *localJob) ID() string {
 	return l.id
@@ -102,20 +260,108 @@ func (l *localJob) Status() StatusResult {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	return StatusResult{Status: l.status, ExitCode: l.exitCode}
+	// While the job is running, read the count from its cgroup. Once it
+	// exits, the cgroup may be gone, so use the count recorded by Wait.
+	if l.status == StatusRunning {
+		l.updatePidsMaxHits()
+	}
+	return StatusResult{
+		Status:      l.status,
+		ExitCode:    l.exitCode,
+		Reason:      l.reason,
+		PidsMaxHits: l.pidsMaxHits,
+		Usage:       l.usage,
+		Cpuset:      l.cpuset,
+	}
 }
 
-// Stop kills the job and all of its child processes. Returns ErrJobNotRunning
-// if the job has already exited.
+// updatePidsMaxHits records the pids.events max count from the job's cgroup.
+// The caller must hold l.mu.
+func (l *localJob) updatePidsMaxHits() {
+	if l.cgroup == nil {
+		return
+	}
+	hits, err := l.cgroup.PidsMaxHits()
+	if err != nil {
+		slog.Warn(
+			"failed to read pids.events",
+			"jobID", l.id,
+			"error", err,
+		)
+		return
+	}
+	l.pidsMaxHits = hits
+}
+
+// recordUsage records the job's final resource accounting, since it is lost
+// when the cgroup is removed. The caller must hold l.mu.
+func (l *localJob) recordUsage() {
+	if l.cgroup == nil {
+		return
+	}
+	usage, err := l.cgroup.Usage()
+	if err != nil {
+		slog.Warn(
+			"failed to read job resource usage",
+			"jobID", l.id,
+			"error", err,
+		)
+		return
+	}
+	l.usage = usage
+}
+
+// recordCpuset records the cpuset of the job's cgroup, so that it can be
+// reported after the cgroup is removed. The caller must hold l.mu.
+func (l *localJob) recordCpuset() {
+	cpuset, err := l.cgroup.Cpuset()
+	if err != nil {
+		slog.Warn(
+			"failed to read job cpuset",
+			"jobID", l.id,
+			"error", err,
+		)
+		return
+	}
+	l.cpuset = cpuset
+}
+
+// Stats returns the current resource usage of the job's cgroup. Returns
+// ErrJobNotRunning if the job is not running, since its cgroup is removed when
+// it exits, or ErrNoCgroup if the job is running without a cgroup.
+func (l *localJob) Stats() (*resources.Stats, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.status != StatusRunning {
+		return nil, ErrJobNotRunning
+	}
+	if l.cgroup == nil {
+		return nil, ErrNoCgroup
+	}
+	return l.cgroup.Stats()
+}
+
+// Stop kills the job and all of its child processes. A job that has not
+// started yet, such as one waiting for exclusive CPUs, is marked as killed and
+// will not start. Returns ErrJobNotRunning if the job has already exited.
 func (l *localJob) Stop() error {
 	var cgroupErr error
 
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
+	if l.status == StatusSubmitted {
+		l.status = StatusKilled
+		l.reason = TerminationStoppedByUser
+		if l.cgroup != nil && !l.noCleanup {
+			l.cgroup.Cleanup()
+		}
+		l.closeWorkspace()
+		l.output.Close()
+		return nil
+	}
 	if l.status != StatusRunning {
-		// This would happen if job.Start() is not called before calling
-		// job.Stop()
 		return ErrJobNotRunning
 	}
 
@@ -171,6 +417,7 @@ func (l *localJob) Stop() error {
 		}
 	}
 	l.status = StatusKilled
+	l.reason = TerminationStoppedByUser
 	ec := 128 + int(syscall.SIGKILL)
 	l.exitCode = &ec
 
@@ -190,19 +437,31 @@ func (l *localJob) Wait() {
 		err = nil
 	}
 
+	// The watcher takes l.mu, so it is stopped before l.mu is held.
+	l.mu.Lock()
+	stopEvents := l.stopEvents
+	l.mu.Unlock()
+	if stopEvents != nil {
+		stopEvents()
+	}
+
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
+	l.updatePidsMaxHits()
+	l.recordUsage()
 	defer func() {
 		if l.cgroup != nil && !l.noCleanup {
 			l.cgroup.Cleanup()
 		}
+		l.closeWorkspace()
 	}()
 
 	if err != nil {
 		// If Stop already set killed, leave status as killed.
 		if l.status != StatusKilled {
 			l.status = StatusFailed
+			l.reason = TerminationExited
 		}
 		var exitErr *exec.ExitError
 		if errors.As(err, &exitErr) {
@@ -211,14 +470,25 @@ func (l *localJob) Wait() {
 			if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
 				ec := 128 + int(ws.Signal())
 				l.exitCode = &ec
+				if l.status != StatusKilled {
+					l.reason = TerminationSignaled
+				}
 			} else {
 				ec := exitErr.ExitCode()
 				l.exitCode = &ec
 			}
 		}
+		// An OOM kill looks like any other SIGKILL from the exit status, so
+		// check the cgroup. The OOM killer may have picked a child process
+		// rather than the job's main process, which then failed as a result,
+		// so any OOM kill in a failed job is reported.
+		if l.status == StatusFailed && l.oomKilled() {
+			l.reason = TerminationOOMKilled
+		}
 	} else {
 		if l.status != StatusKilled {
 			l.status = StatusSuccess
+			l.reason = TerminationExited
 		}
 		ec := 0
 		l.exitCode = &ec
@@ -226,3 +496,50 @@ func (l *localJob) Wait() {
 
 	l.output.Close()
 }
+
+// oomKilled returns true if the OOM killer killed a process in the job's
+// cgroup, either as recorded from its events or, in case the last event was
+// missed, as read from the cgroup now. The caller must hold l.mu, and the
+// cgroup must not be cleaned up yet.
+func (l *localJob) oomKilled() bool {
+	if l.cgroup == nil {
+		return false
+	}
+	if l.oomKills > 0 {
+		return true
+	}
+	kills, err := l.cgroup.OOMKills()
+	if err != nil {
+		slog.Warn(
+			"failed to read memory.events",
+			"jobID", l.id,
+			"error", err,
+		)
+		return false
+	}
+	return kills > 0
+}
+
+// closeWorkspace unmounts the job's workspace, if it has one. Depending on the
+// workspace's retention setting, the files the job wrote are either discarded
+// or kept on disk for inspection.
+func (l *localJob) closeWorkspace() {
+	if l.workspace == nil {
+		return
+	}
+	if err := l.workspace.Close(); err != nil {
+		slog.Warn(
+			"failed to close job workspace",
+			"jobID", l.id,
+			"error", err,
+		)
+		return
+	}
+	if l.workspace.Kept() {
+		slog.Info(
+			"kept job workspace",
+			"jobID", l.id,
+			"path", l.workspace.UpperPath(),
+		)
+	}
+}
@@ -0,0 +1,176 @@
+package job
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/kkloberdanz/teleworker/image"
+	"github.com/kkloberdanz/teleworker/output"
+	"github.com/kkloberdanz/teleworker/overlay"
+)
+
+// defaultPath is used when an image does not set PATH in its environment.
+const defaultPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// ociJob runs a command from an OCI image. The image's layers are mounted as
+// the lower layers of an overlayfs, with a per-job upper layer so that the job
+// cannot modify the cached layers, and the command is chrooted into the
+// overlay. Apart from the root filesystem, an ociJob behaves exactly like a
+// localJob, running in the same cgroup and namespaces.
+//
+// TODO: The job sees the rootfs as unpacked from the image, without /proc,
+// /dev or /sys mounted. These could be mounted by the job init process when
+// the job runs in its own mount namespace.
+type ociJob struct {
+	*localJob
+	jobDir string // Holds the overlay's upper, work and rootfs directories.
+}
+
+// newOCIJob unpacks opts.Image, mounts its root filesystem and resolves the
+// command to run from the image config.
+func newOCIJob(id, command string, args []string, opts Options) (*ociJob, error) {
+	if opts.Image == "" {
+		return nil, errors.New("OCI jobs require an image")
+	}
+	if opts.DataDir == "" {
+		return nil, errors.New("OCI jobs require a data directory")
+	}
+
+	img, err := image.Unpack(opts.Image, filepath.Join(opts.DataDir, "layers"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to unpack image: %w", err)
+	}
+
+	o := &ociJob{jobDir: filepath.Join(opts.DataDir, "jobs", id)}
+	rootfs := filepath.Join(o.jobDir, "rootfs")
+	// The root directory of an overlay takes its owner and mode from the
+	// upper directory, so it must be traversable by the image's user.
+	for _, dir := range []string{"upper", "work", "rootfs"} {
+		if err := os.MkdirAll(filepath.Join(o.jobDir, dir), 0700); err != nil {
+			o.removeJobDir()
+			return nil, fmt.Errorf("failed to create job directory: %w", err)
+		}
+	}
+	if err := os.Chmod(filepath.Join(o.jobDir, "upper"), 0755); err != nil {
+		o.removeJobDir()
+		return nil, fmt.Errorf("failed to create job directory: %w", err)
+	}
+	if err := overlay.Mount(rootfs, img.Layers, filepath.Join(o.jobDir, "upper"), filepath.Join(o.jobDir, "work")); err != nil {
+		o.removeJobDir()
+		return nil, err
+	}
+
+	path, argv, env, err := resolveCommand(rootfs, img.Config, command, args)
+	if err != nil {
+		o.cleanupRootfs()
+		return nil, err
+	}
+
+	uid, gid, err := image.ResolveUser(rootfs, img.Config.User)
+	if err != nil {
+		o.cleanupRootfs()
+		return nil, err
+	}
+
+	dir := img.Config.WorkingDir
+	if dir == "" {
+		dir = "/"
+	}
+
+	o.localJob = &localJob{
+		id:        id,
+		command:   path,
+		args:      argv[1:],
+		status:    StatusSubmitted,
+		cgroup:    opts.Cgroup,
+		noCleanup: opts.NoCleanup,
+		output:    output.NewBuffer(),
+		root:      rootfs,
+		dir:       dir,
+		env:       env,
+		cred:      &syscall.Credential{Uid: uid, Gid: gid},
+		isolation: opts.Isolation,
+		landlock:  opts.Landlock,
+		rlimits:   opts.Rlimits,
+	}
+	return o, nil
+}
+
+// resolveCommand builds the argv and environment for a job from the image
+// config, and resolves the executable within rootfs.
+func resolveCommand(rootfs string, cfg image.Config, command string, args []string) (path string, argv, env []string, err error) {
+	argv = append([]string{}, cfg.Entrypoint...)
+	if command != "" {
+		argv = append(argv, command)
+		argv = append(argv, args...)
+	} else {
+		argv = append(argv, cfg.Cmd...)
+	}
+	if len(argv) == 0 {
+		return "", nil, nil, errors.New("image has no entrypoint or cmd, and no command was given")
+	}
+
+	env = append([]string{}, cfg.Env...)
+	pathEnv := ""
+	for _, kv := range env {
+		if v, ok := strings.CutPrefix(kv, "PATH="); ok {
+			pathEnv = v
+		}
+	}
+	if pathEnv == "" {
+		pathEnv = defaultPath
+		env = append(env, "PATH="+defaultPath)
+	}
+
+	path, err = image.LookPath(rootfs, argv[0], pathEnv)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return path, argv, env, nil
+}
+
+// Start starts the job. If the job fails to start, its root filesystem is
+// unmounted and removed.
+func (o *ociJob) Start() error {
+	err := o.localJob.Start()
+	if err != nil && !errors.Is(err, errJobAlreadyStarted) {
+		o.cleanupRootfs()
+	}
+	return err
+}
+
+// Wait blocks until the job exits, then unmounts and removes its root
+// filesystem. The cached image layers are kept for future jobs.
+func (o *ociJob) Wait() {
+	o.localJob.Wait()
+	o.cleanupRootfs()
+}
+
+func (o *ociJob) cleanupRootfs() {
+	// If the unmount fails, leave the directory in place rather than
+	// recursively deleting through a mounted filesystem.
+	if err := overlay.Unmount(filepath.Join(o.jobDir, "rootfs")); err != nil {
+		slog.Warn(
+			"failed to unmount job rootfs",
+			"path", o.jobDir,
+			"error", err,
+		)
+		return
+	}
+	o.removeJobDir()
+}
+
+func (o *ociJob) removeJobDir() {
+	if err := os.RemoveAll(o.jobDir); err != nil {
+		slog.Warn(
+			"failed to remove job directory",
+			"path", o.jobDir,
+			"error", err,
+		)
+	}
+}
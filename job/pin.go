@@ -0,0 +1,91 @@
+package job
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// A policy may only allow an executable with a given hash. Hashing the file
+// when the job is checked, and then executing it by path, would let anyone who
+// can write the file swap it in between. Instead, the job init process copies
+// the executable into a sealed memfd, which can no longer be changed, hashes
+// the copy and executes that same copy.
+
+// pinExecutable copies the executable at path into a sealed memfd, and checks
+// that the copy has the hex SHA-256 hash want. The memfd is not closed on
+// exec, so that an interpreter can open it through /dev/fd if the executable
+// is a script.
+func pinExecutable(path, want string) (*os.File, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	fd, err := unix.MemfdCreate("teleworker-exec", unix.MFD_ALLOW_SEALING|unix.MFD_EXEC)
+	if errors.Is(err, unix.EINVAL) {
+		// Kernels before 6.3 do not know MFD_EXEC, and make every memfd
+		// executable.
+		fd, err = unix.MemfdCreate("teleworker-exec", unix.MFD_ALLOW_SEALING)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create memfd: %w", err)
+	}
+	f := os.NewFile(uintptr(fd), path)
+
+	if _, err := io.Copy(f, src); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to copy %s: %w", path, err)
+	}
+	if _, err := unix.FcntlInt(f.Fd(), unix.F_ADD_SEALS, unix.F_SEAL_SEAL|unix.F_SEAL_SHRINK|unix.F_SEAL_GROW|unix.F_SEAL_WRITE); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to seal copy of %s: %w", path, err)
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(f, 0, math.MaxInt64)); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != want {
+		f.Close()
+		return nil, fmt.Errorf("%s has sha256 %s, not %s", path, got, want)
+	}
+	return f, nil
+}
+
+// execveat executes the file open at fd, like fexecve(3). Like syscall.Exec,
+// it only returns if the exec fails.
+func execveat(fd uintptr, argv, envv []string) error {
+	argvp, err := syscall.SlicePtrFromStrings(argv)
+	if err != nil {
+		return err
+	}
+	envvp, err := syscall.SlicePtrFromStrings(envv)
+	if err != nil {
+		return err
+	}
+	empty, err := syscall.BytePtrFromString("")
+	if err != nil {
+		return err
+	}
+	_, _, errno := syscall.Syscall6(
+		unix.SYS_EXECVEAT,
+		fd,
+		uintptr(unsafe.Pointer(empty)),
+		uintptr(unsafe.Pointer(&argvp[0])),
+		uintptr(unsafe.Pointer(&envvp[0])),
+		unix.AT_EMPTY_PATH,
+		0,
+	)
+	return errno
+}
@@ -0,0 +1,113 @@
+package job
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// ErrRlimitExceedsCeiling is returned when a job asks for a resource limit
+// above the ceiling set by the teleworker administrator.
+var ErrRlimitExceedsCeiling = errors.New("resource limit exceeds ceiling")
+
+// Rlimits are POSIX resource limits for a job. Each limit sets both the soft
+// and the hard limit. A nil limit is inherited from teleworker.
+//
+// Unlike cgroup limits, which apply to a job as a whole, these apply to each
+// process in the job, except for NProc, which applies to every process of the
+// job's user.
+type Rlimits struct {
+	NoFile *uint64 // RLIMIT_NOFILE: Maximum number of open file descriptors.
+	Core   *uint64 // RLIMIT_CORE: Maximum core dump size in bytes.
+	FSize  *uint64 // RLIMIT_FSIZE: Maximum size of a file the job may write, in bytes.
+	Stack  *uint64 // RLIMIT_STACK: Maximum stack size in bytes.
+	NProc  *uint64 // RLIMIT_NPROC: Maximum number of processes for the job's user. Not enforced for root.
+}
+
+// rlimitField is one of the limits in Rlimits.
+type rlimitField struct {
+	name     string
+	resource int
+	limit    **uint64
+}
+
+func (r *Rlimits) fields() []rlimitField {
+	return []rlimitField{
+		{"nofile", unix.RLIMIT_NOFILE, &r.NoFile},
+		{"core", unix.RLIMIT_CORE, &r.Core},
+		{"fsize", unix.RLIMIT_FSIZE, &r.FSize},
+		{"stack", unix.RLIMIT_STACK, &r.Stack},
+		{"nproc", unix.RLIMIT_NPROC, &r.NProc},
+	}
+}
+
+// ParseRlimits parses a list of "name=value" limits, such as "nofile=1024",
+// into Rlimits. The names are "nofile", "core", "fsize", "stack" and "nproc".
+func ParseRlimits(specs []string) (Rlimits, error) {
+	var r Rlimits
+	for _, spec := range specs {
+		name, value, ok := strings.Cut(spec, "=")
+		if !ok {
+			return Rlimits{}, fmt.Errorf("invalid resource limit %q (expected name=value)", spec)
+		}
+		limit, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return Rlimits{}, fmt.Errorf("invalid resource limit %q: %w", spec, err)
+		}
+		found := false
+		for _, f := range r.fields() {
+			if f.name == name {
+				*f.limit = &limit
+				found = true
+			}
+		}
+		if !found {
+			return Rlimits{}, fmt.Errorf("unknown resource limit %q", name)
+		}
+	}
+	return r, nil
+}
+
+// IsZero returns true if no limit is set.
+func (r Rlimits) IsZero() bool {
+	return r == Rlimits{}
+}
+
+// Within checks the limits against the given ceilings, and returns the limits
+// to apply to the job. Limits that are not set default to their ceiling.
+// Returns ErrRlimitExceedsCeiling if a limit is above its ceiling.
+func (r Rlimits) Within(ceilings Rlimits) (Rlimits, error) {
+	ceilingFields := ceilings.fields()
+	for i, f := range r.fields() {
+		ceiling := *ceilingFields[i].limit
+		switch {
+		case ceiling == nil:
+		case *f.limit == nil:
+			*f.limit = ceiling
+		case **f.limit > *ceiling:
+			return Rlimits{}, fmt.Errorf("%w: %s %d is above %d", ErrRlimitExceedsCeiling, f.name, **f.limit, *ceiling)
+		}
+	}
+	return r, nil
+}
+
+// apply sets the limits on the calling process. It is called by the job init
+// process, so the limits are inherited by the job's command.
+func (r Rlimits) apply() error {
+	for _, f := range r.fields() {
+		if *f.limit == nil {
+			continue
+		}
+		// syscall.Setrlimit is used rather than unix.Setrlimit, so that the Go
+		// runtime does not restore its original RLIMIT_NOFILE on exec.
+		lim := &syscall.Rlimit{Cur: **f.limit, Max: **f.limit}
+		if err := syscall.Setrlimit(f.resource, lim); err != nil {
+			return fmt.Errorf("failed to set %s limit: %w", f.name, err)
+		}
+	}
+	return nil
+}
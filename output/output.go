@@ -13,10 +13,12 @@ import (
 // via Subscribe each maintain an independent read offset and block until new
 // data is available or the buffer is closed.
 type Buffer struct {
-	mu     sync.Mutex
-	cond   *sync.Cond
-	buf    []byte
-	closed bool
+	mu        sync.Mutex
+	cond      *sync.Cond
+	buf       []byte
+	closed    bool
+	max       int  // Most bytes the buffer keeps. If 0, it is not capped.
+	truncated bool // If true, writes past max have been discarded.
 }
 
 // NewBuffer creates new buffer
@@ -29,6 +31,10 @@ func NewBuffer() *Buffer {
 	return b
 }
 
+// TruncatedMarker is appended to a capped buffer once it is full, after
+// which further writes are discarded.
+const TruncatedMarker = "\n[output truncated]\n"
+
 // ErrClosed is returned by Write when the buffer has already been closed.
 var ErrClosed = errors.New("write to closed buffer")
 
@@ -41,11 +47,31 @@ func (b *Buffer) Write(p []byte) (int, error) {
 	if b.closed {
 		return 0, ErrClosed
 	}
-	b.buf = append(b.buf, p...)
+	if b.truncated {
+		return len(p), nil
+	}
+	if b.max > 0 && len(b.buf)+len(p) > b.max {
+		b.buf = append(b.buf, p[:max(0, b.max-len(b.buf))]...)
+		b.buf = append(b.buf, TruncatedMarker...)
+		b.truncated = true
+	} else {
+		b.buf = append(b.buf, p...)
+	}
 	b.cond.Broadcast()
 	return len(p), nil
 }
 
+// SetMax caps the buffer at n bytes, plus TruncatedMarker. Writes past the
+// cap are discarded, but still succeed, so that the writer, such as a job,
+// keeps running. It must be called before the first write. If n is 0, the
+// buffer is not capped.
+func (b *Buffer) SetMax(n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.max = n
+}
+
 // Close marks the buffer as complete. Subsequent subscriber reads that have
 // consumed all data will return io.EOF.
 func (b *Buffer) Close() {
@@ -56,6 +82,14 @@ func (b *Buffer) Close() {
 	b.cond.Broadcast()
 }
 
+// Len returns the number of bytes written to the buffer.
+func (b *Buffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.buf)
+}
+
 // Subscribe returns a new subscriber starting at offset 0. The caller must
 // call Close when done reading.
 func (b *Buffer) Subscribe() io.ReadCloser {
@@ -21,6 +21,9 @@ func TestWriteAndRead(t *testing.T) {
 		t.Fatalf("Write failed: %v", err)
 	}
 	buf.Close()
+	if buf.Len() != len(data) {
+		t.Fatalf("expected Len %d, got %d", len(data), buf.Len())
+	}
 
 	sub := buf.Subscribe()
 	got := make([]byte, 64)
@@ -56,6 +59,25 @@ func TestSubscriberReadsFromBeginning(t *testing.T) {
 	}
 }
 
+func TestSetMax(t *testing.T) {
+	buf := output.NewBuffer()
+	buf.SetMax(8)
+	for _, s := range []string{"hello ", "world", "again"} {
+		if n, err := buf.Write([]byte(s)); err != nil || n != len(s) {
+			t.Fatalf("Write(%q) = %d, %v, expected the write to succeed", s, n, err)
+		}
+	}
+	buf.Close()
+
+	got, err := io.ReadAll(buf.Subscribe())
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	if want := "hello wo" + output.TruncatedMarker; string(got) != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
 func TestReadReturnsEOFOnClose(t *testing.T) {
 	buf := output.NewBuffer()
 	sub := buf.Subscribe()
@@ -0,0 +1,50 @@
+// Package overlay mounts and unmounts overlayfs filesystems.
+package overlay
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// Mount mounts an overlayfs at target. The lower directories are read-only and
+// are listed from the top-most layer to the bottom-most layer, which is the
+// order overlayfs expects. Writes go to upper, and work must be an empty
+// directory on the same filesystem as upper.
+//
+// See: https://docs.kernel.org/filesystems/overlayfs.html
+func Mount(target string, lower []string, upper, work string) error {
+	if len(lower) == 0 {
+		return fmt.Errorf("overlay requires at least one lower directory")
+	}
+
+	// The mount options are a comma separated list, and lowerdir is a colon
+	// separated list. Rather than escaping, reject paths that would be
+	// misinterpreted by the kernel.
+	for _, dir := range append([]string{upper, work}, lower...) {
+		if strings.ContainsAny(dir, ",:") {
+			return fmt.Errorf("overlay path %q must not contain ',' or ':'", dir)
+		}
+	}
+
+	opts := fmt.Sprintf(
+		"lowerdir=%s,upperdir=%s,workdir=%s",
+		strings.Join(lower, ":"),
+		upper,
+		work,
+	)
+	if err := unix.Mount("overlay", target, "overlay", 0, opts); err != nil {
+		return fmt.Errorf("failed to mount overlay at %s: %w", target, err)
+	}
+	return nil
+}
+
+// Unmount lazily detaches the overlay mounted at target. A lazy unmount is
+// used so that a process which is still exiting does not keep the mount busy.
+func Unmount(target string) error {
+	if err := unix.Unmount(target, unix.MNT_DETACH); err != nil {
+		return fmt.Errorf("failed to unmount %s: %w", target, err)
+	}
+	return nil
+}
@@ -79,29 +79,1724 @@ func (JobStatus) EnumDescriptor() ([]byte, []int) {
 	return file_proto_teleworker_v1_teleworker_proto_rawDescGZIP(), []int{0}
 }
 
+type TerminationReason int32
+
+const (
+	TerminationReason_TERMINATION_REASON_UNSPECIFIED     TerminationReason = 0
+	TerminationReason_TERMINATION_REASON_EXITED          TerminationReason = 1 // The job exited on its own, whether or not it succeeded.
+	TerminationReason_TERMINATION_REASON_SIGNALED        TerminationReason = 2 // The job was killed by a signal that did not come from the server.
+	TerminationReason_TERMINATION_REASON_OOM_KILLED      TerminationReason = 3 // The job was killed for using more memory than its limit.
+	TerminationReason_TERMINATION_REASON_TIMED_OUT       TerminationReason = 4 // The job ran past its time limit.
+	TerminationReason_TERMINATION_REASON_STOPPED_BY_USER TerminationReason = 5 // The job was stopped with StopJob.
+)
+
+// Enum value maps for TerminationReason.
+var (
+	TerminationReason_name = map[int32]string{
+		0: "TERMINATION_REASON_UNSPECIFIED",
+		1: "TERMINATION_REASON_EXITED",
+		2: "TERMINATION_REASON_SIGNALED",
+		3: "TERMINATION_REASON_OOM_KILLED",
+		4: "TERMINATION_REASON_TIMED_OUT",
+		5: "TERMINATION_REASON_STOPPED_BY_USER",
+	}
+	TerminationReason_value = map[string]int32{
+		"TERMINATION_REASON_UNSPECIFIED":     0,
+		"TERMINATION_REASON_EXITED":          1,
+		"TERMINATION_REASON_SIGNALED":        2,
+		"TERMINATION_REASON_OOM_KILLED":      3,
+		"TERMINATION_REASON_TIMED_OUT":       4,
+		"TERMINATION_REASON_STOPPED_BY_USER": 5,
+	}
+)
+
+func (x TerminationReason) Enum() *TerminationReason {
+	p := new(TerminationReason)
+	*p = x
+	return p
+}
+
+func (x TerminationReason) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (TerminationReason) Descriptor() protoreflect.EnumDescriptor {
+	return file_proto_teleworker_v1_teleworker_proto_enumTypes[1].Descriptor()
+}
+
+func (TerminationReason) Type() protoreflect.EnumType {
+	return &file_proto_teleworker_v1_teleworker_proto_enumTypes[1]
+}
+
+func (x TerminationReason) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use TerminationReason.Descriptor instead.
+func (TerminationReason) EnumDescriptor() ([]byte, []int) {
+	return file_proto_teleworker_v1_teleworker_proto_rawDescGZIP(), []int{1}
+}
+
+type Permission int32
+
+const (
+	Permission_PERMISSION_UNSPECIFIED Permission = 0
+	Permission_PERMISSION_VIEW        Permission = 1 // Get the job's status and stats.
+	Permission_PERMISSION_LOGS        Permission = 2 // Stream the job's output.
+	Permission_PERMISSION_STOP        Permission = 3 // Stop the job.
+)
+
+// Enum value maps for Permission.
+var (
+	Permission_name = map[int32]string{
+		0: "PERMISSION_UNSPECIFIED",
+		1: "PERMISSION_VIEW",
+		2: "PERMISSION_LOGS",
+		3: "PERMISSION_STOP",
+	}
+	Permission_value = map[string]int32{
+		"PERMISSION_UNSPECIFIED": 0,
+		"PERMISSION_VIEW":        1,
+		"PERMISSION_LOGS":        2,
+		"PERMISSION_STOP":        3,
+	}
+)
+
+func (x Permission) Enum() *Permission {
+	p := new(Permission)
+	*p = x
+	return p
+}
+
+func (x Permission) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Permission) Descriptor() protoreflect.EnumDescriptor {
+	return file_proto_teleworker_v1_teleworker_proto_enumTypes[2].Descriptor()
+}
+
+func (Permission) Type() protoreflect.EnumType {
+	return &file_proto_teleworker_v1_teleworker_proto_enumTypes[2]
+}
+
+func (x Permission) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Permission.Descriptor instead.
+func (Permission) EnumDescriptor() ([]byte, []int) {
+	return file_proto_teleworker_v1_teleworker_proto_rawDescGZIP(), []int{2}
+}
+
 type StartJobRequest struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Command        string                 `protobuf:"bytes,1,opt,name=command,proto3" json:"command,omitempty"`                                               // Command to run.
+	Args           []string               `protobuf:"bytes,2,rep,name=args,proto3" json:"args,omitempty"`                                                     // Arguments to give to the command.
+	Image          string                 `protobuf:"bytes,3,opt,name=image,proto3" json:"image,omitempty"`                                                   // Optional path to an OCI image layout directory or tarball on the server.
+	Rlimits        *Rlimits               `protobuf:"bytes,4,opt,name=rlimits,proto3" json:"rlimits,omitempty"`                                               // Optional POSIX resource limits for the job.
+	PidsMax        int64                  `protobuf:"varint,5,opt,name=pids_max,json=pidsMax,proto3" json:"pids_max,omitempty"`                               // Optional maximum number of processes in the job. 0 uses the server's default, which is also the highest allowed.
+	Cpus           string                 `protobuf:"bytes,6,opt,name=cpus,proto3" json:"cpus,omitempty"`                                                     // Optional CPUs to pin the job to, in the cpuset list format, e.g. "0-3,6".
+	Mems           string                 `protobuf:"bytes,7,opt,name=mems,proto3" json:"mems,omitempty"`                                                     // Optional NUMA memory nodes to pin the job to, in the same format.
+	ExclusiveCpus  uint32                 `protobuf:"varint,8,opt,name=exclusive_cpus,json=exclusiveCpus,proto3" json:"exclusive_cpus,omitempty"`             // Optional number of CPUs to dedicate to the job. Can not be combined with cpus.
+	MemoryHigh     int64                  `protobuf:"varint,9,opt,name=memory_high,json=memoryHigh,proto3" json:"memory_high,omitempty"`                      // Optional memory in bytes above which the job is throttled. Must not exceed the server's memory limit.
+	MemorySwapMax  *int64                 `protobuf:"varint,10,opt,name=memory_swap_max,json=memorySwapMax,proto3,oneof" json:"memory_swap_max,omitempty"`    // Optional swap in bytes the job may use. 0 disables swap.
+	MemoryOomGroup *bool                  `protobuf:"varint,11,opt,name=memory_oom_group,json=memoryOomGroup,proto3,oneof" json:"memory_oom_group,omitempty"` // Optional. If true, an OOM kill kills the whole job rather than one process. Defaults to true.
+	OnBehalfOf     string                 `protobuf:"bytes,12,opt,name=on_behalf_of,json=onBehalfOf,proto3" json:"on_behalf_of,omitempty"`                    // Optional user to start the job for. Only callers the policy allows to impersonate, such as admins, may set it. The job belongs to, and counts towards the quota of, that user.
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *StartJobRequest) Reset() {
+	*x = StartJobRequest{}
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StartJobRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StartJobRequest) ProtoMessage() {}
+
+func (x *StartJobRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StartJobRequest.ProtoReflect.Descriptor instead.
+func (*StartJobRequest) Descriptor() ([]byte, []int) {
+	return file_proto_teleworker_v1_teleworker_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *StartJobRequest) GetCommand() string {
+	if x != nil {
+		return x.Command
+	}
+	return ""
+}
+
+func (x *StartJobRequest) GetArgs() []string {
+	if x != nil {
+		return x.Args
+	}
+	return nil
+}
+
+func (x *StartJobRequest) GetImage() string {
+	if x != nil {
+		return x.Image
+	}
+	return ""
+}
+
+func (x *StartJobRequest) GetRlimits() *Rlimits {
+	if x != nil {
+		return x.Rlimits
+	}
+	return nil
+}
+
+func (x *StartJobRequest) GetPidsMax() int64 {
+	if x != nil {
+		return x.PidsMax
+	}
+	return 0
+}
+
+func (x *StartJobRequest) GetCpus() string {
+	if x != nil {
+		return x.Cpus
+	}
+	return ""
+}
+
+func (x *StartJobRequest) GetMems() string {
+	if x != nil {
+		return x.Mems
+	}
+	return ""
+}
+
+func (x *StartJobRequest) GetExclusiveCpus() uint32 {
+	if x != nil {
+		return x.ExclusiveCpus
+	}
+	return 0
+}
+
+func (x *StartJobRequest) GetMemoryHigh() int64 {
+	if x != nil {
+		return x.MemoryHigh
+	}
+	return 0
+}
+
+func (x *StartJobRequest) GetMemorySwapMax() int64 {
+	if x != nil && x.MemorySwapMax != nil {
+		return *x.MemorySwapMax
+	}
+	return 0
+}
+
+func (x *StartJobRequest) GetMemoryOomGroup() bool {
+	if x != nil && x.MemoryOomGroup != nil {
+		return *x.MemoryOomGroup
+	}
+	return false
+}
+
+func (x *StartJobRequest) GetOnBehalfOf() string {
+	if x != nil {
+		return x.OnBehalfOf
+	}
+	return ""
+}
+
+// POSIX resource limits for a job. Each limit sets both the soft and the hard
+// limit. Limits that are not set default to the server's ceiling, if it has
+// one, and may not exceed it.
+type Rlimits struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Nofile        *uint64                `protobuf:"varint,1,opt,name=nofile,proto3,oneof" json:"nofile,omitempty"` // Maximum number of open file descriptors.
+	Core          *uint64                `protobuf:"varint,2,opt,name=core,proto3,oneof" json:"core,omitempty"`     // Maximum core dump size in bytes.
+	Fsize         *uint64                `protobuf:"varint,3,opt,name=fsize,proto3,oneof" json:"fsize,omitempty"`   // Maximum size of a file the job may write, in bytes.
+	Stack         *uint64                `protobuf:"varint,4,opt,name=stack,proto3,oneof" json:"stack,omitempty"`   // Maximum stack size in bytes.
+	Nproc         *uint64                `protobuf:"varint,5,opt,name=nproc,proto3,oneof" json:"nproc,omitempty"`   // Maximum number of processes for the job's user.
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Rlimits) Reset() {
+	*x = Rlimits{}
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Rlimits) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Rlimits) ProtoMessage() {}
+
+func (x *Rlimits) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Rlimits.ProtoReflect.Descriptor instead.
+func (*Rlimits) Descriptor() ([]byte, []int) {
+	return file_proto_teleworker_v1_teleworker_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Rlimits) GetNofile() uint64 {
+	if x != nil && x.Nofile != nil {
+		return *x.Nofile
+	}
+	return 0
+}
+
+func (x *Rlimits) GetCore() uint64 {
+	if x != nil && x.Core != nil {
+		return *x.Core
+	}
+	return 0
+}
+
+func (x *Rlimits) GetFsize() uint64 {
+	if x != nil && x.Fsize != nil {
+		return *x.Fsize
+	}
+	return 0
+}
+
+func (x *Rlimits) GetStack() uint64 {
+	if x != nil && x.Stack != nil {
+		return *x.Stack
+	}
+	return 0
+}
+
+func (x *Rlimits) GetNproc() uint64 {
+	if x != nil && x.Nproc != nil {
+		return *x.Nproc
+	}
+	return 0
+}
+
+type StartJobResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	JobId         string                 `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"` // Only contains ID for the job that was submitted.
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StartJobResponse) Reset() {
+	*x = StartJobResponse{}
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StartJobResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StartJobResponse) ProtoMessage() {}
+
+func (x *StartJobResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StartJobResponse.ProtoReflect.Descriptor instead.
+func (*StartJobResponse) Descriptor() ([]byte, []int) {
+	return file_proto_teleworker_v1_teleworker_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *StartJobResponse) GetJobId() string {
+	if x != nil {
+		return x.JobId
+	}
+	return ""
+}
+
+// Query the status of the job, used by `telerun status ...`
+type GetJobStatusRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	JobId         string                 `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetJobStatusRequest) Reset() {
+	*x = GetJobStatusRequest{}
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetJobStatusRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetJobStatusRequest) ProtoMessage() {}
+
+func (x *GetJobStatusRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetJobStatusRequest.ProtoReflect.Descriptor instead.
+func (*GetJobStatusRequest) Descriptor() ([]byte, []int) {
+	return file_proto_teleworker_v1_teleworker_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *GetJobStatusRequest) GetJobId() string {
+	if x != nil {
+		return x.JobId
+	}
+	return ""
+}
+
+type GetJobStatusResponse struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	JobId             string                 `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+	Status            JobStatus              `protobuf:"varint,2,opt,name=status,proto3,enum=teleworker.v1.JobStatus" json:"status,omitempty"`
+	ExitCode          *int32                 `protobuf:"varint,3,opt,name=exit_code,json=exitCode,proto3,oneof" json:"exit_code,omitempty"`
+	PidsMaxHits       int64                  `protobuf:"varint,4,opt,name=pids_max_hits,json=pidsMaxHits,proto3" json:"pids_max_hits,omitempty"`                                                      // Number of times a process in the job failed to fork because the job reached its process limit.
+	TerminationReason TerminationReason      `protobuf:"varint,5,opt,name=termination_reason,json=terminationReason,proto3,enum=teleworker.v1.TerminationReason" json:"termination_reason,omitempty"` // Why the job stopped running. Unspecified while it is running.
+	Usage             *JobUsage              `protobuf:"bytes,6,opt,name=usage,proto3" json:"usage,omitempty"`                                                                                        // Resources the job used over its lifetime. Unset while it is running, or if it ran without a cgroup.
+	Cpus              string                 `protobuf:"bytes,7,opt,name=cpus,proto3" json:"cpus,omitempty"`                                                                                          // CPUs the job is pinned to, including exclusive CPUs. Empty if it is not pinned or has not started.
+	Mems              string                 `protobuf:"bytes,8,opt,name=mems,proto3" json:"mems,omitempty"`                                                                                          // NUMA memory nodes the job is pinned to. Empty if it is not pinned.
+	Owner             string                 `protobuf:"bytes,9,opt,name=owner,proto3" json:"owner,omitempty"`                                                                                        // User the job belongs to.
+	StartedBy         string                 `protobuf:"bytes,10,opt,name=started_by,json=startedBy,proto3" json:"started_by,omitempty"`                                                              // Admin who started the job on its owner's behalf. Empty if the owner started it.
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *GetJobStatusResponse) Reset() {
+	*x = GetJobStatusResponse{}
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetJobStatusResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetJobStatusResponse) ProtoMessage() {}
+
+func (x *GetJobStatusResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetJobStatusResponse.ProtoReflect.Descriptor instead.
+func (*GetJobStatusResponse) Descriptor() ([]byte, []int) {
+	return file_proto_teleworker_v1_teleworker_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *GetJobStatusResponse) GetJobId() string {
+	if x != nil {
+		return x.JobId
+	}
+	return ""
+}
+
+func (x *GetJobStatusResponse) GetStatus() JobStatus {
+	if x != nil {
+		return x.Status
+	}
+	return JobStatus_JOB_STATUS_UNSPECIFIED
+}
+
+func (x *GetJobStatusResponse) GetExitCode() int32 {
+	if x != nil && x.ExitCode != nil {
+		return *x.ExitCode
+	}
+	return 0
+}
+
+func (x *GetJobStatusResponse) GetPidsMaxHits() int64 {
+	if x != nil {
+		return x.PidsMaxHits
+	}
+	return 0
+}
+
+func (x *GetJobStatusResponse) GetTerminationReason() TerminationReason {
+	if x != nil {
+		return x.TerminationReason
+	}
+	return TerminationReason_TERMINATION_REASON_UNSPECIFIED
+}
+
+func (x *GetJobStatusResponse) GetUsage() *JobUsage {
+	if x != nil {
+		return x.Usage
+	}
+	return nil
+}
+
+func (x *GetJobStatusResponse) GetCpus() string {
+	if x != nil {
+		return x.Cpus
+	}
+	return ""
+}
+
+func (x *GetJobStatusResponse) GetMems() string {
+	if x != nil {
+		return x.Mems
+	}
+	return ""
+}
+
+func (x *GetJobStatusResponse) GetOwner() string {
+	if x != nil {
+		return x.Owner
+	}
+	return ""
+}
+
+func (x *GetJobStatusResponse) GetStartedBy() string {
+	if x != nil {
+		return x.StartedBy
+	}
+	return ""
+}
+
+// Final resource accounting for a job, taken just before its cgroup is
+// removed. Times are in microseconds and sizes in bytes.
+type JobUsage struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	CpuUsec       uint64                 `protobuf:"varint,1,opt,name=cpu_usec,json=cpuUsec,proto3" json:"cpu_usec,omitempty"`
+	UserUsec      uint64                 `protobuf:"varint,2,opt,name=user_usec,json=userUsec,proto3" json:"user_usec,omitempty"`
+	SystemUsec    uint64                 `protobuf:"varint,3,opt,name=system_usec,json=systemUsec,proto3" json:"system_usec,omitempty"`
+	MemoryPeak    uint64                 `protobuf:"varint,4,opt,name=memory_peak,json=memoryPeak,proto3" json:"memory_peak,omitempty"` // 0 if the server's kernel does not report it.
+	ReadBytes     uint64                 `protobuf:"varint,5,opt,name=read_bytes,json=readBytes,proto3" json:"read_bytes,omitempty"`    // Summed over all block devices.
+	WriteBytes    uint64                 `protobuf:"varint,6,opt,name=write_bytes,json=writeBytes,proto3" json:"write_bytes,omitempty"` // Summed over all block devices.
+	PidsPeak      uint64                 `protobuf:"varint,7,opt,name=pids_peak,json=pidsPeak,proto3" json:"pids_peak,omitempty"`       // 0 if the server's kernel does not report it.
+	NrThrottled   uint64                 `protobuf:"varint,8,opt,name=nr_throttled,json=nrThrottled,proto3" json:"nr_throttled,omitempty"`
+	ThrottledUsec uint64                 `protobuf:"varint,9,opt,name=throttled_usec,json=throttledUsec,proto3" json:"throttled_usec,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *JobUsage) Reset() {
+	*x = JobUsage{}
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *JobUsage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*JobUsage) ProtoMessage() {}
+
+func (x *JobUsage) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use JobUsage.ProtoReflect.Descriptor instead.
+func (*JobUsage) Descriptor() ([]byte, []int) {
+	return file_proto_teleworker_v1_teleworker_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *JobUsage) GetCpuUsec() uint64 {
+	if x != nil {
+		return x.CpuUsec
+	}
+	return 0
+}
+
+func (x *JobUsage) GetUserUsec() uint64 {
+	if x != nil {
+		return x.UserUsec
+	}
+	return 0
+}
+
+func (x *JobUsage) GetSystemUsec() uint64 {
+	if x != nil {
+		return x.SystemUsec
+	}
+	return 0
+}
+
+func (x *JobUsage) GetMemoryPeak() uint64 {
+	if x != nil {
+		return x.MemoryPeak
+	}
+	return 0
+}
+
+func (x *JobUsage) GetReadBytes() uint64 {
+	if x != nil {
+		return x.ReadBytes
+	}
+	return 0
+}
+
+func (x *JobUsage) GetWriteBytes() uint64 {
+	if x != nil {
+		return x.WriteBytes
+	}
+	return 0
+}
+
+func (x *JobUsage) GetPidsPeak() uint64 {
+	if x != nil {
+		return x.PidsPeak
+	}
+	return 0
+}
+
+func (x *JobUsage) GetNrThrottled() uint64 {
+	if x != nil {
+		return x.NrThrottled
+	}
+	return 0
+}
+
+func (x *JobUsage) GetThrottledUsec() uint64 {
+	if x != nil {
+		return x.ThrottledUsec
+	}
+	return 0
+}
+
+// Request the output of stdout and stderr, used by `telerun logs ...`
+type StreamOutputRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	JobId         string                 `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamOutputRequest) Reset() {
+	*x = StreamOutputRequest{}
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamOutputRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamOutputRequest) ProtoMessage() {}
+
+func (x *StreamOutputRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamOutputRequest.ProtoReflect.Descriptor instead.
+func (*StreamOutputRequest) Descriptor() ([]byte, []int) {
+	return file_proto_teleworker_v1_teleworker_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *StreamOutputRequest) GetJobId() string {
+	if x != nil {
+		return x.JobId
+	}
+	return ""
+}
+
+// Receive the output of stdout and stderr, used by `telerun logs ...`
+type StreamOutputResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Data          []byte                 `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamOutputResponse) Reset() {
+	*x = StreamOutputResponse{}
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamOutputResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamOutputResponse) ProtoMessage() {}
+
+func (x *StreamOutputResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamOutputResponse.ProtoReflect.Descriptor instead.
+func (*StreamOutputResponse) Descriptor() ([]byte, []int) {
+	return file_proto_teleworker_v1_teleworker_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *StreamOutputResponse) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+type StopJobRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	JobId         string                 `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StopJobRequest) Reset() {
+	*x = StopJobRequest{}
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StopJobRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StopJobRequest) ProtoMessage() {}
+
+func (x *StopJobRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StopJobRequest.ProtoReflect.Descriptor instead.
+func (*StopJobRequest) Descriptor() ([]byte, []int) {
+	return file_proto_teleworker_v1_teleworker_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *StopJobRequest) GetJobId() string {
+	if x != nil {
+		return x.JobId
+	}
+	return ""
+}
+
+type StopJobResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StopJobResponse) Reset() {
+	*x = StopJobResponse{}
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StopJobResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StopJobResponse) ProtoMessage() {}
+
+func (x *StopJobResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StopJobResponse.ProtoReflect.Descriptor instead.
+func (*StopJobResponse) Descriptor() ([]byte, []int) {
+	return file_proto_teleworker_v1_teleworker_proto_rawDescGZIP(), []int{9}
+}
+
+// Query the resource usage of a running job, used by `telerun stats ...`
+type GetJobStatsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	JobId         string                 `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetJobStatsRequest) Reset() {
+	*x = GetJobStatsRequest{}
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetJobStatsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetJobStatsRequest) ProtoMessage() {}
+
+func (x *GetJobStatsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetJobStatsRequest.ProtoReflect.Descriptor instead.
+func (*GetJobStatsRequest) Descriptor() ([]byte, []int) {
+	return file_proto_teleworker_v1_teleworker_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *GetJobStatsRequest) GetJobId() string {
+	if x != nil {
+		return x.JobId
+	}
+	return ""
+}
+
+type GetJobStatsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	JobId         string                 `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+	Stats         *JobStats              `protobuf:"bytes,2,opt,name=stats,proto3" json:"stats,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetJobStatsResponse) Reset() {
+	*x = GetJobStatsResponse{}
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetJobStatsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetJobStatsResponse) ProtoMessage() {}
+
+func (x *GetJobStatsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetJobStatsResponse.ProtoReflect.Descriptor instead.
+func (*GetJobStatsResponse) Descriptor() ([]byte, []int) {
+	return file_proto_teleworker_v1_teleworker_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *GetJobStatsResponse) GetJobId() string {
+	if x != nil {
+		return x.JobId
+	}
+	return ""
+}
+
+func (x *GetJobStatsResponse) GetStats() *JobStats {
+	if x != nil {
+		return x.Stats
+	}
+	return nil
+}
+
+// Sample the resource usage of a running job until it exits, used by
+// `telerun top ...`
+type WatchJobStatsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	JobId         string                 `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+	IntervalMs    uint32                 `protobuf:"varint,2,opt,name=interval_ms,json=intervalMs,proto3" json:"interval_ms,omitempty"` // Time between samples. The server enforces a minimum, and uses a default if 0.
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchJobStatsRequest) Reset() {
+	*x = WatchJobStatsRequest{}
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchJobStatsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchJobStatsRequest) ProtoMessage() {}
+
+func (x *WatchJobStatsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchJobStatsRequest.ProtoReflect.Descriptor instead.
+func (*WatchJobStatsRequest) Descriptor() ([]byte, []int) {
+	return file_proto_teleworker_v1_teleworker_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *WatchJobStatsRequest) GetJobId() string {
+	if x != nil {
+		return x.JobId
+	}
+	return ""
+}
+
+func (x *WatchJobStatsRequest) GetIntervalMs() uint32 {
+	if x != nil {
+		return x.IntervalMs
+	}
+	return 0
+}
+
+// Resource usage read from a job's cgroup.
+type JobStats struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Cpu           *CpuStats              `protobuf:"bytes,1,opt,name=cpu,proto3" json:"cpu,omitempty"`
+	Memory        *MemoryStats           `protobuf:"bytes,2,opt,name=memory,proto3" json:"memory,omitempty"`
+	Io            []*IoStats             `protobuf:"bytes,3,rep,name=io,proto3" json:"io,omitempty"`                                       // One entry per block device the job has used.
+	PidsCurrent   uint64                 `protobuf:"varint,4,opt,name=pids_current,json=pidsCurrent,proto3" json:"pids_current,omitempty"` // Number of processes and threads in the job.
+	Pressure      *Pressure              `protobuf:"bytes,5,opt,name=pressure,proto3" json:"pressure,omitempty"`                           // Unset if the server's kernel does not report pressure stall information.
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *JobStats) Reset() {
+	*x = JobStats{}
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *JobStats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*JobStats) ProtoMessage() {}
+
+func (x *JobStats) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use JobStats.ProtoReflect.Descriptor instead.
+func (*JobStats) Descriptor() ([]byte, []int) {
+	return file_proto_teleworker_v1_teleworker_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *JobStats) GetCpu() *CpuStats {
+	if x != nil {
+		return x.Cpu
+	}
+	return nil
+}
+
+func (x *JobStats) GetMemory() *MemoryStats {
+	if x != nil {
+		return x.Memory
+	}
+	return nil
+}
+
+func (x *JobStats) GetIo() []*IoStats {
+	if x != nil {
+		return x.Io
+	}
+	return nil
+}
+
+func (x *JobStats) GetPidsCurrent() uint64 {
+	if x != nil {
+		return x.PidsCurrent
+	}
+	return 0
+}
+
+func (x *JobStats) GetPressure() *Pressure {
+	if x != nil {
+		return x.Pressure
+	}
+	return nil
+}
+
+// Pressure stall information: how long tasks in the job waited for each
+// resource. See: https://docs.kernel.org/accounting/psi.html
+type Pressure struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Cpu           *PressureStats         `protobuf:"bytes,1,opt,name=cpu,proto3" json:"cpu,omitempty"`
+	Memory        *PressureStats         `protobuf:"bytes,2,opt,name=memory,proto3" json:"memory,omitempty"`
+	Io            *PressureStats         `protobuf:"bytes,3,opt,name=io,proto3" json:"io,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Pressure) Reset() {
+	*x = Pressure{}
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Pressure) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Pressure) ProtoMessage() {}
+
+func (x *Pressure) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Pressure.ProtoReflect.Descriptor instead.
+func (*Pressure) Descriptor() ([]byte, []int) {
+	return file_proto_teleworker_v1_teleworker_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *Pressure) GetCpu() *PressureStats {
+	if x != nil {
+		return x.Cpu
+	}
+	return nil
+}
+
+func (x *Pressure) GetMemory() *PressureStats {
+	if x != nil {
+		return x.Memory
+	}
+	return nil
+}
+
+func (x *Pressure) GetIo() *PressureStats {
+	if x != nil {
+		return x.Io
+	}
+	return nil
+}
+
+type PressureStats struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Some          *PressureLine          `protobuf:"bytes,1,opt,name=some,proto3" json:"some,omitempty"` // Time at least one task was stalled.
+	Full          *PressureLine          `protobuf:"bytes,2,opt,name=full,proto3" json:"full,omitempty"` // Time all tasks were stalled at once.
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PressureStats) Reset() {
+	*x = PressureStats{}
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PressureStats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PressureStats) ProtoMessage() {}
+
+func (x *PressureStats) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PressureStats.ProtoReflect.Descriptor instead.
+func (*PressureStats) Descriptor() ([]byte, []int) {
+	return file_proto_teleworker_v1_teleworker_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *PressureStats) GetSome() *PressureLine {
+	if x != nil {
+		return x.Some
+	}
+	return nil
+}
+
+func (x *PressureStats) GetFull() *PressureLine {
+	if x != nil {
+		return x.Full
+	}
+	return nil
+}
+
+// Averages are percentages of wall time.
+type PressureLine struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Avg10         float64                `protobuf:"fixed64,1,opt,name=avg10,proto3" json:"avg10,omitempty"`
+	Avg60         float64                `protobuf:"fixed64,2,opt,name=avg60,proto3" json:"avg60,omitempty"`
+	Avg300        float64                `protobuf:"fixed64,3,opt,name=avg300,proto3" json:"avg300,omitempty"`
+	TotalUsec     uint64                 `protobuf:"varint,4,opt,name=total_usec,json=totalUsec,proto3" json:"total_usec,omitempty"` // Total stall time.
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PressureLine) Reset() {
+	*x = PressureLine{}
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PressureLine) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PressureLine) ProtoMessage() {}
+
+func (x *PressureLine) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PressureLine.ProtoReflect.Descriptor instead.
+func (*PressureLine) Descriptor() ([]byte, []int) {
+	return file_proto_teleworker_v1_teleworker_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *PressureLine) GetAvg10() float64 {
+	if x != nil {
+		return x.Avg10
+	}
+	return 0
+}
+
+func (x *PressureLine) GetAvg60() float64 {
+	if x != nil {
+		return x.Avg60
+	}
+	return 0
+}
+
+func (x *PressureLine) GetAvg300() float64 {
+	if x != nil {
+		return x.Avg300
+	}
+	return 0
+}
+
+func (x *PressureLine) GetTotalUsec() uint64 {
+	if x != nil {
+		return x.TotalUsec
+	}
+	return 0
+}
+
+// From cpu.stat. Times are in microseconds.
+type CpuStats struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UsageUsec     uint64                 `protobuf:"varint,1,opt,name=usage_usec,json=usageUsec,proto3" json:"usage_usec,omitempty"`
+	UserUsec      uint64                 `protobuf:"varint,2,opt,name=user_usec,json=userUsec,proto3" json:"user_usec,omitempty"`
+	SystemUsec    uint64                 `protobuf:"varint,3,opt,name=system_usec,json=systemUsec,proto3" json:"system_usec,omitempty"`
+	NrPeriods     uint64                 `protobuf:"varint,4,opt,name=nr_periods,json=nrPeriods,proto3" json:"nr_periods,omitempty"`
+	NrThrottled   uint64                 `protobuf:"varint,5,opt,name=nr_throttled,json=nrThrottled,proto3" json:"nr_throttled,omitempty"`
+	ThrottledUsec uint64                 `protobuf:"varint,6,opt,name=throttled_usec,json=throttledUsec,proto3" json:"throttled_usec,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CpuStats) Reset() {
+	*x = CpuStats{}
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CpuStats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CpuStats) ProtoMessage() {}
+
+func (x *CpuStats) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CpuStats.ProtoReflect.Descriptor instead.
+func (*CpuStats) Descriptor() ([]byte, []int) {
+	return file_proto_teleworker_v1_teleworker_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *CpuStats) GetUsageUsec() uint64 {
+	if x != nil {
+		return x.UsageUsec
+	}
+	return 0
+}
+
+func (x *CpuStats) GetUserUsec() uint64 {
+	if x != nil {
+		return x.UserUsec
+	}
+	return 0
+}
+
+func (x *CpuStats) GetSystemUsec() uint64 {
+	if x != nil {
+		return x.SystemUsec
+	}
+	return 0
+}
+
+func (x *CpuStats) GetNrPeriods() uint64 {
+	if x != nil {
+		return x.NrPeriods
+	}
+	return 0
+}
+
+func (x *CpuStats) GetNrThrottled() uint64 {
+	if x != nil {
+		return x.NrThrottled
+	}
+	return 0
+}
+
+func (x *CpuStats) GetThrottledUsec() uint64 {
+	if x != nil {
+		return x.ThrottledUsec
+	}
+	return 0
+}
+
+// From memory.current, memory.peak and memory.stat. Sizes are in bytes.
+type MemoryStats struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Current       uint64                 `protobuf:"varint,1,opt,name=current,proto3" json:"current,omitempty"`
+	Peak          uint64                 `protobuf:"varint,2,opt,name=peak,proto3" json:"peak,omitempty"` // 0 if the server's kernel does not report it.
+	Stat          map[string]uint64      `protobuf:"bytes,3,rep,name=stat,proto3" json:"stat,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MemoryStats) Reset() {
+	*x = MemoryStats{}
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MemoryStats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MemoryStats) ProtoMessage() {}
+
+func (x *MemoryStats) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MemoryStats.ProtoReflect.Descriptor instead.
+func (*MemoryStats) Descriptor() ([]byte, []int) {
+	return file_proto_teleworker_v1_teleworker_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *MemoryStats) GetCurrent() uint64 {
+	if x != nil {
+		return x.Current
+	}
+	return 0
+}
+
+func (x *MemoryStats) GetPeak() uint64 {
+	if x != nil {
+		return x.Peak
+	}
+	return 0
+}
+
+func (x *MemoryStats) GetStat() map[string]uint64 {
+	if x != nil {
+		return x.Stat
+	}
+	return nil
+}
+
+// From io.stat, for one block device.
+type IoStats struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Major         uint32                 `protobuf:"varint,1,opt,name=major,proto3" json:"major,omitempty"`
+	Minor         uint32                 `protobuf:"varint,2,opt,name=minor,proto3" json:"minor,omitempty"`
+	Rbytes        uint64                 `protobuf:"varint,3,opt,name=rbytes,proto3" json:"rbytes,omitempty"`
+	Wbytes        uint64                 `protobuf:"varint,4,opt,name=wbytes,proto3" json:"wbytes,omitempty"`
+	Rios          uint64                 `protobuf:"varint,5,opt,name=rios,proto3" json:"rios,omitempty"`
+	Wios          uint64                 `protobuf:"varint,6,opt,name=wios,proto3" json:"wios,omitempty"`
+	Dbytes        uint64                 `protobuf:"varint,7,opt,name=dbytes,proto3" json:"dbytes,omitempty"`
+	Dios          uint64                 `protobuf:"varint,8,opt,name=dios,proto3" json:"dios,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *IoStats) Reset() {
+	*x = IoStats{}
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *IoStats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IoStats) ProtoMessage() {}
+
+func (x *IoStats) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IoStats.ProtoReflect.Descriptor instead.
+func (*IoStats) Descriptor() ([]byte, []int) {
+	return file_proto_teleworker_v1_teleworker_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *IoStats) GetMajor() uint32 {
+	if x != nil {
+		return x.Major
+	}
+	return 0
+}
+
+func (x *IoStats) GetMinor() uint32 {
+	if x != nil {
+		return x.Minor
+	}
+	return 0
+}
+
+func (x *IoStats) GetRbytes() uint64 {
+	if x != nil {
+		return x.Rbytes
+	}
+	return 0
+}
+
+func (x *IoStats) GetWbytes() uint64 {
+	if x != nil {
+		return x.Wbytes
+	}
+	return 0
+}
+
+func (x *IoStats) GetRios() uint64 {
+	if x != nil {
+		return x.Rios
+	}
+	return 0
+}
+
+func (x *IoStats) GetWios() uint64 {
+	if x != nil {
+		return x.Wios
+	}
+	return 0
+}
+
+func (x *IoStats) GetDbytes() uint64 {
+	if x != nil {
+		return x.Dbytes
+	}
+	return 0
+}
+
+func (x *IoStats) GetDios() uint64 {
+	if x != nil {
+		return x.Dios
+	}
+	return 0
+}
+
+// Grant another user, or a group, permissions on a job, used by
+// `telerun share ...`. Only the job's owner, or a caller the server's policy
+// allows to share any job, may share it. Exactly one of user and group must
+// be set.
+type ShareJobRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	JobId         string                 `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+	User          string                 `protobuf:"bytes,2,opt,name=user,proto3" json:"user,omitempty"`                                                     // Username, the CN of their certificate.
+	Group         string                 `protobuf:"bytes,3,opt,name=group,proto3" json:"group,omitempty"`                                                   // Group, an extra OU of a certificate or a "group:<name>" URI SAN.
+	Permissions   []Permission           `protobuf:"varint,4,rep,packed,name=permissions,proto3,enum=teleworker.v1.Permission" json:"permissions,omitempty"` // Added to those the user or group already has.
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ShareJobRequest) Reset() {
+	*x = ShareJobRequest{}
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ShareJobRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ShareJobRequest) ProtoMessage() {}
+
+func (x *ShareJobRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ShareJobRequest.ProtoReflect.Descriptor instead.
+func (*ShareJobRequest) Descriptor() ([]byte, []int) {
+	return file_proto_teleworker_v1_teleworker_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *ShareJobRequest) GetJobId() string {
+	if x != nil {
+		return x.JobId
+	}
+	return ""
+}
+
+func (x *ShareJobRequest) GetUser() string {
+	if x != nil {
+		return x.User
+	}
+	return ""
+}
+
+func (x *ShareJobRequest) GetGroup() string {
+	if x != nil {
+		return x.Group
+	}
+	return ""
+}
+
+func (x *ShareJobRequest) GetPermissions() []Permission {
+	if x != nil {
+		return x.Permissions
+	}
+	return nil
+}
+
+type ShareJobResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Grants        []*JobGrant            `protobuf:"bytes,1,rep,name=grants,proto3" json:"grants,omitempty"` // Everyone the job is now shared with.
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ShareJobResponse) Reset() {
+	*x = ShareJobResponse{}
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ShareJobResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ShareJobResponse) ProtoMessage() {}
+
+func (x *ShareJobResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ShareJobResponse.ProtoReflect.Descriptor instead.
+func (*ShareJobResponse) Descriptor() ([]byte, []int) {
+	return file_proto_teleworker_v1_teleworker_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *ShareJobResponse) GetGrants() []*JobGrant {
+	if x != nil {
+		return x.Grants
+	}
+	return nil
+}
+
+// Revoke permissions on a job, used by `telerun share --revoke ...`.
+type UnshareJobRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	JobId         string                 `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+	User          string                 `protobuf:"bytes,2,opt,name=user,proto3" json:"user,omitempty"`
+	Group         string                 `protobuf:"bytes,3,opt,name=group,proto3" json:"group,omitempty"`
+	Permissions   []Permission           `protobuf:"varint,4,rep,packed,name=permissions,proto3,enum=teleworker.v1.Permission" json:"permissions,omitempty"` // Permissions to revoke. If empty, all are revoked.
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UnshareJobRequest) Reset() {
+	*x = UnshareJobRequest{}
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UnshareJobRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UnshareJobRequest) ProtoMessage() {}
+
+func (x *UnshareJobRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UnshareJobRequest.ProtoReflect.Descriptor instead.
+func (*UnshareJobRequest) Descriptor() ([]byte, []int) {
+	return file_proto_teleworker_v1_teleworker_proto_rawDescGZIP(), []int{22}
+}
+
+func (x *UnshareJobRequest) GetJobId() string {
+	if x != nil {
+		return x.JobId
+	}
+	return ""
+}
+
+func (x *UnshareJobRequest) GetUser() string {
+	if x != nil {
+		return x.User
+	}
+	return ""
+}
+
+func (x *UnshareJobRequest) GetGroup() string {
+	if x != nil {
+		return x.Group
+	}
+	return ""
+}
+
+func (x *UnshareJobRequest) GetPermissions() []Permission {
+	if x != nil {
+		return x.Permissions
+	}
+	return nil
+}
+
+type UnshareJobResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Grants        []*JobGrant            `protobuf:"bytes,1,rep,name=grants,proto3" json:"grants,omitempty"` // Everyone the job is still shared with.
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UnshareJobResponse) Reset() {
+	*x = UnshareJobResponse{}
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[23]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UnshareJobResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UnshareJobResponse) ProtoMessage() {}
+
+func (x *UnshareJobResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[23]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UnshareJobResponse.ProtoReflect.Descriptor instead.
+func (*UnshareJobResponse) Descriptor() ([]byte, []int) {
+	return file_proto_teleworker_v1_teleworker_proto_rawDescGZIP(), []int{23}
+}
+
+func (x *UnshareJobResponse) GetGrants() []*JobGrant {
+	if x != nil {
+		return x.Grants
+	}
+	return nil
+}
+
+// Permissions granted to one user or group on a job.
+type JobGrant struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	Command       string                 `protobuf:"bytes,1,opt,name=command,proto3" json:"command,omitempty"` // Command to run.
-	Args          []string               `protobuf:"bytes,2,rep,name=args,proto3" json:"args,omitempty"`       // Arguments to give to the command.
+	User          string                 `protobuf:"bytes,1,opt,name=user,proto3" json:"user,omitempty"`
+	Group         string                 `protobuf:"bytes,2,opt,name=group,proto3" json:"group,omitempty"`
+	Permissions   []Permission           `protobuf:"varint,3,rep,packed,name=permissions,proto3,enum=teleworker.v1.Permission" json:"permissions,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *StartJobRequest) Reset() {
-	*x = StartJobRequest{}
-	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[0]
+func (x *JobGrant) Reset() {
+	*x = JobGrant{}
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[24]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *StartJobRequest) String() string {
+func (x *JobGrant) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*StartJobRequest) ProtoMessage() {}
+func (*JobGrant) ProtoMessage() {}
 
-func (x *StartJobRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[0]
+func (x *JobGrant) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[24]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -112,47 +1807,55 @@ func (x *StartJobRequest) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use StartJobRequest.ProtoReflect.Descriptor instead.
-func (*StartJobRequest) Descriptor() ([]byte, []int) {
-	return file_proto_teleworker_v1_teleworker_proto_rawDescGZIP(), []int{0}
+// Deprecated: Use JobGrant.ProtoReflect.Descriptor instead.
+func (*JobGrant) Descriptor() ([]byte, []int) {
+	return file_proto_teleworker_v1_teleworker_proto_rawDescGZIP(), []int{24}
 }
 
-func (x *StartJobRequest) GetCommand() string {
+func (x *JobGrant) GetUser() string {
 	if x != nil {
-		return x.Command
+		return x.User
 	}
 	return ""
 }
 
-func (x *StartJobRequest) GetArgs() []string {
+func (x *JobGrant) GetGroup() string {
 	if x != nil {
-		return x.Args
+		return x.Group
+	}
+	return ""
+}
+
+func (x *JobGrant) GetPermissions() []Permission {
+	if x != nil {
+		return x.Permissions
 	}
 	return nil
 }
 
-type StartJobResponse struct {
+// Query the caller's quota and how much of it they use, used by
+// `telerun quota`.
+type GetQuotaRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	JobId         string                 `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"` // Only contains ID for the job that was submitted.
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *StartJobResponse) Reset() {
-	*x = StartJobResponse{}
-	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[1]
+func (x *GetQuotaRequest) Reset() {
+	*x = GetQuotaRequest{}
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[25]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *StartJobResponse) String() string {
+func (x *GetQuotaRequest) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*StartJobResponse) ProtoMessage() {}
+func (*GetQuotaRequest) ProtoMessage() {}
 
-func (x *StartJobResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[1]
+func (x *GetQuotaRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[25]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -163,41 +1866,34 @@ func (x *StartJobResponse) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use StartJobResponse.ProtoReflect.Descriptor instead.
-func (*StartJobResponse) Descriptor() ([]byte, []int) {
-	return file_proto_teleworker_v1_teleworker_proto_rawDescGZIP(), []int{1}
-}
-
-func (x *StartJobResponse) GetJobId() string {
-	if x != nil {
-		return x.JobId
-	}
-	return ""
+// Deprecated: Use GetQuotaRequest.ProtoReflect.Descriptor instead.
+func (*GetQuotaRequest) Descriptor() ([]byte, []int) {
+	return file_proto_teleworker_v1_teleworker_proto_rawDescGZIP(), []int{25}
 }
 
-// Query the status of the job, used by `telerun status ...`
-type GetJobStatusRequest struct {
+type GetQuotaResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	JobId         string                 `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+	Limits        *Quota                 `protobuf:"bytes,1,opt,name=limits,proto3" json:"limits,omitempty"` // The caller's quota. A limit of 0 is not enforced.
+	Usage         *Quota                 `protobuf:"bytes,2,opt,name=usage,proto3" json:"usage,omitempty"`   // How much of each limit the caller uses.
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *GetJobStatusRequest) Reset() {
-	*x = GetJobStatusRequest{}
-	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[2]
+func (x *GetQuotaResponse) Reset() {
+	*x = GetQuotaResponse{}
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[26]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *GetJobStatusRequest) String() string {
+func (x *GetQuotaResponse) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*GetJobStatusRequest) ProtoMessage() {}
+func (*GetQuotaResponse) ProtoMessage() {}
 
-func (x *GetJobStatusRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[2]
+func (x *GetQuotaResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[26]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -208,42 +1904,52 @@ func (x *GetJobStatusRequest) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use GetJobStatusRequest.ProtoReflect.Descriptor instead.
-func (*GetJobStatusRequest) Descriptor() ([]byte, []int) {
-	return file_proto_teleworker_v1_teleworker_proto_rawDescGZIP(), []int{2}
+// Deprecated: Use GetQuotaResponse.ProtoReflect.Descriptor instead.
+func (*GetQuotaResponse) Descriptor() ([]byte, []int) {
+	return file_proto_teleworker_v1_teleworker_proto_rawDescGZIP(), []int{26}
 }
 
-func (x *GetJobStatusRequest) GetJobId() string {
+func (x *GetQuotaResponse) GetLimits() *Quota {
 	if x != nil {
-		return x.JobId
+		return x.Limits
 	}
-	return ""
+	return nil
 }
 
-type GetJobStatusResponse struct {
+func (x *GetQuotaResponse) GetUsage() *Quota {
+	if x != nil {
+		return x.Usage
+	}
+	return nil
+}
+
+// Limits on the jobs of one user, or how much of them the user uses.
+type Quota struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	JobId         string                 `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
-	Status        JobStatus              `protobuf:"varint,2,opt,name=status,proto3,enum=teleworker.v1.JobStatus" json:"status,omitempty"`
-	ExitCode      *int32                 `protobuf:"varint,3,opt,name=exit_code,json=exitCode,proto3,oneof" json:"exit_code,omitempty"`
+	Jobs          int32                  `protobuf:"varint,1,opt,name=jobs,proto3" json:"jobs,omitempty"`                                     // Jobs that are queued or running.
+	Cpus          float64                `protobuf:"fixed64,2,opt,name=cpus,proto3" json:"cpus,omitempty"`                                    // CPUs reserved by queued and running jobs.
+	MemoryBytes   int64                  `protobuf:"varint,3,opt,name=memory_bytes,json=memoryBytes,proto3" json:"memory_bytes,omitempty"`    // Memory reserved by queued and running jobs.
+	RetainedJobs  int32                  `protobuf:"varint,4,opt,name=retained_jobs,json=retainedJobs,proto3" json:"retained_jobs,omitempty"` // Jobs the server keeps, including finished jobs.
+	LogBytes      int64                  `protobuf:"varint,5,opt,name=log_bytes,json=logBytes,proto3" json:"log_bytes,omitempty"`             // Output the server keeps, over every retained job.
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *GetJobStatusResponse) Reset() {
-	*x = GetJobStatusResponse{}
-	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[3]
+func (x *Quota) Reset() {
+	*x = Quota{}
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[27]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *GetJobStatusResponse) String() string {
+func (x *Quota) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*GetJobStatusResponse) ProtoMessage() {}
+func (*Quota) ProtoMessage() {}
 
-func (x *GetJobStatusResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[3]
+func (x *Quota) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[27]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -254,55 +1960,75 @@ func (x *GetJobStatusResponse) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use GetJobStatusResponse.ProtoReflect.Descriptor instead.
-func (*GetJobStatusResponse) Descriptor() ([]byte, []int) {
-	return file_proto_teleworker_v1_teleworker_proto_rawDescGZIP(), []int{3}
+// Deprecated: Use Quota.ProtoReflect.Descriptor instead.
+func (*Quota) Descriptor() ([]byte, []int) {
+	return file_proto_teleworker_v1_teleworker_proto_rawDescGZIP(), []int{27}
 }
 
-func (x *GetJobStatusResponse) GetJobId() string {
+func (x *Quota) GetJobs() int32 {
 	if x != nil {
-		return x.JobId
+		return x.Jobs
 	}
-	return ""
+	return 0
 }
 
-func (x *GetJobStatusResponse) GetStatus() JobStatus {
+func (x *Quota) GetCpus() float64 {
 	if x != nil {
-		return x.Status
+		return x.Cpus
 	}
-	return JobStatus_JOB_STATUS_UNSPECIFIED
+	return 0
 }
 
-func (x *GetJobStatusResponse) GetExitCode() int32 {
-	if x != nil && x.ExitCode != nil {
-		return *x.ExitCode
+func (x *Quota) GetMemoryBytes() int64 {
+	if x != nil {
+		return x.MemoryBytes
 	}
 	return 0
 }
 
-// Request the output of stdout and stderr, used by `telerun logs ...`
-type StreamOutputRequest struct {
+func (x *Quota) GetRetainedJobs() int32 {
+	if x != nil {
+		return x.RetainedJobs
+	}
+	return 0
+}
+
+func (x *Quota) GetLogBytes() int64 {
+	if x != nil {
+		return x.LogBytes
+	}
+	return 0
+}
+
+// Read the server's audit log, used by `telerun audit`. Only callers the
+// server's policy allows to audit any job may query it. Filters that are not
+// set match every record.
+type QueryAuditRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	JobId         string                 `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+	User          string                 `protobuf:"bytes,1,opt,name=user,proto3" json:"user,omitempty"`                // Only RPCs made by, or on behalf of, this user.
+	Rpc           string                 `protobuf:"bytes,2,opt,name=rpc,proto3" json:"rpc,omitempty"`                  // Only calls of this method, e.g. "StopJob".
+	JobId         string                 `protobuf:"bytes,3,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"` // Only RPCs on this job.
+	Since         string                 `protobuf:"bytes,4,opt,name=since,proto3" json:"since,omitempty"`              // Only RPCs made at or after this time, in RFC 3339.
+	Limit         uint32                 `protobuf:"varint,5,opt,name=limit,proto3" json:"limit,omitempty"`             // Return at most this many of the newest records. The server uses a default if 0, and enforces a maximum.
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *StreamOutputRequest) Reset() {
-	*x = StreamOutputRequest{}
-	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[4]
+func (x *QueryAuditRequest) Reset() {
+	*x = QueryAuditRequest{}
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[28]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *StreamOutputRequest) String() string {
+func (x *QueryAuditRequest) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*StreamOutputRequest) ProtoMessage() {}
+func (*QueryAuditRequest) ProtoMessage() {}
 
-func (x *StreamOutputRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[4]
+func (x *QueryAuditRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[28]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -313,41 +2039,68 @@ func (x *StreamOutputRequest) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use StreamOutputRequest.ProtoReflect.Descriptor instead.
-func (*StreamOutputRequest) Descriptor() ([]byte, []int) {
-	return file_proto_teleworker_v1_teleworker_proto_rawDescGZIP(), []int{4}
+// Deprecated: Use QueryAuditRequest.ProtoReflect.Descriptor instead.
+func (*QueryAuditRequest) Descriptor() ([]byte, []int) {
+	return file_proto_teleworker_v1_teleworker_proto_rawDescGZIP(), []int{28}
 }
 
-func (x *StreamOutputRequest) GetJobId() string {
+func (x *QueryAuditRequest) GetUser() string {
+	if x != nil {
+		return x.User
+	}
+	return ""
+}
+
+func (x *QueryAuditRequest) GetRpc() string {
+	if x != nil {
+		return x.Rpc
+	}
+	return ""
+}
+
+func (x *QueryAuditRequest) GetJobId() string {
 	if x != nil {
 		return x.JobId
 	}
 	return ""
 }
 
-// Receive the output of stdout and stderr, used by `telerun logs ...`
-type StreamOutputResponse struct {
+func (x *QueryAuditRequest) GetSince() string {
+	if x != nil {
+		return x.Since
+	}
+	return ""
+}
+
+func (x *QueryAuditRequest) GetLimit() uint32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type QueryAuditResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	Data          []byte                 `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+	Records       []*AuditRecord         `protobuf:"bytes,1,rep,name=records,proto3" json:"records,omitempty"` // Oldest first.
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *StreamOutputResponse) Reset() {
-	*x = StreamOutputResponse{}
-	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[5]
+func (x *QueryAuditResponse) Reset() {
+	*x = QueryAuditResponse{}
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[29]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *StreamOutputResponse) String() string {
+func (x *QueryAuditResponse) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*StreamOutputResponse) ProtoMessage() {}
+func (*QueryAuditResponse) ProtoMessage() {}
 
-func (x *StreamOutputResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[5]
+func (x *QueryAuditResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[29]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -358,40 +2111,52 @@ func (x *StreamOutputResponse) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use StreamOutputResponse.ProtoReflect.Descriptor instead.
-func (*StreamOutputResponse) Descriptor() ([]byte, []int) {
-	return file_proto_teleworker_v1_teleworker_proto_rawDescGZIP(), []int{5}
+// Deprecated: Use QueryAuditResponse.ProtoReflect.Descriptor instead.
+func (*QueryAuditResponse) Descriptor() ([]byte, []int) {
+	return file_proto_teleworker_v1_teleworker_proto_rawDescGZIP(), []int{29}
 }
 
-func (x *StreamOutputResponse) GetData() []byte {
+func (x *QueryAuditResponse) GetRecords() []*AuditRecord {
 	if x != nil {
-		return x.Data
+		return x.Records
 	}
 	return nil
 }
 
-type StopJobRequest struct {
+// One RPC in the audit log.
+type AuditRecord struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	JobId         string                 `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+	Time          string                 `protobuf:"bytes,1,opt,name=time,proto3" json:"time,omitempty"` // When the RPC started, in RFC 3339.
+	User          string                 `protobuf:"bytes,2,opt,name=user,proto3" json:"user,omitempty"`
+	Role          string                 `protobuf:"bytes,3,opt,name=role,proto3" json:"role,omitempty"`
+	Rpc           string                 `protobuf:"bytes,4,opt,name=rpc,proto3" json:"rpc,omitempty"`
+	JobId         string                 `protobuf:"bytes,5,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+	Request       string                 `protobuf:"bytes,6,opt,name=request,proto3" json:"request,omitempty"` // The request as JSON, cut short if it is long.
+	Code          string                 `protobuf:"bytes,7,opt,name=code,proto3" json:"code,omitempty"`       // gRPC status code, e.g. "OK" or "NotFound".
+	Error         string                 `protobuf:"bytes,8,opt,name=error,proto3" json:"error,omitempty"`     // Status message, if the RPC failed.
+	LatencyMs     float64                `protobuf:"fixed64,9,opt,name=latency_ms,json=latencyMs,proto3" json:"latency_ms,omitempty"`
+	PrevHash      string                 `protobuf:"bytes,10,opt,name=prev_hash,json=prevHash,proto3" json:"prev_hash,omitempty"`         // Hash of the record before, if the log is hash chained.
+	Hash          string                 `protobuf:"bytes,11,opt,name=hash,proto3" json:"hash,omitempty"`                                 // Hash of this record, if the log is hash chained.
+	OnBehalfOf    string                 `protobuf:"bytes,12,opt,name=on_behalf_of,json=onBehalfOf,proto3" json:"on_behalf_of,omitempty"` // User an admin made the RPC on behalf of, if any.
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *StopJobRequest) Reset() {
-	*x = StopJobRequest{}
-	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[6]
+func (x *AuditRecord) Reset() {
+	*x = AuditRecord{}
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[30]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *StopJobRequest) String() string {
+func (x *AuditRecord) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*StopJobRequest) ProtoMessage() {}
+func (*AuditRecord) ProtoMessage() {}
 
-func (x *StopJobRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[6]
+func (x *AuditRecord) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[30]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -402,92 +2167,309 @@ func (x *StopJobRequest) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use StopJobRequest.ProtoReflect.Descriptor instead.
-func (*StopJobRequest) Descriptor() ([]byte, []int) {
-	return file_proto_teleworker_v1_teleworker_proto_rawDescGZIP(), []int{6}
+// Deprecated: Use AuditRecord.ProtoReflect.Descriptor instead.
+func (*AuditRecord) Descriptor() ([]byte, []int) {
+	return file_proto_teleworker_v1_teleworker_proto_rawDescGZIP(), []int{30}
 }
 
-func (x *StopJobRequest) GetJobId() string {
+func (x *AuditRecord) GetTime() string {
+	if x != nil {
+		return x.Time
+	}
+	return ""
+}
+
+func (x *AuditRecord) GetUser() string {
+	if x != nil {
+		return x.User
+	}
+	return ""
+}
+
+func (x *AuditRecord) GetRole() string {
+	if x != nil {
+		return x.Role
+	}
+	return ""
+}
+
+func (x *AuditRecord) GetRpc() string {
+	if x != nil {
+		return x.Rpc
+	}
+	return ""
+}
+
+func (x *AuditRecord) GetJobId() string {
 	if x != nil {
 		return x.JobId
 	}
 	return ""
 }
 
-type StopJobResponse struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+func (x *AuditRecord) GetRequest() string {
+	if x != nil {
+		return x.Request
+	}
+	return ""
 }
 
-func (x *StopJobResponse) Reset() {
-	*x = StopJobResponse{}
-	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[7]
-	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-	ms.StoreMessageInfo(mi)
+func (x *AuditRecord) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
 }
 
-func (x *StopJobResponse) String() string {
-	return protoimpl.X.MessageStringOf(x)
+func (x *AuditRecord) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
 }
 
-func (*StopJobResponse) ProtoMessage() {}
+func (x *AuditRecord) GetLatencyMs() float64 {
+	if x != nil {
+		return x.LatencyMs
+	}
+	return 0
+}
 
-func (x *StopJobResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_teleworker_v1_teleworker_proto_msgTypes[7]
+func (x *AuditRecord) GetPrevHash() string {
 	if x != nil {
-		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-		if ms.LoadMessageInfo() == nil {
-			ms.StoreMessageInfo(mi)
-		}
-		return ms
+		return x.PrevHash
 	}
-	return mi.MessageOf(x)
+	return ""
 }
 
-// Deprecated: Use StopJobResponse.ProtoReflect.Descriptor instead.
-func (*StopJobResponse) Descriptor() ([]byte, []int) {
-	return file_proto_teleworker_v1_teleworker_proto_rawDescGZIP(), []int{7}
+func (x *AuditRecord) GetHash() string {
+	if x != nil {
+		return x.Hash
+	}
+	return ""
+}
+
+func (x *AuditRecord) GetOnBehalfOf() string {
+	if x != nil {
+		return x.OnBehalfOf
+	}
+	return ""
 }
 
 var File_proto_teleworker_v1_teleworker_proto protoreflect.FileDescriptor
 
 const file_proto_teleworker_v1_teleworker_proto_rawDesc = "" +
 	"\n" +
-	"$proto/teleworker/v1/teleworker.proto\x12\rteleworker.v1\"?\n" +
+	"$proto/teleworker/v1/teleworker.proto\x12\rteleworker.v1\"\xb9\x03\n" +
 	"\x0fStartJobRequest\x12\x18\n" +
 	"\acommand\x18\x01 \x01(\tR\acommand\x12\x12\n" +
-	"\x04args\x18\x02 \x03(\tR\x04args\")\n" +
+	"\x04args\x18\x02 \x03(\tR\x04args\x12\x14\n" +
+	"\x05image\x18\x03 \x01(\tR\x05image\x120\n" +
+	"\arlimits\x18\x04 \x01(\v2\x16.teleworker.v1.RlimitsR\arlimits\x12\x19\n" +
+	"\bpids_max\x18\x05 \x01(\x03R\apidsMax\x12\x12\n" +
+	"\x04cpus\x18\x06 \x01(\tR\x04cpus\x12\x12\n" +
+	"\x04mems\x18\a \x01(\tR\x04mems\x12%\n" +
+	"\x0eexclusive_cpus\x18\b \x01(\rR\rexclusiveCpus\x12\x1f\n" +
+	"\vmemory_high\x18\t \x01(\x03R\n" +
+	"memoryHigh\x12+\n" +
+	"\x0fmemory_swap_max\x18\n" +
+	" \x01(\x03H\x00R\rmemorySwapMax\x88\x01\x01\x12-\n" +
+	"\x10memory_oom_group\x18\v \x01(\bH\x01R\x0ememoryOomGroup\x88\x01\x01\x12 \n" +
+	"\fon_behalf_of\x18\f \x01(\tR\n" +
+	"onBehalfOfB\x12\n" +
+	"\x10_memory_swap_maxB\x13\n" +
+	"\x11_memory_oom_group\"\xc2\x01\n" +
+	"\aRlimits\x12\x1b\n" +
+	"\x06nofile\x18\x01 \x01(\x04H\x00R\x06nofile\x88\x01\x01\x12\x17\n" +
+	"\x04core\x18\x02 \x01(\x04H\x01R\x04core\x88\x01\x01\x12\x19\n" +
+	"\x05fsize\x18\x03 \x01(\x04H\x02R\x05fsize\x88\x01\x01\x12\x19\n" +
+	"\x05stack\x18\x04 \x01(\x04H\x03R\x05stack\x88\x01\x01\x12\x19\n" +
+	"\x05nproc\x18\x05 \x01(\x04H\x04R\x05nproc\x88\x01\x01B\t\n" +
+	"\a_nofileB\a\n" +
+	"\x05_coreB\b\n" +
+	"\x06_fsizeB\b\n" +
+	"\x06_stackB\b\n" +
+	"\x06_nproc\")\n" +
 	"\x10StartJobResponse\x12\x15\n" +
 	"\x06job_id\x18\x01 \x01(\tR\x05jobId\",\n" +
 	"\x13GetJobStatusRequest\x12\x15\n" +
-	"\x06job_id\x18\x01 \x01(\tR\x05jobId\"\x8f\x01\n" +
+	"\x06job_id\x18\x01 \x01(\tR\x05jobId\"\x90\x03\n" +
 	"\x14GetJobStatusResponse\x12\x15\n" +
 	"\x06job_id\x18\x01 \x01(\tR\x05jobId\x120\n" +
 	"\x06status\x18\x02 \x01(\x0e2\x18.teleworker.v1.JobStatusR\x06status\x12 \n" +
-	"\texit_code\x18\x03 \x01(\x05H\x00R\bexitCode\x88\x01\x01B\f\n" +
+	"\texit_code\x18\x03 \x01(\x05H\x00R\bexitCode\x88\x01\x01\x12\"\n" +
+	"\rpids_max_hits\x18\x04 \x01(\x03R\vpidsMaxHits\x12O\n" +
+	"\x12termination_reason\x18\x05 \x01(\x0e2 .teleworker.v1.TerminationReasonR\x11terminationReason\x12-\n" +
+	"\x05usage\x18\x06 \x01(\v2\x17.teleworker.v1.JobUsageR\x05usage\x12\x12\n" +
+	"\x04cpus\x18\a \x01(\tR\x04cpus\x12\x12\n" +
+	"\x04mems\x18\b \x01(\tR\x04mems\x12\x14\n" +
+	"\x05owner\x18\t \x01(\tR\x05owner\x12\x1d\n" +
+	"\n" +
+	"started_by\x18\n" +
+	" \x01(\tR\tstartedByB\f\n" +
 	"\n" +
-	"_exit_code\",\n" +
+	"_exit_code\"\xab\x02\n" +
+	"\bJobUsage\x12\x19\n" +
+	"\bcpu_usec\x18\x01 \x01(\x04R\acpuUsec\x12\x1b\n" +
+	"\tuser_usec\x18\x02 \x01(\x04R\buserUsec\x12\x1f\n" +
+	"\vsystem_usec\x18\x03 \x01(\x04R\n" +
+	"systemUsec\x12\x1f\n" +
+	"\vmemory_peak\x18\x04 \x01(\x04R\n" +
+	"memoryPeak\x12\x1d\n" +
+	"\n" +
+	"read_bytes\x18\x05 \x01(\x04R\treadBytes\x12\x1f\n" +
+	"\vwrite_bytes\x18\x06 \x01(\x04R\n" +
+	"writeBytes\x12\x1b\n" +
+	"\tpids_peak\x18\a \x01(\x04R\bpidsPeak\x12!\n" +
+	"\fnr_throttled\x18\b \x01(\x04R\vnrThrottled\x12%\n" +
+	"\x0ethrottled_usec\x18\t \x01(\x04R\rthrottledUsec\",\n" +
 	"\x13StreamOutputRequest\x12\x15\n" +
 	"\x06job_id\x18\x01 \x01(\tR\x05jobId\"*\n" +
 	"\x14StreamOutputResponse\x12\x12\n" +
 	"\x04data\x18\x01 \x01(\fR\x04data\"'\n" +
 	"\x0eStopJobRequest\x12\x15\n" +
 	"\x06job_id\x18\x01 \x01(\tR\x05jobId\"\x11\n" +
-	"\x0fStopJobResponse*\x9f\x01\n" +
+	"\x0fStopJobResponse\"+\n" +
+	"\x12GetJobStatsRequest\x12\x15\n" +
+	"\x06job_id\x18\x01 \x01(\tR\x05jobId\"[\n" +
+	"\x13GetJobStatsResponse\x12\x15\n" +
+	"\x06job_id\x18\x01 \x01(\tR\x05jobId\x12-\n" +
+	"\x05stats\x18\x02 \x01(\v2\x17.teleworker.v1.JobStatsR\x05stats\"N\n" +
+	"\x14WatchJobStatsRequest\x12\x15\n" +
+	"\x06job_id\x18\x01 \x01(\tR\x05jobId\x12\x1f\n" +
+	"\vinterval_ms\x18\x02 \x01(\rR\n" +
+	"intervalMs\"\xe9\x01\n" +
+	"\bJobStats\x12)\n" +
+	"\x03cpu\x18\x01 \x01(\v2\x17.teleworker.v1.CpuStatsR\x03cpu\x122\n" +
+	"\x06memory\x18\x02 \x01(\v2\x1a.teleworker.v1.MemoryStatsR\x06memory\x12&\n" +
+	"\x02io\x18\x03 \x03(\v2\x16.teleworker.v1.IoStatsR\x02io\x12!\n" +
+	"\fpids_current\x18\x04 \x01(\x04R\vpidsCurrent\x123\n" +
+	"\bpressure\x18\x05 \x01(\v2\x17.teleworker.v1.PressureR\bpressure\"\x9e\x01\n" +
+	"\bPressure\x12.\n" +
+	"\x03cpu\x18\x01 \x01(\v2\x1c.teleworker.v1.PressureStatsR\x03cpu\x124\n" +
+	"\x06memory\x18\x02 \x01(\v2\x1c.teleworker.v1.PressureStatsR\x06memory\x12,\n" +
+	"\x02io\x18\x03 \x01(\v2\x1c.teleworker.v1.PressureStatsR\x02io\"q\n" +
+	"\rPressureStats\x12/\n" +
+	"\x04some\x18\x01 \x01(\v2\x1b.teleworker.v1.PressureLineR\x04some\x12/\n" +
+	"\x04full\x18\x02 \x01(\v2\x1b.teleworker.v1.PressureLineR\x04full\"q\n" +
+	"\fPressureLine\x12\x14\n" +
+	"\x05avg10\x18\x01 \x01(\x01R\x05avg10\x12\x14\n" +
+	"\x05avg60\x18\x02 \x01(\x01R\x05avg60\x12\x16\n" +
+	"\x06avg300\x18\x03 \x01(\x01R\x06avg300\x12\x1d\n" +
+	"\n" +
+	"total_usec\x18\x04 \x01(\x04R\ttotalUsec\"\xd0\x01\n" +
+	"\bCpuStats\x12\x1d\n" +
+	"\n" +
+	"usage_usec\x18\x01 \x01(\x04R\tusageUsec\x12\x1b\n" +
+	"\tuser_usec\x18\x02 \x01(\x04R\buserUsec\x12\x1f\n" +
+	"\vsystem_usec\x18\x03 \x01(\x04R\n" +
+	"systemUsec\x12\x1d\n" +
+	"\n" +
+	"nr_periods\x18\x04 \x01(\x04R\tnrPeriods\x12!\n" +
+	"\fnr_throttled\x18\x05 \x01(\x04R\vnrThrottled\x12%\n" +
+	"\x0ethrottled_usec\x18\x06 \x01(\x04R\rthrottledUsec\"\xae\x01\n" +
+	"\vMemoryStats\x12\x18\n" +
+	"\acurrent\x18\x01 \x01(\x04R\acurrent\x12\x12\n" +
+	"\x04peak\x18\x02 \x01(\x04R\x04peak\x128\n" +
+	"\x04stat\x18\x03 \x03(\v2$.teleworker.v1.MemoryStats.StatEntryR\x04stat\x1a7\n" +
+	"\tStatEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x04R\x05value:\x028\x01\"\xb9\x01\n" +
+	"\aIoStats\x12\x14\n" +
+	"\x05major\x18\x01 \x01(\rR\x05major\x12\x14\n" +
+	"\x05minor\x18\x02 \x01(\rR\x05minor\x12\x16\n" +
+	"\x06rbytes\x18\x03 \x01(\x04R\x06rbytes\x12\x16\n" +
+	"\x06wbytes\x18\x04 \x01(\x04R\x06wbytes\x12\x12\n" +
+	"\x04rios\x18\x05 \x01(\x04R\x04rios\x12\x12\n" +
+	"\x04wios\x18\x06 \x01(\x04R\x04wios\x12\x16\n" +
+	"\x06dbytes\x18\a \x01(\x04R\x06dbytes\x12\x12\n" +
+	"\x04dios\x18\b \x01(\x04R\x04dios\"\x8f\x01\n" +
+	"\x0fShareJobRequest\x12\x15\n" +
+	"\x06job_id\x18\x01 \x01(\tR\x05jobId\x12\x12\n" +
+	"\x04user\x18\x02 \x01(\tR\x04user\x12\x14\n" +
+	"\x05group\x18\x03 \x01(\tR\x05group\x12;\n" +
+	"\vpermissions\x18\x04 \x03(\x0e2\x19.teleworker.v1.PermissionR\vpermissions\"C\n" +
+	"\x10ShareJobResponse\x12/\n" +
+	"\x06grants\x18\x01 \x03(\v2\x17.teleworker.v1.JobGrantR\x06grants\"\x91\x01\n" +
+	"\x11UnshareJobRequest\x12\x15\n" +
+	"\x06job_id\x18\x01 \x01(\tR\x05jobId\x12\x12\n" +
+	"\x04user\x18\x02 \x01(\tR\x04user\x12\x14\n" +
+	"\x05group\x18\x03 \x01(\tR\x05group\x12;\n" +
+	"\vpermissions\x18\x04 \x03(\x0e2\x19.teleworker.v1.PermissionR\vpermissions\"E\n" +
+	"\x12UnshareJobResponse\x12/\n" +
+	"\x06grants\x18\x01 \x03(\v2\x17.teleworker.v1.JobGrantR\x06grants\"q\n" +
+	"\bJobGrant\x12\x12\n" +
+	"\x04user\x18\x01 \x01(\tR\x04user\x12\x14\n" +
+	"\x05group\x18\x02 \x01(\tR\x05group\x12;\n" +
+	"\vpermissions\x18\x03 \x03(\x0e2\x19.teleworker.v1.PermissionR\vpermissions\"\x11\n" +
+	"\x0fGetQuotaRequest\"l\n" +
+	"\x10GetQuotaResponse\x12,\n" +
+	"\x06limits\x18\x01 \x01(\v2\x14.teleworker.v1.QuotaR\x06limits\x12*\n" +
+	"\x05usage\x18\x02 \x01(\v2\x14.teleworker.v1.QuotaR\x05usage\"\x94\x01\n" +
+	"\x05Quota\x12\x12\n" +
+	"\x04jobs\x18\x01 \x01(\x05R\x04jobs\x12\x12\n" +
+	"\x04cpus\x18\x02 \x01(\x01R\x04cpus\x12!\n" +
+	"\fmemory_bytes\x18\x03 \x01(\x03R\vmemoryBytes\x12#\n" +
+	"\rretained_jobs\x18\x04 \x01(\x05R\fretainedJobs\x12\x1b\n" +
+	"\tlog_bytes\x18\x05 \x01(\x03R\blogBytes\"|\n" +
+	"\x11QueryAuditRequest\x12\x12\n" +
+	"\x04user\x18\x01 \x01(\tR\x04user\x12\x10\n" +
+	"\x03rpc\x18\x02 \x01(\tR\x03rpc\x12\x15\n" +
+	"\x06job_id\x18\x03 \x01(\tR\x05jobId\x12\x14\n" +
+	"\x05since\x18\x04 \x01(\tR\x05since\x12\x14\n" +
+	"\x05limit\x18\x05 \x01(\rR\x05limit\"J\n" +
+	"\x12QueryAuditResponse\x124\n" +
+	"\arecords\x18\x01 \x03(\v2\x1a.teleworker.v1.AuditRecordR\arecords\"\xa8\x02\n" +
+	"\vAuditRecord\x12\x12\n" +
+	"\x04time\x18\x01 \x01(\tR\x04time\x12\x12\n" +
+	"\x04user\x18\x02 \x01(\tR\x04user\x12\x12\n" +
+	"\x04role\x18\x03 \x01(\tR\x04role\x12\x10\n" +
+	"\x03rpc\x18\x04 \x01(\tR\x03rpc\x12\x15\n" +
+	"\x06job_id\x18\x05 \x01(\tR\x05jobId\x12\x18\n" +
+	"\arequest\x18\x06 \x01(\tR\arequest\x12\x12\n" +
+	"\x04code\x18\a \x01(\tR\x04code\x12\x14\n" +
+	"\x05error\x18\b \x01(\tR\x05error\x12\x1d\n" +
+	"\n" +
+	"latency_ms\x18\t \x01(\x01R\tlatencyMs\x12\x1b\n" +
+	"\tprev_hash\x18\n" +
+	" \x01(\tR\bprevHash\x12\x12\n" +
+	"\x04hash\x18\v \x01(\tR\x04hash\x12 \n" +
+	"\fon_behalf_of\x18\f \x01(\tR\n" +
+	"onBehalfOf*\x9f\x01\n" +
 	"\tJobStatus\x12\x1a\n" +
 	"\x16JOB_STATUS_UNSPECIFIED\x10\x00\x12\x18\n" +
 	"\x14JOB_STATUS_SUBMITTED\x10\x01\x12\x16\n" +
 	"\x12JOB_STATUS_RUNNING\x10\x02\x12\x16\n" +
 	"\x12JOB_STATUS_SUCCESS\x10\x03\x12\x15\n" +
 	"\x11JOB_STATUS_FAILED\x10\x04\x12\x15\n" +
-	"\x11JOB_STATUS_KILLED\x10\x052\xd7\x02\n" +
+	"\x11JOB_STATUS_KILLED\x10\x05*\xe4\x01\n" +
+	"\x11TerminationReason\x12\"\n" +
+	"\x1eTERMINATION_REASON_UNSPECIFIED\x10\x00\x12\x1d\n" +
+	"\x19TERMINATION_REASON_EXITED\x10\x01\x12\x1f\n" +
+	"\x1bTERMINATION_REASON_SIGNALED\x10\x02\x12!\n" +
+	"\x1dTERMINATION_REASON_OOM_KILLED\x10\x03\x12 \n" +
+	"\x1cTERMINATION_REASON_TIMED_OUT\x10\x04\x12&\n" +
+	"\"TERMINATION_REASON_STOPPED_BY_USER\x10\x05*g\n" +
+	"\n" +
+	"Permission\x12\x1a\n" +
+	"\x16PERMISSION_UNSPECIFIED\x10\x00\x12\x13\n" +
+	"\x0fPERMISSION_VIEW\x10\x01\x12\x13\n" +
+	"\x0fPERMISSION_LOGS\x10\x02\x12\x13\n" +
+	"\x0fPERMISSION_STOP\x10\x032\xc9\x06\n" +
 	"\n" +
 	"TeleWorker\x12K\n" +
 	"\bStartJob\x12\x1e.teleworker.v1.StartJobRequest\x1a\x1f.teleworker.v1.StartJobResponse\x12W\n" +
 	"\fGetJobStatus\x12\".teleworker.v1.GetJobStatusRequest\x1a#.teleworker.v1.GetJobStatusResponse\x12Y\n" +
 	"\fStreamOutput\x12\".teleworker.v1.StreamOutputRequest\x1a#.teleworker.v1.StreamOutputResponse0\x01\x12H\n" +
-	"\aStopJob\x12\x1d.teleworker.v1.StopJobRequest\x1a\x1e.teleworker.v1.StopJobResponseBDZBgithub.com/kkloberdanz/teleworker/proto/teleworker/v1;teleworkerv1b\x06proto3"
+	"\aStopJob\x12\x1d.teleworker.v1.StopJobRequest\x1a\x1e.teleworker.v1.StopJobResponse\x12T\n" +
+	"\vGetJobStats\x12!.teleworker.v1.GetJobStatsRequest\x1a\".teleworker.v1.GetJobStatsResponse\x12Z\n" +
+	"\rWatchJobStats\x12#.teleworker.v1.WatchJobStatsRequest\x1a\".teleworker.v1.GetJobStatsResponse0\x01\x12K\n" +
+	"\bShareJob\x12\x1e.teleworker.v1.ShareJobRequest\x1a\x1f.teleworker.v1.ShareJobResponse\x12Q\n" +
+	"\n" +
+	"UnshareJob\x12 .teleworker.v1.UnshareJobRequest\x1a!.teleworker.v1.UnshareJobResponse\x12K\n" +
+	"\bGetQuota\x12\x1e.teleworker.v1.GetQuotaRequest\x1a\x1f.teleworker.v1.GetQuotaResponse\x12Q\n" +
+	"\n" +
+	"QueryAudit\x12 .teleworker.v1.QueryAuditRequest\x1a!.teleworker.v1.QueryAuditResponseBDZBgithub.com/kkloberdanz/teleworker/proto/teleworker/v1;teleworkerv1b\x06proto3"
 
 var (
 	file_proto_teleworker_v1_teleworker_proto_rawDescOnce sync.Once
@@ -501,34 +2483,94 @@ func file_proto_teleworker_v1_teleworker_proto_rawDescGZIP() []byte {
 	return file_proto_teleworker_v1_teleworker_proto_rawDescData
 }
 
-var file_proto_teleworker_v1_teleworker_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
-var file_proto_teleworker_v1_teleworker_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
+var file_proto_teleworker_v1_teleworker_proto_enumTypes = make([]protoimpl.EnumInfo, 3)
+var file_proto_teleworker_v1_teleworker_proto_msgTypes = make([]protoimpl.MessageInfo, 32)
 var file_proto_teleworker_v1_teleworker_proto_goTypes = []any{
 	(JobStatus)(0),               // 0: teleworker.v1.JobStatus
-	(*StartJobRequest)(nil),      // 1: teleworker.v1.StartJobRequest
-	(*StartJobResponse)(nil),     // 2: teleworker.v1.StartJobResponse
-	(*GetJobStatusRequest)(nil),  // 3: teleworker.v1.GetJobStatusRequest
-	(*GetJobStatusResponse)(nil), // 4: teleworker.v1.GetJobStatusResponse
-	(*StreamOutputRequest)(nil),  // 5: teleworker.v1.StreamOutputRequest
-	(*StreamOutputResponse)(nil), // 6: teleworker.v1.StreamOutputResponse
-	(*StopJobRequest)(nil),       // 7: teleworker.v1.StopJobRequest
-	(*StopJobResponse)(nil),      // 8: teleworker.v1.StopJobResponse
+	(TerminationReason)(0),       // 1: teleworker.v1.TerminationReason
+	(Permission)(0),              // 2: teleworker.v1.Permission
+	(*StartJobRequest)(nil),      // 3: teleworker.v1.StartJobRequest
+	(*Rlimits)(nil),              // 4: teleworker.v1.Rlimits
+	(*StartJobResponse)(nil),     // 5: teleworker.v1.StartJobResponse
+	(*GetJobStatusRequest)(nil),  // 6: teleworker.v1.GetJobStatusRequest
+	(*GetJobStatusResponse)(nil), // 7: teleworker.v1.GetJobStatusResponse
+	(*JobUsage)(nil),             // 8: teleworker.v1.JobUsage
+	(*StreamOutputRequest)(nil),  // 9: teleworker.v1.StreamOutputRequest
+	(*StreamOutputResponse)(nil), // 10: teleworker.v1.StreamOutputResponse
+	(*StopJobRequest)(nil),       // 11: teleworker.v1.StopJobRequest
+	(*StopJobResponse)(nil),      // 12: teleworker.v1.StopJobResponse
+	(*GetJobStatsRequest)(nil),   // 13: teleworker.v1.GetJobStatsRequest
+	(*GetJobStatsResponse)(nil),  // 14: teleworker.v1.GetJobStatsResponse
+	(*WatchJobStatsRequest)(nil), // 15: teleworker.v1.WatchJobStatsRequest
+	(*JobStats)(nil),             // 16: teleworker.v1.JobStats
+	(*Pressure)(nil),             // 17: teleworker.v1.Pressure
+	(*PressureStats)(nil),        // 18: teleworker.v1.PressureStats
+	(*PressureLine)(nil),         // 19: teleworker.v1.PressureLine
+	(*CpuStats)(nil),             // 20: teleworker.v1.CpuStats
+	(*MemoryStats)(nil),          // 21: teleworker.v1.MemoryStats
+	(*IoStats)(nil),              // 22: teleworker.v1.IoStats
+	(*ShareJobRequest)(nil),      // 23: teleworker.v1.ShareJobRequest
+	(*ShareJobResponse)(nil),     // 24: teleworker.v1.ShareJobResponse
+	(*UnshareJobRequest)(nil),    // 25: teleworker.v1.UnshareJobRequest
+	(*UnshareJobResponse)(nil),   // 26: teleworker.v1.UnshareJobResponse
+	(*JobGrant)(nil),             // 27: teleworker.v1.JobGrant
+	(*GetQuotaRequest)(nil),      // 28: teleworker.v1.GetQuotaRequest
+	(*GetQuotaResponse)(nil),     // 29: teleworker.v1.GetQuotaResponse
+	(*Quota)(nil),                // 30: teleworker.v1.Quota
+	(*QueryAuditRequest)(nil),    // 31: teleworker.v1.QueryAuditRequest
+	(*QueryAuditResponse)(nil),   // 32: teleworker.v1.QueryAuditResponse
+	(*AuditRecord)(nil),          // 33: teleworker.v1.AuditRecord
+	nil,                          // 34: teleworker.v1.MemoryStats.StatEntry
 }
 var file_proto_teleworker_v1_teleworker_proto_depIdxs = []int32{
-	0, // 0: teleworker.v1.GetJobStatusResponse.status:type_name -> teleworker.v1.JobStatus
-	1, // 1: teleworker.v1.TeleWorker.StartJob:input_type -> teleworker.v1.StartJobRequest
-	3, // 2: teleworker.v1.TeleWorker.GetJobStatus:input_type -> teleworker.v1.GetJobStatusRequest
-	5, // 3: teleworker.v1.TeleWorker.StreamOutput:input_type -> teleworker.v1.StreamOutputRequest
-	7, // 4: teleworker.v1.TeleWorker.StopJob:input_type -> teleworker.v1.StopJobRequest
-	2, // 5: teleworker.v1.TeleWorker.StartJob:output_type -> teleworker.v1.StartJobResponse
-	4, // 6: teleworker.v1.TeleWorker.GetJobStatus:output_type -> teleworker.v1.GetJobStatusResponse
-	6, // 7: teleworker.v1.TeleWorker.StreamOutput:output_type -> teleworker.v1.StreamOutputResponse
-	8, // 8: teleworker.v1.TeleWorker.StopJob:output_type -> teleworker.v1.StopJobResponse
-	5, // [5:9] is the sub-list for method output_type
-	1, // [1:5] is the sub-list for method input_type
-	1, // [1:1] is the sub-list for extension type_name
-	1, // [1:1] is the sub-list for extension extendee
-	0, // [0:1] is the sub-list for field type_name
+	4,  // 0: teleworker.v1.StartJobRequest.rlimits:type_name -> teleworker.v1.Rlimits
+	0,  // 1: teleworker.v1.GetJobStatusResponse.status:type_name -> teleworker.v1.JobStatus
+	1,  // 2: teleworker.v1.GetJobStatusResponse.termination_reason:type_name -> teleworker.v1.TerminationReason
+	8,  // 3: teleworker.v1.GetJobStatusResponse.usage:type_name -> teleworker.v1.JobUsage
+	16, // 4: teleworker.v1.GetJobStatsResponse.stats:type_name -> teleworker.v1.JobStats
+	20, // 5: teleworker.v1.JobStats.cpu:type_name -> teleworker.v1.CpuStats
+	21, // 6: teleworker.v1.JobStats.memory:type_name -> teleworker.v1.MemoryStats
+	22, // 7: teleworker.v1.JobStats.io:type_name -> teleworker.v1.IoStats
+	17, // 8: teleworker.v1.JobStats.pressure:type_name -> teleworker.v1.Pressure
+	18, // 9: teleworker.v1.Pressure.cpu:type_name -> teleworker.v1.PressureStats
+	18, // 10: teleworker.v1.Pressure.memory:type_name -> teleworker.v1.PressureStats
+	18, // 11: teleworker.v1.Pressure.io:type_name -> teleworker.v1.PressureStats
+	19, // 12: teleworker.v1.PressureStats.some:type_name -> teleworker.v1.PressureLine
+	19, // 13: teleworker.v1.PressureStats.full:type_name -> teleworker.v1.PressureLine
+	34, // 14: teleworker.v1.MemoryStats.stat:type_name -> teleworker.v1.MemoryStats.StatEntry
+	2,  // 15: teleworker.v1.ShareJobRequest.permissions:type_name -> teleworker.v1.Permission
+	27, // 16: teleworker.v1.ShareJobResponse.grants:type_name -> teleworker.v1.JobGrant
+	2,  // 17: teleworker.v1.UnshareJobRequest.permissions:type_name -> teleworker.v1.Permission
+	27, // 18: teleworker.v1.UnshareJobResponse.grants:type_name -> teleworker.v1.JobGrant
+	2,  // 19: teleworker.v1.JobGrant.permissions:type_name -> teleworker.v1.Permission
+	30, // 20: teleworker.v1.GetQuotaResponse.limits:type_name -> teleworker.v1.Quota
+	30, // 21: teleworker.v1.GetQuotaResponse.usage:type_name -> teleworker.v1.Quota
+	33, // 22: teleworker.v1.QueryAuditResponse.records:type_name -> teleworker.v1.AuditRecord
+	3,  // 23: teleworker.v1.TeleWorker.StartJob:input_type -> teleworker.v1.StartJobRequest
+	6,  // 24: teleworker.v1.TeleWorker.GetJobStatus:input_type -> teleworker.v1.GetJobStatusRequest
+	9,  // 25: teleworker.v1.TeleWorker.StreamOutput:input_type -> teleworker.v1.StreamOutputRequest
+	11, // 26: teleworker.v1.TeleWorker.StopJob:input_type -> teleworker.v1.StopJobRequest
+	13, // 27: teleworker.v1.TeleWorker.GetJobStats:input_type -> teleworker.v1.GetJobStatsRequest
+	15, // 28: teleworker.v1.TeleWorker.WatchJobStats:input_type -> teleworker.v1.WatchJobStatsRequest
+	23, // 29: teleworker.v1.TeleWorker.ShareJob:input_type -> teleworker.v1.ShareJobRequest
+	25, // 30: teleworker.v1.TeleWorker.UnshareJob:input_type -> teleworker.v1.UnshareJobRequest
+	28, // 31: teleworker.v1.TeleWorker.GetQuota:input_type -> teleworker.v1.GetQuotaRequest
+	31, // 32: teleworker.v1.TeleWorker.QueryAudit:input_type -> teleworker.v1.QueryAuditRequest
+	5,  // 33: teleworker.v1.TeleWorker.StartJob:output_type -> teleworker.v1.StartJobResponse
+	7,  // 34: teleworker.v1.TeleWorker.GetJobStatus:output_type -> teleworker.v1.GetJobStatusResponse
+	10, // 35: teleworker.v1.TeleWorker.StreamOutput:output_type -> teleworker.v1.StreamOutputResponse
+	12, // 36: teleworker.v1.TeleWorker.StopJob:output_type -> teleworker.v1.StopJobResponse
+	14, // 37: teleworker.v1.TeleWorker.GetJobStats:output_type -> teleworker.v1.GetJobStatsResponse
+	14, // 38: teleworker.v1.TeleWorker.WatchJobStats:output_type -> teleworker.v1.GetJobStatsResponse
+	24, // 39: teleworker.v1.TeleWorker.ShareJob:output_type -> teleworker.v1.ShareJobResponse
+	26, // 40: teleworker.v1.TeleWorker.UnshareJob:output_type -> teleworker.v1.UnshareJobResponse
+	29, // 41: teleworker.v1.TeleWorker.GetQuota:output_type -> teleworker.v1.GetQuotaResponse
+	32, // 42: teleworker.v1.TeleWorker.QueryAudit:output_type -> teleworker.v1.QueryAuditResponse
+	33, // [33:43] is the sub-list for method output_type
+	23, // [23:33] is the sub-list for method input_type
+	23, // [23:23] is the sub-list for extension type_name
+	23, // [23:23] is the sub-list for extension extendee
+	0,  // [0:23] is the sub-list for field type_name
 }
 
 func init() { file_proto_teleworker_v1_teleworker_proto_init() }
@@ -536,14 +2578,16 @@ func file_proto_teleworker_v1_teleworker_proto_init() {
 	if File_proto_teleworker_v1_teleworker_proto != nil {
 		return
 	}
-	file_proto_teleworker_v1_teleworker_proto_msgTypes[3].OneofWrappers = []any{}
+	file_proto_teleworker_v1_teleworker_proto_msgTypes[0].OneofWrappers = []any{}
+	file_proto_teleworker_v1_teleworker_proto_msgTypes[1].OneofWrappers = []any{}
+	file_proto_teleworker_v1_teleworker_proto_msgTypes[4].OneofWrappers = []any{}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_teleworker_v1_teleworker_proto_rawDesc), len(file_proto_teleworker_v1_teleworker_proto_rawDesc)),
-			NumEnums:      1,
-			NumMessages:   8,
+			NumEnums:      3,
+			NumMessages:   32,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
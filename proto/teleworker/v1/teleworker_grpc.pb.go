@@ -19,10 +19,16 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	TeleWorker_StartJob_FullMethodName     = "/teleworker.v1.TeleWorker/StartJob"
-	TeleWorker_GetJobStatus_FullMethodName = "/teleworker.v1.TeleWorker/GetJobStatus"
-	TeleWorker_StreamOutput_FullMethodName = "/teleworker.v1.TeleWorker/StreamOutput"
-	TeleWorker_StopJob_FullMethodName      = "/teleworker.v1.TeleWorker/StopJob"
+	TeleWorker_StartJob_FullMethodName      = "/teleworker.v1.TeleWorker/StartJob"
+	TeleWorker_GetJobStatus_FullMethodName  = "/teleworker.v1.TeleWorker/GetJobStatus"
+	TeleWorker_StreamOutput_FullMethodName  = "/teleworker.v1.TeleWorker/StreamOutput"
+	TeleWorker_StopJob_FullMethodName       = "/teleworker.v1.TeleWorker/StopJob"
+	TeleWorker_GetJobStats_FullMethodName   = "/teleworker.v1.TeleWorker/GetJobStats"
+	TeleWorker_WatchJobStats_FullMethodName = "/teleworker.v1.TeleWorker/WatchJobStats"
+	TeleWorker_ShareJob_FullMethodName      = "/teleworker.v1.TeleWorker/ShareJob"
+	TeleWorker_UnshareJob_FullMethodName    = "/teleworker.v1.TeleWorker/UnshareJob"
+	TeleWorker_GetQuota_FullMethodName      = "/teleworker.v1.TeleWorker/GetQuota"
+	TeleWorker_QueryAudit_FullMethodName    = "/teleworker.v1.TeleWorker/QueryAudit"
 )
 
 // TeleWorkerClient is the client API for TeleWorker service.
@@ -33,6 +39,12 @@ type TeleWorkerClient interface {
 	GetJobStatus(ctx context.Context, in *GetJobStatusRequest, opts ...grpc.CallOption) (*GetJobStatusResponse, error)
 	StreamOutput(ctx context.Context, in *StreamOutputRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StreamOutputResponse], error)
 	StopJob(ctx context.Context, in *StopJobRequest, opts ...grpc.CallOption) (*StopJobResponse, error)
+	GetJobStats(ctx context.Context, in *GetJobStatsRequest, opts ...grpc.CallOption) (*GetJobStatsResponse, error)
+	WatchJobStats(ctx context.Context, in *WatchJobStatsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[GetJobStatsResponse], error)
+	ShareJob(ctx context.Context, in *ShareJobRequest, opts ...grpc.CallOption) (*ShareJobResponse, error)
+	UnshareJob(ctx context.Context, in *UnshareJobRequest, opts ...grpc.CallOption) (*UnshareJobResponse, error)
+	GetQuota(ctx context.Context, in *GetQuotaRequest, opts ...grpc.CallOption) (*GetQuotaResponse, error)
+	QueryAudit(ctx context.Context, in *QueryAuditRequest, opts ...grpc.CallOption) (*QueryAuditResponse, error)
 }
 
 type teleWorkerClient struct {
@@ -92,6 +104,75 @@ func (c *teleWorkerClient) StopJob(ctx context.Context, in *StopJobRequest, opts
 	return out, nil
 }
 
+func (c *teleWorkerClient) GetJobStats(ctx context.Context, in *GetJobStatsRequest, opts ...grpc.CallOption) (*GetJobStatsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetJobStatsResponse)
+	err := c.cc.Invoke(ctx, TeleWorker_GetJobStats_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *teleWorkerClient) WatchJobStats(ctx context.Context, in *WatchJobStatsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[GetJobStatsResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &TeleWorker_ServiceDesc.Streams[1], TeleWorker_WatchJobStats_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchJobStatsRequest, GetJobStatsResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TeleWorker_WatchJobStatsClient = grpc.ServerStreamingClient[GetJobStatsResponse]
+
+func (c *teleWorkerClient) ShareJob(ctx context.Context, in *ShareJobRequest, opts ...grpc.CallOption) (*ShareJobResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ShareJobResponse)
+	err := c.cc.Invoke(ctx, TeleWorker_ShareJob_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *teleWorkerClient) UnshareJob(ctx context.Context, in *UnshareJobRequest, opts ...grpc.CallOption) (*UnshareJobResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UnshareJobResponse)
+	err := c.cc.Invoke(ctx, TeleWorker_UnshareJob_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *teleWorkerClient) GetQuota(ctx context.Context, in *GetQuotaRequest, opts ...grpc.CallOption) (*GetQuotaResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetQuotaResponse)
+	err := c.cc.Invoke(ctx, TeleWorker_GetQuota_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *teleWorkerClient) QueryAudit(ctx context.Context, in *QueryAuditRequest, opts ...grpc.CallOption) (*QueryAuditResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(QueryAuditResponse)
+	err := c.cc.Invoke(ctx, TeleWorker_QueryAudit_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // TeleWorkerServer is the server API for TeleWorker service.
 // All implementations must embed UnimplementedTeleWorkerServer
 // for forward compatibility.
@@ -100,6 +181,12 @@ type TeleWorkerServer interface {
 	GetJobStatus(context.Context, *GetJobStatusRequest) (*GetJobStatusResponse, error)
 	StreamOutput(*StreamOutputRequest, grpc.ServerStreamingServer[StreamOutputResponse]) error
 	StopJob(context.Context, *StopJobRequest) (*StopJobResponse, error)
+	GetJobStats(context.Context, *GetJobStatsRequest) (*GetJobStatsResponse, error)
+	WatchJobStats(*WatchJobStatsRequest, grpc.ServerStreamingServer[GetJobStatsResponse]) error
+	ShareJob(context.Context, *ShareJobRequest) (*ShareJobResponse, error)
+	UnshareJob(context.Context, *UnshareJobRequest) (*UnshareJobResponse, error)
+	GetQuota(context.Context, *GetQuotaRequest) (*GetQuotaResponse, error)
+	QueryAudit(context.Context, *QueryAuditRequest) (*QueryAuditResponse, error)
 	mustEmbedUnimplementedTeleWorkerServer()
 }
 
@@ -122,6 +209,24 @@ func (UnimplementedTeleWorkerServer) StreamOutput(*StreamOutputRequest, grpc.Ser
 func (UnimplementedTeleWorkerServer) StopJob(context.Context, *StopJobRequest) (*StopJobResponse, error) {
 	return nil, status.Error(codes.Unimplemented, "method StopJob not implemented")
 }
+func (UnimplementedTeleWorkerServer) GetJobStats(context.Context, *GetJobStatsRequest) (*GetJobStatsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetJobStats not implemented")
+}
+func (UnimplementedTeleWorkerServer) WatchJobStats(*WatchJobStatsRequest, grpc.ServerStreamingServer[GetJobStatsResponse]) error {
+	return status.Error(codes.Unimplemented, "method WatchJobStats not implemented")
+}
+func (UnimplementedTeleWorkerServer) ShareJob(context.Context, *ShareJobRequest) (*ShareJobResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method ShareJob not implemented")
+}
+func (UnimplementedTeleWorkerServer) UnshareJob(context.Context, *UnshareJobRequest) (*UnshareJobResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method UnshareJob not implemented")
+}
+func (UnimplementedTeleWorkerServer) GetQuota(context.Context, *GetQuotaRequest) (*GetQuotaResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetQuota not implemented")
+}
+func (UnimplementedTeleWorkerServer) QueryAudit(context.Context, *QueryAuditRequest) (*QueryAuditResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method QueryAudit not implemented")
+}
 func (UnimplementedTeleWorkerServer) mustEmbedUnimplementedTeleWorkerServer() {}
 func (UnimplementedTeleWorkerServer) testEmbeddedByValue()                    {}
 
@@ -208,6 +313,107 @@ func _TeleWorker_StopJob_Handler(srv interface{}, ctx context.Context, dec func(
 	return interceptor(ctx, in, info, handler)
 }
 
+func _TeleWorker_GetJobStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetJobStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TeleWorkerServer).GetJobStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TeleWorker_GetJobStats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TeleWorkerServer).GetJobStats(ctx, req.(*GetJobStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TeleWorker_WatchJobStats_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchJobStatsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TeleWorkerServer).WatchJobStats(m, &grpc.GenericServerStream[WatchJobStatsRequest, GetJobStatsResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TeleWorker_WatchJobStatsServer = grpc.ServerStreamingServer[GetJobStatsResponse]
+
+func _TeleWorker_ShareJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ShareJobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TeleWorkerServer).ShareJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TeleWorker_ShareJob_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TeleWorkerServer).ShareJob(ctx, req.(*ShareJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TeleWorker_UnshareJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UnshareJobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TeleWorkerServer).UnshareJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TeleWorker_UnshareJob_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TeleWorkerServer).UnshareJob(ctx, req.(*UnshareJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TeleWorker_GetQuota_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetQuotaRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TeleWorkerServer).GetQuota(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TeleWorker_GetQuota_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TeleWorkerServer).GetQuota(ctx, req.(*GetQuotaRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TeleWorker_QueryAudit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueryAuditRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TeleWorkerServer).QueryAudit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TeleWorker_QueryAudit_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TeleWorkerServer).QueryAudit(ctx, req.(*QueryAuditRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // TeleWorker_ServiceDesc is the grpc.ServiceDesc for TeleWorker service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -227,6 +433,26 @@ var TeleWorker_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "StopJob",
 			Handler:    _TeleWorker_StopJob_Handler,
 		},
+		{
+			MethodName: "GetJobStats",
+			Handler:    _TeleWorker_GetJobStats_Handler,
+		},
+		{
+			MethodName: "ShareJob",
+			Handler:    _TeleWorker_ShareJob_Handler,
+		},
+		{
+			MethodName: "UnshareJob",
+			Handler:    _TeleWorker_UnshareJob_Handler,
+		},
+		{
+			MethodName: "GetQuota",
+			Handler:    _TeleWorker_GetQuota_Handler,
+		},
+		{
+			MethodName: "QueryAudit",
+			Handler:    _TeleWorker_QueryAudit_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -234,6 +460,11 @@ var TeleWorker_ServiceDesc = grpc.ServiceDesc{
 			Handler:       _TeleWorker_StreamOutput_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "WatchJobStats",
+			Handler:       _TeleWorker_WatchJobStats_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "proto/teleworker/v1/teleworker.proto",
 }
@@ -0,0 +1,78 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"path"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/kkloberdanz/teleworker/auth"
+)
+
+// RetryAfterKey is the trailer metadata key that says, in whole seconds, how
+// long a caller that was rate limited should wait before trying again.
+const RetryAfterKey = "retry-after"
+
+// NewUnaryInterceptor returns an interceptor that rejects RPCs with
+// ResourceExhausted once the caller has run out of tokens for their class,
+// and sets RetryAfterKey in the trailer. It must come after the auth
+// interceptor in the chain, so that the caller's identity is in the context,
+// and after the audit interceptor, if any, so that the RPCs it rejects are
+// recorded.
+func NewUnaryInterceptor(l *Limiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		id, err := auth.FromContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		rpc := path.Base(info.FullMethod)
+		if ok, wait := l.Allow(id, auth.ClassOf(rpc)); !ok {
+			return nil, limited(ctx, rpc, wait, grpc.SetTrailer)
+		}
+		return handler(ctx, req)
+	}
+}
+
+// NewStreamInterceptor is like NewUnaryInterceptor, for streaming RPCs. It
+// also rejects StreamOutput with ResourceExhausted if the caller already has
+// as many subscriptions open as they may.
+func NewStreamInterceptor(l *Limiter) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		id, err := auth.FromContext(ss.Context())
+		if err != nil {
+			return err
+		}
+		rpc := path.Base(info.FullMethod)
+		if ok, wait := l.Allow(id, auth.ClassOf(rpc)); !ok {
+			setTrailer := func(_ context.Context, md metadata.MD) error {
+				ss.SetTrailer(md)
+				return nil
+			}
+			return limited(ss.Context(), rpc, wait, setTrailer)
+		}
+		if rpc == "StreamOutput" {
+			done, limit, ok := l.OpenStream(id)
+			if !ok {
+				return status.Errorf(codes.ResourceExhausted, "%s already has %d output streams open", id.Username, limit)
+			}
+			defer done()
+		}
+		return handler(srv, ss)
+	}
+}
+
+// limited sets RetryAfterKey in the trailer with setTrailer, and returns the
+// error for an RPC that was rate limited.
+func limited(ctx context.Context, rpc string, wait time.Duration, setTrailer func(context.Context, metadata.MD) error) error {
+	secs := max(1, int(math.Ceil(wait.Seconds())))
+	// The RPC fails either way, so a trailer that cannot be set is not an
+	// error; the message also says how long to wait.
+	_ = setTrailer(ctx, metadata.Pairs(RetryAfterKey, strconv.Itoa(secs)))
+	return status.Errorf(codes.ResourceExhausted, "rate limit exceeded for %s, retry after %ds", rpc, secs)
+}
@@ -0,0 +1,127 @@
+// Package ratelimit limits how often each user may make RPCs, with a token
+// bucket for each user and class of RPC, and how many output streams each
+// user may have open at once. The limits come from the policy, see
+// auth.RateLimitPolicy.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/kkloberdanz/teleworker/auth"
+)
+
+// Limiter keeps the token buckets and open streams of each user. It is safe
+// for concurrent use.
+type Limiter struct {
+	limits func(auth.Identity) auth.RateLimits // Limits of each caller. Looked up on every RPC, so that they may change.
+
+	mu      sync.Mutex
+	buckets map[bucketKey]*bucket
+	streams map[string]int // Open StreamOutput subscriptions of each username.
+	swept   time.Time      // When idle buckets were last removed, see sweep.
+}
+
+// sweepInterval is how often Allow removes the buckets of callers that have
+// gone idle.
+const sweepInterval = time.Minute
+
+// bucketKey identifies the token bucket of one caller and class of RPC.
+type bucketKey struct {
+	username string
+	role     string
+	class    auth.RPCClass
+}
+
+// bucket is a token bucket. Tokens are added lazily, when one is taken.
+type bucket struct {
+	tokens float64   // Tokens in the bucket at last.
+	last   time.Time // When tokens was last brought up to date.
+	rate   float64   // Tokens added per second, when tokens was last brought up to date.
+	burst  float64   // Most tokens the bucket holds, when tokens was last brought up to date.
+}
+
+// New returns a limiter that takes each caller's limits from the function,
+// e.g. auth.Policy.RateLimit.
+func New(limits func(auth.Identity) auth.RateLimits) *Limiter {
+	return &Limiter{
+		limits:  limits,
+		buckets: make(map[bucketKey]*bucket),
+		streams: make(map[string]int),
+	}
+}
+
+// Allow takes a token from the caller's bucket for the class of RPC. If the
+// bucket is empty, it returns false and how long until it holds a token
+// again.
+func (l *Limiter) Allow(id auth.Identity, class auth.RPCClass) (bool, time.Duration) {
+	r := l.limits(id).Rate(class)
+	if r.Rate <= 0 {
+		return true, 0
+	}
+	burst := float64(r.Burst)
+	if burst == 0 {
+		burst = max(1, math.Ceil(r.Rate))
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.swept) >= sweepInterval {
+		l.sweep(now)
+	}
+	key := bucketKey{username: id.Username, role: id.Role, class: class}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = min(burst, b.tokens+now.Sub(b.last).Seconds()*r.Rate)
+	b.last = now
+	b.rate = r.Rate
+	b.burst = burst
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / r.Rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep removes the buckets that have filled up again. A caller's next RPC
+// gets a new bucket, which starts full, so this only frees the memory of
+// callers that have gone idle. l.mu must be held.
+func (l *Limiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*b.rate >= b.burst {
+			delete(l.buckets, key)
+		}
+	}
+	l.swept = now
+}
+
+// OpenStream counts a StreamOutput subscription against the caller's limit.
+// If they already have as many open as they may, it returns false, and how
+// many that is. Otherwise, the returned function must be called once the
+// stream ends.
+func (l *Limiter) OpenStream(id auth.Identity) (func(), int, bool) {
+	limit := l.limits(id).Streams
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if limit > 0 && l.streams[id.Username] >= limit {
+		return nil, limit, false
+	}
+	l.streams[id.Username]++
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		l.streams[id.Username]--
+		if l.streams[id.Username] == 0 {
+			delete(l.streams, id.Username)
+		}
+	}, limit, true
+}
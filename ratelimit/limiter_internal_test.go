@@ -0,0 +1,38 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kkloberdanz/teleworker/auth"
+)
+
+func TestSweep(t *testing.T) {
+	l := New(func(auth.Identity) auth.RateLimits {
+		return auth.RateLimits{Status: auth.Rate{Rate: 1, Burst: 2}}
+	})
+	alice := auth.Identity{Username: "alice", Role: auth.RoleClient}
+	bob := auth.Identity{Username: "bob", Role: auth.RoleClient}
+	l.Allow(alice, auth.ClassStatus)
+	l.Allow(bob, auth.ClassStatus)
+	l.Allow(bob, auth.ClassStatus)
+
+	// After a second, alice's bucket has refilled, but bob's has not.
+	l.mu.Lock()
+	l.sweep(time.Now().Add(time.Second))
+	_, aliceKept := l.buckets[bucketKey{username: "alice", role: auth.RoleClient, class: auth.ClassStatus}]
+	_, bobKept := l.buckets[bucketKey{username: "bob", role: auth.RoleClient, class: auth.ClassStatus}]
+	l.mu.Unlock()
+	if aliceKept || !bobKept {
+		t.Fatalf("expected only alice's full bucket to be removed, got alice %v and bob %v", aliceKept, bobKept)
+	}
+
+	// Once bob's has refilled too, no buckets are left.
+	l.mu.Lock()
+	l.sweep(time.Now().Add(3 * time.Second))
+	n := len(l.buckets)
+	l.mu.Unlock()
+	if n != 0 {
+		t.Fatalf("expected every bucket to be removed, got %d", n)
+	}
+}
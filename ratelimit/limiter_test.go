@@ -0,0 +1,92 @@
+package ratelimit_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kkloberdanz/teleworker/auth"
+	"github.com/kkloberdanz/teleworker/ratelimit"
+)
+
+var (
+	alice = auth.Identity{Username: "alice", Role: auth.RoleClient}
+	bob   = auth.Identity{Username: "bob", Role: auth.RoleClient}
+)
+
+func fixed(limits auth.RateLimits) func(auth.Identity) auth.RateLimits {
+	return func(auth.Identity) auth.RateLimits { return limits }
+}
+
+func TestAllow(t *testing.T) {
+	tests := []struct {
+		name    string
+		rate    auth.Rate
+		allowed int // Calls allowed in a row, before the bucket is empty.
+	}{
+		{"burst", auth.Rate{Rate: 0.001, Burst: 3}, 3},
+		// Without a burst, the bucket holds the rate rounded up.
+		{"default burst", auth.Rate{Rate: 1.5}, 2},
+		{"default burst of at least 1", auth.Rate{Rate: 0.001}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := ratelimit.New(fixed(auth.RateLimits{Status: tt.rate}))
+			for i := range tt.allowed {
+				if ok, _ := l.Allow(alice, auth.ClassStatus); !ok {
+					t.Fatalf("expected call %d to be allowed", i+1)
+				}
+			}
+			ok, wait := l.Allow(alice, auth.ClassStatus)
+			if ok {
+				t.Fatal("expected the bucket to be empty")
+			}
+			if limit := time.Duration(float64(time.Second) / tt.rate.Rate); wait <= 0 || wait > limit {
+				t.Fatalf("expected to wait up to %v, got %v", limit, wait)
+			}
+
+			// Other users and classes have their own buckets.
+			if ok, _ := l.Allow(bob, auth.ClassStatus); !ok {
+				t.Fatal("expected bob to be allowed")
+			}
+			if ok, _ := l.Allow(alice, auth.ClassStart); !ok {
+				t.Fatal("expected a class without a limit to be allowed")
+			}
+		})
+	}
+}
+
+func TestAllowRefills(t *testing.T) {
+	l := ratelimit.New(fixed(auth.RateLimits{Start: auth.Rate{Rate: 50, Burst: 1}}))
+	if ok, _ := l.Allow(alice, auth.ClassStart); !ok {
+		t.Fatal("expected the first call to be allowed")
+	}
+	ok, wait := l.Allow(alice, auth.ClassStart)
+	if ok {
+		t.Fatal("expected the bucket to be empty")
+	}
+	time.Sleep(wait)
+	if ok, _ := l.Allow(alice, auth.ClassStart); !ok {
+		t.Fatal("expected the bucket to have refilled")
+	}
+}
+
+func TestOpenStream(t *testing.T) {
+	l := ratelimit.New(fixed(auth.RateLimits{Streams: 2}))
+	done1, _, ok := l.OpenStream(alice)
+	if !ok {
+		t.Fatal("expected the first stream to open")
+	}
+	if _, _, ok := l.OpenStream(alice); !ok {
+		t.Fatal("expected the second stream to open")
+	}
+	if _, limit, ok := l.OpenStream(alice); ok || limit != 2 {
+		t.Fatalf("expected the third stream to be refused at a limit of 2, got %v, %d", ok, limit)
+	}
+	if _, _, ok := l.OpenStream(bob); !ok {
+		t.Fatal("expected bob's stream to open")
+	}
+	done1()
+	if _, _, ok := l.OpenStream(alice); !ok {
+		t.Fatal("expected a stream to open once one has closed")
+	}
+}
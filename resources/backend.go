@@ -0,0 +1,100 @@
+package resources
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// Backend creates the cgroups that jobs run in. Manager is the Backend for
+// the cgroup v2 filesystem, and V1Manager for hosts that still use cgroup v1.
+// The fake package has an in-memory Backend for tests that can not use real
+// cgroups.
+type Backend interface {
+	// CreateCgroup creates a cgroup for a job with the given limits. Limits
+	// that are not set use the backend's defaults. Returns ErrLimitTooHigh
+	// if a limit is above its default, or ErrInvalidCpuset if the cpuset is
+	// not valid.
+	CreateCgroup(jobID string, limits Limits) (Cgroup, error)
+	// PidsMax returns the default, and highest, pids.max for job cgroups.
+	PidsMax() int64
+	// EffectiveCPUs returns the CPUs that job cgroups may use.
+	EffectiveCPUs() ([]int, error)
+	// Cleanup kills every process in every job cgroup and removes them.
+	Cleanup()
+}
+
+// Cgroup is a single job's cgroup.
+type Cgroup interface {
+	// FD returns a directory fd for SysProcAttr.CgroupFD, or -1 if processes
+	// must be added with AddProcess after they start.
+	FD() int
+	// CloseFD closes the fd returned by FD. It is safe to call more than once.
+	CloseFD() error
+	// AddProcess adds a running process to the cgroup.
+	AddProcess(pid int) error
+	// SetCpuset pins the cgroup to CPUs and memory nodes. It must be called
+	// before any process joins the cgroup.
+	SetCpuset(cs Cpuset) error
+	// Cpuset returns the cpuset set on the cgroup.
+	Cpuset() (Cpuset, error)
+
+	// Kill kills every process in the cgroup.
+	Kill() error
+	// Freeze stops every process in the cgroup, and returns once they are
+	// stopped.
+	Freeze() error
+	// Thaw resumes the processes stopped by Freeze.
+	Thaw() error
+
+	// Stats returns the cgroup's current resource usage.
+	Stats() (*Stats, error)
+	// Usage returns the resources the cgroup has used since it was created.
+	Usage() (*Usage, error)
+	// PidsMaxHits returns the number of times a fork failed because the
+	// cgroup reached pids.max.
+	PidsMaxHits() (int64, error)
+	// OOMKills returns the number of processes killed by the OOM killer.
+	OOMKills() (uint64, error)
+	// Events sends the state of the cgroup each time it changes, until ctx
+	// is done or the cgroup is removed.
+	Events(ctx context.Context) (<-chan Event, error)
+
+	// Cleanup closes the fd, waits for the processes in the cgroup to exit
+	// and removes the cgroup.
+	Cleanup() error
+}
+
+var (
+	_ Backend = (*Manager)(nil)
+	_ Backend = (*V1Manager)(nil)
+	_ Cgroup  = (*cgroupDir)(nil)
+	_ Cgroup  = (*v1Cgroup)(nil)
+)
+
+// NewBackend detects how cgroups are mounted at root, usually /sys/fs/cgroup,
+// and creates the Backend for it, with job cgroups beneath a parent cgroup
+// called name. A host with the unified cgroup v2 hierarchy mounted at root
+// uses a Manager. A host with a cgroup v1 or hybrid hierarchy, where the
+// controllers are in v1 hierarchies even if cgroup v2 is mounted elsewhere,
+// uses a V1Manager.
+func NewBackend(root, name string, opts Options) (Backend, error) {
+	if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err == nil {
+		mgr, err := NewManager(filepath.Join(root, name), opts)
+		if err != nil {
+			return nil, err
+		}
+		return mgr, nil
+	}
+
+	slog.Info(
+		"cgroup v2 is not mounted, using cgroup v1",
+		"root", root,
+	)
+	mgr, err := NewV1Manager(root, name, opts)
+	if err != nil {
+		return nil, err
+	}
+	return mgr, nil
+}
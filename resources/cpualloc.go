@@ -0,0 +1,146 @@
+package resources
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// ErrNoFreeCPUs is returned when a job asks for more exclusive CPUs than are
+// free.
+var ErrNoFreeCPUs = errors.New("not enough free exclusive cpus")
+
+// CPUAllocator hands out exclusive CPUs from a pool, so that jobs which need
+// dedicated cores, such as benchmarks, do not share them with other jobs.
+// Jobs that are not given exclusive CPUs should be kept off the pool.
+type CPUAllocator struct {
+	mu      sync.Mutex
+	pool    []int        // Every CPU the allocator hands out.
+	free    []int        // CPUs in the pool that are not allocated, in ascending order.
+	queue   bool         // If true, AllocateWait waits for CPUs to be freed. Otherwise it fails like Allocate.
+	waiters []*cpuWaiter // Callers of AllocateWait waiting for CPUs, in the order they arrived.
+}
+
+// cpuWaiter is a caller of AllocateWait that is waiting for CPUs.
+type cpuWaiter struct {
+	n     int
+	ready chan []int // Receives the CPUs once they are allocated.
+}
+
+// NewCPUAllocator creates an allocator for the given pool of CPUs. If queue is
+// true, jobs that ask for more CPUs than are free wait for them in the order
+// they asked. Otherwise they are refused.
+func NewCPUAllocator(pool []int, queue bool) *CPUAllocator {
+	pool = slices.Sorted(slices.Values(pool))
+	return &CPUAllocator{
+		pool:  pool,
+		free:  slices.Clone(pool),
+		queue: queue,
+	}
+}
+
+// Pool returns every CPU the allocator hands out.
+func (a *CPUAllocator) Pool() []int {
+	return slices.Clone(a.pool)
+}
+
+// Queues returns true if jobs wait for CPUs rather than being refused.
+func (a *CPUAllocator) Queues() bool {
+	return a.queue
+}
+
+// Allocate allocates n CPUs if they are free. Returns ErrNoFreeCPUs if they
+// are not, or if other callers are already waiting for CPUs.
+func (a *CPUAllocator) Allocate(n int) ([]int, error) {
+	if err := a.check(n); err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if len(a.waiters) > 0 || len(a.free) < n {
+		return nil, fmt.Errorf("%w: asked for %d, %d free", ErrNoFreeCPUs, n, len(a.free))
+	}
+	return a.take(n), nil
+}
+
+// AllocateWait allocates n CPUs. If the allocator queues, it waits until
+// they are free or ctx is done. Otherwise it behaves like Allocate.
+func (a *CPUAllocator) AllocateWait(ctx context.Context, n int) ([]int, error) {
+	if !a.queue {
+		return a.Allocate(n)
+	}
+	if err := a.check(n); err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	if len(a.waiters) == 0 && len(a.free) >= n {
+		defer a.mu.Unlock()
+		return a.take(n), nil
+	}
+	w := &cpuWaiter{n: n, ready: make(chan []int, 1)}
+	a.waiters = append(a.waiters, w)
+	a.mu.Unlock()
+
+	select {
+	case cpus := <-w.ready:
+		return cpus, nil
+	case <-ctx.Done():
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if i := slices.Index(a.waiters, w); i >= 0 {
+		a.waiters = slices.Delete(a.waiters, i, i+1)
+		// Waiters behind this one may now fit.
+		a.wake()
+		return nil, ctx.Err()
+	}
+	// The CPUs were allocated while ctx was being canceled, so give them
+	// back.
+	a.put(<-w.ready)
+	return nil, ctx.Err()
+}
+
+// Release returns CPUs to the pool, and hands them to waiting callers.
+func (a *CPUAllocator) Release(cpus []int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.put(cpus)
+}
+
+func (a *CPUAllocator) check(n int) error {
+	if n <= 0 || n > len(a.pool) {
+		return fmt.Errorf("%w: asked for %d exclusive cpus, the pool has %d", ErrInvalidCpuset, n, len(a.pool))
+	}
+	return nil
+}
+
+// take removes n CPUs from the free list. The caller must hold a.mu.
+func (a *CPUAllocator) take(n int) []int {
+	cpus := slices.Clone(a.free[:n])
+	a.free = a.free[n:]
+	return cpus
+}
+
+// put adds CPUs to the free list and wakes waiters. The caller must hold a.mu.
+func (a *CPUAllocator) put(cpus []int) {
+	a.free = append(a.free, cpus...)
+	slices.Sort(a.free)
+	a.wake()
+}
+
+// wake hands free CPUs to waiters in order, stopping at the first that does
+// not fit, so that jobs asking for many CPUs are not starved. The caller must
+// hold a.mu.
+func (a *CPUAllocator) wake() {
+	for len(a.waiters) > 0 && len(a.free) >= a.waiters[0].n {
+		w := a.waiters[0]
+		a.waiters = a.waiters[1:]
+		w.ready <- a.take(w.n)
+	}
+}
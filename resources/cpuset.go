@@ -0,0 +1,129 @@
+package resources
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidCpuset is returned when a job asks for a cpuset the manager can
+// not give it.
+var ErrInvalidCpuset = errors.New("invalid cpuset")
+
+// Cpuset pins a job to a set of CPUs and memory nodes. The values use the
+// list format of cpuset.cpus, e.g. "0-3,6". An empty value uses every CPU or
+// memory node that teleworker may use.
+type Cpuset struct {
+	CPUs string // CPUs the job may run on.
+	Mems string // NUMA memory nodes the job may allocate memory on.
+}
+
+// IsZero returns true if the cpuset does not restrict the job.
+func (cs Cpuset) IsZero() bool {
+	return cs == Cpuset{}
+}
+
+// ParseCPUList parses a list in the format of cpuset.cpus, such as "0-3,6",
+// and returns the numbers in it in ascending order.
+func ParseCPUList(list string) ([]int, error) {
+	var cpus []int
+	list = strings.TrimSpace(list)
+	if list == "" {
+		return nil, nil
+	}
+	for _, part := range strings.Split(list, ",") {
+		first, last, isRange := strings.Cut(part, "-")
+		lo, err := strconv.Atoi(first)
+		if err != nil || lo < 0 {
+			return nil, fmt.Errorf("%w: bad cpu list %q", ErrInvalidCpuset, list)
+		}
+		hi := lo
+		if isRange {
+			if hi, err = strconv.Atoi(last); err != nil || hi < lo {
+				return nil, fmt.Errorf("%w: bad cpu list %q", ErrInvalidCpuset, list)
+			}
+		}
+		for cpu := lo; cpu <= hi; cpu++ {
+			if !slices.Contains(cpus, cpu) {
+				cpus = append(cpus, cpu)
+			}
+		}
+	}
+	slices.Sort(cpus)
+	return cpus, nil
+}
+
+// FormatCPUList formats CPU numbers in the format of cpuset.cpus, collapsing
+// consecutive numbers into ranges.
+func FormatCPUList(cpus []int) string {
+	cpus = slices.Sorted(slices.Values(cpus))
+	var parts []string
+	for i := 0; i < len(cpus); {
+		j := i
+		for j+1 < len(cpus) && cpus[j+1] == cpus[j]+1 {
+			j++
+		}
+		if i == j {
+			parts = append(parts, strconv.Itoa(cpus[i]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", cpus[i], cpus[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
+
+// EffectiveCPUs returns the CPUs that job cgroups may use, from the parent
+// cgroup's cpuset.cpus.effective.
+func (m *Manager) EffectiveCPUs() ([]int, error) {
+	data, err := os.ReadFile(filepath.Join(m.parentPath, "cpuset.cpus.effective"))
+	if err != nil {
+		return nil, err
+	}
+	return ParseCPUList(string(data))
+}
+
+// SetCpuset writes the cpuset to the cgroup. It must be called before any
+// process joins the cgroup. Returns ErrInvalidCpuset if the kernel rejects
+// it, e.g. because a CPU does not exist or teleworker may not use it.
+func (c *cgroupDir) SetCpuset(cs Cpuset) error {
+	for _, f := range []struct{ name, value string }{
+		{"cpuset.cpus", cs.CPUs},
+		{"cpuset.mems", cs.Mems},
+	} {
+		if f.value == "" {
+			continue
+		}
+		if _, err := ParseCPUList(f.value); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(c.path, f.name), []byte(f.value), 0644); err != nil {
+			return fmt.Errorf("%w: failed to set %s to %q: %v", ErrInvalidCpuset, f.name, f.value, err)
+		}
+	}
+	return nil
+}
+
+// Cpuset reads the cpuset written to the cgroup. Values are empty if the
+// cgroup uses every CPU or memory node of its parent.
+func (c *cgroupDir) Cpuset() (Cpuset, error) {
+	var cs Cpuset
+	for _, f := range []struct {
+		name  string
+		value *string
+	}{
+		{"cpuset.cpus", &cs.CPUs},
+		{"cpuset.mems", &cs.Mems},
+	} {
+		data, err := os.ReadFile(filepath.Join(c.path, f.name))
+		if err != nil {
+			return Cpuset{}, err
+		}
+		*f.value = strings.TrimSpace(string(data))
+	}
+	return cs, nil
+}
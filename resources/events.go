@@ -0,0 +1,159 @@
+package resources
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// depopulateTimeout is how long awaitDepopulated waits for the processes
+	// in a cgroup to exit.
+	depopulateTimeout = 5 * time.Second
+	// freezeTimeout is how long Freeze and Thaw wait for the change to take
+	// effect.
+	freezeTimeout = 5 * time.Second
+)
+
+// Event is the state of a cgroup, read from cgroup.events and memory.events.
+type Event struct {
+	Populated bool   // True if the cgroup or any of its descendants has a process.
+	Frozen    bool   // True if the cgroup is frozen.
+	OOMKills  uint64 // Number of processes killed by the OOM killer so far.
+}
+
+// Events watches the cgroup's cgroup.events and memory.events files, and
+// sends an Event with the current state when it starts and each time either
+// file changes. Cleanup uses it to detect when every process in the cgroup has
+// exited, Freeze and Thaw when the change has taken effect, and jobs to record
+// OOM kills as they happen, without polling.
+//
+// The kernel only notifies the latest state, so changes between two events
+// may be missed, but the last event is always current. The channel is closed
+// when ctx is done or the cgroup is removed.
+func (c *cgroupDir) Events(ctx context.Context) (<-chan Event, error) {
+	return watchEvents(ctx, c.path)
+}
+
+// watchEvents implements Events for the cgroup at dir. It uses inotify, whose
+// fd is read through the Go runtime's epoll based poller, so that the
+// goroutine sleeps until the kernel reports a change.
+func watchEvents(ctx context.Context, dir string) (<-chan Event, error) {
+	fd, err := unix.InotifyInit1(unix.IN_NONBLOCK | unix.IN_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create inotify instance: %w", err)
+	}
+	// memory.events is missing if the memory controller is not enabled, in
+	// which case only cgroup.events is watched.
+	for _, name := range []string{"cgroup.events", "memory.events"} {
+		_, err := unix.InotifyAddWatch(fd, filepath.Join(dir, name), unix.IN_MODIFY)
+		if err != nil && (name == "cgroup.events" || !errors.Is(err, unix.ENOENT)) {
+			unix.Close(fd)
+			return nil, fmt.Errorf("failed to watch %s: %w", name, err)
+		}
+	}
+	// The file is closed when ctx is done, which wakes up the pending read.
+	inotify := os.NewFile(uintptr(fd), "inotify")
+	stop := context.AfterFunc(ctx, func() { inotify.Close() })
+
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		defer func() {
+			if stop() {
+				inotify.Close()
+			}
+		}()
+
+		buf := make([]byte, 4096)
+		for {
+			ev, err := readEvent(dir)
+			if err != nil {
+				// The cgroup has been removed.
+				return
+			}
+			select {
+			case events <- ev:
+			case <-ctx.Done():
+				return
+			}
+
+			n, err := inotify.Read(buf)
+			if err != nil {
+				return
+			}
+			if removed(buf[:n]) {
+				return
+			}
+		}
+	}()
+	return events, nil
+}
+
+// removed returns true if a batch of inotify events says that a watched file
+// is gone, which happens when the cgroup is removed.
+func removed(buf []byte) bool {
+	for len(buf) >= unix.SizeofInotifyEvent {
+		event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[0]))
+		if event.Mask&unix.IN_IGNORED != 0 {
+			return true
+		}
+		buf = buf[unix.SizeofInotifyEvent+int(event.Len):]
+	}
+	return false
+}
+
+// readEvent reads the current state of the cgroup at dir.
+func readEvent(dir string) (Event, error) {
+	c := &cgroupDir{path: dir}
+	events, err := c.readKeyed("cgroup.events")
+	if err != nil {
+		return Event{}, err
+	}
+	ev := Event{
+		Populated: events["populated"] == 1,
+		Frozen:    events["frozen"] == 1,
+	}
+	if memory, err := c.readKeyed("memory.events"); err == nil {
+		ev.OOMKills = memory["oom_kill"]
+	}
+	return ev, nil
+}
+
+// awaitDepopulated waits until "populated 0" in cgroup.events indicates that
+// all processes in the cgroup at dir have exited. This is best-effort: if the
+// cgroup can not be watched or the processes do not exit within
+// depopulateTimeout, a warning is logged and it returns anyway.
+func awaitDepopulated(dir string) {
+	ctx, cancel := context.WithTimeout(context.Background(), depopulateTimeout)
+	defer cancel()
+
+	events, err := watchEvents(ctx, dir)
+	if err != nil {
+		slog.Warn(
+			"failed to watch cgroup events",
+			"path", dir,
+			"error", err,
+		)
+		return
+	}
+	for ev := range events {
+		if !ev.Populated {
+			return
+		}
+	}
+	if ctx.Err() != nil {
+		slog.Warn(
+			"timed out waiting for cgroup processes to exit",
+			"path", dir,
+			"timeout", depopulateTimeout,
+		)
+	}
+}
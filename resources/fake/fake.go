@@ -0,0 +1,341 @@
+// Package fake provides an in-memory resources.Backend for tests that can not
+// use real cgroups, such as tests that run without root. It records the calls
+// made to it, and can inject failures and simulate OOM kills.
+//
+// A fake cgroup has no kernel accounting, so its limits are not enforced.
+// Processes are added to it once they start, and it kills, freezes and thaws
+// them by signaling their process groups. Stats counts the processes added to
+// it and reads their resident memory from /proc.
+package fake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/kkloberdanz/teleworker/resources"
+)
+
+// Backend is an in-memory resources.Backend. The exported fields may be set
+// before the backend is used.
+type Backend struct {
+	CreateErr error // If set, CreateCgroup fails with this error.
+	CPUs      []int // CPUs returned by EffectiveCPUs.
+
+	mu      sync.Mutex
+	pidsMax int64
+	cgroups map[string]*Cgroup
+	calls   []string
+}
+
+// NewBackend creates a fake backend with the default limits of the cgroupfs
+// backend, and 4 CPUs.
+func NewBackend() *Backend {
+	return &Backend{
+		CPUs:    []int{0, 1, 2, 3},
+		pidsMax: resources.DefaultPidsMax,
+		cgroups: make(map[string]*Cgroup),
+	}
+}
+
+// CreateCgroup records the call and returns a new fake cgroup. Limits are
+// checked like the cgroupfs backend checks them.
+func (b *Backend) CreateCgroup(jobID string, limits resources.Limits) (resources.Cgroup, error) {
+	b.record("CreateCgroup %s", jobID)
+	if b.CreateErr != nil {
+		return nil, b.CreateErr
+	}
+	if limits.PidsMax < 0 || limits.PidsMax > b.pidsMax {
+		return nil, fmt.Errorf("%w: pids.max must be between 1 and %d, got %d", resources.ErrLimitTooHigh, b.pidsMax, limits.PidsMax)
+	}
+	if _, err := resources.ParseCPUList(limits.Cpuset.CPUs); err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.cgroups[jobID]; ok {
+		return nil, fmt.Errorf("cgroup %s already exists", jobID)
+	}
+	cg := &Cgroup{Limits: limits, backend: b, id: jobID, cpuset: limits.Cpuset, changed: make(chan struct{})}
+	b.cgroups[jobID] = cg
+	return cg, nil
+}
+
+// PidsMax returns resources.DefaultPidsMax, the highest pids.max a job may
+// ask for.
+func (b *Backend) PidsMax() int64 {
+	return b.pidsMax
+}
+
+// EffectiveCPUs returns b.CPUs.
+func (b *Backend) EffectiveCPUs() ([]int, error) {
+	return slices.Clone(b.CPUs), nil
+}
+
+// Cleanup kills the processes in every cgroup and removes them.
+func (b *Backend) Cleanup() {
+	b.record("Cleanup")
+	b.mu.Lock()
+	cgroups := make([]*Cgroup, 0, len(b.cgroups))
+	for _, cg := range b.cgroups {
+		cgroups = append(cgroups, cg)
+	}
+	b.mu.Unlock()
+	for _, cg := range cgroups {
+		cg.Kill()
+		cg.Cleanup()
+	}
+}
+
+// Cgroup returns the fake cgroup for a job, or nil if it does not exist or
+// has been cleaned up.
+func (b *Backend) Cgroup(jobID string) *Cgroup {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.cgroups[jobID]
+}
+
+// Calls returns the calls made to the backend and its cgroups, in order, such
+// as "CreateCgroup <id>" and "Kill <id>".
+func (b *Backend) Calls() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return slices.Clone(b.calls)
+}
+
+func (b *Backend) record(format string, args ...any) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.calls = append(b.calls, fmt.Sprintf(format, args...))
+}
+
+// Cgroup is an in-memory resources.Cgroup. The exported fields may be set to
+// inject failures and usage.
+type Cgroup struct {
+	KillErr   error            // If set, Kill fails with this error without killing anything.
+	FreezeErr error            // If set, Freeze and Thaw fail with this error.
+	Stat      resources.Stats  // Returned by Stats.
+	Use       resources.Usage  // Returned by Usage.
+	PidsHits  int64            // Returned by PidsMaxHits.
+	Limits    resources.Limits // Limits the cgroup was created with. Read only.
+
+	backend *Backend
+	id      string
+
+	mu       sync.Mutex
+	pids     []int
+	cpuset   resources.Cpuset
+	frozen   bool
+	oomKills uint64
+	removed  bool
+	changed  chan struct{} // Closed and replaced each time the state changes.
+}
+
+// FD returns -1, since a fake cgroup has no directory.
+func (c *Cgroup) FD() int {
+	return -1
+}
+
+// CloseFD does nothing.
+func (c *Cgroup) CloseFD() error {
+	return nil
+}
+
+// AddProcess records the process, so that it is killed, frozen and thawed
+// with the cgroup.
+func (c *Cgroup) AddProcess(pid int) error {
+	c.backend.record("AddProcess %s", c.id)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pids = append(c.pids, pid)
+	c.notify()
+	return nil
+}
+
+// SetCpuset records the cpuset.
+func (c *Cgroup) SetCpuset(cs resources.Cpuset) error {
+	c.backend.record("SetCpuset %s %s", c.id, cs.CPUs)
+	if _, err := resources.ParseCPUList(cs.CPUs); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cpuset = cs
+	return nil
+}
+
+// Cpuset returns the cpuset the cgroup was created with, or set by SetCpuset.
+func (c *Cgroup) Cpuset() (resources.Cpuset, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cpuset, nil
+}
+
+// Kill sends SIGKILL to the process group of every process in the cgroup,
+// unless KillErr is set.
+func (c *Cgroup) Kill() error {
+	c.backend.record("Kill %s", c.id)
+	if c.KillErr != nil {
+		return c.KillErr
+	}
+	c.signal(syscall.SIGKILL)
+	return nil
+}
+
+// Freeze sends SIGSTOP to the processes in the cgroup, unless FreezeErr is
+// set.
+func (c *Cgroup) Freeze() error {
+	c.backend.record("Freeze %s", c.id)
+	return c.setFrozen(true, syscall.SIGSTOP)
+}
+
+// Thaw sends SIGCONT to the processes in the cgroup, unless FreezeErr is set.
+func (c *Cgroup) Thaw() error {
+	c.backend.record("Thaw %s", c.id)
+	return c.setFrozen(false, syscall.SIGCONT)
+}
+
+func (c *Cgroup) setFrozen(frozen bool, sig syscall.Signal) error {
+	if c.FreezeErr != nil {
+		return c.FreezeErr
+	}
+	c.signal(sig)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.frozen = frozen
+	c.notify()
+	return nil
+}
+
+// OOMKill simulates the OOM killer: it counts an OOM kill and kills every
+// process in the cgroup, as it would with memory.oom.group set.
+func (c *Cgroup) OOMKill() {
+	c.backend.record("OOMKill %s", c.id)
+	c.mu.Lock()
+	c.oomKills++
+	c.notify()
+	c.mu.Unlock()
+	c.signal(syscall.SIGKILL)
+}
+
+func (c *Cgroup) signal(sig syscall.Signal) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, pid := range c.pids {
+		// Jobs run in their own process group, so signal the whole group.
+		if err := syscall.Kill(-pid, sig); errors.Is(err, syscall.ESRCH) {
+			syscall.Kill(pid, sig)
+		}
+	}
+}
+
+// Stats returns c.Stat, with PidsCurrent and Memory.Current filled in from
+// the processes added to the cgroup that are still alive, unless they are set.
+func (c *Cgroup) Stats() (*resources.Stats, error) {
+	stats := c.Stat
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var pids, rss uint64
+	for _, pid := range c.pids {
+		// statm holds sizes in pages, and the second field is resident memory.
+		data, err := os.ReadFile(fmt.Sprintf("/proc/%d/statm", pid))
+		if err != nil {
+			continue
+		}
+		pids++
+		fields := strings.Fields(string(data))
+		if len(fields) < 2 {
+			continue
+		}
+		if pages, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			rss += pages * uint64(os.Getpagesize())
+		}
+	}
+	if stats.PidsCurrent == 0 {
+		stats.PidsCurrent = pids
+	}
+	if stats.Memory.Current == 0 {
+		stats.Memory.Current = rss
+	}
+	return &stats, nil
+}
+
+// Usage returns c.Use.
+func (c *Cgroup) Usage() (*resources.Usage, error) {
+	usage := c.Use
+	return &usage, nil
+}
+
+// PidsMaxHits returns c.PidsHits.
+func (c *Cgroup) PidsMaxHits() (int64, error) {
+	return c.PidsHits, nil
+}
+
+// OOMKills returns the number of OOM kills simulated with OOMKill.
+func (c *Cgroup) OOMKills() (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.oomKills, nil
+}
+
+// Events sends the state of the cgroup when it starts and each time it
+// changes. A fake cgroup is populated once a process is added, until it is
+// cleaned up.
+func (c *Cgroup) Events(ctx context.Context) (<-chan resources.Event, error) {
+	events := make(chan resources.Event)
+	go func() {
+		defer close(events)
+		for {
+			c.mu.Lock()
+			ev := resources.Event{
+				Populated: len(c.pids) > 0 && !c.removed,
+				Frozen:    c.frozen,
+				OOMKills:  c.oomKills,
+			}
+			removed, changed := c.removed, c.changed
+			c.mu.Unlock()
+
+			select {
+			case events <- ev:
+			case <-ctx.Done():
+				return
+			}
+			if removed {
+				return
+			}
+			select {
+			case <-changed:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events, nil
+}
+
+// Cleanup removes the cgroup from the backend.
+func (c *Cgroup) Cleanup() error {
+	c.backend.record("Cleanup %s", c.id)
+	c.backend.mu.Lock()
+	delete(c.backend.cgroups, c.id)
+	c.backend.mu.Unlock()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removed = true
+	c.notify()
+	return nil
+}
+
+// notify wakes up Events. The caller must hold c.mu.
+func (c *Cgroup) notify() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
@@ -0,0 +1,154 @@
+package resources
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// DefaultIOLimits are the IO limits used when none are configured: 5 MB/s
+// read and write on the disk holding the root filesystem.
+var DefaultIOLimits = []IOLimit{{Device: "/", RBps: 5242880, WBps: 5242880}}
+
+// sysDevBlock is where the kernel lists block devices by major:minor number.
+const sysDevBlock = "/sys/dev/block"
+
+// IOLimit is an io.max limit for one device. Limits of 0 are unlimited.
+type IOLimit struct {
+	Device string // A "major:minor" device number, a block device such as /dev/sda1, or any other path, which means the device its filesystem is on.
+	RBps   uint64 // Read bytes per second.
+	WBps   uint64 // Write bytes per second.
+	RIOps  uint64 // Read operations per second.
+	WIOps  uint64 // Write operations per second.
+}
+
+// ParseIOLimit parses a limit in the format of io.max, except that the device
+// may also be a path, e.g. "/var/lib rbps=1048576 wiops=100". The limits are
+// "rbps", "wbps", "riops" and "wiops", and at least one must be set.
+func ParseIOLimit(spec string) (IOLimit, error) {
+	fields := strings.Fields(spec)
+	if len(fields) < 2 {
+		return IOLimit{}, fmt.Errorf("invalid io limit %q (expected a device followed by key=value limits)", spec)
+	}
+	limit := IOLimit{Device: fields[0]}
+	for _, field := range fields[1:] {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return IOLimit{}, fmt.Errorf("invalid io limit %q (expected key=value)", field)
+		}
+		v, err := strconv.ParseUint(value, 10, 64)
+		if err != nil || v == 0 {
+			return IOLimit{}, fmt.Errorf("invalid io limit %q: must be a positive number", field)
+		}
+		switch key {
+		case "rbps":
+			limit.RBps = v
+		case "wbps":
+			limit.WBps = v
+		case "riops":
+			limit.RIOps = v
+		case "wiops":
+			limit.WIOps = v
+		default:
+			return IOLimit{}, fmt.Errorf("unknown io limit %q", key)
+		}
+	}
+	return limit, nil
+}
+
+// ioMax resolves the limit's device and returns an io.max line for each disk
+// it is on.
+func (l IOLimit) ioMax() ([]string, error) {
+	disks, err := ResolveDevice(l.Device)
+	if err != nil {
+		return nil, err
+	}
+	value := func(v uint64) string {
+		if v == 0 {
+			return "max"
+		}
+		return strconv.FormatUint(v, 10)
+	}
+	lines := make([]string, len(disks))
+	for i, disk := range disks {
+		lines[i] = fmt.Sprintf("%s rbps=%s wbps=%s riops=%s wiops=%s",
+			disk, value(l.RBps), value(l.WBps), value(l.RIOps), value(l.WIOps))
+	}
+	return lines, nil
+}
+
+// ResolveDevice returns the "major:minor" numbers of the whole disks that
+// hold device, which is a "major:minor" number or a path, as described for
+// IOLimit.Device. The kernel only throttles IO on whole disks, so a partition
+// resolves to its disk, and a device-mapper or md RAID device, such as an LVM
+// volume, resolves to every disk beneath it.
+func ResolveDevice(device string) ([]string, error) {
+	devNum := device
+	if strings.HasPrefix(device, "/") {
+		var st unix.Stat_t
+		if err := unix.Stat(device, &st); err != nil {
+			return nil, fmt.Errorf("failed to stat %s: %w", device, err)
+		}
+		dev := st.Dev
+		if st.Mode&unix.S_IFMT == unix.S_IFBLK {
+			dev = st.Rdev
+		}
+		devNum = fmt.Sprintf("%d:%d", unix.Major(dev), unix.Minor(dev))
+	}
+
+	sysPath := filepath.Join(sysDevBlock, devNum)
+	if _, err := os.Stat(sysPath); err != nil {
+		return nil, fmt.Errorf("%s (device %s) is not a block device", device, devNum)
+	}
+	return wholeDisks(sysPath)
+}
+
+// wholeDisks returns the "major:minor" numbers of the disks that hold the
+// block device at sysPath in sysfs.
+func wholeDisks(sysPath string) ([]string, error) {
+	// sysfs links to the device's real directory, which must be resolved
+	// before its parent can be found.
+	resolved, err := filepath.EvalSymlinks(sysPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", sysPath, err)
+	}
+	sysPath = resolved
+
+	// Partitions are listed in sysfs beneath their disk.
+	if _, err := os.Stat(filepath.Join(sysPath, "partition")); err == nil {
+		sysPath = filepath.Join(sysPath, "..")
+	}
+
+	// Stacked devices list the devices beneath them in slaves.
+	slaves, err := os.ReadDir(filepath.Join(sysPath, "slaves"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read %s: %w", filepath.Join(sysPath, "slaves"), err)
+	}
+	if len(slaves) == 0 {
+		dev, err := os.ReadFile(filepath.Join(sysPath, "dev"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read device number: %w", err)
+		}
+		return []string{strings.TrimSpace(string(dev))}, nil
+	}
+
+	var disks []string
+	for _, slave := range slaves {
+		d, err := wholeDisks(filepath.Join(sysPath, "slaves", slave.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, disk := range d {
+			if !slices.Contains(disks, disk) {
+				disks = append(disks, disk)
+			}
+		}
+	}
+	return disks, nil
+}
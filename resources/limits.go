@@ -0,0 +1,98 @@
+package resources
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Limits are the cgroup limits for one job. Zero values use the manager's
+// defaults, see DefaultLimits.
+type Limits struct {
+	CPUQuota   time.Duration // CPU time the job may use in each CPUPeriod. Together they set cpu.max.
+	CPUPeriod  time.Duration // Length of a cpu.max enforcement period.
+	MemoryMax  int64         // memory.max: Memory in bytes above which the OOM killer is invoked.
+	MemoryHigh int64         // memory.high: Memory in bytes above which the job is throttled and reclaimed from. 0 does not throttle.
+	SwapMax    *int64        // memory.swap.max: Swap in bytes the job may use. 0 disables swap, and nil leaves the kernel default.
+	OOMGroup   *bool         // memory.oom.group: If true, an OOM kill kills every process in the job, rather than the one using the most memory.
+	PidsMax    int64         // pids.max: Maximum number of processes and threads.
+	Cpuset     Cpuset        // cpuset.cpus and cpuset.mems: CPUs and memory nodes to pin the job to.
+}
+
+// DefaultLimits are the limits of a job that does not set its own: 1 CPU,
+// 500 MiB of memory, DefaultPidsMax processes, and OOM kills that kill the
+// whole job.
+var DefaultLimits = Limits{
+	CPUQuota:  100 * time.Millisecond,
+	CPUPeriod: 100 * time.Millisecond,
+	MemoryMax: 500 * 1024 * 1024,
+	OOMGroup:  func() *bool { b := true; return &b }(),
+	PidsMax:   DefaultPidsMax,
+}
+
+// withDefaults fills in the limits that are not set from defaults, which are
+// also the highest limits allowed. Returns ErrLimitTooHigh if a limit is above
+// its default.
+func (l Limits) withDefaults(defaults Limits) (Limits, error) {
+	if l.CPUQuota == 0 {
+		l.CPUQuota = defaults.CPUQuota
+	}
+	if l.CPUPeriod == 0 {
+		l.CPUPeriod = defaults.CPUPeriod
+	}
+	if l.MemoryMax == 0 {
+		l.MemoryMax = defaults.MemoryMax
+	}
+	if l.OOMGroup == nil {
+		l.OOMGroup = defaults.OOMGroup
+	}
+	if l.PidsMax == 0 {
+		l.PidsMax = defaults.PidsMax
+	}
+
+	switch {
+	case l.PidsMax < 0 || l.PidsMax > defaults.PidsMax:
+		return Limits{}, fmt.Errorf("%w: pids.max must be between 1 and %d, got %d", ErrLimitTooHigh, defaults.PidsMax, l.PidsMax)
+	case l.MemoryMax < 0 || l.MemoryMax > defaults.MemoryMax:
+		return Limits{}, fmt.Errorf("%w: memory.max must be between 1 and %d, got %d", ErrLimitTooHigh, defaults.MemoryMax, l.MemoryMax)
+	case l.MemoryHigh < 0 || l.MemoryHigh > l.MemoryMax:
+		return Limits{}, fmt.Errorf("%w: memory.high must be between 0 and memory.max (%d), got %d", ErrLimitTooHigh, l.MemoryMax, l.MemoryHigh)
+	case l.SwapMax != nil && *l.SwapMax < 0:
+		return Limits{}, fmt.Errorf("%w: memory.swap.max must not be negative, got %d", ErrLimitTooHigh, *l.SwapMax)
+	case l.CPUQuota > l.CPUPeriod*time.Duration(defaults.CPUQuota)/time.Duration(defaults.CPUPeriod):
+		return Limits{}, fmt.Errorf("%w: cpu quota %v per %v is above %v per %v", ErrLimitTooHigh, l.CPUQuota, l.CPUPeriod, defaults.CPUQuota, defaults.CPUPeriod)
+	}
+	return l, nil
+}
+
+// files returns the interface files to write, with their values, in the order
+// to write them. The cpuset is written separately, by SetCpuset.
+func (l Limits) files() []limitFile {
+	files := []limitFile{
+		{"cpu.max", fmt.Sprintf("%d %d", l.CPUQuota.Microseconds(), l.CPUPeriod.Microseconds())},
+		{"memory.max", strconv.FormatInt(l.MemoryMax, 10)},
+	}
+	if l.MemoryHigh > 0 {
+		files = append(files, limitFile{"memory.high", strconv.FormatInt(l.MemoryHigh, 10)})
+	}
+	if l.SwapMax != nil {
+		files = append(files, limitFile{"memory.swap.max", strconv.FormatInt(*l.SwapMax, 10)})
+	}
+	if l.OOMGroup != nil {
+		files = append(files, limitFile{"memory.oom.group", boolFile(*l.OOMGroup)})
+	}
+	return append(files, limitFile{"pids.max", strconv.FormatInt(l.PidsMax, 10)})
+}
+
+// limitFile is a cgroup interface file and the value to write to it.
+type limitFile struct {
+	name  string
+	value string
+}
+
+func boolFile(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
@@ -1,25 +1,45 @@
-// Package resources provides cgroup v2 resource controls for jobs.
+// Package resources provides cgroup resource controls for jobs, using cgroup
+// v2, or cgroup v1 on hosts that do not have it.
 package resources
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
-	"syscall"
-	"time"
 
 	"golang.org/x/sys/unix"
 )
 
-// Manager is used to create cgroups.
+// DefaultPidsMax is the default maximum number of processes and threads in
+// a job's cgroup. This stops a fork bomb in one job from exhausting the PIDs
+// of the whole host.
+const DefaultPidsMax = 1024
+
+// ErrLimitTooHigh is returned when a job asks for a limit above the one the
+// manager allows.
+var ErrLimitTooHigh = errors.New("limit exceeds the server's maximum")
+
+// Manager is the cgroupfs Backend. It creates job cgroups beneath a parent
+// cgroup in the cgroup v2 filesystem.
 type Manager struct {
 	parentPath string
+	limits     Limits      // Default, and highest, limits for job cgroups.
+	ioMax      []limitFile // io.max lines to write to each job cgroup, one per disk.
+}
+
+// Options configures the limits of the cgroups a Manager creates.
+type Options struct {
+	PidsMax  int64     // Default, and highest, pids.max for each job. If 0, DefaultPidsMax is used.
+	IOLimits []IOLimit // IO limits for each job. If nil, DefaultIOLimits is used, and skipped with a warning if the root filesystem's disk can not be limited.
 }
 
-// Cgroup represents a single job's cgroup.
-type Cgroup struct {
+// cgroupDir is a job's cgroup in the cgroup v2 filesystem.
+type cgroupDir struct {
 	path string
 	fd   int
 }
@@ -27,7 +47,15 @@ type Cgroup struct {
 // NewManager creates the parent cgroup directory and enables controllers.
 // Returns an error if cgroup v2 is not available or permissions are insufficient.
 // The parentPath specifies where to create job cgroups (e.g. "/sys/fs/cgroup/teleworker").
-func NewManager(parentPath string) (*Manager, error) {
+// Configured IO limits are checked against the kernel here, so that a
+// misconfigured device is reported when teleworker starts rather than when a
+// job does.
+func NewManager(parentPath string, opts Options) (*Manager, error) {
+	limits, err := opts.limits()
+	if err != nil {
+		return nil, err
+	}
+
 	if _, err := os.Stat("/sys/fs/cgroup/cgroup.controllers"); err != nil {
 		return nil, fmt.Errorf("cgroup v2 not available: %w", err)
 	}
@@ -40,16 +68,98 @@ func NewManager(parentPath string) (*Manager, error) {
 		return nil, fmt.Errorf("failed to create parent cgroup: %w", err)
 	}
 
-	// We'll be enabling CPU, Memory, and Disk IO controllers.
+	// We'll be enabling CPU, cpuset, Memory, Disk IO and PIDs controllers.
 	if err := os.WriteFile(
 		filepath.Join(parentPath, "cgroup.subtree_control"),
-		[]byte("+cpu +memory +io"),
+		[]byte("+cpu +cpuset +memory +io +pids"),
 		0644,
 	); err != nil {
 		return nil, fmt.Errorf("failed to enable cgroup controllers: %w", err)
 	}
 
-	return &Manager{parentPath: parentPath}, nil
+	ioMax, err := checkIOLimits(opts.IOLimits, func(limits []IOLimit) ([]limitFile, error) {
+		return resolveIOLimits(parentPath, limits)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Manager{parentPath: parentPath, limits: limits, ioMax: ioMax}, nil
+}
+
+// limits returns the default, and highest, limits for job cgroups.
+func (opts Options) limits() (Limits, error) {
+	if opts.PidsMax < 0 {
+		return Limits{}, fmt.Errorf("invalid pids.max %d", opts.PidsMax)
+	}
+	limits := DefaultLimits
+	if opts.PidsMax != 0 {
+		limits.PidsMax = opts.PidsMax
+	}
+	return limits, nil
+}
+
+// checkIOLimits resolves the IO limits to interface files with resolve, which
+// also checks that the kernel accepts them. If limits is nil, DefaultIOLimits
+// is used, and dropped with a warning if it is not accepted, since the root
+// filesystem is not always on a disk that can be limited, such as in a
+// container.
+func checkIOLimits(limits []IOLimit, resolve func([]IOLimit) ([]limitFile, error)) ([]limitFile, error) {
+	bestEffort := limits == nil
+	if bestEffort {
+		limits = DefaultIOLimits
+	}
+
+	files, err := resolve(limits)
+	if err != nil {
+		if !bestEffort {
+			return nil, err
+		}
+		slog.Warn(
+			"running jobs without io limits",
+			"error", err,
+		)
+		return nil, nil
+	}
+	return files, nil
+}
+
+// resolveIOLimits resolves the IO limits to io.max lines, and checks that the
+// kernel accepts them by writing them to a temporary cgroup.
+func resolveIOLimits(parentPath string, limits []IOLimit) ([]limitFile, error) {
+	var ioMax []limitFile
+	for _, limit := range limits {
+		lines, err := limit.ioMax()
+		if err != nil {
+			return nil, fmt.Errorf("invalid io limit for %s: %w", limit.Device, err)
+		}
+		for _, line := range lines {
+			ioMax = append(ioMax, limitFile{"io.max", line})
+		}
+	}
+	if err := probeLimitFiles(parentPath, ioMax); err != nil {
+		return nil, err
+	}
+	return ioMax, nil
+}
+
+// probeLimitFiles checks that the kernel accepts the interface files by
+// writing them to a temporary cgroup beneath parentPath.
+func probeLimitFiles(parentPath string, files []limitFile) error {
+	if len(files) == 0 {
+		return nil
+	}
+	path := filepath.Join(parentPath, "io-check")
+	if err := os.Mkdir(path, 0755); err != nil {
+		return fmt.Errorf("failed to create cgroup directory: %w", err)
+	}
+	defer os.Remove(path)
+	for _, f := range files {
+		if err := os.WriteFile(filepath.Join(path, f.name), []byte(f.value), 0644); err != nil {
+			return fmt.Errorf("%s %q was rejected by the kernel: %w", f.name, f.value, err)
+		}
+	}
+	return nil
 }
 
 // ParentPath returns the parent cgroup directory path.
@@ -62,16 +172,26 @@ func (m *Manager) Cleanup() {
 	cleanupStaleDir(m.parentPath)
 }
 
+// PidsMax returns the default, and highest, pids.max for job cgroups.
+func (m *Manager) PidsMax() int64 {
+	return m.limits.PidsMax
+}
+
 // CreateCgroup creates a cgroup for the given job ID, writes resource limits,
-// and opens a directory fd for use with SysProcAttr.CgroupFD.
-func (m *Manager) CreateCgroup(jobID string) (*Cgroup, error) {
+// and opens a directory fd for use with SysProcAttr.CgroupFD. Limits that are
+// not set use the manager's defaults. Returns ErrLimitTooHigh if a limit is
+// above its default, or ErrInvalidCpuset if the cpuset is not valid.
+func (m *Manager) CreateCgroup(jobID string, limits Limits) (Cgroup, error) {
+	limits, err := limits.withDefaults(m.limits)
+	if err != nil {
+		return nil, err
+	}
+
 	path := filepath.Join(m.parentPath, jobID)
 	if err := os.Mkdir(path, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create cgroup directory: %w", err)
 	}
-
-	// CPU: 1 core (100ms quota per 100ms period).
-	if err := os.WriteFile(filepath.Join(path, "cpu.max"), []byte("100000 100000"), 0644); err != nil {
+	removeDir := func() {
 		if rmErr := os.Remove(path); rmErr != nil {
 			slog.Warn(
 				"failed to remove cgroup directory",
@@ -79,62 +199,35 @@ func (m *Manager) CreateCgroup(jobID string) (*Cgroup, error) {
 				"error", rmErr,
 			)
 		}
-		return nil, fmt.Errorf("failed to set cpu.max: %w", err)
 	}
 
-	// Memory: 500 MiB.
-	if err := os.WriteFile(filepath.Join(path, "memory.max"), []byte("524288000"), 0644); err != nil {
-		if rmErr := os.Remove(path); rmErr != nil {
-			slog.Warn(
-				"failed to remove cgroup directory",
-				"path", path,
-				"error", rmErr,
-			)
+	// PIDs contain fork bombs: once the limit is reached, fork and clone fail
+	// with EAGAIN inside the job. IO limits were checked by NewManager, so an
+	// error writing them is unexpected.
+	for _, f := range append(limits.files(), m.ioMax...) {
+		if err := os.WriteFile(filepath.Join(path, f.name), []byte(f.value), 0644); err != nil {
+			removeDir()
+			return nil, fmt.Errorf("failed to set %s: %w", f.name, err)
 		}
-		return nil, fmt.Errorf("failed to set memory.max: %w", err)
 	}
 
-	// TODO: I tested setting disk io on my machine, but different disk
-	// configurations may have different behavior. I'm going to make this a best
-	// effort configuration in case this runs on a machine with a disk
-	// configuration that I have not been able to test. If this fails, then I
-	// will warn instead of failing to configure io cgroups.
-	//
-	// IO: 5 MB/s read and write on root filesystem block device.
-	ioMax, err := rootIOMax()
-	if err != nil {
-		slog.Warn(
-			"failed to get io.max config",
-			"error", err,
-		)
-	} else if err := os.WriteFile(filepath.Join(path, "io.max"), []byte(ioMax), 0644); err != nil {
-		// Setting io.max with an incorrect major:minor configuration results in
-		// an error. While this works on my machine, I have not been able to
-		// test it on other disk configurations (e.g. RAID). I will not make
-		// this a failure condition, but instead log a warning.
-		slog.Warn(
-			"failed to set io.max",
-			"error", err,
-		)
+	cg := &cgroupDir{path: path, fd: -1}
+	if err := cg.SetCpuset(limits.Cpuset); err != nil {
+		removeDir()
+		return nil, err
 	}
 
-	fd, err := unix.Open(path, unix.O_RDONLY|unix.O_DIRECTORY, 0)
+	cg.fd, err = unix.Open(path, unix.O_RDONLY|unix.O_DIRECTORY, 0)
 	if err != nil {
-		if rmErr := os.Remove(path); rmErr != nil {
-			slog.Warn(
-				"failed to remove cgroup directory",
-				"path", path,
-				"error", rmErr,
-			)
-		}
+		removeDir()
 		return nil, fmt.Errorf("failed to open cgroup directory fd: %w", err)
 	}
 
-	return &Cgroup{path: path, fd: fd}, nil
+	return cg, nil
 }
 
 // FD returns the cgroup directory file descriptor for SysProcAttr.CgroupFD.
-func (c *Cgroup) FD() int {
+func (c *cgroupDir) FD() int {
 	return c.fd
 }
 
@@ -142,7 +235,7 @@ func (c *Cgroup) FD() int {
 // process has started and the fd is no longer needed. The fd is set to -1 when
 // called, and that value is checked before calling close, meaning it is safe
 // to call this method multiple times.
-func (c *Cgroup) CloseFD() error {
+func (c *cgroupDir) CloseFD() error {
 	if c.fd == -1 {
 		return nil
 	}
@@ -151,14 +244,84 @@ func (c *Cgroup) CloseFD() error {
 	return err
 }
 
+// AddProcess writes the process to cgroup.procs. Processes are normally
+// started in the cgroup through FD, so this is only needed for processes
+// started some other way.
+func (c *cgroupDir) AddProcess(pid int) error {
+	return os.WriteFile(filepath.Join(c.path, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0644)
+}
+
 // Kill writes "1" to cgroup.kill, terminating all processes in this cgroup.
-func (c *Cgroup) Kill() error {
+func (c *cgroupDir) Kill() error {
 	return os.WriteFile(filepath.Join(c.path, "cgroup.kill"), []byte("1"), 0644)
 }
 
-// Cleanup closes the directory fd if still open and removes the cgroup directory.
-func (c *Cgroup) Cleanup() error {
+// Freeze writes "1" to cgroup.freeze, stopping every process in the cgroup,
+// and waits until cgroup.events reports that the cgroup is frozen.
+func (c *cgroupDir) Freeze() error {
+	return c.setFrozen(true)
+}
+
+// Thaw writes "0" to cgroup.freeze, resuming the processes in the cgroup, and
+// waits until cgroup.events reports that the cgroup is no longer frozen.
+func (c *cgroupDir) Thaw() error {
+	return c.setFrozen(false)
+}
+
+func (c *cgroupDir) setFrozen(frozen bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), freezeTimeout)
+	defer cancel()
+
+	// Watch before writing, so that the change can not be missed.
+	events, err := c.Events(ctx)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(c.path, "cgroup.freeze"), []byte(boolFile(frozen)), 0644); err != nil {
+		return fmt.Errorf("failed to write cgroup.freeze: %w", err)
+	}
+	for ev := range events {
+		if ev.Frozen == frozen {
+			return nil
+		}
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("timed out waiting for cgroup.freeze to take effect: %w", ctx.Err())
+	}
+	return errors.New("cgroup was removed while freezing")
+}
+
+// PidsMaxHits returns the number of times a process in the cgroup failed to
+// fork because the cgroup reached its pids.max limit, from the "max" entry in
+// pids.events.
+func (c *cgroupDir) PidsMaxHits() (int64, error) {
+	data, err := os.ReadFile(filepath.Join(c.path, "pids.events"))
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if v, ok := strings.CutPrefix(line, "max "); ok {
+			return strconv.ParseInt(v, 10, 64)
+		}
+	}
+	return 0, fmt.Errorf("no max entry in %s", filepath.Join(c.path, "pids.events"))
+}
+
+// OOMKills returns the number of processes in the cgroup that were killed by
+// the OOM killer, from the "oom_kill" entry in memory.events.
+func (c *cgroupDir) OOMKills() (uint64, error) {
+	events, err := c.readKeyed("memory.events")
+	if err != nil {
+		return 0, err
+	}
+	return events["oom_kill"], nil
+}
+
+// Cleanup closes the directory fd if still open, waits for any processes left
+// in the cgroup to exit, and removes the cgroup directory.
+func (c *cgroupDir) Cleanup() error {
 	c.CloseFD()
+	awaitDepopulated(c.path)
 	return os.Remove(c.path)
 }
 
@@ -199,35 +362,3 @@ func cleanupStaleDir(dir string) {
 		)
 	}
 }
-
-// awaitDepopulated polls cgroup.events until "populated 0" indicates all
-// processes have exited. This is best-effort; errors and timeouts are silently
-// ignored. This could also be done more efficiently with inotify on
-// cgroup.events instead of polling.
-func awaitDepopulated(dir string) {
-	eventsPath := filepath.Join(dir, "cgroup.events")
-	for range 50 {
-		data, err := os.ReadFile(eventsPath)
-		if err != nil {
-			return
-		}
-		if strings.Contains(string(data), "populated 0") {
-			return
-		}
-		time.Sleep(100 * time.Millisecond)
-	}
-}
-
-// rootIOMax returns the io.max string for the root filesystem's block device.
-//
-// TODO: For simplicity, this hard-codes the path to the root directory, and
-// finds which device is mapped to that directory. This could be extended to
-// allow configuration of which disks have which limits.
-func rootIOMax() (string, error) {
-	var stat syscall.Stat_t
-	if err := syscall.Stat("/", &stat); err != nil {
-		return "", err
-	}
-	major := unix.Major(stat.Dev)
-	return fmt.Sprintf("%d:0 rbps=5242880 wbps=5242880", major), nil
-}
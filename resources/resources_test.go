@@ -1,13 +1,21 @@
 package resources_test
 
 import (
+	"context"
+	"errors"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"syscall"
 	"testing"
+	"time"
 
 	"go.uber.org/goleak"
 
+	"github.com/kkloberdanz/teleworker/resources"
 	"github.com/kkloberdanz/teleworker/testutil"
 )
 
@@ -18,7 +26,7 @@ func TestMain(m *testing.M) {
 func TestCreateAndCleanupCgroup(t *testing.T) {
 	mgr := testutil.RequireManager(t)
 
-	cg, err := mgr.CreateCgroup("test-job-1")
+	cg, err := mgr.CreateCgroup("test-job-1", resources.Limits{})
 	if err != nil {
 		t.Fatalf("CreateCgroup failed: %v", err)
 	}
@@ -40,7 +48,7 @@ func TestCreateAndCleanupCgroup(t *testing.T) {
 func TestResourceLimitsWritten(t *testing.T) {
 	mgr := testutil.RequireManager(t)
 
-	cg, err := mgr.CreateCgroup("test-job-2")
+	cg, err := mgr.CreateCgroup("test-job-2", resources.Limits{})
 	if err != nil {
 		t.Fatalf("CreateCgroup failed: %v", err)
 	}
@@ -63,12 +71,46 @@ func TestResourceLimitsWritten(t *testing.T) {
 	if got := strings.TrimSpace(string(memMax)); got != "524288000" {
 		t.Fatalf("expected memory.max = %q, got %q", "524288000", got)
 	}
+
+	pidsMax, err := os.ReadFile(filepath.Join(cgPath, "pids.max"))
+	if err != nil {
+		t.Fatalf("failed to read pids.max: %v", err)
+	}
+	if got, want := strings.TrimSpace(string(pidsMax)), strconv.Itoa(resources.DefaultPidsMax); got != want {
+		t.Fatalf("expected pids.max = %q, got %q", want, got)
+	}
+}
+
+func TestPidsMaxOverride(t *testing.T) {
+	mgr := testutil.RequireManager(t)
+
+	cg, err := mgr.CreateCgroup("test-job-4", resources.Limits{PidsMax: 16})
+	if err != nil {
+		t.Fatalf("CreateCgroup failed: %v", err)
+	}
+	t.Cleanup(func() { cg.Cleanup() })
+
+	pidsMax, err := os.ReadFile(filepath.Join(mgr.ParentPath(), "test-job-4", "pids.max"))
+	if err != nil {
+		t.Fatalf("failed to read pids.max: %v", err)
+	}
+	if got := strings.TrimSpace(string(pidsMax)); got != "16" {
+		t.Fatalf("expected pids.max = %q, got %q", "16", got)
+	}
+	if hits, err := cg.PidsMaxHits(); err != nil || hits != 0 {
+		t.Fatalf("expected no pids.max hits, got %d (%v)", hits, err)
+	}
+
+	// Jobs may not raise their limit above the manager's default.
+	if _, err := mgr.CreateCgroup("test-job-5", resources.Limits{PidsMax: mgr.PidsMax() + 1}); !errors.Is(err, resources.ErrLimitTooHigh) {
+		t.Fatalf("expected ErrLimitTooHigh, got %v", err)
+	}
 }
 
 func TestKillCgroup(t *testing.T) {
 	mgr := testutil.RequireManager(t)
 
-	cg, err := mgr.CreateCgroup("test-job-3")
+	cg, err := mgr.CreateCgroup("test-job-3", resources.Limits{})
 	if err != nil {
 		t.Fatalf("CreateCgroup failed: %v", err)
 	}
@@ -79,3 +121,390 @@ func TestKillCgroup(t *testing.T) {
 		t.Fatalf("Kill failed: %v", err)
 	}
 }
+
+func TestCgroupStats(t *testing.T) {
+	mgr := testutil.RequireManager(t)
+
+	cg, err := mgr.CreateCgroup("test-job-6", resources.Limits{})
+	if err != nil {
+		t.Fatalf("CreateCgroup failed: %v", err)
+	}
+	t.Cleanup(func() { cg.Cleanup() })
+
+	stats, err := cg.Stats()
+	if err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+	if stats.PidsCurrent != 0 {
+		t.Fatalf("expected no processes in an empty cgroup, got %d", stats.PidsCurrent)
+	}
+	if _, ok := stats.Memory.Stat["anon"]; !ok {
+		t.Fatalf("expected memory.stat to include anon, got %v", stats.Memory.Stat)
+	}
+	if _, err := os.Stat("/proc/pressure/memory"); err == nil && stats.Pressure == nil {
+		t.Fatal("expected pressure stats on a kernel with PSI enabled")
+	}
+}
+
+func TestCgroupUsage(t *testing.T) {
+	mgr := testutil.RequireManager(t)
+
+	cg, err := mgr.CreateCgroup("test-job-7", resources.Limits{})
+	if err != nil {
+		t.Fatalf("CreateCgroup failed: %v", err)
+	}
+	t.Cleanup(func() { cg.Cleanup() })
+
+	usage, err := cg.Usage()
+	if err != nil {
+		t.Fatalf("Usage failed: %v", err)
+	}
+	if usage.CPUUsec != 0 || usage.ReadBytes != 0 || usage.WriteBytes != 0 || usage.PidsPeak != 0 {
+		t.Fatalf("expected no usage in an empty cgroup, got %+v", usage)
+	}
+}
+
+func TestCgroupEvents(t *testing.T) {
+	mgr := testutil.RequireManager(t)
+
+	cg, err := mgr.CreateCgroup("test-job-8", resources.Limits{})
+	if err != nil {
+		t.Fatalf("CreateCgroup failed: %v", err)
+	}
+
+	cmd := exec.Command("sleep", "60")
+	cmd.SysProcAttr = &syscall.SysProcAttr{UseCgroupFD: true, CgroupFD: cg.FD()}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("failed to start process: %v", err)
+	}
+	cg.CloseFD()
+
+	events, err := cg.Events(t.Context())
+	if err != nil {
+		t.Fatalf("Events failed: %v", err)
+	}
+	if ev := <-events; !ev.Populated {
+		t.Fatalf("expected populated cgroup, got %+v", ev)
+	}
+
+	if err := cg.Kill(); err != nil {
+		t.Fatalf("Kill failed: %v", err)
+	}
+	cmd.Wait()
+	for ev := range events {
+		if !ev.Populated {
+			break
+		}
+	}
+
+	// The channel is closed once the cgroup is removed.
+	if err := cg.Cleanup(); err != nil {
+		t.Fatalf("Cleanup failed: %v", err)
+	}
+	for range events {
+	}
+}
+
+func TestParseIOLimit(t *testing.T) {
+	limit, err := resources.ParseIOLimit("/var/lib rbps=1048576 wiops=100")
+	if err != nil {
+		t.Fatalf("ParseIOLimit failed: %v", err)
+	}
+	want := resources.IOLimit{Device: "/var/lib", RBps: 1048576, WIOps: 100}
+	if limit != want {
+		t.Fatalf("expected %+v, got %+v", want, limit)
+	}
+	for _, bad := range []string{"8:0", "8:0 rbps", "8:0 rbps=0", "8:0 rbps=-1", "8:0 bps=10"} {
+		if _, err := resources.ParseIOLimit(bad); err == nil {
+			t.Fatalf("expected error for %q, got nil", bad)
+		}
+	}
+}
+
+func TestResolveDevice(t *testing.T) {
+	disks, err := resources.ResolveDevice("/")
+	if err != nil {
+		t.Skipf("skipping: root filesystem is not on a block device: %v", err)
+	}
+	for _, disk := range disks {
+		if _, err := os.Stat(filepath.Join("/sys/dev/block", disk, "partition")); err == nil {
+			t.Fatalf("expected %s to be a whole disk, not a partition", disk)
+		}
+		// A whole disk resolves to itself.
+		got, err := resources.ResolveDevice(disk)
+		if err != nil {
+			t.Fatalf("ResolveDevice(%q) failed: %v", disk, err)
+		}
+		if len(got) != 1 || got[0] != disk {
+			t.Fatalf("expected %s to resolve to itself, got %v", disk, got)
+		}
+	}
+
+	if _, err := resources.ResolveDevice("/proc"); err == nil {
+		t.Fatal("expected error for a filesystem without a block device, got nil")
+	}
+}
+
+func TestResolveDevicePartition(t *testing.T) {
+	partitions, _ := filepath.Glob("/sys/class/block/*/partition")
+	if len(partitions) == 0 {
+		t.Skip("skipping: no partitions")
+	}
+	data, err := os.ReadFile(filepath.Join(filepath.Dir(partitions[0]), "dev"))
+	if err != nil {
+		t.Fatalf("failed to read partition device number: %v", err)
+	}
+	part := strings.TrimSpace(string(data))
+
+	disks, err := resources.ResolveDevice(part)
+	if err != nil {
+		t.Fatalf("ResolveDevice(%q) failed: %v", part, err)
+	}
+	if len(disks) != 1 || disks[0] == part {
+		t.Fatalf("expected partition %s to resolve to its disk, got %v", part, disks)
+	}
+}
+
+func TestParseCPUList(t *testing.T) {
+	cpus, err := resources.ParseCPUList("6,0-3,2")
+	if err != nil {
+		t.Fatalf("ParseCPUList failed: %v", err)
+	}
+	if want := []int{0, 1, 2, 3, 6}; !slices.Equal(cpus, want) {
+		t.Fatalf("expected %v, got %v", want, cpus)
+	}
+	if got := resources.FormatCPUList(cpus); got != "0-3,6" {
+		t.Fatalf("expected %q, got %q", "0-3,6", got)
+	}
+	for _, bad := range []string{"a", "3-1", "-1", "0,,1"} {
+		if _, err := resources.ParseCPUList(bad); !errors.Is(err, resources.ErrInvalidCpuset) {
+			t.Fatalf("expected ErrInvalidCpuset for %q, got %v", bad, err)
+		}
+	}
+}
+
+func TestCPUAllocator(t *testing.T) {
+	a := resources.NewCPUAllocator([]int{4, 5, 6}, false)
+
+	cpus, err := a.Allocate(2)
+	if err != nil {
+		t.Fatalf("Allocate failed: %v", err)
+	}
+	if want := []int{4, 5}; !slices.Equal(cpus, want) {
+		t.Fatalf("expected %v, got %v", want, cpus)
+	}
+	if _, err := a.AllocateWait(t.Context(), 2); !errors.Is(err, resources.ErrNoFreeCPUs) {
+		t.Fatalf("expected ErrNoFreeCPUs, got %v", err)
+	}
+	if _, err := a.Allocate(4); !errors.Is(err, resources.ErrInvalidCpuset) {
+		t.Fatalf("expected ErrInvalidCpuset for more cpus than the pool, got %v", err)
+	}
+
+	a.Release(cpus)
+	if cpus, err = a.Allocate(3); err != nil {
+		t.Fatalf("Allocate after Release failed: %v", err)
+	}
+}
+
+func TestCPUAllocatorQueue(t *testing.T) {
+	a := resources.NewCPUAllocator([]int{0, 1}, true)
+
+	held, err := a.Allocate(2)
+	if err != nil {
+		t.Fatalf("Allocate failed: %v", err)
+	}
+
+	// A canceled wait gives up without taking any CPUs.
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	if _, err := a.AllocateWait(ctx, 1); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	// Waiters are served in order, so once the first waiter is queued for
+	// two CPUs, the one free CPU is not handed to anyone else.
+	a.Release(held[:1])
+	first := make(chan []int)
+	go func() {
+		cpus, _ := a.AllocateWait(context.Background(), 2)
+		first <- cpus
+	}()
+	testutil.PollUntil(t, "first waiter to queue", func() bool {
+		cpus, err := a.Allocate(1)
+		if err == nil {
+			a.Release(cpus)
+		}
+		return errors.Is(err, resources.ErrNoFreeCPUs)
+	})
+	second := make(chan []int)
+	go func() {
+		cpus, _ := a.AllocateWait(context.Background(), 1)
+		second <- cpus
+	}()
+	select {
+	case cpus := <-second:
+		t.Fatalf("second waiter jumped the queue with %v", cpus)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	a.Release(held[1:])
+	cpus := <-first
+	if !slices.Equal(cpus, []int{0, 1}) {
+		t.Fatalf("expected first waiter to get [0 1], got %v", cpus)
+	}
+	a.Release(cpus)
+	if cpus := <-second; len(cpus) != 1 {
+		t.Fatalf("expected second waiter to get 1 cpu, got %v", cpus)
+	}
+}
+
+func TestCreateCgroupMemoryLimits(t *testing.T) {
+	mgr := testutil.RequireManager(t)
+
+	swap, oomGroup := int64(0), false
+	cg, err := mgr.CreateCgroup("test-job-9", resources.Limits{
+		MemoryHigh: 100 * 1024 * 1024,
+		SwapMax:    &swap,
+		OOMGroup:   &oomGroup,
+	})
+	if err != nil {
+		t.Fatalf("CreateCgroup failed: %v", err)
+	}
+	t.Cleanup(func() { cg.Cleanup() })
+
+	cgPath := filepath.Join(mgr.ParentPath(), "test-job-9")
+	for name, want := range map[string]string{
+		"memory.max":       "524288000",
+		"memory.high":      "104857600",
+		"memory.swap.max":  "0",
+		"memory.oom.group": "0",
+		"cpu.max":          "100000 100000",
+	} {
+		data, err := os.ReadFile(filepath.Join(cgPath, name))
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", name, err)
+		}
+		if got := strings.TrimSpace(string(data)); got != want {
+			t.Fatalf("expected %s to be %q, got %q", name, want, got)
+		}
+	}
+
+	if _, err := mgr.CreateCgroup("test-job-10", resources.Limits{MemoryHigh: 1 << 40}); !errors.Is(err, resources.ErrLimitTooHigh) {
+		t.Fatalf("expected ErrLimitTooHigh for memory.high above memory.max, got %v", err)
+	}
+}
+
+func TestNewBackend(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("skipping: requires root")
+	}
+
+	backend, err := resources.NewBackend("/sys/fs/cgroup", "teleworker-test-backend", resources.Options{})
+	if err != nil {
+		t.Fatalf("NewBackend failed: %v", err)
+	}
+	t.Cleanup(backend.Cleanup)
+
+	_, v2 := backend.(*resources.Manager)
+	if _, err := os.Stat("/sys/fs/cgroup/cgroup.controllers"); (err == nil) != v2 {
+		t.Fatalf("expected the cgroup v2 backend only when cgroup v2 is mounted, got %T", backend)
+	}
+}
+
+func TestV1ResourceLimitsWritten(t *testing.T) {
+	mgr := testutil.RequireV1Manager(t)
+
+	cg, err := mgr.CreateCgroup("test-job-1", resources.Limits{MemoryHigh: 256 * 1024 * 1024, PidsMax: 16})
+	if err != nil {
+		t.Fatalf("CreateCgroup failed: %v", err)
+	}
+	t.Cleanup(func() { cg.Cleanup() })
+
+	for _, f := range []struct {
+		controller, name, want string
+	}{
+		{"cpu", "cpu.cfs_quota_us", "100000"},
+		{"cpu", "cpu.cfs_period_us", "100000"},
+		{"memory", "memory.limit_in_bytes", "524288000"},
+		{"memory", "memory.soft_limit_in_bytes", "268435456"},
+		{"pids", "pids.max", "16"},
+	} {
+		parent := mgr.ParentPath(f.controller)
+		if parent == "" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(parent, "test-job-1", f.name))
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", f.name, err)
+		}
+		if got := strings.TrimSpace(string(data)); got != f.want {
+			t.Fatalf("expected %s = %q, got %q", f.name, f.want, got)
+		}
+	}
+
+	// Jobs may not raise their limit above the manager's default.
+	if _, err := mgr.CreateCgroup("test-job-2", resources.Limits{PidsMax: mgr.PidsMax() + 1}); !errors.Is(err, resources.ErrLimitTooHigh) {
+		t.Fatalf("expected ErrLimitTooHigh, got %v", err)
+	}
+}
+
+func TestV1KillCgroup(t *testing.T) {
+	mgr := testutil.RequireV1Manager(t)
+
+	cg, err := mgr.CreateCgroup("test-job-3", resources.Limits{})
+	if err != nil {
+		t.Fatalf("CreateCgroup failed: %v", err)
+	}
+
+	// The shell waits for a line on stdin before forking, so that it is in
+	// the cgroup before its children start.
+	cmd := exec.Command("sh", "-c", "read x; sleep 60 & sleep 60 & wait")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatalf("StdinPipe failed: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("failed to start process: %v", err)
+	}
+	if err := cg.AddProcess(cmd.Process.Pid); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		t.Fatalf("AddProcess failed: %v", err)
+	}
+	stdin.Write([]byte("\n"))
+
+	testutil.PollUntil(t, "children to join the cgroup", func() bool {
+		stats, err := cg.Stats()
+		if err != nil {
+			t.Fatalf("Stats failed: %v", err)
+		}
+		return stats.PidsCurrent >= 3
+	})
+
+	events, err := cg.Events(t.Context())
+	if err != nil {
+		t.Fatalf("Events failed: %v", err)
+	}
+	if ev := <-events; !ev.Populated {
+		t.Fatalf("expected populated cgroup, got %+v", ev)
+	}
+
+	if err := cg.Kill(); err != nil {
+		t.Fatalf("Kill failed: %v", err)
+	}
+	cmd.Wait()
+	for ev := range events {
+		if !ev.Populated {
+			break
+		}
+	}
+
+	if err := cg.Cleanup(); err != nil {
+		t.Fatalf("Cleanup failed: %v", err)
+	}
+	for range events {
+	}
+	if _, err := os.Stat(filepath.Join(mgr.ParentPath("memory"), "test-job-3")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected job cgroup to be removed, got %v", err)
+	}
+}
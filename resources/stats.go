@@ -0,0 +1,287 @@
+package resources
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Stats is a snapshot of a cgroup's resource usage, read from its interface
+// files. See: https://www.kernel.org/doc/html/latest/admin-guide/cgroup-v2.html
+type Stats struct {
+	CPU         CPUStats    `json:"cpu"`
+	Memory      MemoryStats `json:"memory"`
+	IO          []IOStats   `json:"io"`                 // One entry per block device the cgroup has used.
+	PidsCurrent uint64      `json:"pids_current"`       // Number of processes and threads in the cgroup.
+	Pressure    *Pressure   `json:"pressure,omitempty"` // Pressure stall information: `nil` if the kernel was built or booted without PSI.
+}
+
+// Pressure holds the cpu.pressure, memory.pressure and io.pressure files,
+// which report how long tasks in the cgroup stalled waiting for each resource.
+// See: https://docs.kernel.org/accounting/psi.html
+type Pressure struct {
+	CPU    PressureStats `json:"cpu"`
+	Memory PressureStats `json:"memory"`
+	IO     PressureStats `json:"io"`
+}
+
+// PressureStats is one pressure file. "some" is the share of time at least
+// one task was stalled, and "full" the share of time all tasks were stalled
+// at once.
+type PressureStats struct {
+	Some PressureLine `json:"some"`
+	Full PressureLine `json:"full"`
+}
+
+// PressureLine is one line of a pressure file. Averages are percentages.
+type PressureLine struct {
+	Avg10  float64 `json:"avg10"`  // Average over the last 10 seconds.
+	Avg60  float64 `json:"avg60"`  // Average over the last 60 seconds.
+	Avg300 float64 `json:"avg300"` // Average over the last 300 seconds.
+	Total  uint64  `json:"total"`  // Total stall time in microseconds.
+}
+
+// CPUStats holds the fields of cpu.stat. Times are in microseconds.
+type CPUStats struct {
+	UsageUsec     uint64 `json:"usage_usec"`     // Total CPU time used.
+	UserUsec      uint64 `json:"user_usec"`      // CPU time used in user mode.
+	SystemUsec    uint64 `json:"system_usec"`    // CPU time used in kernel mode.
+	NrPeriods     uint64 `json:"nr_periods"`     // Number of cpu.max enforcement periods that have elapsed.
+	NrThrottled   uint64 `json:"nr_throttled"`   // Number of periods in which the cgroup was throttled.
+	ThrottledUsec uint64 `json:"throttled_usec"` // Total time the cgroup was throttled for.
+}
+
+// MemoryStats holds memory.current, memory.peak and memory.stat. Values are
+// in bytes, except for the event counters in Stat.
+type MemoryStats struct {
+	Current uint64            `json:"current"` // Memory currently used by the cgroup.
+	Peak    uint64            `json:"peak"`    // Highest memory usage since the cgroup was created. 0 if the kernel does not provide memory.peak (before Linux 5.19).
+	Stat    map[string]uint64 `json:"stat"`    // Breakdown of memory usage from memory.stat, e.g. "anon" and "file".
+}
+
+// IOStats holds the io.stat entry for one block device.
+type IOStats struct {
+	Major  uint32 `json:"major"`
+	Minor  uint32 `json:"minor"`
+	RBytes uint64 `json:"rbytes"` // Bytes read.
+	WBytes uint64 `json:"wbytes"` // Bytes written.
+	RIOs   uint64 `json:"rios"`   // Read operations.
+	WIOs   uint64 `json:"wios"`   // Write operations.
+	DBytes uint64 `json:"dbytes"` // Bytes discarded.
+	DIOs   uint64 `json:"dios"`   // Discard operations.
+}
+
+// Stats reads the cgroup's current resource usage.
+func (c *cgroupDir) Stats() (*Stats, error) {
+	var stats Stats
+
+	cpu, err := c.readKeyed("cpu.stat")
+	if err != nil {
+		return nil, err
+	}
+	stats.CPU = CPUStats{
+		UsageUsec:     cpu["usage_usec"],
+		UserUsec:      cpu["user_usec"],
+		SystemUsec:    cpu["system_usec"],
+		NrPeriods:     cpu["nr_periods"],
+		NrThrottled:   cpu["nr_throttled"],
+		ThrottledUsec: cpu["throttled_usec"],
+	}
+
+	if stats.Memory.Current, err = c.readUint("memory.current"); err != nil {
+		return nil, err
+	}
+	if stats.Memory.Peak, err = c.readUint("memory.peak"); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if stats.Memory.Stat, err = c.readKeyed("memory.stat"); err != nil {
+		return nil, err
+	}
+
+	if stats.IO, err = c.readIOStat(); err != nil {
+		return nil, err
+	}
+
+	if stats.PidsCurrent, err = c.readUint("pids.current"); err != nil {
+		return nil, err
+	}
+
+	if stats.Pressure, err = c.readPressure(); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// readPressure reads the cgroup's pressure files, or returns nil if the
+// kernel does not provide them.
+func (c *cgroupDir) readPressure() (*Pressure, error) {
+	var p Pressure
+	for _, f := range []struct {
+		name  string
+		stats *PressureStats
+	}{
+		{"cpu.pressure", &p.CPU},
+		{"memory.pressure", &p.Memory},
+		{"io.pressure", &p.IO},
+	} {
+		data, err := os.ReadFile(filepath.Join(c.path, f.name))
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, syscall.EOPNOTSUPP) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if *f.stats, err = parsePressure(string(data)); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", f.name, err)
+		}
+	}
+	return &p, nil
+}
+
+// parsePressure parses a pressure file, which looks like so:
+//
+//	some avg10=0.00 avg60=0.00 avg300=0.00 total=0
+//	full avg10=0.00 avg60=0.00 avg300=0.00 total=0
+func parsePressure(data string) (PressureStats, error) {
+	var stats PressureStats
+	for _, line := range strings.Split(strings.TrimSpace(data), "\n") {
+		var kind string
+		var pl PressureLine
+		if _, err := fmt.Sscanf(line, "%s avg10=%f avg60=%f avg300=%f total=%d", &kind, &pl.Avg10, &pl.Avg60, &pl.Avg300, &pl.Total); err != nil {
+			return PressureStats{}, err
+		}
+		switch kind {
+		case "some":
+			stats.Some = pl
+		case "full":
+			stats.Full = pl
+		}
+	}
+	return stats, nil
+}
+
+// Usage is a summary of the resources a cgroup has used over its lifetime.
+// It is taken just before the cgroup is removed, so that the accounting
+// outlives it.
+type Usage struct {
+	CPUUsec       uint64 `json:"cpu_usec"`       // Total CPU time used, in microseconds.
+	UserUsec      uint64 `json:"user_usec"`      // CPU time used in user mode, in microseconds.
+	SystemUsec    uint64 `json:"system_usec"`    // CPU time used in kernel mode, in microseconds.
+	MemoryPeak    uint64 `json:"memory_peak"`    // Highest memory usage in bytes. 0 if the kernel does not provide memory.peak (before Linux 5.19).
+	ReadBytes     uint64 `json:"read_bytes"`     // Bytes read from all block devices.
+	WriteBytes    uint64 `json:"write_bytes"`    // Bytes written to all block devices.
+	PidsPeak      uint64 `json:"pids_peak"`      // Highest number of processes and threads. 0 if the kernel does not provide pids.peak (before Linux 6.1).
+	NrThrottled   uint64 `json:"nr_throttled"`   // Number of cpu.max periods in which the cgroup was throttled.
+	ThrottledUsec uint64 `json:"throttled_usec"` // Total time the cgroup was throttled for, in microseconds.
+}
+
+// Usage reads a summary of the resources the cgroup has used since it was
+// created.
+func (c *cgroupDir) Usage() (*Usage, error) {
+	stats, err := c.Stats()
+	if err != nil {
+		return nil, err
+	}
+	usage := Usage{
+		CPUUsec:       stats.CPU.UsageUsec,
+		UserUsec:      stats.CPU.UserUsec,
+		SystemUsec:    stats.CPU.SystemUsec,
+		MemoryPeak:    stats.Memory.Peak,
+		NrThrottled:   stats.CPU.NrThrottled,
+		ThrottledUsec: stats.CPU.ThrottledUsec,
+	}
+	for _, dev := range stats.IO {
+		usage.ReadBytes += dev.RBytes
+		usage.WriteBytes += dev.WBytes
+	}
+	if usage.PidsPeak, err = c.readUint("pids.peak"); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return &usage, nil
+}
+
+// readUint reads an interface file holding a single number.
+func (c *cgroupDir) readUint(name string) (uint64, error) {
+	data, err := os.ReadFile(filepath.Join(c.path, name))
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	return v, nil
+}
+
+// readKeyed reads an interface file with a "key value" pair on each line,
+// such as cpu.stat or memory.stat.
+func (c *cgroupDir) readKeyed(name string) (map[string]uint64, error) {
+	data, err := os.ReadFile(filepath.Join(c.path, name))
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]uint64)
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		key, value, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		v, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+		}
+		values[key] = v
+	}
+	return values, nil
+}
+
+// readIOStat reads io.stat, which has a line for each device like so:
+//
+//	8:0 rbytes=1459200 wbytes=314773504 rios=192 wios=353 dbytes=0 dios=0
+func (c *cgroupDir) readIOStat() ([]IOStats, error) {
+	data, err := os.ReadFile(filepath.Join(c.path, "io.stat"))
+	if err != nil {
+		return nil, err
+	}
+	var devices []IOStats
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		var dev IOStats
+		if _, err := fmt.Sscanf(fields[0], "%d:%d", &dev.Major, &dev.Minor); err != nil {
+			return nil, fmt.Errorf("failed to parse io.stat device %q: %w", fields[0], err)
+		}
+		for _, field := range fields[1:] {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok {
+				continue
+			}
+			v, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse io.stat: %w", err)
+			}
+			switch key {
+			case "rbytes":
+				dev.RBytes = v
+			case "wbytes":
+				dev.WBytes = v
+			case "rios":
+				dev.RIOs = v
+			case "wios":
+				dev.WIOs = v
+			case "dbytes":
+				dev.DBytes = v
+			case "dios":
+				dev.DIOs = v
+			}
+		}
+		devices = append(devices, dev)
+	}
+	return devices, nil
+}
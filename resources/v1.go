@@ -0,0 +1,743 @@
+package resources
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// v1PollInterval is how often the v1 backend polls a cgroup for changes,
+	// since cgroup v1 has no cgroup.events file to watch.
+	v1PollInterval = 50 * time.Millisecond
+	// userHZ is the unit of cpuacct.stat, which the kernel always reports in
+	// hundredths of a second.
+	userHZ = 100
+)
+
+var (
+	// v1Required are the controllers whose hierarchies the v1 backend needs.
+	v1Required = []string{"cpu", "memory", "blkio"}
+	// v1Optional are the controllers whose hierarchies the v1 backend uses if
+	// they are mounted: cpuacct for CPU accounting, pids for pids.max, cpuset
+	// for pinning and freezer for freezing, and for killing jobs that fork.
+	v1Optional = []string{"cpuacct", "pids", "cpuset", "freezer"}
+)
+
+// V1Manager is the Backend for hosts with a cgroup v1 or hybrid hierarchy,
+// where each controller has its own hierarchy. It creates a job's cgroup
+// beneath a parent cgroup in each hierarchy it uses, and writes the v1
+// equivalent of each limit:
+//
+//   - cpu.max is cpu.cfs_quota_us and cpu.cfs_period_us.
+//   - memory.max is memory.limit_in_bytes.
+//   - memory.high is memory.soft_limit_in_bytes, which is only reclaimed from
+//     when the host is short of memory, rather than throttling the job.
+//   - memory.swap.max is memory.memsw.limit_in_bytes, less memory.max. It
+//     requires swap accounting to be enabled.
+//   - memory.oom.group has no equivalent, so an OOM kill only kills the
+//     process using the most memory.
+//   - io.max is the blkio.throttle files.
+//
+// Jobs are started without a cgroup fd, since the kernel can only start
+// processes in a cgroup v2 cgroup, so they are added to their cgroup by the
+// job init process before it runs the command.
+type V1Manager struct {
+	parents  map[string]string // Controller to the parent cgroup in its hierarchy, e.g. "memory" to "/sys/fs/cgroup/memory/teleworker".
+	limits   Limits            // Default, and highest, limits for job cgroups.
+	throttle []limitFile       // blkio.throttle files to write to each job cgroup.
+}
+
+// v1Cgroup is a job's cgroup in each hierarchy used by a V1Manager.
+type v1Cgroup struct {
+	dirs   map[string]string // Controller to the job's cgroup in its hierarchy.
+	cpuset Cpuset            // Set by SetCpuset.
+}
+
+// NewV1Manager creates the parent cgroup called name in each of the cgroup v1
+// hierarchies mounted beneath root, usually /sys/fs/cgroup. Returns an error
+// if the cpu, memory or blkio hierarchy is not mounted, or permissions are
+// insufficient.
+func NewV1Manager(root, name string, opts Options) (*V1Manager, error) {
+	limits, err := opts.limits()
+	if err != nil {
+		return nil, err
+	}
+
+	m := &V1Manager{parents: make(map[string]string), limits: limits}
+	for _, controller := range slices.Concat(v1Required, v1Optional) {
+		// Controllers mounted together, such as "cpu,cpuacct", are linked
+		// to from each name, so resolve the link to find the hierarchy.
+		mount, err := filepath.EvalSymlinks(filepath.Join(root, controller))
+		if err == nil {
+			_, err = os.Stat(filepath.Join(mount, "cgroup.procs"))
+		}
+		if err != nil {
+			if slices.Contains(v1Required, controller) {
+				return nil, fmt.Errorf("cgroup v1 %s hierarchy not available: %w", controller, err)
+			}
+			continue
+		}
+		m.parents[controller] = filepath.Join(mount, name)
+	}
+	if _, ok := m.parents["pids"]; !ok {
+		slog.Warn(
+			"cgroup v1 pids hierarchy not mounted, running jobs without pids.max",
+		)
+	}
+
+	// Kill any stale processes and remove the directories left over from a
+	// previous run (e.g. if teleworker was killed with SIGKILL).
+	m.Cleanup()
+
+	for _, dir := range m.dirs() {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create parent cgroup: %w", err)
+		}
+	}
+	if err := m.initCpuset(); err != nil {
+		return nil, err
+	}
+
+	m.throttle, err = checkIOLimits(opts.IOLimits, m.resolveIOLimits)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// initCpuset gives the parent cpuset cgroup every CPU and memory node of the
+// hierarchy's root. In cgroup v1 a cpuset cgroup starts empty, and processes
+// can not join it until both are set. With cgroup.clone_children set, job
+// cgroups start with the parent's cpuset.
+func (m *V1Manager) initCpuset() error {
+	parent, ok := m.parents["cpuset"]
+	if !ok {
+		return nil
+	}
+	for _, name := range []string{"cpuset.cpus", "cpuset.mems"} {
+		data, err := os.ReadFile(filepath.Join(parent, "..", name))
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		if err := os.WriteFile(filepath.Join(parent, name), data, 0644); err != nil {
+			return fmt.Errorf("failed to set %s: %w", name, err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(parent, "cgroup.clone_children"), []byte("1"), 0644); err != nil {
+		return fmt.Errorf("failed to set cgroup.clone_children: %w", err)
+	}
+	return nil
+}
+
+// resolveIOLimits resolves the IO limits to blkio.throttle files, and checks
+// that the kernel accepts them by writing them to a temporary cgroup.
+func (m *V1Manager) resolveIOLimits(limits []IOLimit) ([]limitFile, error) {
+	var files []limitFile
+	for _, limit := range limits {
+		disks, err := ResolveDevice(limit.Device)
+		if err != nil {
+			return nil, fmt.Errorf("invalid io limit for %s: %w", limit.Device, err)
+		}
+		for _, disk := range disks {
+			for _, f := range []struct {
+				name  string
+				value uint64
+			}{
+				{"blkio.throttle.read_bps_device", limit.RBps},
+				{"blkio.throttle.write_bps_device", limit.WBps},
+				{"blkio.throttle.read_iops_device", limit.RIOps},
+				{"blkio.throttle.write_iops_device", limit.WIOps},
+			} {
+				if f.value != 0 {
+					files = append(files, limitFile{f.name, fmt.Sprintf("%s %d", disk, f.value)})
+				}
+			}
+		}
+	}
+	if err := probeLimitFiles(m.parents["blkio"], files); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// dirs returns the parent cgroup in each hierarchy, once each.
+func (m *V1Manager) dirs() []string {
+	return uniqueDirs(m.parents)
+}
+
+// Cleanup kills all processes in the job cgroups and removes the parent
+// cgroups.
+func (m *V1Manager) Cleanup() {
+	for _, dir := range m.dirs() {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			// Directory doesn't exist yet. Nothing to clean up.
+			continue
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				cg := m.cgroup(entry.Name())
+				cg.Kill()
+				cg.Cleanup()
+			}
+		}
+	}
+	for _, dir := range m.dirs() {
+		if err := os.Remove(dir); err != nil && !errors.Is(err, os.ErrNotExist) {
+			slog.Warn(
+				"failed to remove parent cgroup",
+				"path", dir,
+				"error", err,
+			)
+		}
+	}
+}
+
+// ParentPath returns the parent cgroup directory in a controller's hierarchy,
+// or "" if the manager does not use the hierarchy.
+func (m *V1Manager) ParentPath(controller string) string {
+	return m.parents[controller]
+}
+
+// PidsMax returns the default, and highest, pids.max for job cgroups.
+func (m *V1Manager) PidsMax() int64 {
+	return m.limits.PidsMax
+}
+
+// EffectiveCPUs returns the CPUs that job cgroups may use, from the parent
+// cgroup's cpuset.effective_cpus, or every online CPU if the cpuset hierarchy
+// is not mounted.
+func (m *V1Manager) EffectiveCPUs() ([]int, error) {
+	path := "/sys/devices/system/cpu/online"
+	if parent, ok := m.parents["cpuset"]; ok {
+		path = filepath.Join(parent, "cpuset.effective_cpus")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseCPUList(string(data))
+}
+
+// CreateCgroup creates a cgroup for the given job ID in each hierarchy and
+// writes resource limits. Limits that are not set use the manager's defaults.
+// Returns ErrLimitTooHigh if a limit is above its default, or
+// ErrInvalidCpuset if the cpuset is not valid.
+func (m *V1Manager) CreateCgroup(jobID string, limits Limits) (Cgroup, error) {
+	limits, err := limits.withDefaults(m.limits)
+	if err != nil {
+		return nil, err
+	}
+
+	cg := m.cgroup(jobID)
+	for _, dir := range uniqueDirs(cg.dirs) {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			cg.remove()
+			return nil, fmt.Errorf("failed to create cgroup directory: %w", err)
+		}
+	}
+
+	for _, f := range append(limits.v1Files(), m.throttle...) {
+		controller, _, _ := strings.Cut(f.name, ".")
+		dir, ok := cg.dirs[controller]
+		if !ok {
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(dir, f.name), []byte(f.value), 0644); err != nil {
+			cg.remove()
+			return nil, fmt.Errorf("failed to set %s: %w", f.name, err)
+		}
+	}
+	if err := cg.SetCpuset(limits.Cpuset); err != nil {
+		cg.remove()
+		return nil, err
+	}
+	return cg, nil
+}
+
+// cgroup returns the job cgroup for jobID, without creating it.
+func (m *V1Manager) cgroup(jobID string) *v1Cgroup {
+	cg := &v1Cgroup{dirs: make(map[string]string, len(m.parents))}
+	for controller, parent := range m.parents {
+		cg.dirs[controller] = filepath.Join(parent, jobID)
+	}
+	return cg
+}
+
+// v1Files returns the cgroup v1 interface files to write, with their values,
+// in the order to write them. Each file is in the hierarchy named by the
+// start of its name.
+func (l Limits) v1Files() []limitFile {
+	files := []limitFile{
+		// The period is written first, since the quota must not be below
+		// 1ms of it.
+		{"cpu.cfs_period_us", strconv.FormatInt(l.CPUPeriod.Microseconds(), 10)},
+		{"cpu.cfs_quota_us", strconv.FormatInt(l.CPUQuota.Microseconds(), 10)},
+		{"memory.limit_in_bytes", strconv.FormatInt(l.MemoryMax, 10)},
+	}
+	if l.MemoryHigh > 0 {
+		files = append(files, limitFile{"memory.soft_limit_in_bytes", strconv.FormatInt(l.MemoryHigh, 10)})
+	}
+	if l.SwapMax != nil {
+		files = append(files, limitFile{"memory.memsw.limit_in_bytes", strconv.FormatInt(l.MemoryMax+*l.SwapMax, 10)})
+	}
+	return append(files, limitFile{"pids.max", strconv.FormatInt(l.PidsMax, 10)})
+}
+
+// uniqueDirs returns the directories in dirs in a stable order.
+func uniqueDirs(dirs map[string]string) []string {
+	var unique []string
+	for _, dir := range dirs {
+		if !slices.Contains(unique, dir) {
+			unique = append(unique, dir)
+		}
+	}
+	slices.Sort(unique)
+	return unique
+}
+
+// FD returns -1, since processes can not be started in a cgroup v1 cgroup.
+func (c *v1Cgroup) FD() int {
+	return -1
+}
+
+// CloseFD does nothing, since there is no fd.
+func (c *v1Cgroup) CloseFD() error {
+	return nil
+}
+
+// AddProcess writes the process to cgroup.procs in each hierarchy.
+func (c *v1Cgroup) AddProcess(pid int) error {
+	for _, dir := range uniqueDirs(c.dirs) {
+		if err := os.WriteFile(filepath.Join(dir, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0644); err != nil {
+			return fmt.Errorf("failed to add process to %s: %w", dir, err)
+		}
+	}
+	return nil
+}
+
+// SetCpuset writes the cpuset to the cgroup in the cpuset hierarchy. Returns
+// ErrInvalidCpuset if the kernel rejects it, or the hierarchy is not mounted.
+func (c *v1Cgroup) SetCpuset(cs Cpuset) error {
+	if cs.IsZero() {
+		return nil
+	}
+	dir, ok := c.dirs["cpuset"]
+	if !ok {
+		return fmt.Errorf("%w: the cgroup v1 cpuset hierarchy is not mounted", ErrInvalidCpuset)
+	}
+	if err := (&cgroupDir{path: dir}).SetCpuset(cs); err != nil {
+		return err
+	}
+	c.cpuset = cs
+	return nil
+}
+
+// Cpuset returns the cpuset set by SetCpuset. Values are empty if the cgroup
+// uses every CPU or memory node of its parent.
+func (c *v1Cgroup) Cpuset() (Cpuset, error) {
+	return c.cpuset, nil
+}
+
+// Kill sends SIGKILL to every process in cgroup.procs, since cgroup v1 has no
+// cgroup.kill. If the freezer hierarchy is mounted, the cgroup is frozen
+// first, so that no process can fork while they are being killed. Otherwise
+// cgroup.procs is read again until it has no new processes.
+func (c *v1Cgroup) Kill() error {
+	if _, ok := c.dirs["freezer"]; ok {
+		if err := c.Freeze(); err != nil {
+			slog.Warn(
+				"failed to freeze cgroup before killing it",
+				"path", c.dirs["freezer"],
+				"error", err,
+			)
+		}
+		// Killed processes only exit once they are thawed.
+		defer c.Thaw()
+	}
+
+	killed := make(map[int]bool)
+	for {
+		pids, err := c.procs()
+		if err != nil {
+			return err
+		}
+		found := false
+		for _, pid := range pids {
+			if killed[pid] {
+				continue
+			}
+			found = true
+			killed[pid] = true
+			if err := unix.Kill(pid, unix.SIGKILL); err != nil && !errors.Is(err, unix.ESRCH) {
+				return fmt.Errorf("failed to kill process %d: %w", pid, err)
+			}
+		}
+		if !found {
+			return nil
+		}
+	}
+}
+
+// procs reads the processes in the cgroup from cgroup.procs in the memory
+// hierarchy, which every job process joins.
+func (c *v1Cgroup) procs() ([]int, error) {
+	data, err := os.ReadFile(filepath.Join(c.dirs["memory"], "cgroup.procs"))
+	if err != nil {
+		return nil, err
+	}
+	var pids []int
+	for _, field := range strings.Fields(string(data)) {
+		pid, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse cgroup.procs: %w", err)
+		}
+		pids = append(pids, pid)
+	}
+	return pids, nil
+}
+
+// Freeze writes FROZEN to freezer.state, and waits until every process in the
+// cgroup is stopped. Returns an error if the freezer hierarchy is not mounted.
+func (c *v1Cgroup) Freeze() error {
+	return c.setFrozen(true)
+}
+
+// Thaw writes THAWED to freezer.state, resuming the processes in the cgroup,
+// and waits until they are no longer frozen.
+func (c *v1Cgroup) Thaw() error {
+	return c.setFrozen(false)
+}
+
+func (c *v1Cgroup) setFrozen(frozen bool) error {
+	dir, ok := c.dirs["freezer"]
+	if !ok {
+		return errors.New("the cgroup v1 freezer hierarchy is not mounted")
+	}
+	state := "THAWED"
+	if frozen {
+		state = "FROZEN"
+	}
+	path := filepath.Join(dir, "freezer.state")
+	if err := os.WriteFile(path, []byte(state), 0644); err != nil {
+		return fmt.Errorf("failed to write freezer.state: %w", err)
+	}
+
+	// The state is FREEZING until every process has stopped.
+	deadline := time.Now().Add(freezeTimeout)
+	for {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read freezer.state: %w", err)
+		}
+		if strings.TrimSpace(string(data)) == state {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for freezer.state to become %s", state)
+		}
+		time.Sleep(v1PollInterval)
+	}
+}
+
+// Stats reads the cgroup's current resource usage from each hierarchy. CPU
+// usage is only reported if the cpuacct hierarchy is mounted, and pressure
+// only if the kernel provides it for cgroup v1, in the cpuacct hierarchy.
+func (c *v1Cgroup) Stats() (*Stats, error) {
+	var stats Stats
+
+	cpu, err := c.in("cpu").readKeyed("cpu.stat")
+	if err != nil {
+		return nil, err
+	}
+	stats.CPU = CPUStats{
+		NrPeriods:     cpu["nr_periods"],
+		NrThrottled:   cpu["nr_throttled"],
+		ThrottledUsec: cpu["throttled_time"] / 1000,
+	}
+	if cpuacct, ok := c.dirs["cpuacct"]; ok {
+		acct := &cgroupDir{path: cpuacct}
+		usage, err := acct.readUint("cpuacct.usage")
+		if err != nil {
+			return nil, err
+		}
+		times, err := acct.readKeyed("cpuacct.stat")
+		if err != nil {
+			return nil, err
+		}
+		stats.CPU.UsageUsec = usage / 1000
+		stats.CPU.UserUsec = times["user"] * 1000000 / userHZ
+		stats.CPU.SystemUsec = times["system"] * 1000000 / userHZ
+
+		if stats.Pressure, err = acct.readPressure(); err != nil {
+			return nil, err
+		}
+	}
+
+	memory := c.in("memory")
+	if stats.Memory.Current, err = memory.readUint("memory.usage_in_bytes"); err != nil {
+		return nil, err
+	}
+	if stats.Memory.Peak, err = memory.readUint("memory.max_usage_in_bytes"); err != nil {
+		return nil, err
+	}
+	if stats.Memory.Stat, err = memory.readKeyed("memory.stat"); err != nil {
+		return nil, err
+	}
+
+	if stats.IO, err = c.readBlkioStat(); err != nil {
+		return nil, err
+	}
+
+	if pids, ok := c.dirs["pids"]; ok {
+		if stats.PidsCurrent, err = (&cgroupDir{path: pids}).readUint("pids.current"); err != nil {
+			return nil, err
+		}
+	} else {
+		// Without the pids hierarchy, count the threads in the cgroup.
+		data, err := os.ReadFile(filepath.Join(c.dirs["memory"], "tasks"))
+		if err != nil {
+			return nil, err
+		}
+		stats.PidsCurrent = uint64(len(strings.Fields(string(data))))
+	}
+	return &stats, nil
+}
+
+// in returns the job's cgroup in a controller's hierarchy, to read its files.
+func (c *v1Cgroup) in(controller string) *cgroupDir {
+	return &cgroupDir{path: c.dirs[controller]}
+}
+
+// readBlkioStat reads blkio.throttle.io_service_bytes and
+// blkio.throttle.io_serviced, which have a line for each device and operation
+// like so:
+//
+//	8:0 Read 1459200
+//	8:0 Write 314773504
+//	8:0 Discard 0
+//
+// Other lines, such as the total, are skipped.
+func (c *v1Cgroup) readBlkioStat() ([]IOStats, error) {
+	var devices []IOStats
+	device := func(dev string) (*IOStats, error) {
+		var major, minor uint32
+		if _, err := fmt.Sscanf(dev, "%d:%d", &major, &minor); err != nil {
+			return nil, fmt.Errorf("failed to parse blkio device %q: %w", dev, err)
+		}
+		for i := range devices {
+			if devices[i].Major == major && devices[i].Minor == minor {
+				return &devices[i], nil
+			}
+		}
+		devices = append(devices, IOStats{Major: major, Minor: minor})
+		return &devices[len(devices)-1], nil
+	}
+
+	for _, f := range []struct {
+		name                  string
+		read, write, discards func(*IOStats) *uint64
+	}{
+		{
+			"blkio.throttle.io_service_bytes",
+			func(s *IOStats) *uint64 { return &s.RBytes },
+			func(s *IOStats) *uint64 { return &s.WBytes },
+			func(s *IOStats) *uint64 { return &s.DBytes },
+		},
+		{
+			"blkio.throttle.io_serviced",
+			func(s *IOStats) *uint64 { return &s.RIOs },
+			func(s *IOStats) *uint64 { return &s.WIOs },
+			func(s *IOStats) *uint64 { return &s.DIOs },
+		},
+	} {
+		data, err := os.ReadFile(filepath.Join(c.dirs["blkio"], f.name))
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) != 3 {
+				continue
+			}
+			var field func(*IOStats) *uint64
+			switch fields[1] {
+			case "Read":
+				field = f.read
+			case "Write":
+				field = f.write
+			case "Discard":
+				field = f.discards
+			default:
+				continue
+			}
+			v, err := strconv.ParseUint(fields[2], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %w", f.name, err)
+			}
+			dev, err := device(fields[0])
+			if err != nil {
+				return nil, err
+			}
+			*field(dev) = v
+		}
+	}
+	return devices, nil
+}
+
+// Usage reads a summary of the resources the cgroup has used since it was
+// created.
+func (c *v1Cgroup) Usage() (*Usage, error) {
+	stats, err := c.Stats()
+	if err != nil {
+		return nil, err
+	}
+	usage := Usage{
+		CPUUsec:       stats.CPU.UsageUsec,
+		UserUsec:      stats.CPU.UserUsec,
+		SystemUsec:    stats.CPU.SystemUsec,
+		MemoryPeak:    stats.Memory.Peak,
+		NrThrottled:   stats.CPU.NrThrottled,
+		ThrottledUsec: stats.CPU.ThrottledUsec,
+	}
+	for _, dev := range stats.IO {
+		usage.ReadBytes += dev.RBytes
+		usage.WriteBytes += dev.WBytes
+	}
+	if pids, ok := c.dirs["pids"]; ok {
+		if usage.PidsPeak, err = (&cgroupDir{path: pids}).readUint("pids.peak"); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return &usage, nil
+}
+
+// PidsMaxHits returns the number of times a process in the cgroup failed to
+// fork because the cgroup reached its pids.max limit, or 0 if the pids
+// hierarchy is not mounted.
+func (c *v1Cgroup) PidsMaxHits() (int64, error) {
+	pids, ok := c.dirs["pids"]
+	if !ok {
+		return 0, nil
+	}
+	return (&cgroupDir{path: pids}).PidsMaxHits()
+}
+
+// OOMKills returns the number of processes in the cgroup that were killed by
+// the OOM killer, from the "oom_kill" entry in memory.oom_control.
+func (c *v1Cgroup) OOMKills() (uint64, error) {
+	control, err := c.in("memory").readKeyed("memory.oom_control")
+	if err != nil {
+		return 0, err
+	}
+	return control["oom_kill"], nil
+}
+
+// Events polls the cgroup every v1PollInterval, since cgroup v1 has no
+// cgroup.events file, and sends an Event with the current state when it
+// starts and each time it changes. The channel is closed when ctx is done or
+// the cgroup is removed.
+func (c *v1Cgroup) Events(ctx context.Context) (<-chan Event, error) {
+	ev, err := c.readEvent()
+	if err != nil {
+		return nil, err
+	}
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		ticker := time.NewTicker(v1PollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case events <- ev:
+			case <-ctx.Done():
+				return
+			}
+			for last := ev; ev == last; {
+				select {
+				case <-ticker.C:
+				case <-ctx.Done():
+					return
+				}
+				if ev, err = c.readEvent(); err != nil {
+					// The cgroup has been removed.
+					return
+				}
+			}
+		}
+	}()
+	return events, nil
+}
+
+// readEvent reads the current state of the cgroup.
+func (c *v1Cgroup) readEvent() (Event, error) {
+	pids, err := c.procs()
+	if err != nil {
+		return Event{}, err
+	}
+	ev := Event{Populated: len(pids) > 0}
+	if dir, ok := c.dirs["freezer"]; ok {
+		state, err := os.ReadFile(filepath.Join(dir, "freezer.state"))
+		if err != nil {
+			return Event{}, err
+		}
+		ev.Frozen = strings.TrimSpace(string(state)) == "FROZEN"
+	}
+	if ev.OOMKills, err = c.OOMKills(); err != nil {
+		return Event{}, err
+	}
+	return ev, nil
+}
+
+// Cleanup waits for any processes left in the cgroup to exit, and removes the
+// cgroup from each hierarchy.
+func (c *v1Cgroup) Cleanup() error {
+	c.awaitDepopulated()
+	return c.remove()
+}
+
+// awaitDepopulated waits until cgroup.procs is empty. Like the cgroup v2
+// version, this is best-effort, and logs a warning if the processes do not
+// exit within depopulateTimeout.
+func (c *v1Cgroup) awaitDepopulated() {
+	ctx, cancel := context.WithTimeout(context.Background(), depopulateTimeout)
+	defer cancel()
+
+	events, err := c.Events(ctx)
+	if err != nil {
+		return
+	}
+	for ev := range events {
+		if !ev.Populated {
+			return
+		}
+	}
+	if ctx.Err() != nil {
+		slog.Warn(
+			"timed out waiting for cgroup processes to exit",
+			"path", c.dirs["memory"],
+			"timeout", depopulateTimeout,
+		)
+	}
+}
+
+// remove removes the cgroup from each hierarchy it was created in.
+func (c *v1Cgroup) remove() error {
+	var errs []error
+	for _, dir := range uniqueDirs(c.dirs) {
+		if err := os.Remove(dir); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -6,15 +6,23 @@ import (
 	"errors"
 	"io"
 	"log/slog"
+	"maps"
+	"path"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
+	"github.com/kkloberdanz/teleworker/audit"
 	"github.com/kkloberdanz/teleworker/auth"
+	"github.com/kkloberdanz/teleworker/image"
 	"github.com/kkloberdanz/teleworker/job"
 	pb "github.com/kkloberdanz/teleworker/proto/teleworker/v1"
+	"github.com/kkloberdanz/teleworker/resources"
 	"github.com/kkloberdanz/teleworker/worker"
 )
 
@@ -22,23 +30,41 @@ import (
 type Server struct {
 	pb.UnimplementedTeleWorkerServer
 	worker *worker.Worker
+	policy *auth.Policy
+	audit  *audit.Log
+}
+
+// Options configures a Server.
+type Options struct {
+	Policy *auth.Policy // Decides which RPCs each caller may make. If nil, auth.DefaultPolicy is used.
+	Audit  *audit.Log   // Audit log that QueryAudit reads. If nil, QueryAudit fails.
 }
 
 // New creates a Server backed by the given Worker.
-func New(w *worker.Worker) *Server {
-	return &Server{worker: w}
+func New(w *worker.Worker, opts Options) *Server {
+	policy := opts.Policy
+	if policy == nil {
+		policy = auth.DefaultPolicy()
+	}
+	return &Server{worker: w, policy: policy, audit: opts.Audit}
 }
 
-// authorize checks that the caller is allowed to access the given job. Admins
-// may access any job. Regular users may only access their own jobs.
+// authorize checks that the policy allows the caller to make the RPC, given by
+// its full method name, on the given job. If the policy only allows it on the
+// caller's own jobs, the job must be theirs, or its owner must have shared it
+// with them. StartJob and GetQuota, which act on no job, pass an empty jobID.
 // The caller's identity must already be in the context (set by the auth interceptor).
-func (s *Server) authorize(ctx context.Context, jobID string) (auth.Identity, error) {
+func (s *Server) authorize(ctx context.Context, method, jobID string) (auth.Identity, error) {
 	id, err := auth.FromContext(ctx)
 	if err != nil {
 		return auth.Identity{}, err
 	}
 
-	if id.IsAdmin() {
+	scope, ok := s.policy.Allows(id, method)
+	if !ok {
+		return auth.Identity{}, status.Errorf(codes.PermissionDenied, "%s (role %q) may not call %s", id.Username, id.Role, path.Base(method))
+	}
+	if scope == auth.ScopeAny || jobID == "" {
 		return id, nil
 	}
 
@@ -50,7 +76,14 @@ func (s *Server) authorize(ctx context.Context, jobID string) (auth.Identity, er
 		return auth.Identity{}, status.Errorf(codes.Internal, "failed to check job owner: %v", err)
 	}
 
-	if owner.Username != id.Username {
+	if owner.Username == id.Username {
+		return id, nil
+	}
+	acl, err := s.worker.GetJobACL(jobID)
+	if err != nil {
+		return auth.Identity{}, status.Errorf(codes.Internal, "failed to check job acl: %v", err)
+	}
+	if !acl.Allows(id, method) {
 		// We return a NotFound here because if we returned PermissionDenied,
 		// this could leak which job IDs are valid and owned by another user.
 		// Job IDs currently are UUIDs, which are 128 bits. It would be
@@ -64,20 +97,68 @@ func (s *Server) authorize(ctx context.Context, jobID string) (auth.Identity, er
 
 // StartJob starts a new job and returns its ID.
 func (s *Server) StartJob(ctx context.Context, req *pb.StartJobRequest) (*pb.StartJobResponse, error) {
-	id, err := auth.FromContext(ctx)
+	id, err := s.authorize(ctx, pb.TeleWorker_StartJob_FullMethodName, "")
 	if err != nil {
 		return nil, err
 	}
 
-	if req.GetCommand() == "" {
+	// Images provide a default command, so the command may only be omitted
+	// when running an image.
+	if req.GetCommand() == "" && req.GetImage() == "" {
 		return nil, status.Error(codes.InvalidArgument, "command must not be empty")
 	}
 
-	// TODO: We can support other job types, such as Docker by extending the
-	// protobuf to include which job type we want to launch. Currently, we will
-	// hard-code JobTypeLocal for simplicity.
-	jobID, err := s.worker.StartJob(job.JobTypeLocal, req.GetCommand(), req.GetArgs(), id)
+	// A caller the policy allows to impersonate on any job, such as an admin,
+	// may start a job for another user, which then belongs to, and is limited
+	// like a job started by, that user. The request only names the user, and
+	// roles come from certificates, so the user is always taken to be a
+	// client: their role's rules, commands and quotas are those of clients.
+	owner := id
+	if req.GetOnBehalfOf() != "" {
+		if scope, _ := s.policy.AllowsVerb(id, auth.VerbImpersonate); scope != auth.ScopeAny {
+			return nil, status.Errorf(codes.PermissionDenied, "%s (role %q) may not start jobs on behalf of other users", id.Username, id.Role)
+		}
+		owner = auth.Identity{Username: req.GetOnBehalfOf(), Role: auth.RoleClient}
+	}
+
+	cmd := auth.Command{Name: req.GetCommand(), Args: req.GetArgs(), Image: req.GetImage()}
+	sha256, err := s.policy.CheckCommand(owner, cmd)
 	if err != nil {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+
+	jobType := job.JobTypeLocal
+	if req.GetImage() != "" {
+		jobType = job.JobTypeOCI
+	}
+
+	opts := job.Options{
+		Image:   req.GetImage(),
+		Rlimits: mapRlimits(req.GetRlimits()),
+		SHA256:  sha256,
+		Limits: resources.Limits{
+			MemoryHigh: req.GetMemoryHigh(),
+			SwapMax:    req.MemorySwapMax,
+			OOMGroup:   req.MemoryOomGroup,
+			PidsMax:    req.GetPidsMax(),
+			Cpuset: resources.Cpuset{
+				CPUs: req.GetCpus(),
+				Mems: req.GetMems(),
+			},
+		},
+		Exclusive: int(req.GetExclusiveCpus()),
+	}
+	jobID, err := s.worker.StartJobFor(jobType, req.GetCommand(), req.GetArgs(), owner, id, opts)
+	if err != nil {
+		if errors.Is(err, job.ErrRlimitExceedsCeiling) || errors.Is(err, resources.ErrLimitTooHigh) || errors.Is(err, resources.ErrInvalidCpuset) || errors.Is(err, image.ErrInvalidName) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if errors.Is(err, worker.ErrNoExclusiveCPUs) || errors.Is(err, worker.ErrNoImageDir) {
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		if errors.Is(err, resources.ErrNoFreeCPUs) || errors.Is(err, worker.ErrQuotaExceeded) {
+			return nil, status.Error(codes.ResourceExhausted, err.Error())
+		}
 		return nil, status.Errorf(codes.Internal, "failed to start job: %v", err)
 	}
 
@@ -86,7 +167,9 @@ func (s *Server) StartJob(ctx context.Context, req *pb.StartJobRequest) (*pb.Sta
 		"jobID", jobID,
 		"command", req.GetCommand(),
 		"args", req.GetArgs(),
+		"image", req.GetImage(),
 		"user", id.Username,
+		"owner", owner.Username,
 	)
 
 	return &pb.StartJobResponse{
@@ -96,7 +179,7 @@ func (s *Server) StartJob(ctx context.Context, req *pb.StartJobRequest) (*pb.Sta
 
 // GetJobStatus returns the current status and exit code for a job.
 func (s *Server) GetJobStatus(ctx context.Context, req *pb.GetJobStatusRequest) (*pb.GetJobStatusResponse, error) {
-	if _, err := s.authorize(ctx, req.GetJobId()); err != nil {
+	if _, err := s.authorize(ctx, pb.TeleWorker_GetJobStatus_FullMethodName, req.GetJobId()); err != nil {
 		return nil, err
 	}
 
@@ -108,9 +191,25 @@ func (s *Server) GetJobStatus(ctx context.Context, req *pb.GetJobStatusRequest)
 		return nil, status.Errorf(codes.Internal, "failed to get job status: %v", err)
 	}
 
+	// The job may have been forgotten since, to keep its owner within their
+	// quota.
+	owner, startedBy, err := s.worker.GetJobStartedBy(req.GetJobId())
+	if err != nil {
+		return nil, status.Error(codes.NotFound, "job not found")
+	}
+
 	resp := &pb.GetJobStatusResponse{
-		JobId:  req.GetJobId(),
-		Status: mapJobStatus(result.Status),
+		JobId:             req.GetJobId(),
+		Owner:             owner.Username,
+		Status:            mapJobStatus(result.Status),
+		PidsMaxHits:       result.PidsMaxHits,
+		TerminationReason: mapTerminationReason(result.Reason),
+		Usage:             mapUsage(result.Usage),
+		Cpus:              result.Cpuset.CPUs,
+		Mems:              result.Cpuset.Mems,
+	}
+	if startedBy.Username != owner.Username {
+		resp.StartedBy = startedBy.Username
 	}
 
 	if result.ExitCode != nil {
@@ -121,9 +220,104 @@ func (s *Server) GetJobStatus(ctx context.Context, req *pb.GetJobStatusRequest)
 	return resp, nil
 }
 
+// ShareJob grants a user or group permissions on a job.
+func (s *Server) ShareJob(ctx context.Context, req *pb.ShareJobRequest) (*pb.ShareJobResponse, error) {
+	id, err := s.authorize(ctx, pb.TeleWorker_ShareJob_FullMethodName, req.GetJobId())
+	if err != nil {
+		return nil, err
+	}
+	grantee, err := mapGrantee(req.GetUser(), req.GetGroup())
+	if err != nil {
+		return nil, err
+	}
+	perms, err := mapPermissions(req.GetPermissions())
+	if err != nil {
+		return nil, err
+	}
+	if len(perms) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "no permissions to grant")
+	}
+
+	acl, err := s.worker.ShareJob(req.GetJobId(), grantee, perms)
+	if err != nil {
+		if errors.Is(err, worker.ErrJobNotFound) {
+			return nil, status.Error(codes.NotFound, "job not found")
+		}
+		return nil, status.Errorf(codes.Internal, "failed to share job: %v", err)
+	}
+
+	slog.Info(
+		"shared job",
+		"jobID", req.GetJobId(),
+		"grantee", grantee,
+		"permissions", perms,
+		"user", id.Username,
+	)
+	return &pb.ShareJobResponse{Grants: mapACL(acl)}, nil
+}
+
+// UnshareJob revokes a user's or group's permissions on a job.
+func (s *Server) UnshareJob(ctx context.Context, req *pb.UnshareJobRequest) (*pb.UnshareJobResponse, error) {
+	id, err := s.authorize(ctx, pb.TeleWorker_UnshareJob_FullMethodName, req.GetJobId())
+	if err != nil {
+		return nil, err
+	}
+	grantee, err := mapGrantee(req.GetUser(), req.GetGroup())
+	if err != nil {
+		return nil, err
+	}
+	perms, err := mapPermissions(req.GetPermissions())
+	if err != nil {
+		return nil, err
+	}
+
+	acl, err := s.worker.UnshareJob(req.GetJobId(), grantee, perms)
+	if err != nil {
+		if errors.Is(err, worker.ErrJobNotFound) {
+			return nil, status.Error(codes.NotFound, "job not found")
+		}
+		return nil, status.Errorf(codes.Internal, "failed to unshare job: %v", err)
+	}
+
+	slog.Info(
+		"unshared job",
+		"jobID", req.GetJobId(),
+		"grantee", grantee,
+		"permissions", perms,
+		"user", id.Username,
+	)
+	return &pb.UnshareJobResponse{Grants: mapACL(acl)}, nil
+}
+
+// GetQuota returns the caller's quota and how much of it they use.
+func (s *Server) GetQuota(ctx context.Context, req *pb.GetQuotaRequest) (*pb.GetQuotaResponse, error) {
+	id, err := s.authorize(ctx, pb.TeleWorker_GetQuota_FullMethodName, "")
+	if err != nil {
+		return nil, err
+	}
+
+	quota, usage := s.worker.GetQuota(id)
+	return &pb.GetQuotaResponse{
+		Limits: &pb.Quota{
+			Jobs:         int32(quota.Jobs),
+			Cpus:         quota.CPUs,
+			MemoryBytes:  quota.Memory,
+			RetainedJobs: int32(quota.RetainedJobs),
+			LogBytes:     quota.LogBytes,
+		},
+		Usage: &pb.Quota{
+			Jobs:         int32(usage.Jobs),
+			Cpus:         usage.CPUs,
+			MemoryBytes:  usage.Memory,
+			RetainedJobs: int32(usage.RetainedJobs),
+			LogBytes:     usage.LogBytes,
+		},
+	}, nil
+}
+
 // StopJob terminates a running job.
 func (s *Server) StopJob(ctx context.Context, req *pb.StopJobRequest) (*pb.StopJobResponse, error) {
-	if _, err := s.authorize(ctx, req.GetJobId()); err != nil {
+	if _, err := s.authorize(ctx, pb.TeleWorker_StopJob_FullMethodName, req.GetJobId()); err != nil {
 		return nil, err
 	}
 
@@ -143,7 +337,7 @@ func (s *Server) StopJob(ctx context.Context, req *pb.StopJobRequest) (*pb.StopJ
 
 // StreamOutput streams the combined stdout/stderr of a job to the client.
 func (s *Server) StreamOutput(req *pb.StreamOutputRequest, stream grpc.ServerStreamingServer[pb.StreamOutputResponse]) error {
-	if _, err := s.authorize(stream.Context(), req.GetJobId()); err != nil {
+	if _, err := s.authorize(stream.Context(), pb.TeleWorker_StreamOutput_FullMethodName, req.GetJobId()); err != nil {
 		return err
 	}
 
@@ -184,6 +378,284 @@ func (s *Server) StreamOutput(req *pb.StreamOutputRequest, stream grpc.ServerStr
 	}
 }
 
+// Bounds for the sampling interval of WatchJobStats. Reading a cgroup's stats
+// is cheap, but sampling too often would let one client keep the server busy.
+const (
+	defaultStatsInterval = time.Second
+	minStatsInterval     = 100 * time.Millisecond
+)
+
+// GetJobStats returns the current resource usage of a running job.
+func (s *Server) GetJobStats(ctx context.Context, req *pb.GetJobStatsRequest) (*pb.GetJobStatsResponse, error) {
+	if _, err := s.authorize(ctx, pb.TeleWorker_GetJobStats_FullMethodName, req.GetJobId()); err != nil {
+		return nil, err
+	}
+
+	stats, err := s.getJobStats(req.GetJobId())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.GetJobStatsResponse{JobId: req.GetJobId(), Stats: stats}, nil
+}
+
+// WatchJobStats samples the resource usage of a job at the requested interval
+// until the job exits or the client disconnects.
+func (s *Server) WatchJobStats(req *pb.WatchJobStatsRequest, stream grpc.ServerStreamingServer[pb.GetJobStatsResponse]) error {
+	if _, err := s.authorize(stream.Context(), pb.TeleWorker_WatchJobStats_FullMethodName, req.GetJobId()); err != nil {
+		return err
+	}
+
+	interval := time.Duration(req.GetIntervalMs()) * time.Millisecond
+	if interval == 0 {
+		interval = defaultStatsInterval
+	}
+	interval = max(interval, minStatsInterval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		stats, err := s.getJobStats(req.GetJobId())
+		if status.Code(err) == codes.FailedPrecondition {
+			// The job has exited, so there is nothing more to watch.
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(&pb.GetJobStatsResponse{JobId: req.GetJobId(), Stats: stats}); err != nil {
+			return err
+		}
+
+		select {
+		case <-stream.Context().Done():
+			return status.Error(codes.Canceled, "client disconnected")
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) getJobStats(jobID string) (*pb.JobStats, error) {
+	stats, err := s.worker.GetJobStats(jobID)
+	if err != nil {
+		if errors.Is(err, worker.ErrJobNotFound) {
+			return nil, status.Error(codes.NotFound, "job not found")
+		}
+		if errors.Is(err, job.ErrJobNotRunning) {
+			return nil, status.Error(codes.FailedPrecondition, "job is not running")
+		}
+		if errors.Is(err, job.ErrNoCgroup) {
+			return nil, status.Error(codes.Unavailable, "job is running without cgroups")
+		}
+		return nil, status.Errorf(codes.Internal, "failed to get job stats: %v", err)
+	}
+	return mapStats(stats), nil
+}
+
+func mapStats(s *resources.Stats) *pb.JobStats {
+	out := &pb.JobStats{
+		Cpu: &pb.CpuStats{
+			UsageUsec:     s.CPU.UsageUsec,
+			UserUsec:      s.CPU.UserUsec,
+			SystemUsec:    s.CPU.SystemUsec,
+			NrPeriods:     s.CPU.NrPeriods,
+			NrThrottled:   s.CPU.NrThrottled,
+			ThrottledUsec: s.CPU.ThrottledUsec,
+		},
+		Memory: &pb.MemoryStats{
+			Current: s.Memory.Current,
+			Peak:    s.Memory.Peak,
+			Stat:    s.Memory.Stat,
+		},
+		PidsCurrent: s.PidsCurrent,
+	}
+	for _, dev := range s.IO {
+		out.Io = append(out.Io, &pb.IoStats{
+			Major:  dev.Major,
+			Minor:  dev.Minor,
+			Rbytes: dev.RBytes,
+			Wbytes: dev.WBytes,
+			Rios:   dev.RIOs,
+			Wios:   dev.WIOs,
+			Dbytes: dev.DBytes,
+			Dios:   dev.DIOs,
+		})
+	}
+	if p := s.Pressure; p != nil {
+		out.Pressure = &pb.Pressure{
+			Cpu:    mapPressureStats(p.CPU),
+			Memory: mapPressureStats(p.Memory),
+			Io:     mapPressureStats(p.IO),
+		}
+	}
+	return out
+}
+
+func mapPressureStats(p resources.PressureStats) *pb.PressureStats {
+	line := func(l resources.PressureLine) *pb.PressureLine {
+		return &pb.PressureLine{
+			Avg10:     l.Avg10,
+			Avg60:     l.Avg60,
+			Avg300:    l.Avg300,
+			TotalUsec: l.Total,
+		}
+	}
+	return &pb.PressureStats{Some: line(p.Some), Full: line(p.Full)}
+}
+
+// mapRlimits converts the resource limits in a request to job.Rlimits. Unset
+// limits stay nil.
+func mapRlimits(r *pb.Rlimits) job.Rlimits {
+	if r == nil {
+		return job.Rlimits{}
+	}
+	return job.Rlimits{
+		NoFile: r.Nofile,
+		Core:   r.Core,
+		FSize:  r.Fsize,
+		Stack:  r.Stack,
+		NProc:  r.Nproc,
+	}
+}
+
+func mapUsage(u *resources.Usage) *pb.JobUsage {
+	if u == nil {
+		return nil
+	}
+	return &pb.JobUsage{
+		CpuUsec:       u.CPUUsec,
+		UserUsec:      u.UserUsec,
+		SystemUsec:    u.SystemUsec,
+		MemoryPeak:    u.MemoryPeak,
+		ReadBytes:     u.ReadBytes,
+		WriteBytes:    u.WriteBytes,
+		PidsPeak:      u.PidsPeak,
+		NrThrottled:   u.NrThrottled,
+		ThrottledUsec: u.ThrottledUsec,
+	}
+}
+
+func mapTerminationReason(r job.TerminationReason) pb.TerminationReason {
+	switch r {
+	case job.TerminationExited:
+		return pb.TerminationReason_TERMINATION_REASON_EXITED
+	case job.TerminationSignaled:
+		return pb.TerminationReason_TERMINATION_REASON_SIGNALED
+	case job.TerminationOOMKilled:
+		return pb.TerminationReason_TERMINATION_REASON_OOM_KILLED
+	case job.TerminationTimedOut:
+		return pb.TerminationReason_TERMINATION_REASON_TIMED_OUT
+	case job.TerminationStoppedByUser:
+		return pb.TerminationReason_TERMINATION_REASON_STOPPED_BY_USER
+	default:
+		return pb.TerminationReason_TERMINATION_REASON_UNSPECIFIED
+	}
+}
+
+const (
+	defaultAuditLimit = 100  // Records QueryAudit returns if the request sets no limit.
+	maxAuditLimit     = 1000 // Most records QueryAudit returns.
+)
+
+// QueryAudit returns the newest records of the audit log that match the
+// request. The log covers every job, so the caller must be allowed to audit
+// any job.
+func (s *Server) QueryAudit(ctx context.Context, req *pb.QueryAuditRequest) (*pb.QueryAuditResponse, error) {
+	id, err := s.authorize(ctx, pb.TeleWorker_QueryAudit_FullMethodName, "")
+	if err != nil {
+		return nil, err
+	}
+	if scope, _ := s.policy.Allows(id, pb.TeleWorker_QueryAudit_FullMethodName); scope != auth.ScopeAny {
+		return nil, status.Errorf(codes.PermissionDenied, "%s (role %q) may not query the audit log", id.Username, id.Role)
+	}
+	if s.audit == nil {
+		return nil, status.Error(codes.FailedPrecondition, "audit log is not enabled")
+	}
+
+	filter := audit.Filter{
+		User:  req.GetUser(),
+		RPC:   req.GetRpc(),
+		JobID: req.GetJobId(),
+		Limit: min(int(req.GetLimit()), maxAuditLimit),
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultAuditLimit
+	}
+	if req.GetSince() != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, req.GetSince()); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid since: %v", err)
+		}
+	}
+
+	records, err := s.audit.Query(filter)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to query audit log: %v", err)
+	}
+	resp := &pb.QueryAuditResponse{}
+	for _, r := range records {
+		resp.Records = append(resp.Records, &pb.AuditRecord{
+			Time:       r.Time.Format(time.RFC3339Nano),
+			User:       r.User,
+			Role:       r.Role,
+			Rpc:        r.RPC,
+			JobId:      r.JobID,
+			Request:    r.Request,
+			Code:       r.Code,
+			Error:      r.Error,
+			LatencyMs:  r.LatencyMS,
+			PrevHash:   r.PrevHash,
+			Hash:       r.Hash,
+			OnBehalfOf: r.OnBehalfOf,
+		})
+	}
+	return resp, nil
+}
+
+func mapGrantee(user, group string) (auth.Grantee, error) {
+	if (user == "") == (group == "") {
+		return auth.Grantee{}, status.Error(codes.InvalidArgument, "exactly one of user and group must be set")
+	}
+	return auth.Grantee{User: user, Group: group}, nil
+}
+
+var permissions = map[pb.Permission]auth.Permission{
+	pb.Permission_PERMISSION_VIEW: auth.PermissionView,
+	pb.Permission_PERMISSION_LOGS: auth.PermissionLogs,
+	pb.Permission_PERMISSION_STOP: auth.PermissionStop,
+}
+
+func mapPermissions(in []pb.Permission) ([]auth.Permission, error) {
+	out := make([]auth.Permission, 0, len(in))
+	for _, p := range in {
+		perm, ok := permissions[p]
+		if !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "unknown permission %v", p)
+		}
+		out = append(out, perm)
+	}
+	return out, nil
+}
+
+// mapACL returns the grants of an ACL, sorted by grantee.
+func mapACL(acl auth.ACL) []*pb.JobGrant {
+	grantees := slices.SortedFunc(maps.Keys(acl), func(a, b auth.Grantee) int {
+		return strings.Compare(a.String(), b.String())
+	})
+	grants := make([]*pb.JobGrant, 0, len(grantees))
+	for _, g := range grantees {
+		grant := &pb.JobGrant{User: g.User, Group: g.Group}
+		for _, perm := range acl[g] {
+			for p, ap := range permissions {
+				if ap == perm {
+					grant.Permissions = append(grant.Permissions, p)
+				}
+			}
+		}
+		slices.Sort(grant.Permissions)
+		grants = append(grants, grant)
+	}
+	return grants
+}
+
 func mapJobStatus(s job.Status) pb.JobStatus {
 	switch s {
 	case job.StatusSubmitted:
@@ -1,21 +1,29 @@
 package server_test
 
 import (
+	"context"
 	"io"
 	"net"
+	"path/filepath"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"go.uber.org/goleak"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 
+	"github.com/kkloberdanz/teleworker/audit"
 	"github.com/kkloberdanz/teleworker/auth"
+	"github.com/kkloberdanz/teleworker/job"
 	pb "github.com/kkloberdanz/teleworker/proto/teleworker/v1"
+	"github.com/kkloberdanz/teleworker/ratelimit"
+	"github.com/kkloberdanz/teleworker/resources/fake"
 	"github.com/kkloberdanz/teleworker/server"
 	"github.com/kkloberdanz/teleworker/testutil"
 	"github.com/kkloberdanz/teleworker/worker"
@@ -23,6 +31,9 @@ import (
 
 // Enable goleak to ensure no goroutines have been leaked.
 func TestMain(m *testing.M) {
+	// Jobs on a backend without cgroup fds, such as the fake, are started
+	// through the job init process.
+	job.Init()
 	goleak.VerifyTestMain(m)
 }
 
@@ -34,20 +45,49 @@ type testEnv struct {
 // newTestEnv starts a gRPC server with mTLS and returns the test environment.
 func newTestEnv(t *testing.T) *testEnv {
 	t.Helper()
+	return newTestEnvWithOptions(t, server.Options{})
+}
+
+// newTestEnvWithOptions is like newTestEnv, but configures the server with
+// opts. The worker uses a fake cgroup backend, so the server runs without
+// root, but tests that start jobs need it for their PID namespace.
+func newTestEnvWithOptions(t *testing.T, opts server.Options) *testEnv {
+	t.Helper()
 
 	listen, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
 		t.Fatalf("failed to listen: %v", err)
 	}
 
-	mgr := testutil.RequireManager(t)
-	w := worker.New(worker.Options{CgroupMgr: mgr})
-	srv := server.New(w)
-
+	// Like teleworker does, take quotas from the policy.
+	workerOpts := worker.Options{CgroupMgr: fake.NewBackend()}
+	if opts.Policy != nil {
+		workerOpts.Quotas = opts.Policy.Quota
+	}
+	w := worker.New(workerOpts)
+	srv := server.New(w, opts)
+
+	// Like teleworker does, audit and then rate limit RPCs after the auth
+	// interceptors.
+	var onReject auth.RejectFunc
+	if opts.Audit != nil {
+		onReject = opts.Audit.Reject
+	}
+	unary := []grpc.UnaryServerInterceptor{auth.NewUnaryInterceptor(auth.SubjectMapper{}, onReject)}
+	stream := []grpc.StreamServerInterceptor{auth.NewStreamInterceptor(auth.SubjectMapper{}, onReject)}
+	if opts.Audit != nil {
+		unary = append(unary, audit.NewUnaryInterceptor(opts.Audit))
+		stream = append(stream, audit.NewStreamInterceptor(opts.Audit))
+	}
+	if opts.Policy != nil {
+		limiter := ratelimit.New(opts.Policy.RateLimit)
+		unary = append(unary, ratelimit.NewUnaryInterceptor(limiter))
+		stream = append(stream, ratelimit.NewStreamInterceptor(limiter))
+	}
 	grpcServer := grpc.NewServer(
 		grpc.Creds(credentials.NewTLS(testutil.ServerTLSConfig(t))),
-		grpc.UnaryInterceptor(auth.UnaryInterceptor),
-		grpc.StreamInterceptor(auth.StreamInterceptor),
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
 	)
 	pb.RegisterTeleWorkerServer(grpcServer, srv)
 
@@ -78,6 +118,7 @@ func (e *testEnv) clientAs(t *testing.T, name string) pb.TeleWorkerClient {
 }
 
 func TestStartJobReturnsValidUUID(t *testing.T) {
+	testutil.RequireRoot(t)
 	env := newTestEnv(t)
 	client := env.clientAs(t, "alice")
 
@@ -106,7 +147,18 @@ func TestStartJobEmptyCommand(t *testing.T) {
 	}
 }
 
+func TestStartJobImageNotConfigured(t *testing.T) {
+	env := newTestEnv(t)
+	client := env.clientAs(t, "alice")
+
+	_, err := client.StartJob(t.Context(), &pb.StartJobRequest{Image: "alpine.tar"})
+	if s, ok := status.FromError(err); !ok || s.Code() != codes.FailedPrecondition {
+		t.Fatalf("expected FailedPrecondition, got %v", err)
+	}
+}
+
 func TestGetJobStatus(t *testing.T) {
+	testutil.RequireRoot(t)
 	env := newTestEnv(t)
 	client := env.clientAs(t, "alice")
 
@@ -150,6 +202,7 @@ func TestGetJobStatusNotFound(t *testing.T) {
 }
 
 func TestStopJob(t *testing.T) {
+	testutil.RequireRoot(t)
 	env := newTestEnv(t)
 	client := env.clientAs(t, "alice")
 
@@ -198,6 +251,7 @@ func TestStopJobNotFound(t *testing.T) {
 }
 
 func TestStopFinishedJob(t *testing.T) {
+	testutil.RequireRoot(t)
 	env := newTestEnv(t)
 	client := env.clientAs(t, "alice")
 
@@ -246,6 +300,7 @@ func recvAll(t *testing.T, stream grpc.ServerStreamingClient[pb.StreamOutputResp
 }
 
 func TestStreamOutput(t *testing.T) {
+	testutil.RequireRoot(t)
 	env := newTestEnv(t)
 	client := env.clientAs(t, "alice")
 
@@ -291,6 +346,7 @@ func TestStreamOutputJobNotFound(t *testing.T) {
 }
 
 func TestStreamOutputMultipleClients(t *testing.T) {
+	testutil.RequireRoot(t)
 	env := newTestEnv(t)
 	client := env.clientAs(t, "alice")
 
@@ -337,6 +393,7 @@ func TestStreamOutputMultipleClients(t *testing.T) {
 }
 
 func TestOwnerCanAccessOwnJob(t *testing.T) {
+	testutil.RequireRoot(t)
 	env := newTestEnv(t)
 	alice := env.clientAs(t, "alice")
 
@@ -358,6 +415,7 @@ func TestOwnerCanAccessOwnJob(t *testing.T) {
 }
 
 func TestNonOwnerCannotGetStatus(t *testing.T) {
+	testutil.RequireRoot(t)
 	env := newTestEnv(t)
 	alice := env.clientAs(t, "alice")
 	bob := env.clientAs(t, "bob")
@@ -384,6 +442,7 @@ func TestNonOwnerCannotGetStatus(t *testing.T) {
 }
 
 func TestNonOwnerCannotStopJob(t *testing.T) {
+	testutil.RequireRoot(t)
 	env := newTestEnv(t)
 	alice := env.clientAs(t, "alice")
 	bob := env.clientAs(t, "bob")
@@ -410,6 +469,7 @@ func TestNonOwnerCannotStopJob(t *testing.T) {
 }
 
 func TestNonOwnerCannotStreamOutput(t *testing.T) {
+	testutil.RequireRoot(t)
 	env := newTestEnv(t)
 	alice := env.clientAs(t, "alice")
 	bob := env.clientAs(t, "bob")
@@ -441,6 +501,7 @@ func TestNonOwnerCannotStreamOutput(t *testing.T) {
 }
 
 func TestAdminCanAccessAnyJob(t *testing.T) {
+	testutil.RequireRoot(t)
 	env := newTestEnv(t)
 	alice := env.clientAs(t, "alice")
 	admin := env.clientAs(t, "admin")
@@ -469,3 +530,628 @@ func TestAdminCanAccessAnyJob(t *testing.T) {
 		t.Fatalf("admin StopJob failed: %v", err)
 	}
 }
+
+func TestGetJobStats(t *testing.T) {
+	testutil.RequireRoot(t)
+	env := newTestEnv(t)
+	client := env.clientAs(t, "alice")
+
+	resp, err := client.StartJob(t.Context(), &pb.StartJobRequest{
+		Command: "sleep",
+		Args:    []string{"60"},
+	})
+	if err != nil {
+		t.Fatalf("StartJob failed: %v", err)
+	}
+	t.Cleanup(func() {
+		client.StopJob(context.Background(), &pb.StopJobRequest{JobId: resp.GetJobId()})
+	})
+
+	statsResp, err := client.GetJobStats(t.Context(), &pb.GetJobStatsRequest{JobId: resp.GetJobId()})
+	if err != nil {
+		t.Fatalf("GetJobStats failed: %v", err)
+	}
+	stats := statsResp.GetStats()
+	if stats.GetPidsCurrent() == 0 {
+		t.Fatalf("expected at least one process in the job, got %d", stats.GetPidsCurrent())
+	}
+	if stats.GetMemory().GetCurrent() == 0 {
+		t.Fatal("expected non-zero memory usage")
+	}
+}
+
+func TestGetJobStatsFinishedJob(t *testing.T) {
+	testutil.RequireRoot(t)
+	env := newTestEnv(t)
+	client := env.clientAs(t, "alice")
+
+	resp, err := client.StartJob(t.Context(), &pb.StartJobRequest{
+		Command: "true",
+	})
+	if err != nil {
+		t.Fatalf("StartJob failed: %v", err)
+	}
+	testutil.PollUntil(t, "job to finish", func() bool {
+		statusResp, err := client.GetJobStatus(t.Context(), &pb.GetJobStatusRequest{JobId: resp.GetJobId()})
+		if err != nil {
+			t.Fatalf("GetJobStatus failed: %v", err)
+		}
+		return statusResp.GetStatus() != pb.JobStatus_JOB_STATUS_RUNNING
+	})
+
+	_, err = client.GetJobStats(t.Context(), &pb.GetJobStatsRequest{JobId: resp.GetJobId()})
+	if s, ok := status.FromError(err); !ok || s.Code() != codes.FailedPrecondition {
+		t.Fatalf("expected FailedPrecondition, got %v", err)
+	}
+}
+
+func TestWatchJobStatsEndsWhenJobExits(t *testing.T) {
+	testutil.RequireRoot(t)
+	env := newTestEnv(t)
+	client := env.clientAs(t, "alice")
+
+	resp, err := client.StartJob(t.Context(), &pb.StartJobRequest{
+		Command: "sleep",
+		Args:    []string{"1"},
+	})
+	if err != nil {
+		t.Fatalf("StartJob failed: %v", err)
+	}
+
+	stream, err := client.WatchJobStats(t.Context(), &pb.WatchJobStatsRequest{
+		JobId:      resp.GetJobId(),
+		IntervalMs: 100,
+	})
+	if err != nil {
+		t.Fatalf("WatchJobStats failed: %v", err)
+	}
+	samples := 0
+	for {
+		_, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Recv failed: %v", err)
+		}
+		samples++
+	}
+	if samples < 2 {
+		t.Fatalf("expected several samples over the life of the job, got %d", samples)
+	}
+}
+
+func TestNonOwnerCannotGetStats(t *testing.T) {
+	testutil.RequireRoot(t)
+	env := newTestEnv(t)
+	alice := env.clientAs(t, "alice")
+	bob := env.clientAs(t, "bob")
+
+	resp, err := alice.StartJob(t.Context(), &pb.StartJobRequest{
+		Command: "sleep",
+		Args:    []string{"60"},
+	})
+	if err != nil {
+		t.Fatalf("StartJob failed: %v", err)
+	}
+	t.Cleanup(func() {
+		alice.StopJob(context.Background(), &pb.StopJobRequest{JobId: resp.GetJobId()})
+	})
+
+	_, err = bob.GetJobStats(t.Context(), &pb.GetJobStatsRequest{JobId: resp.GetJobId()})
+	if s, ok := status.FromError(err); !ok || s.Code() != codes.NotFound {
+		t.Fatalf("expected NotFound, got %v", err)
+	}
+}
+
+func TestAuditorCanReadAnyJob(t *testing.T) {
+	testutil.RequireRoot(t)
+	env := newTestEnv(t)
+	alice := env.clientAs(t, "alice")
+	carol := env.clientAs(t, "carol")
+
+	resp, err := alice.StartJob(t.Context(), &pb.StartJobRequest{
+		Command: "sleep",
+		Args:    []string{"60"},
+	})
+	if err != nil {
+		t.Fatalf("StartJob failed: %v", err)
+	}
+	t.Cleanup(func() {
+		alice.StopJob(context.Background(), &pb.StopJobRequest{JobId: resp.GetJobId()})
+	})
+
+	if _, err := carol.GetJobStatus(t.Context(), &pb.GetJobStatusRequest{JobId: resp.GetJobId()}); err != nil {
+		t.Fatalf("GetJobStatus failed: %v", err)
+	}
+
+	// Auditors are read only.
+	_, err = carol.StopJob(t.Context(), &pb.StopJobRequest{JobId: resp.GetJobId()})
+	if s, ok := status.FromError(err); !ok || s.Code() != codes.PermissionDenied {
+		t.Fatalf("expected PermissionDenied, got %v", err)
+	}
+	_, err = carol.StartJob(t.Context(), &pb.StartJobRequest{Command: "true"})
+	if s, ok := status.FromError(err); !ok || s.Code() != codes.PermissionDenied {
+		t.Fatalf("expected PermissionDenied, got %v", err)
+	}
+}
+
+func TestPolicyUserRule(t *testing.T) {
+	testutil.RequireRoot(t)
+	policy, err := auth.ParsePolicy([]byte(`
+roles:
+  client:
+    - verbs: ["*"]
+users:
+  bob:
+    - verbs: [status]
+      jobs: any
+`))
+	if err != nil {
+		t.Fatalf("ParsePolicy failed: %v", err)
+	}
+	env := newTestEnvWithOptions(t, server.Options{Policy: policy})
+	alice := env.clientAs(t, "alice")
+	bob := env.clientAs(t, "bob")
+
+	resp, err := alice.StartJob(t.Context(), &pb.StartJobRequest{
+		Command: "sleep",
+		Args:    []string{"60"},
+	})
+	if err != nil {
+		t.Fatalf("StartJob failed: %v", err)
+	}
+	t.Cleanup(func() {
+		alice.StopJob(context.Background(), &pb.StopJobRequest{JobId: resp.GetJobId()})
+	})
+
+	if _, err := bob.GetJobStatus(t.Context(), &pb.GetJobStatusRequest{JobId: resp.GetJobId()}); err != nil {
+		t.Fatalf("GetJobStatus failed: %v", err)
+	}
+	// Other verbs are still limited to bob's own jobs.
+	_, err = bob.StopJob(t.Context(), &pb.StopJobRequest{JobId: resp.GetJobId()})
+	if s, ok := status.FromError(err); !ok || s.Code() != codes.NotFound {
+		t.Fatalf("expected NotFound, got %v", err)
+	}
+
+	// Admins have no rules in this policy, so may do nothing.
+	admin := env.clientAs(t, "admin")
+	_, err = admin.GetJobStatus(t.Context(), &pb.GetJobStatusRequest{JobId: resp.GetJobId()})
+	if s, ok := status.FromError(err); !ok || s.Code() != codes.PermissionDenied {
+		t.Fatalf("expected PermissionDenied, got %v", err)
+	}
+}
+
+func TestCommandPolicy(t *testing.T) {
+	testutil.RequireRoot(t)
+	policy, err := auth.ParsePolicy([]byte(`
+roles:
+  client:
+    - verbs: ["*"]
+commands:
+  roles:
+    client:
+      - path: /usr/bin/sleep
+        args: ["6?"]
+`))
+	if err != nil {
+		t.Fatalf("ParsePolicy failed: %v", err)
+	}
+	env := newTestEnvWithOptions(t, server.Options{Policy: policy})
+	alice := env.clientAs(t, "alice")
+
+	// sleep is looked up in PATH, like exec.Command would.
+	resp, err := alice.StartJob(t.Context(), &pb.StartJobRequest{
+		Command: "sleep",
+		Args:    []string{"60"},
+	})
+	if err != nil {
+		t.Fatalf("StartJob failed: %v", err)
+	}
+	t.Cleanup(func() {
+		alice.StopJob(context.Background(), &pb.StopJobRequest{JobId: resp.GetJobId()})
+	})
+
+	for _, req := range []*pb.StartJobRequest{
+		{Command: "sleep", Args: []string{"infinity"}},
+		{Command: "sh", Args: []string{"-c", "sleep 60"}},
+	} {
+		_, err := alice.StartJob(t.Context(), req)
+		if s, ok := status.FromError(err); !ok || s.Code() != codes.PermissionDenied {
+			t.Fatalf("expected PermissionDenied for %s %v, got %v", req.GetCommand(), req.GetArgs(), err)
+		}
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	testutil.RequireRoot(t)
+	policy, err := auth.ParsePolicy([]byte(`
+roles:
+  client:
+    - verbs: ["*"]
+rate_limits:
+  roles:
+    client:
+      status: {rate: 0.001, burst: 2}
+`))
+	if err != nil {
+		t.Fatalf("ParsePolicy failed: %v", err)
+	}
+	l, err := audit.Open(filepath.Join(t.TempDir(), "audit.log"), audit.Options{})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	env := newTestEnvWithOptions(t, server.Options{Policy: policy, Audit: l})
+	alice := env.clientAs(t, "alice")
+
+	for range 2 {
+		if _, err := alice.GetQuota(t.Context(), &pb.GetQuotaRequest{}); err != nil {
+			t.Fatalf("GetQuota failed: %v", err)
+		}
+	}
+	var trailer metadata.MD
+	_, err = alice.GetJobStatus(t.Context(), &pb.GetJobStatusRequest{JobId: uuid.NewString()}, grpc.Trailer(&trailer))
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("expected ResourceExhausted, got %v", err)
+	}
+	retryAfter := trailer.Get(ratelimit.RetryAfterKey)
+	if len(retryAfter) != 1 || retryAfter[0] == "0" {
+		t.Fatalf("expected a retry-after trailer, got %v", trailer)
+	}
+	// Calls that are rate limited are audited.
+	records, err := l.Query(audit.Filter{RPC: "GetJobStatus"})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(records) != 1 || records[0].User != "alice" || records[0].Code != codes.ResourceExhausted.String() {
+		t.Fatalf("expected a record of the rate limited call, got %+v", records)
+	}
+
+	// Each class of RPC, and each user, has its own bucket.
+	if _, err := alice.StartJob(t.Context(), &pb.StartJobRequest{Command: "true"}); err != nil {
+		t.Fatalf("StartJob failed: %v", err)
+	}
+	if _, err := env.clientAs(t, "bob").GetQuota(t.Context(), &pb.GetQuotaRequest{}); err != nil {
+		t.Fatalf("GetQuota failed: %v", err)
+	}
+}
+
+func TestStreamOutputLimit(t *testing.T) {
+	testutil.RequireRoot(t)
+	policy, err := auth.ParsePolicy([]byte(`
+roles:
+  client:
+    - verbs: ["*"]
+rate_limits:
+  roles:
+    client:
+      streams: 1
+`))
+	if err != nil {
+		t.Fatalf("ParsePolicy failed: %v", err)
+	}
+	env := newTestEnvWithOptions(t, server.Options{Policy: policy})
+	alice := env.clientAs(t, "alice")
+
+	resp, err := alice.StartJob(t.Context(), &pb.StartJobRequest{
+		Command: "sh",
+		Args:    []string{"-c", "echo hello; sleep 60"},
+	})
+	if err != nil {
+		t.Fatalf("StartJob failed: %v", err)
+	}
+	t.Cleanup(func() {
+		alice.StopJob(context.Background(), &pb.StopJobRequest{JobId: resp.GetJobId()})
+	})
+
+	ctx, cancel := context.WithCancel(t.Context())
+	first, err := alice.StreamOutput(ctx, &pb.StreamOutputRequest{JobId: resp.GetJobId()})
+	if err != nil {
+		t.Fatalf("StreamOutput failed: %v", err)
+	}
+	// Once output arrives, the stream is open.
+	if _, err := first.Recv(); err != nil {
+		t.Fatalf("Recv failed: %v", err)
+	}
+
+	second, err := alice.StreamOutput(t.Context(), &pb.StreamOutputRequest{JobId: resp.GetJobId()})
+	if err != nil {
+		t.Fatalf("StreamOutput failed: %v", err)
+	}
+	if _, err := second.Recv(); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("expected ResourceExhausted, got %v", err)
+	}
+
+	// Closing the first stream makes room for another. The server notices
+	// the cancellation asynchronously.
+	cancel()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		third, err := alice.StreamOutput(t.Context(), &pb.StreamOutputRequest{JobId: resp.GetJobId()})
+		if err != nil {
+			t.Fatalf("StreamOutput failed: %v", err)
+		}
+		_, err = third.Recv()
+		if err == nil {
+			break
+		}
+		if status.Code(err) != codes.ResourceExhausted || time.Now().After(deadline) {
+			t.Fatalf("expected the stream to open once the first closed, got %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestQuota(t *testing.T) {
+	testutil.RequireRoot(t)
+	policy, err := auth.ParsePolicy([]byte(`
+roles:
+  client:
+    - verbs: ["*"]
+quotas:
+  users:
+    alice:
+      jobs: 1
+`))
+	if err != nil {
+		t.Fatalf("ParsePolicy failed: %v", err)
+	}
+	env := newTestEnvWithOptions(t, server.Options{Policy: policy})
+	alice := env.clientAs(t, "alice")
+
+	resp, err := alice.StartJob(t.Context(), &pb.StartJobRequest{
+		Command: "sleep",
+		Args:    []string{"60"},
+	})
+	if err != nil {
+		t.Fatalf("StartJob failed: %v", err)
+	}
+	t.Cleanup(func() {
+		alice.StopJob(context.Background(), &pb.StopJobRequest{JobId: resp.GetJobId()})
+	})
+
+	_, err = alice.StartJob(t.Context(), &pb.StartJobRequest{Command: "true"})
+	if s, ok := status.FromError(err); !ok || s.Code() != codes.ResourceExhausted || !strings.Contains(s.Message(), "1 of 1 jobs") {
+		t.Fatalf("expected ResourceExhausted for the jobs quota, got %v", err)
+	}
+
+	quota, err := alice.GetQuota(t.Context(), &pb.GetQuotaRequest{})
+	if err != nil {
+		t.Fatalf("GetQuota failed: %v", err)
+	}
+	if quota.GetLimits().GetJobs() != 1 || quota.GetUsage().GetJobs() != 1 || quota.GetUsage().GetRetainedJobs() != 1 {
+		t.Fatalf("unexpected quota %v", quota)
+	}
+
+	// bob has no quota, and does not see alice's usage.
+	quota, err = env.clientAs(t, "bob").GetQuota(t.Context(), &pb.GetQuotaRequest{})
+	if err != nil {
+		t.Fatalf("GetQuota failed: %v", err)
+	}
+	if quota.GetLimits().GetJobs() != 0 || quota.GetUsage().GetJobs() != 0 {
+		t.Fatalf("unexpected quota %v", quota)
+	}
+}
+
+func TestQueryAudit(t *testing.T) {
+	testutil.RequireRoot(t)
+	l, err := audit.Open(filepath.Join(t.TempDir(), "audit.log"), audit.Options{Chain: true})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	env := newTestEnvWithOptions(t, server.Options{Audit: l})
+	alice := env.clientAs(t, "alice")
+	admin := env.clientAs(t, "admin")
+
+	resp, err := alice.StartJob(t.Context(), &pb.StartJobRequest{Command: "true"})
+	if err != nil {
+		t.Fatalf("StartJob failed: %v", err)
+	}
+	if _, err := env.clientAs(t, "bob").GetJobStatus(t.Context(), &pb.GetJobStatusRequest{JobId: resp.GetJobId()}); status.Code(err) != codes.NotFound {
+		t.Fatalf("expected NotFound, got %v", err)
+	}
+
+	// Only admins may query the log, which covers every user's jobs.
+	for _, name := range []string{"alice", "carol"} {
+		_, err := env.clientAs(t, name).QueryAudit(t.Context(), &pb.QueryAuditRequest{})
+		if status.Code(err) != codes.PermissionDenied {
+			t.Fatalf("expected PermissionDenied for %s, got %v", name, err)
+		}
+	}
+
+	audited, err := admin.QueryAudit(t.Context(), &pb.QueryAuditRequest{JobId: resp.GetJobId()})
+	if err != nil {
+		t.Fatalf("QueryAudit failed: %v", err)
+	}
+	records := audited.GetRecords()
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %v", records)
+	}
+	if r := records[0]; r.GetUser() != "alice" || r.GetRpc() != "StartJob" || r.GetCode() != "OK" {
+		t.Fatalf("unexpected record %v", r)
+	}
+	if r := records[1]; r.GetUser() != "bob" || r.GetRpc() != "GetJobStatus" || r.GetCode() != "NotFound" || r.GetPrevHash() != records[0].GetHash() {
+		t.Fatalf("unexpected record %v", r)
+	}
+	if err := l.Verify(); err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+
+	if _, err := admin.QueryAudit(t.Context(), &pb.QueryAuditRequest{Since: "yesterday"}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument, got %v", err)
+	}
+}
+
+func TestStartJobOnBehalfOf(t *testing.T) {
+	testutil.RequireRoot(t)
+	l, err := audit.Open(filepath.Join(t.TempDir(), "audit.log"), audit.Options{})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	env := newTestEnvWithOptions(t, server.Options{Audit: l})
+	admin := env.clientAs(t, "admin")
+	alice := env.clientAs(t, "alice")
+
+	resp, err := admin.StartJob(t.Context(), &pb.StartJobRequest{Command: "true", OnBehalfOf: "alice"})
+	if err != nil {
+		t.Fatalf("StartJob failed: %v", err)
+	}
+
+	// The job is alice's, so she can see it, and both identities are
+	// recorded.
+	st, err := alice.GetJobStatus(t.Context(), &pb.GetJobStatusRequest{JobId: resp.GetJobId()})
+	if err != nil {
+		t.Fatalf("GetJobStatus failed: %v", err)
+	}
+	if st.GetOwner() != "alice" || st.GetStartedBy() != "admin" {
+		t.Fatalf("expected a job owned by alice and started by admin, got %q and %q", st.GetOwner(), st.GetStartedBy())
+	}
+	records, err := l.Query(audit.Filter{RPC: "StartJob"})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(records) != 1 || records[0].User != "admin" || records[0].OnBehalfOf != "alice" || records[0].JobID != resp.GetJobId() {
+		t.Fatalf("expected a record of admin starting the job for alice, got %+v", records)
+	}
+
+	// Only admins may start jobs for other users.
+	_, err = alice.StartJob(t.Context(), &pb.StartJobRequest{Command: "true", OnBehalfOf: "bob"})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected PermissionDenied, got %v", err)
+	}
+
+	// Jobs owners start themselves have no started_by.
+	resp, err = alice.StartJob(t.Context(), &pb.StartJobRequest{Command: "true"})
+	if err != nil {
+		t.Fatalf("StartJob failed: %v", err)
+	}
+	st, err = alice.GetJobStatus(t.Context(), &pb.GetJobStatusRequest{JobId: resp.GetJobId()})
+	if err != nil {
+		t.Fatalf("GetJobStatus failed: %v", err)
+	}
+	if st.GetOwner() != "alice" || st.GetStartedBy() != "" {
+		t.Fatalf("expected a job owned and started by alice, got %q and %q", st.GetOwner(), st.GetStartedBy())
+	}
+}
+
+func TestStartJobOnBehalfOfPolicy(t *testing.T) {
+	testutil.RequireRoot(t)
+	// Auditors may impersonate. Clients may only run true, and auditors
+	// false.
+	policy, err := auth.ParsePolicy([]byte(`
+roles:
+  client:
+    - verbs: ["*"]
+  auditor:
+    - verbs: [start, impersonate]
+      jobs: any
+commands:
+  roles:
+    client:
+      - path: /usr/bin/true
+    auditor:
+      - path: /usr/bin/false
+`))
+	if err != nil {
+		t.Fatalf("ParsePolicy failed: %v", err)
+	}
+	env := newTestEnvWithOptions(t, server.Options{Policy: policy})
+	carol := env.clientAs(t, "carol")
+
+	// carol, an auditor, may start jobs on behalf of other users, since the
+	// policy allows her to impersonate.
+	resp, err := carol.StartJob(t.Context(), &pb.StartJobRequest{Command: "true", OnBehalfOf: "alice"})
+	if err != nil {
+		t.Fatalf("StartJob failed: %v", err)
+	}
+	st, err := env.clientAs(t, "alice").GetJobStatus(t.Context(), &pb.GetJobStatusRequest{JobId: resp.GetJobId()})
+	if err != nil {
+		t.Fatalf("GetJobStatus failed: %v", err)
+	}
+	if st.GetOwner() != "alice" || st.GetStartedBy() != "carol" {
+		t.Fatalf("expected a job owned by alice and started by carol, got %q and %q", st.GetOwner(), st.GetStartedBy())
+	}
+
+	// The owner's role is not known, so the job is checked as a client's,
+	// even on behalf of an auditor.
+	_, err = carol.StartJob(t.Context(), &pb.StartJobRequest{Command: "false", OnBehalfOf: "carol"})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected the client command policy to deny false, got %v", err)
+	}
+
+	// The default policy's admins are not special: without a rule that
+	// allows it, they may not impersonate.
+	_, err = env.clientAs(t, "admin").StartJob(t.Context(), &pb.StartJobRequest{Command: "true", OnBehalfOf: "alice"})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected PermissionDenied, got %v", err)
+	}
+}
+
+func TestShareJob(t *testing.T) {
+	testutil.RequireRoot(t)
+	env := newTestEnv(t)
+	alice := env.clientAs(t, "alice")
+	bob := env.clientAs(t, "bob")
+
+	resp, err := alice.StartJob(t.Context(), &pb.StartJobRequest{
+		Command: "sleep",
+		Args:    []string{"60"},
+	})
+	if err != nil {
+		t.Fatalf("StartJob failed: %v", err)
+	}
+	jobID := resp.GetJobId()
+	t.Cleanup(func() {
+		alice.StopJob(context.Background(), &pb.StopJobRequest{JobId: jobID})
+	})
+
+	expectCode := func(err error, code codes.Code) {
+		t.Helper()
+		if s, ok := status.FromError(err); !ok || s.Code() != code {
+			t.Fatalf("expected %v, got %v", code, err)
+		}
+	}
+
+	// Only the owner may share a job.
+	_, err = bob.ShareJob(t.Context(), &pb.ShareJobRequest{JobId: jobID, User: "bob", Permissions: []pb.Permission{pb.Permission_PERMISSION_STOP}})
+	expectCode(err, codes.NotFound)
+	_, err = alice.ShareJob(t.Context(), &pb.ShareJobRequest{JobId: jobID, User: "bob", Group: "ml", Permissions: []pb.Permission{pb.Permission_PERMISSION_VIEW}})
+	expectCode(err, codes.InvalidArgument)
+
+	share, err := alice.ShareJob(t.Context(), &pb.ShareJobRequest{JobId: jobID, User: "bob", Permissions: []pb.Permission{pb.Permission_PERMISSION_VIEW}})
+	if err != nil {
+		t.Fatalf("ShareJob failed: %v", err)
+	}
+	if len(share.GetGrants()) != 1 || share.GetGrants()[0].GetUser() != "bob" {
+		t.Fatalf("expected the job to be shared with bob, got %v", share.GetGrants())
+	}
+
+	if _, err := bob.GetJobStatus(t.Context(), &pb.GetJobStatusRequest{JobId: jobID}); err != nil {
+		t.Fatalf("GetJobStatus failed: %v", err)
+	}
+	_, err = bob.StopJob(t.Context(), &pb.StopJobRequest{JobId: jobID})
+	expectCode(err, codes.NotFound)
+	// Nor may those it is shared with share it further.
+	_, err = bob.ShareJob(t.Context(), &pb.ShareJobRequest{JobId: jobID, User: "bob", Permissions: []pb.Permission{pb.Permission_PERMISSION_STOP}})
+	expectCode(err, codes.NotFound)
+
+	unshare, err := alice.UnshareJob(t.Context(), &pb.UnshareJobRequest{JobId: jobID, User: "bob"})
+	if err != nil {
+		t.Fatalf("UnshareJob failed: %v", err)
+	}
+	if len(unshare.GetGrants()) != 0 {
+		t.Fatalf("expected the job not to be shared, got %v", unshare.GetGrants())
+	}
+	_, err = bob.GetJobStatus(t.Context(), &pb.GetJobStatusRequest{JobId: jobID})
+	expectCode(err, codes.NotFound)
+
+	if _, err := alice.ShareJob(t.Context(), &pb.ShareJobRequest{JobId: jobID, User: "bob", Permissions: []pb.Permission{pb.Permission_PERMISSION_STOP}}); err != nil {
+		t.Fatalf("ShareJob failed: %v", err)
+	}
+	if _, err := bob.StopJob(t.Context(), &pb.StopJobRequest{JobId: jobID}); err != nil {
+		t.Fatalf("StopJob failed: %v", err)
+	}
+}
@@ -45,13 +45,20 @@ func LoadCert(t *testing.T, name string) tls.Certificate {
 }
 
 // ServerTLSConfig returns a *tls.Config for the server using certs from certs/.
+// Like teleworker's, it is an auth.ServerTLS config.
 func ServerTLSConfig(t *testing.T) *tls.Config {
 	t.Helper()
-	conf, err := auth.ServerTLSConfig(CACertPEM(t), LoadCert(t, "server"))
+	dir := CertsDir(t)
+	serverTLS, err := auth.LoadServerTLS(
+		filepath.Join(dir, "ca.crt"),
+		filepath.Join(dir, "server.crt"),
+		filepath.Join(dir, "server.key"),
+		nil,
+	)
 	if err != nil {
 		t.Fatalf("failed to build server TLS config: %v", err)
 	}
-	return conf
+	return serverTLS.Config()
 }
 
 // ClientTLSConfig returns a *tls.Config for a client using certs/<name>.crt/.key.
@@ -10,13 +10,21 @@ import (
 	"github.com/kkloberdanz/teleworker/resources"
 )
 
-// SkipIfNoCgroupV2 skips the test if cgroup v2 is not available or the
-// process is not running as root.
-func SkipIfNoCgroupV2(t *testing.T) {
+// RequireRoot skips the test if the process is not running as root. Jobs need
+// root even without cgroups, to start in their own PID namespace through the
+// job init process.
+func RequireRoot(t *testing.T) {
 	t.Helper()
 	if os.Getuid() != 0 {
 		t.Skip("skipping: requires root")
 	}
+}
+
+// SkipIfNoCgroupV2 skips the test if cgroup v2 is not available or the
+// process is not running as root.
+func SkipIfNoCgroupV2(t *testing.T) {
+	t.Helper()
+	RequireRoot(t)
 	if _, err := os.Stat("/sys/fs/cgroup/cgroup.controllers"); err != nil {
 		t.Skip("skipping: cgroup v2 not available")
 	}
@@ -25,15 +33,42 @@ func SkipIfNoCgroupV2(t *testing.T) {
 // RequireManager skips the test if cgroups are unavailable and returns a
 // Manager that uses a unique cgroup directory. The directory is cleaned up
 // when the test finishes.
-func RequireManager(t *testing.T) resources.Manager {
+func RequireManager(t *testing.T) *resources.Manager {
 	t.Helper()
 	SkipIfNoCgroupV2(t)
 
 	parentPath := filepath.Join("/sys/fs/cgroup", "teleworker-test-"+uuid.New().String())
-	mgr, err := resources.NewManager(parentPath)
+	mgr, err := resources.NewManager(parentPath, resources.Options{})
 	if err != nil {
 		t.Fatalf("NewManager failed: %v", err)
 	}
 	t.Cleanup(mgr.Cleanup)
-	return *mgr
+	return mgr
+}
+
+// SkipIfNoCgroupV1 skips the test if the cgroup v1 cpu, memory and blkio
+// hierarchies are not mounted or the process is not running as root.
+func SkipIfNoCgroupV1(t *testing.T) {
+	t.Helper()
+	RequireRoot(t)
+	for _, controller := range []string{"cpu", "memory", "blkio"} {
+		if _, err := os.Stat(filepath.Join("/sys/fs/cgroup", controller, "cgroup.procs")); err != nil {
+			t.Skipf("skipping: cgroup v1 %s hierarchy not available", controller)
+		}
+	}
+}
+
+// RequireV1Manager skips the test if the cgroup v1 hierarchies are
+// unavailable and returns a V1Manager that uses a unique parent cgroup. The
+// cgroups are cleaned up when the test finishes.
+func RequireV1Manager(t *testing.T) *resources.V1Manager {
+	t.Helper()
+	SkipIfNoCgroupV1(t)
+
+	mgr, err := resources.NewV1Manager("/sys/fs/cgroup", "teleworker-test-"+uuid.New().String(), resources.Options{})
+	if err != nil {
+		t.Fatalf("NewV1Manager failed: %v", err)
+	}
+	t.Cleanup(mgr.Cleanup)
+	return mgr
 }
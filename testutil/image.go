@@ -0,0 +1,178 @@
+package testutil
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/kkloberdanz/teleworker/image"
+)
+
+// ImageFile is an entry in a test image layer. Typeflag defaults to a regular
+// file, and Mode defaults to 0644.
+type ImageFile struct {
+	Name     string
+	Body     []byte
+	Mode     int64
+	Typeflag byte
+	Linkname string
+}
+
+// WriteImage writes an OCI image layout with the given config and layers to a
+// temporary directory and returns its path. Layers are listed from the
+// bottom-most to the top-most, as in an image manifest.
+func WriteImage(t *testing.T, cfg image.Config, layers ...[]ImageFile) string {
+	t.Helper()
+	dir := t.TempDir()
+
+	type descriptor struct {
+		MediaType string `json:"mediaType"`
+		Digest    string `json:"digest"`
+		Size      int    `json:"size"`
+	}
+	writeBlob := func(mediaType string, data []byte) descriptor {
+		sum := sha256.Sum256(data)
+		encoded := hex.EncodeToString(sum[:])
+		path := filepath.Join(dir, "blobs", "sha256", encoded)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create blobs directory: %v", err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatalf("failed to write blob: %v", err)
+		}
+		return descriptor{MediaType: mediaType, Digest: "sha256:" + encoded, Size: len(data)}
+	}
+	marshal := func(v any) []byte {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("failed to marshal: %v", err)
+		}
+		return data
+	}
+
+	var layerDescs []descriptor
+	for _, files := range layers {
+		layerDescs = append(layerDescs, writeBlob("application/vnd.oci.image.layer.v1.tar", tarFiles(t, files)))
+	}
+
+	configDesc := writeBlob("application/vnd.oci.image.config.v1+json", marshal(map[string]any{
+		"architecture": runtime.GOARCH,
+		"os":           "linux",
+		"config":       cfg,
+	}))
+	manifestDesc := writeBlob("application/vnd.oci.image.manifest.v1+json", marshal(map[string]any{
+		"schemaVersion": 2,
+		"config":        configDesc,
+		"layers":        layerDescs,
+	}))
+
+	index := marshal(map[string]any{
+		"schemaVersion": 2,
+		"manifests":     []descriptor{manifestDesc},
+	})
+	if err := os.WriteFile(filepath.Join(dir, "index.json"), index, 0644); err != nil {
+		t.Fatalf("failed to write index.json: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "oci-layout"), []byte(`{"imageLayoutVersion":"1.0.0"}`), 0644); err != nil {
+		t.Fatalf("failed to write oci-layout: %v", err)
+	}
+	return dir
+}
+
+// TarDir archives the contents of dir into a tarball and returns its path.
+func TarDir(t *testing.T, dir string) string {
+	t.Helper()
+	var files []ImageFile
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		body, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		files = append(files, ImageFile{Name: rel, Body: body})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to walk %s: %v", dir, err)
+	}
+	path := filepath.Join(t.TempDir(), "image.tar")
+	if err := os.WriteFile(path, tarFiles(t, files), 0644); err != nil {
+		t.Fatalf("failed to write tarball: %v", err)
+	}
+	return path
+}
+
+func tarFiles(t *testing.T, files []ImageFile) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, f := range files {
+		hdr := &tar.Header{
+			Name:     f.Name,
+			Mode:     f.Mode,
+			Typeflag: f.Typeflag,
+			Linkname: f.Linkname,
+		}
+		if hdr.Mode == 0 {
+			hdr.Mode = 0644
+		}
+		if hdr.Typeflag == 0 {
+			hdr.Typeflag = tar.TypeReg
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			hdr.Size = int64(len(f.Body))
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("failed to write tar header: %v", err)
+		}
+		if _, err := tw.Write(f.Body); err != nil {
+			t.Fatalf("failed to write tar body: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("failed to close tar writer: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// ImageHelper builds testdata/imagehelper as a static binary and returns its
+// contents, so that it can be copied into a test image and run without any
+// shared libraries. The test is skipped if the go tool is unavailable.
+func ImageHelper(t *testing.T) []byte {
+	t.Helper()
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("skipping: go tool not available")
+	}
+
+	_, filename, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatal("failed to determine testutil package location")
+	}
+	out := filepath.Join(t.TempDir(), "imagehelper")
+	cmd := exec.Command(goTool, "build", "-o", out, "./testdata/imagehelper")
+	cmd.Dir = filepath.Dir(filename)
+	cmd.Env = append(os.Environ(), "CGO_ENABLED=0")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("failed to build image helper: %v\n%s", err, output)
+	}
+
+	helper, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("failed to read image helper: %v", err)
+	}
+	return helper
+}
@@ -0,0 +1,13 @@
+// Program imagehelper is copied into test images as the image's program. It
+// reports what the process sees so that tests can check how it was run.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	wd, _ := os.Getwd()
+	fmt.Printf("args=%v wd=%s user=%d:%d\n", os.Args[1:], wd, os.Getuid(), os.Getgid())
+}
@@ -0,0 +1,255 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"github.com/kkloberdanz/teleworker/auth"
+	"github.com/kkloberdanz/teleworker/job"
+	"github.com/kkloberdanz/teleworker/resources"
+	"github.com/kkloberdanz/teleworker/workspace"
+)
+
+// ErrQuotaExceeded is returned when a job would take its owner over their
+// quota.
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// QuotaUsage is how much of each limit of auth.Quota a user is using.
+type QuotaUsage struct {
+	Jobs         int     // Jobs that are queued or running.
+	CPUs         float64 // CPUs reserved by queued and running jobs.
+	Memory       int64   // Memory in bytes reserved by queued and running jobs.
+	RetainedJobs int     // Jobs the worker keeps, including finished jobs.
+	LogBytes     int64   // Output in bytes of the retained jobs.
+}
+
+// reservation is the part of its owner's quota that a queued or running job
+// takes.
+type reservation struct {
+	owner  string  // Username of the job's owner.
+	cpus   float64 // Exclusive CPUs, or the CPU limit of the job.
+	memory int64   // Memory limit of the job in bytes.
+}
+
+// newReservation returns the reservation of a job, from the limits it asks
+// for, or resources.DefaultLimits for those it does not set.
+func newReservation(owner auth.Identity, opts job.Options) reservation {
+	r := reservation{owner: owner.Username, cpus: float64(opts.Exclusive), memory: opts.Limits.MemoryMax}
+	if r.cpus == 0 {
+		quota, period := opts.Limits.CPUQuota, opts.Limits.CPUPeriod
+		if quota == 0 {
+			quota = resources.DefaultLimits.CPUQuota
+		}
+		if period == 0 {
+			period = resources.DefaultLimits.CPUPeriod
+		}
+		r.cpus = quota.Seconds() / period.Seconds()
+	}
+	if r.memory == 0 {
+		r.memory = resources.DefaultLimits.MemoryMax
+	}
+	return r
+}
+
+// reserve checks that a new job fits in its owner's quota, and reserves its
+// part of the quota until release is called. To stay within the retained jobs
+// and log quotas, the owner's oldest finished jobs are forgotten. If the job
+// does not fit, an error wrapping ErrQuotaExceeded says which quota it would
+// exceed.
+//
+// It returns the most output in bytes the job may keep, which is what is left
+// of its owner's log quota, or 0 if the owner has no log quota. Jobs that run
+// at the same time each get what was left when they started, so together they
+// may go over the quota until the oldest of them are forgotten.
+func (w *Worker) reserve(jobID string, owner auth.Identity, r reservation) (int, error) {
+	var q auth.Quota
+	if w.quotas != nil {
+		q = w.quotas(owner)
+	}
+
+	done := w.finishedJobs(owner.Username)
+	var forgotten []string
+	// Runs after w.mu is unlocked, since removing a workspace walks its
+	// files.
+	defer func() {
+		w.removeWorkspaces(forgotten)
+	}()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	used := w.usage(owner.Username, done)
+	switch {
+	case q.Jobs > 0 && used.Jobs >= q.Jobs:
+		return 0, fmt.Errorf("%w: %s already has %d of %d jobs queued or running", ErrQuotaExceeded, owner.Username, used.Jobs, q.Jobs)
+	case q.CPUs > 0 && used.CPUs+r.cpus > q.CPUs:
+		return 0, fmt.Errorf("%w: job needs %g cpus, but %s already has %g of %g cpus reserved", ErrQuotaExceeded, r.cpus, owner.Username, used.CPUs, q.CPUs)
+	case q.Memory > 0 && used.Memory+r.memory > q.Memory:
+		return 0, fmt.Errorf("%w: job needs %d bytes of memory, but %s already has %d of %d bytes reserved", ErrQuotaExceeded, r.memory, owner.Username, used.Memory, q.Memory)
+	}
+
+	for {
+		retainedFull := q.RetainedJobs > 0 && used.RetainedJobs >= q.RetainedJobs
+		logsFull := q.LogBytes > 0 && used.LogBytes >= q.LogBytes
+		if !retainedFull && !logsFull {
+			break
+		}
+		oldest, ok := w.oldestFinished(owner.Username, done)
+		if !ok && retainedFull {
+			return 0, fmt.Errorf("%w: %s already has %d of %d retained jobs, and none of them have finished", ErrQuotaExceeded, owner.Username, used.RetainedJobs, q.RetainedJobs)
+		}
+		if !ok {
+			return 0, fmt.Errorf("%w: %s's jobs already have %d of %d bytes of output, and none of them have finished", ErrQuotaExceeded, owner.Username, used.LogBytes, q.LogBytes)
+		}
+		slog.Info(
+			"forgetting finished job to stay within quota",
+			"jobID", oldest,
+			"owner", owner.Username,
+		)
+		w.forget(oldest)
+		forgotten = append(forgotten, oldest)
+		used = w.usage(owner.Username, done)
+	}
+
+	w.reserved[jobID] = r
+	if q.LogBytes > 0 {
+		return int(q.LogBytes - used.LogBytes), nil
+	}
+	return 0, nil
+}
+
+// release returns a job's reservation to its owner's quota.
+func (w *Worker) release(jobID string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	delete(w.reserved, jobID)
+}
+
+// finishedJobs returns the set of the user's jobs that have finished. The
+// jobs' statuses are read without w.mu held, since reading the status of a
+// running job reads its cgroup. A job never goes back to running once it has
+// finished, so a job that finishes after the set is taken is only counted as
+// running, which can not take its owner over their quota.
+func (w *Worker) finishedJobs(username string) map[string]bool {
+	var jobs []job.Job
+	w.mu.RLock()
+	for jobID, owner := range w.owners {
+		if owner.Username == username {
+			jobs = append(jobs, w.jobs[jobID])
+		}
+	}
+	w.mu.RUnlock()
+
+	done := make(map[string]bool)
+	for _, j := range jobs {
+		if finished(j) {
+			done[j.ID()] = true
+		}
+	}
+	return done
+}
+
+// usage returns the quota a user is using, given the set of their jobs that
+// have finished, from finishedJobs. w.mu must be held.
+func (w *Worker) usage(username string, done map[string]bool) QuotaUsage {
+	var u QuotaUsage
+	for jobID, r := range w.reserved {
+		if r.owner != username {
+			continue
+		}
+		// A job that has exited may not have released its reservation yet.
+		if done[jobID] {
+			continue
+		}
+		u.Jobs++
+		u.CPUs += r.cpus
+		u.Memory += r.memory
+		// Jobs that are still starting are not tracked yet, but will be.
+		if _, tracked := w.jobs[jobID]; !tracked {
+			u.RetainedJobs++
+		}
+	}
+	for jobID, owner := range w.owners {
+		if owner.Username != username {
+			continue
+		}
+		u.RetainedJobs++
+		u.LogBytes += int64(w.jobs[jobID].Output().Len())
+	}
+	return u
+}
+
+// finished returns true if the job has exited, or was stopped before it
+// started.
+func finished(j job.Job) bool {
+	switch j.Status().Status {
+	case job.StatusSubmitted, job.StatusRunning:
+		return false
+	}
+	return true
+}
+
+// oldestFinished returns the ID of the user's oldest job in done, the set of
+// their jobs that have finished, or false if there is none. w.mu must be
+// held.
+func (w *Worker) oldestFinished(username string, done map[string]bool) (string, bool) {
+	for _, jobID := range w.order {
+		if w.owners[jobID].Username == username && done[jobID] {
+			return jobID, true
+		}
+	}
+	return "", false
+}
+
+// forget stops tracking a finished job, and drops its output. Its workspace,
+// if it was kept, must be removed with removeWorkspaces once w.mu is
+// unlocked. w.mu must be held.
+func (w *Worker) forget(jobID string) {
+	delete(w.jobs, jobID)
+	delete(w.owners, jobID)
+	delete(w.startedBy, jobID)
+	delete(w.acls, jobID)
+	delete(w.reserved, jobID)
+	w.order = slices.DeleteFunc(w.order, func(id string) bool {
+		return id == jobID
+	})
+}
+
+// removeWorkspaces removes the kept workspaces of jobs that were forgotten,
+// since they can no longer be found through the worker. Workspaces that are
+// not kept are already removed when their job exits.
+func (w *Worker) removeWorkspaces(jobIDs []string) {
+	if w.workspace == nil || w.workspace.Retention != workspace.RetainKeep {
+		return
+	}
+	for _, jobID := range jobIDs {
+		if err := w.workspace.Remove(jobID); err != nil {
+			slog.Warn(
+				"failed to remove workspace of forgotten job",
+				"jobID", jobID,
+				"error", err,
+			)
+			continue
+		}
+		slog.Info(
+			"removed workspace of forgotten job",
+			"jobID", jobID,
+		)
+	}
+}
+
+// GetQuota returns the user's quota, and how much of it they are using.
+func (w *Worker) GetQuota(owner auth.Identity) (auth.Quota, QuotaUsage) {
+	var q auth.Quota
+	if w.quotas != nil {
+		q = w.quotas(owner)
+	}
+
+	done := w.finishedJobs(owner.Username)
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return q, w.usage(owner.Username, done)
+}
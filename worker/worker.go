@@ -2,38 +2,72 @@
 package worker
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"slices"
 	"sync"
 
 	"github.com/google/uuid"
 
 	"github.com/kkloberdanz/teleworker/auth"
+	"github.com/kkloberdanz/teleworker/image"
 	"github.com/kkloberdanz/teleworker/job"
 	"github.com/kkloberdanz/teleworker/resources"
+	"github.com/kkloberdanz/teleworker/workspace"
 )
 
 // ErrJobNotFound is returned when a job ID does not exist.
 var ErrJobNotFound = errors.New("job not found")
 
+// ErrNoExclusiveCPUs is returned when a job asks for exclusive CPUs, but the
+// worker has no pool of CPUs to hand out.
+var ErrNoExclusiveCPUs = errors.New("exclusive cpus are not configured")
+
+// ErrNoImageDir is returned when a job asks for an image, but the worker has
+// no image directory to find it in.
+var ErrNoImageDir = errors.New("images are not configured")
+
 // Worker manages a set of running jobs.
 //
-// TODO: Finished jobs are never removed from the map. For a long-running
-// server, consider adding a cleanup mechanism to avoid unbounded memory growth.
+// TODO: Finished jobs are only removed from the map to keep their owner within
+// their retained jobs and log quotas. For a long-running server without
+// quotas, consider adding a cleanup mechanism to avoid unbounded memory growth.
 type Worker struct {
 	mu        sync.RWMutex
 	jobs      map[string]job.Job       // TODO: This would ideally be stored in a database. Using a Map for simplicity.
 	owners    map[string]auth.Identity // Map jobID to owner identity.
-	cgroupMgr resources.Manager
+	startedBy map[string]auth.Identity // Map jobID to the admin who started it on its owner's behalf. Not set for jobs owners started themselves.
+	acls      map[string]auth.ACL      // Map jobID to the users and groups it is shared with.
+	order     []string                 // IDs of tracked jobs, oldest first.
+	reserved  map[string]reservation   // Quota taken by each queued or running job.
+	quotas    func(auth.Identity) auth.Quota
+	cgroupMgr resources.Backend
 	noCleanup bool
+	dataDir   string
+	imageDir  string
+	workspace *workspace.Config
+	isolation job.Isolation
+	landlock  *job.Landlock
+	ceilings  job.Rlimits
+	cpus      *resources.CPUAllocator
+	queued    map[string]context.CancelFunc // Cancels the wait of jobs queued for exclusive CPUs.
 }
 
 // Options configures a Worker.
 type Options struct {
-	CgroupMgr resources.Manager
-	NoCleanup bool // If true, skip cgroup cleanup when jobs exit. Used for testing so we can inspect the cgroup directory after a job finishes.
+	CgroupMgr resources.Backend
+	NoCleanup bool                           // If true, skip cgroup cleanup when jobs exit. Used for testing so we can inspect the cgroup directory after a job finishes.
+	DataDir   string                         // Directory for unpacked image layers and job root filesystems. Required to run OCI jobs.
+	ImageDir  string                         // Directory of the images jobs may run. Jobs name images relative to it. Required to run OCI jobs.
+	Workspace *workspace.Config              // If set, each local job runs in its own copy-on-write workspace.
+	Isolation job.Isolation                  // Namespaces every job runs in, in addition to its PID namespace.
+	Landlock  *job.Landlock                  // If set, every job is restricted to the paths in this Landlock ruleset.
+	Ceilings  job.Rlimits                    // Highest resource limits a job may ask for. These are also the defaults for limits a job does not set.
+	CPUs      *resources.CPUAllocator        // If set, jobs may ask for exclusive CPUs from this allocator's pool, and other jobs are kept off the pool.
+	Quotas    func(auth.Identity) auth.Quota // Returns the quota of a job's owner, e.g. auth.Policy.Quota. If nil, owners are not limited.
 }
 
 // New creates a Worker.
@@ -41,47 +75,244 @@ func New(opts Options) *Worker {
 	return &Worker{
 		jobs:      make(map[string]job.Job),
 		owners:    make(map[string]auth.Identity),
+		startedBy: make(map[string]auth.Identity),
+		acls:      make(map[string]auth.ACL),
+		reserved:  make(map[string]reservation),
+		quotas:    opts.Quotas,
 		cgroupMgr: opts.CgroupMgr,
 		noCleanup: opts.NoCleanup,
+		dataDir:   opts.DataDir,
+		imageDir:  opts.ImageDir,
+		workspace: opts.Workspace,
+		isolation: opts.Isolation,
+		landlock:  opts.Landlock,
+		ceilings:  opts.Ceilings,
+		cpus:      opts.CPUs,
+		queued:    make(map[string]context.CancelFunc),
 	}
 }
 
-// trackJob adds the job and its owner to the map so we can track it.
-func (w *Worker) trackJob(jobID string, j job.Job, owner auth.Identity) {
+// trackJob adds the job, its owner and who started it to the maps so we can
+// track it.
+func (w *Worker) trackJob(jobID string, j job.Job, owner, startedBy auth.Identity) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
 	w.jobs[jobID] = j
 	w.owners[jobID] = owner
+	if startedBy.Username != owner.Username {
+		w.startedBy[jobID] = startedBy
+	}
+	w.order = append(w.order, jobID)
 }
 
 // StartJob starts a command and returns the job ID. The owner is recorded for
-// authorization checks.
-func (w *Worker) StartJob(jobType job.JobType, command string, args []string, owner auth.Identity) (string, error) {
+// authorization checks. The worker sets the cgroup, data directory, workspace,
+// isolation profile and Landlock ruleset in opts, so callers only need to set
+// the per-job options, such as the image. Returns job.ErrRlimitExceedsCeiling
+// if opts asks for resource limits above the worker's ceilings.
+//
+// OCI jobs name their image relative to the worker's image directory. Names
+// that could lead out of it are rejected with image.ErrInvalidName, see
+// image.Resolve.
+//
+// If the job asks for exclusive CPUs and not enough are free, StartJob returns
+// resources.ErrNoFreeCPUs, unless the CPU allocator queues jobs. In that case
+// the job is returned in the submitted state, and starts once the CPUs are
+// free.
+//
+// If the job would take its owner over their quota, StartJob returns an error
+// wrapping ErrQuotaExceeded. See reserve.
+func (w *Worker) StartJob(jobType job.JobType, command string, args []string, owner auth.Identity, opts job.Options) (string, error) {
+	return w.StartJobFor(jobType, command, args, owner, owner, opts)
+}
+
+// StartJobFor is like StartJob, for a job that startedBy, an admin, starts on
+// its owner's behalf. The job belongs to, and counts towards the quota of,
+// the owner, and both identities are recorded, see GetJobStartedBy.
+func (w *Worker) StartJobFor(jobType job.JobType, command string, args []string, owner, startedBy auth.Identity, opts job.Options) (string, error) {
+	if jobType == job.JobTypeOCI {
+		if w.imageDir == "" {
+			return "", ErrNoImageDir
+		}
+		src, err := image.Resolve(w.imageDir, opts.Image)
+		if err != nil {
+			return "", err
+		}
+		opts.Image = src
+	}
+
+	rlimits, err := opts.Rlimits.Within(w.ceilings)
+	if err != nil {
+		return "", err
+	}
+	opts.Rlimits = rlimits
+
+	limits := opts.Limits
+	if limits.Cpuset, err = w.cpuset(opts); err != nil {
+		return "", err
+	}
+
 	jobID := uuid.New().String()
+	maxOutput, err := w.reserve(jobID, owner, newReservation(owner, opts))
+	if err != nil {
+		return "", err
+	}
+
+	var cpus []int
+	queue := false
+	if opts.Exclusive > 0 {
+		cpus, err = w.cpus.Allocate(opts.Exclusive)
+		switch {
+		case errors.Is(err, resources.ErrNoFreeCPUs) && w.cpus.Queues():
+			queue = true
+		case err != nil:
+			w.release(jobID)
+			return "", err
+		default:
+			limits.Cpuset.CPUs = resources.FormatCPUList(cpus)
+		}
+	}
 
-	cg, err := w.cgroupMgr.CreateCgroup(jobID)
+	cg, err := w.cgroupMgr.CreateCgroup(jobID, limits)
 	if err != nil {
+		w.releaseCPUs(cpus)
+		w.release(jobID)
 		return "", fmt.Errorf("failed to create cgroup: %w", err)
 	}
 
-	j, err := job.NewJob(jobType, jobID, command, args, job.Options{NoCleanup: w.noCleanup, Cgroup: cg})
+	opts.NoCleanup = w.noCleanup
+	opts.Cgroup = cg
+	opts.DataDir = w.dataDir
+	opts.Workspace = w.workspace
+	opts.Isolation = w.isolation
+	opts.Landlock = w.landlock
+	j, err := job.NewJob(jobType, jobID, command, args, opts)
 	if err != nil {
 		cg.Cleanup()
+		w.releaseCPUs(cpus)
+		w.release(jobID)
 		return "", err
 	}
+	j.Output().SetMax(maxOutput)
+
+	if queue {
+		ctx, cancel := context.WithCancel(context.Background())
+		w.mu.Lock()
+		w.queued[jobID] = cancel
+		w.mu.Unlock()
+		w.trackJob(jobID, j, owner, startedBy)
+
+		slog.Info(
+			"queued job for exclusive cpus",
+			"jobID", jobID,
+			"cpus", opts.Exclusive,
+		)
+		go w.startQueued(ctx, j, cg, limits.Cpuset, opts.Exclusive)
+		return jobID, nil
+	}
 
 	if err := j.Start(); err != nil {
+		w.releaseCPUs(cpus)
+		w.release(jobID)
 		return "", err
 	}
 
-	w.trackJob(jobID, j, owner)
+	w.trackJob(jobID, j, owner, startedBy)
 
-	go j.Wait()
+	go func() {
+		j.Wait()
+		w.releaseCPUs(cpus)
+		w.release(jobID)
+	}()
 
 	return jobID, nil
 }
 
+// cpuset returns the cpuset to apply to a job. Jobs that do not ask for
+// exclusive CPUs are kept off the exclusive pool.
+func (w *Worker) cpuset(opts job.Options) (resources.Cpuset, error) {
+	cpuset := opts.Limits.Cpuset
+	if opts.Exclusive > 0 {
+		if w.cpus == nil {
+			return resources.Cpuset{}, ErrNoExclusiveCPUs
+		}
+		if cpuset.CPUs != "" {
+			return resources.Cpuset{}, fmt.Errorf("%w: can not ask for both exclusive cpus and a cpu list", resources.ErrInvalidCpuset)
+		}
+		return cpuset, nil
+	}
+	if w.cpus == nil {
+		return cpuset, nil
+	}
+
+	pool := w.cpus.Pool()
+	if cpuset.CPUs != "" {
+		cpus, err := resources.ParseCPUList(cpuset.CPUs)
+		if err != nil {
+			return resources.Cpuset{}, err
+		}
+		for _, cpu := range cpus {
+			if slices.Contains(pool, cpu) {
+				return resources.Cpuset{}, fmt.Errorf("%w: cpu %d is reserved for jobs with exclusive cpus", resources.ErrInvalidCpuset, cpu)
+			}
+		}
+		return cpuset, nil
+	}
+
+	all, err := w.cgroupMgr.EffectiveCPUs()
+	if err != nil {
+		return resources.Cpuset{}, fmt.Errorf("failed to read cpus: %w", err)
+	}
+	shared := slices.DeleteFunc(all, func(cpu int) bool {
+		return slices.Contains(pool, cpu)
+	})
+	cpuset.CPUs = resources.FormatCPUList(shared)
+	return cpuset, nil
+}
+
+// startQueued waits for a queued job's exclusive CPUs, then starts the job and
+// waits for it to exit. If the job is stopped while it waits, ctx is canceled.
+func (w *Worker) startQueued(ctx context.Context, j job.Job, cg resources.Cgroup, cpuset resources.Cpuset, n int) {
+	cpus, err := w.cpus.AllocateWait(ctx, n)
+
+	w.mu.Lock()
+	delete(w.queued, j.ID())
+	w.mu.Unlock()
+
+	if err == nil {
+		cpuset.CPUs = resources.FormatCPUList(cpus)
+		if err = cg.SetCpuset(cpuset); err != nil {
+			slog.Warn(
+				"failed to set cpuset of queued job",
+				"jobID", j.ID(),
+				"error", err,
+			)
+			j.Stop()
+		}
+	}
+	// Start also cleans up a job that was stopped while it waited.
+	if err := j.Start(); err != nil {
+		w.releaseCPUs(cpus)
+		w.release(j.ID())
+		return
+	}
+	slog.Info(
+		"started queued job",
+		"jobID", j.ID(),
+		"cpus", cpuset.CPUs,
+	)
+	j.Wait()
+	w.releaseCPUs(cpus)
+	w.release(j.ID())
+}
+
+func (w *Worker) releaseCPUs(cpus []int) {
+	if len(cpus) > 0 {
+		w.cpus.Release(cpus)
+	}
+}
+
 // GetJobOwner returns the identity of the job's owner, or ErrJobNotFound.
 func (w *Worker) GetJobOwner(jobID string) (auth.Identity, error) {
 	w.mu.RLock()
@@ -94,6 +325,68 @@ func (w *Worker) GetJobOwner(jobID string) (auth.Identity, error) {
 	return owner, nil
 }
 
+// GetJobStartedBy returns the identities of the job's owner, and of whoever
+// started the job: an admin, for a job started on its owner's behalf, or else
+// the owner. Returns ErrJobNotFound.
+func (w *Worker) GetJobStartedBy(jobID string) (owner, startedBy auth.Identity, err error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	owner, ok := w.owners[jobID]
+	if !ok {
+		return auth.Identity{}, auth.Identity{}, ErrJobNotFound
+	}
+	if startedBy, ok := w.startedBy[jobID]; ok {
+		return owner, startedBy, nil
+	}
+	return owner, owner, nil
+}
+
+// GetJobACL returns a copy of the users and groups the job is shared with, or
+// ErrJobNotFound.
+func (w *Worker) GetJobACL(jobID string) (auth.ACL, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if _, ok := w.owners[jobID]; !ok {
+		return nil, ErrJobNotFound
+	}
+	return w.acls[jobID].Clone(), nil
+}
+
+// ShareJob grants permissions on the job to a user or group, and returns the
+// job's new ACL. Returns ErrJobNotFound.
+func (w *Worker) ShareJob(jobID string, grantee auth.Grantee, perms []auth.Permission) (auth.ACL, error) {
+	return w.updateACL(jobID, func(acl auth.ACL) {
+		acl.Grant(grantee, perms...)
+	})
+}
+
+// UnshareJob revokes permissions on the job from a user or group, or all of
+// them if perms is empty, and returns the job's new ACL. Returns
+// ErrJobNotFound.
+func (w *Worker) UnshareJob(jobID string, grantee auth.Grantee, perms []auth.Permission) (auth.ACL, error) {
+	return w.updateACL(jobID, func(acl auth.ACL) {
+		acl.Revoke(grantee, perms...)
+	})
+}
+
+func (w *Worker) updateACL(jobID string, update func(auth.ACL)) (auth.ACL, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, ok := w.owners[jobID]; !ok {
+		return nil, ErrJobNotFound
+	}
+	acl := w.acls[jobID]
+	if acl == nil {
+		acl = make(auth.ACL)
+		w.acls[jobID] = acl
+	}
+	update(acl)
+	return acl.Clone(), nil
+}
+
 func (w *Worker) getJob(jobID string) (job.Job, bool) {
 	w.mu.RLock()
 	defer w.mu.RUnlock()
@@ -112,6 +405,16 @@ func (w *Worker) GetJobStatus(jobID string) (job.StatusResult, error) {
 	return j.Status(), nil
 }
 
+// GetJobStats returns the current resource usage of a job. Returns
+// ErrJobNotFound, or job.ErrJobNotRunning if the job has exited.
+func (w *Worker) GetJobStats(jobID string) (*resources.Stats, error) {
+	j, ok := w.getJob(jobID)
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	return j.Stats()
+}
+
 // StreamOutput returns a subscriber for the job's combined stdout/stderr.
 // The caller must close the returned ReadCloser when done.
 func (w *Worker) StreamOutput(jobID string) (io.ReadCloser, error) {
@@ -132,6 +435,9 @@ func (w *Worker) Shutdown() {
 	for _, j := range w.jobs {
 		j.Stop()
 	}
+	for _, cancel := range w.queued {
+		cancel()
+	}
 }
 
 // StopJob kills a running job. Returns ErrJobNotFound or job.ErrJobNotRunning on failure.
@@ -145,5 +451,15 @@ func (w *Worker) StopJob(jobID string) error {
 		"stopping job",
 		"jobID", jobID,
 	)
-	return j.Stop()
+	if err := j.Stop(); err != nil {
+		return err
+	}
+
+	// If the job is queued for exclusive CPUs, stop waiting for them.
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if cancel, ok := w.queued[jobID]; ok {
+		cancel()
+	}
+	return nil
 }
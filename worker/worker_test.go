@@ -7,31 +7,49 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
 	"syscall"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"go.uber.org/goleak"
 
 	"github.com/kkloberdanz/teleworker/auth"
+	"github.com/kkloberdanz/teleworker/image"
 	"github.com/kkloberdanz/teleworker/job"
+	"github.com/kkloberdanz/teleworker/output"
+	"github.com/kkloberdanz/teleworker/resources"
+	"github.com/kkloberdanz/teleworker/resources/fake"
 	"github.com/kkloberdanz/teleworker/testutil"
 	"github.com/kkloberdanz/teleworker/worker"
+	"github.com/kkloberdanz/teleworker/workspace"
 )
 
 func TestMain(m *testing.M) {
+	// Jobs on a backend without cgroup fds, such as the fake, are started
+	// through the job init process.
+	job.Init()
 	goleak.VerifyTestMain(m)
 }
 
-// newTestWorker creates a Worker backed by a real cgroup manager.
-// Tests are skipped if cgroups are unavailable.
+// newTestWorker creates a Worker backed by a fake cgroup backend. Tests that
+// start jobs still need root for their PID namespace. Tests that check what
+// the kernel enforces use newCgroupWorker instead.
 func newTestWorker(t *testing.T) *worker.Worker {
 	t.Helper()
-	mgr := testutil.RequireManager(t)
-	return worker.New(worker.Options{CgroupMgr: mgr})
+	return worker.New(worker.Options{CgroupMgr: fake.NewBackend()})
+}
+
+// newCgroupWorker creates a Worker backed by a real cgroup manager, for tests
+// of what the kernel does, such as cgroup.kill killing every process of a
+// job. Tests are skipped if cgroups are unavailable.
+func newCgroupWorker(t *testing.T) *worker.Worker {
+	t.Helper()
+	return worker.New(worker.Options{CgroupMgr: testutil.RequireManager(t)})
 }
 
 // TODO: Can we make a test if killing teleworker with -9 also kills the child
@@ -39,9 +57,10 @@ func newTestWorker(t *testing.T) *worker.Worker {
 // feasible (perhaps using /proc/self/exe?) but will be a little tricky.
 
 func TestStartJobReturnsUUID(t *testing.T) {
+	testutil.RequireRoot(t)
 	w := newTestWorker(t)
 
-	jobID, err := w.StartJob(job.JobTypeLocal, "echo", []string{"hello"}, auth.Identity{Username: "testuser"})
+	jobID, err := w.StartJob(job.JobTypeLocal, "echo", []string{"hello"}, auth.Identity{Username: "testuser"}, job.Options{})
 	if err != nil {
 		t.Fatalf("StartJob failed: %v", err)
 	}
@@ -56,16 +75,17 @@ func TestStartJobReturnsUUID(t *testing.T) {
 func TestStartJobBadCommand(t *testing.T) {
 	w := newTestWorker(t)
 
-	_, err := w.StartJob(job.JobTypeLocal, "nonexistent-command-that-does-not-exist", nil, auth.Identity{Username: "testuser"})
+	_, err := w.StartJob(job.JobTypeLocal, "nonexistent-command-that-does-not-exist", nil, auth.Identity{Username: "testuser"}, job.Options{})
 	if err == nil {
 		t.Fatal("expected error for bad command, got nil")
 	}
 }
 
 func TestJobRunsToSuccess(t *testing.T) {
+	testutil.RequireRoot(t)
 	w := newTestWorker(t)
 
-	jobID, err := w.StartJob(job.JobTypeLocal, "true", nil, auth.Identity{Username: "testuser"})
+	jobID, err := w.StartJob(job.JobTypeLocal, "true", nil, auth.Identity{Username: "testuser"}, job.Options{})
 	if err != nil {
 		t.Fatalf("StartJob failed: %v", err)
 	}
@@ -85,9 +105,10 @@ func TestJobRunsToSuccess(t *testing.T) {
 }
 
 func TestJobRunsToFailed(t *testing.T) {
+	testutil.RequireRoot(t)
 	w := newTestWorker(t)
 
-	jobID, err := w.StartJob(job.JobTypeLocal, "false", nil, auth.Identity{Username: "testuser"})
+	jobID, err := w.StartJob(job.JobTypeLocal, "false", nil, auth.Identity{Username: "testuser"}, job.Options{})
 	if err != nil {
 		t.Fatalf("StartJob failed: %v", err)
 	}
@@ -107,9 +128,9 @@ func TestJobRunsToFailed(t *testing.T) {
 }
 
 func TestStopRunningJob(t *testing.T) {
-	w := newTestWorker(t)
+	w := newCgroupWorker(t)
 
-	jobID, err := w.StartJob(job.JobTypeLocal, "sleep", []string{"60"}, auth.Identity{Username: "testuser"})
+	jobID, err := w.StartJob(job.JobTypeLocal, "sleep", []string{"60"}, auth.Identity{Username: "testuser"}, job.Options{})
 	if err != nil {
 		t.Fatalf("StartJob failed: %v", err)
 	}
@@ -140,9 +161,10 @@ func TestStopRunningJob(t *testing.T) {
 }
 
 func TestStreamOutput(t *testing.T) {
+	testutil.RequireRoot(t)
 	w := newTestWorker(t)
 
-	jobID, err := w.StartJob(job.JobTypeLocal, "echo", []string{"stream-test"}, auth.Identity{Username: "testuser"})
+	jobID, err := w.StartJob(job.JobTypeLocal, "echo", []string{"stream-test"}, auth.Identity{Username: "testuser"}, job.Options{})
 	if err != nil {
 		t.Fatalf("StartJob failed: %v", err)
 	}
@@ -174,6 +196,7 @@ func TestStreamOutput(t *testing.T) {
 // subscribe to and read a job's output simultaneously without races, and that
 // every subscriber sees the complete output. Run with -race.
 func TestConcurrentStreamSubscribers(t *testing.T) {
+	testutil.RequireRoot(t)
 	w := newTestWorker(t)
 
 	const numSubscribers = 10
@@ -192,7 +215,7 @@ func TestConcurrentStreamSubscribers(t *testing.T) {
 		fmt.Fprintf(&script, "echo 'line %d'; ", i)
 	}
 
-	jobID, err := w.StartJob(job.JobTypeLocal, "sh", []string{"-c", script.String()}, auth.Identity{Username: "testuser"})
+	jobID, err := w.StartJob(job.JobTypeLocal, "sh", []string{"-c", script.String()}, auth.Identity{Username: "testuser"}, job.Options{})
 	if err != nil {
 		t.Fatalf("StartJob failed: %v", err)
 	}
@@ -239,9 +262,10 @@ func TestConcurrentStreamSubscribers(t *testing.T) {
 }
 
 func TestShutdownClosesOutputStreams(t *testing.T) {
+	testutil.RequireRoot(t)
 	w := newTestWorker(t)
 
-	jobID, err := w.StartJob(job.JobTypeLocal, "sleep", []string{"60"}, auth.Identity{Username: "testuser"})
+	jobID, err := w.StartJob(job.JobTypeLocal, "sleep", []string{"60"}, auth.Identity{Username: "testuser"}, job.Options{})
 	if err != nil {
 		t.Fatalf("StartJob failed: %v", err)
 	}
@@ -279,9 +303,10 @@ func TestShutdownClosesOutputStreams(t *testing.T) {
 }
 
 func TestStopFinishedJob(t *testing.T) {
+	testutil.RequireRoot(t)
 	w := newTestWorker(t)
 
-	jobID, err := w.StartJob(job.JobTypeLocal, "true", nil, auth.Identity{Username: "testuser"})
+	jobID, err := w.StartJob(job.JobTypeLocal, "true", nil, auth.Identity{Username: "testuser"}, job.Options{})
 	if err != nil {
 		t.Fatalf("StartJob failed: %v", err)
 	}
@@ -298,9 +323,10 @@ func TestStopFinishedJob(t *testing.T) {
 }
 
 func TestGetJobOwner(t *testing.T) {
+	testutil.RequireRoot(t)
 	w := newTestWorker(t)
 
-	jobID, err := w.StartJob(job.JobTypeLocal, "true", nil, auth.Identity{Username: "alice"})
+	jobID, err := w.StartJob(job.JobTypeLocal, "true", nil, auth.Identity{Username: "alice"}, job.Options{})
 	if err != nil {
 		t.Fatalf("StartJob failed: %v", err)
 	}
@@ -328,6 +354,257 @@ func TestGetJobOwnerNotFound(t *testing.T) {
 	}
 }
 
+func TestShareJob(t *testing.T) {
+	testutil.RequireRoot(t)
+	w := newTestWorker(t)
+
+	jobID, err := w.StartJob(job.JobTypeLocal, "true", nil, auth.Identity{Username: "alice"}, job.Options{})
+	if err != nil {
+		t.Fatalf("StartJob failed: %v", err)
+	}
+	waitForStatus(t, w, jobID, job.StatusSuccess)
+
+	bob := auth.Grantee{User: "bob"}
+	acl, err := w.ShareJob(jobID, bob, []auth.Permission{auth.PermissionView})
+	if err != nil {
+		t.Fatalf("ShareJob failed: %v", err)
+	}
+	// The returned ACL is a copy.
+	acl.Grant(bob, auth.PermissionStop)
+	got, err := w.GetJobACL(jobID)
+	if err != nil {
+		t.Fatalf("GetJobACL failed: %v", err)
+	}
+	if want := []auth.Permission{auth.PermissionView}; !slices.Equal(got[bob], want) {
+		t.Fatalf("expected %q for bob, got %q", want, got[bob])
+	}
+
+	if acl, err = w.UnshareJob(jobID, bob, nil); err != nil {
+		t.Fatalf("UnshareJob failed: %v", err)
+	}
+	if len(acl) != 0 {
+		t.Fatalf("expected the job not to be shared, got %v", acl)
+	}
+
+	if _, err := w.ShareJob("nonexistent-job-id", bob, []auth.Permission{auth.PermissionView}); !errors.Is(err, worker.ErrJobNotFound) {
+		t.Fatalf("expected ErrJobNotFound, got %v", err)
+	}
+}
+
+// newQuotaWorker returns a worker that gives alice the quota q, and nobody
+// else a quota.
+func newQuotaWorker(t *testing.T, q auth.Quota) *worker.Worker {
+	t.Helper()
+	return worker.New(worker.Options{
+		CgroupMgr: fake.NewBackend(),
+		Quotas: func(id auth.Identity) auth.Quota {
+			if id.Username == "alice" {
+				return q
+			}
+			return auth.Quota{}
+		},
+	})
+}
+
+func TestStartJobFor(t *testing.T) {
+	testutil.RequireRoot(t)
+	w := newQuotaWorker(t, auth.Quota{Jobs: 1})
+	admin := auth.Identity{Username: "admin", Role: auth.RoleAdmin}
+	alice := auth.Identity{Username: "alice", Role: auth.RoleClient}
+
+	jobID, err := w.StartJobFor(job.JobTypeLocal, "sleep", []string{"60"}, alice, admin, job.Options{})
+	if err != nil {
+		t.Fatalf("StartJobFor failed: %v", err)
+	}
+	t.Cleanup(func() {
+		w.StopJob(jobID)
+		waitForStatus(t, w, jobID, job.StatusKilled)
+	})
+
+	owner, err := w.GetJobOwner(jobID)
+	if err != nil || owner.Username != "alice" {
+		t.Fatalf("expected alice to own the job, got %v, %v", owner, err)
+	}
+	owner, startedBy, err := w.GetJobStartedBy(jobID)
+	if err != nil || owner.Username != "alice" || startedBy.Username != "admin" {
+		t.Fatalf("expected a job owned by alice and started by admin, got %v, %v, %v", owner, startedBy, err)
+	}
+
+	// The job counts towards alice's quota, not the admin's.
+	if _, err := w.StartJob(job.JobTypeLocal, "true", nil, alice, job.Options{}); !errors.Is(err, worker.ErrQuotaExceeded) {
+		t.Fatalf("expected ErrQuotaExceeded, got %v", err)
+	}
+	adminJob, err := w.StartJob(job.JobTypeLocal, "true", nil, admin, job.Options{})
+	if err != nil {
+		t.Fatalf("StartJob failed: %v", err)
+	}
+	waitForStatus(t, w, adminJob, job.StatusSuccess)
+	// Jobs started by their owner were started by the owner.
+	if owner, startedBy, err := w.GetJobStartedBy(adminJob); err != nil || owner.Username != "admin" || startedBy.Username != "admin" {
+		t.Fatalf("expected admin to have started their own job, got %v, %v, %v", owner, startedBy, err)
+	}
+}
+
+func TestQuotaRunningJobs(t *testing.T) {
+	testutil.RequireRoot(t)
+	w := newQuotaWorker(t, auth.Quota{Jobs: 2, CPUs: 1.5})
+	alice := auth.Identity{Username: "alice"}
+
+	first, err := w.StartJob(job.JobTypeLocal, "sleep", []string{"60"}, alice, job.Options{})
+	if err != nil {
+		t.Fatalf("StartJob failed: %v", err)
+	}
+	// The default CPU limit is 1 CPU, so a second job only fits with a lower
+	// limit.
+	_, err = w.StartJob(job.JobTypeLocal, "sleep", []string{"60"}, alice, job.Options{})
+	if !errors.Is(err, worker.ErrQuotaExceeded) || !strings.Contains(err.Error(), "cpus") {
+		t.Fatalf("expected the cpu quota to be exceeded, got %v", err)
+	}
+	half := job.Options{Limits: resources.Limits{CPUQuota: 50 * time.Millisecond}}
+	second, err := w.StartJob(job.JobTypeLocal, "sleep", []string{"60"}, alice, half)
+	if err != nil {
+		t.Fatalf("StartJob failed: %v", err)
+	}
+	t.Cleanup(func() {
+		w.StopJob(second)
+		waitForStatus(t, w, second, job.StatusKilled)
+	})
+
+	quota, used := w.GetQuota(alice)
+	if quota.Jobs != 2 || used.Jobs != 2 || used.CPUs != 1.5 || used.Memory != 2*resources.DefaultLimits.MemoryMax {
+		t.Fatalf("unexpected quota %+v and usage %+v", quota, used)
+	}
+	_, err = w.StartJob(job.JobTypeLocal, "true", nil, alice, job.Options{Limits: resources.Limits{CPUQuota: time.Millisecond}})
+	if !errors.Is(err, worker.ErrQuotaExceeded) || !strings.Contains(err.Error(), "jobs queued or running") {
+		t.Fatalf("expected the jobs quota to be exceeded, got %v", err)
+	}
+
+	// Other users are not limited by alice's jobs.
+	bobJob, err := w.StartJob(job.JobTypeLocal, "true", nil, auth.Identity{Username: "bob"}, job.Options{})
+	if err != nil {
+		t.Fatalf("StartJob failed: %v", err)
+	}
+	waitForStatus(t, w, bobJob, job.StatusSuccess)
+
+	// Once a job exits, its part of the quota is free again.
+	if err := w.StopJob(first); err != nil {
+		t.Fatalf("StopJob failed: %v", err)
+	}
+	waitForStatus(t, w, first, job.StatusKilled)
+	third, err := w.StartJob(job.JobTypeLocal, "true", nil, alice, half)
+	if err != nil {
+		t.Fatalf("StartJob failed: %v", err)
+	}
+	waitForStatus(t, w, third, job.StatusSuccess)
+}
+
+func TestQuotaRetainedJobs(t *testing.T) {
+	testutil.RequireRoot(t)
+	w := newQuotaWorker(t, auth.Quota{RetainedJobs: 2})
+	alice := auth.Identity{Username: "alice"}
+
+	var jobIDs []string
+	for range 3 {
+		jobID, err := w.StartJob(job.JobTypeLocal, "true", nil, alice, job.Options{})
+		if err != nil {
+			t.Fatalf("StartJob failed: %v", err)
+		}
+		waitForStatus(t, w, jobID, job.StatusSuccess)
+		jobIDs = append(jobIDs, jobID)
+	}
+
+	// The oldest job was forgotten to make room for the third.
+	if _, err := w.GetJobStatus(jobIDs[0]); !errors.Is(err, worker.ErrJobNotFound) {
+		t.Fatalf("expected ErrJobNotFound for the oldest job, got %v", err)
+	}
+	if _, used := w.GetQuota(alice); used.RetainedJobs != 2 {
+		t.Fatalf("expected 2 retained jobs, got %d", used.RetainedJobs)
+	}
+
+	// Jobs that are still running are never forgotten.
+	for range 2 {
+		jobID, err := w.StartJob(job.JobTypeLocal, "sleep", []string{"60"}, alice, job.Options{})
+		if err != nil {
+			t.Fatalf("StartJob failed: %v", err)
+		}
+		t.Cleanup(func() {
+			w.StopJob(jobID)
+			waitForStatus(t, w, jobID, job.StatusKilled)
+		})
+	}
+	_, err := w.StartJob(job.JobTypeLocal, "true", nil, alice, job.Options{})
+	if !errors.Is(err, worker.ErrQuotaExceeded) || !strings.Contains(err.Error(), "retained jobs") {
+		t.Fatalf("expected the retained jobs quota to be exceeded, got %v", err)
+	}
+}
+
+func TestQuotaRemovesKeptWorkspaces(t *testing.T) {
+	testutil.RequireRoot(t)
+	ws := &workspace.Config{Base: t.TempDir(), Dir: t.TempDir(), Retention: workspace.RetainKeep}
+	w := worker.New(worker.Options{
+		CgroupMgr: fake.NewBackend(),
+		Workspace: ws,
+		Quotas: func(auth.Identity) auth.Quota {
+			return auth.Quota{RetainedJobs: 1}
+		},
+	})
+	alice := auth.Identity{Username: "alice"}
+
+	first, err := w.StartJob(job.JobTypeLocal, "touch", []string{"out.txt"}, alice, job.Options{})
+	if err != nil {
+		t.Fatalf("StartJob failed: %v", err)
+	}
+	waitForStatus(t, w, first, job.StatusSuccess)
+	if _, err := os.Stat(filepath.Join(ws.Dir, first, "upper", "out.txt")); err != nil {
+		t.Fatalf("expected the workspace to be kept: %v", err)
+	}
+
+	// Forgetting the first job to make room for the second removes the
+	// workspace it kept.
+	second, err := w.StartJob(job.JobTypeLocal, "true", nil, alice, job.Options{})
+	if err != nil {
+		t.Fatalf("StartJob failed: %v", err)
+	}
+	waitForStatus(t, w, second, job.StatusSuccess)
+	if _, err := os.Stat(filepath.Join(ws.Dir, first)); !os.IsNotExist(err) {
+		t.Fatalf("expected the first job's workspace to be removed, got %v", err)
+	}
+}
+
+func TestQuotaLogBytes(t *testing.T) {
+	testutil.RequireRoot(t)
+	w := newQuotaWorker(t, auth.Quota{LogBytes: 4})
+	alice := auth.Identity{Username: "alice"}
+
+	first, err := w.StartJob(job.JobTypeLocal, "echo", []string{"hello"}, alice, job.Options{})
+	if err != nil {
+		t.Fatalf("StartJob failed: %v", err)
+	}
+	waitForStatus(t, w, first, job.StatusSuccess)
+	// The job's output is cut to what was left of the quota when it started.
+	r, err := w.StreamOutput(first)
+	if err != nil {
+		t.Fatalf("StreamOutput failed: %v", err)
+	}
+	got, err := io.ReadAll(r)
+	r.Close()
+	if want := "hell" + output.TruncatedMarker; err != nil || string(got) != want {
+		t.Fatalf("expected output %q, got %q (%v)", want, got, err)
+	}
+	if _, used := w.GetQuota(alice); used.LogBytes != int64(len(got)) {
+		t.Fatalf("expected %d bytes of output, got %d", len(got), used.LogBytes)
+	}
+
+	second, err := w.StartJob(job.JobTypeLocal, "true", nil, alice, job.Options{})
+	if err != nil {
+		t.Fatalf("StartJob failed: %v", err)
+	}
+	waitForStatus(t, w, second, job.StatusSuccess)
+	if _, err := w.GetJobStatus(first); !errors.Is(err, worker.ErrJobNotFound) {
+		t.Fatalf("expected the first job to be forgotten, got %v", err)
+	}
+}
+
 func TestGetStatusNotFound(t *testing.T) {
 	w := newTestWorker(t)
 
@@ -345,7 +622,7 @@ func TestStopJobKillsChildProcesses(t *testing.T) {
 		t.Skip("skipping: flock not available")
 	}
 
-	w := newTestWorker(t)
+	w := newCgroupWorker(t)
 	tmpDir := t.TempDir()
 
 	// Each child acquires an exclusive flock, writes a ready marker, then
@@ -358,7 +635,7 @@ func TestStopJobKillsChildProcesses(t *testing.T) {
 		tmpDir, tmpDir,
 	)
 
-	jobID, err := w.StartJob(job.JobTypeLocal, "sh", []string{"-c", script}, auth.Identity{Username: "testuser"})
+	jobID, err := w.StartJob(job.JobTypeLocal, "sh", []string{"-c", script}, auth.Identity{Username: "testuser"}, job.Options{})
 	if err != nil {
 		t.Fatalf("StartJob failed: %v", err)
 	}
@@ -408,13 +685,21 @@ func TestCgroupOOMKillsJob(t *testing.T) {
 	// The cgroup OOM killer should terminate the process.
 	jobID, err := w.StartJob(job.JobTypeLocal, "python3", []string{
 		"-c", "x = bytearray(600_000_000); import time; time.sleep(60)",
-	}, auth.Identity{Username: "testuser"})
+	}, auth.Identity{Username: "testuser"}, job.Options{})
 	if err != nil {
 		t.Fatalf("StartJob failed: %v", err)
 	}
 
 	waitForStatus(t, w, jobID, job.StatusFailed)
 
+	result, err := w.GetJobStatus(jobID)
+	if err != nil {
+		t.Fatalf("GetJobStatus failed: %v", err)
+	}
+	if result.Reason != job.TerminationOOMKilled {
+		t.Fatalf("expected TerminationOOMKilled, got %v", result.Reason)
+	}
+
 	// Verify the OOM killer was triggered by checking memory.events.
 
 	// If a job is OOM killed in a cgroup, then the memory.events file will
@@ -488,7 +773,7 @@ func waitForFiles(t *testing.T, dir, prefix string, n int) {
 // starting, polling, and stopping jobs from many goroutines simultaneously.
 // Run with -race to detect data races.
 func TestConcurrentStartQueryStop(t *testing.T) {
-	w := newTestWorker(t)
+	w := newCgroupWorker(t)
 
 	const n = 20
 	jobIDs := make([]string, n)
@@ -499,7 +784,7 @@ func TestConcurrentStartQueryStop(t *testing.T) {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			id, err := w.StartJob(job.JobTypeLocal, "sleep", []string{"60"}, auth.Identity{Username: "testuser"})
+			id, err := w.StartJob(job.JobTypeLocal, "sleep", []string{"60"}, auth.Identity{Username: "testuser"}, job.Options{})
 			if err != nil {
 				t.Errorf("StartJob failed: %v", err)
 				return
@@ -557,3 +842,322 @@ func tryFlock(path string) bool {
 	syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
 	return true
 }
+
+func TestStartJobRlimitAboveCeiling(t *testing.T) {
+	ceiling := uint64(1024)
+	w := worker.New(worker.Options{Ceilings: job.Rlimits{NoFile: &ceiling}})
+
+	nofile := uint64(4096)
+	_, err := w.StartJob(job.JobTypeLocal, "true", nil, auth.Identity{Username: "testuser"}, job.Options{Rlimits: job.Rlimits{NoFile: &nofile}})
+	if !errors.Is(err, job.ErrRlimitExceedsCeiling) {
+		t.Fatalf("expected ErrRlimitExceedsCeiling, got %v", err)
+	}
+}
+
+func TestCgroupPidsMaxContainsForkBomb(t *testing.T) {
+	mgr := testutil.RequireManager(t)
+	w := worker.New(worker.Options{CgroupMgr: mgr, NoCleanup: true})
+
+	// Try to start far more processes than the job's limit allows. Forks
+	// past the limit fail, so the job never has more than 16 processes.
+	script := "for i in $(seq 100); do sleep 60 & done; sleep 60"
+	jobID, err := w.StartJob(job.JobTypeLocal, "sh", []string{"-c", script}, auth.Identity{Username: "testuser"}, job.Options{Limits: resources.Limits{PidsMax: 16}})
+	if err != nil {
+		t.Fatalf("StartJob failed: %v", err)
+	}
+	// The shell may give up once a fork fails, so the job may have already
+	// exited by the time it is stopped.
+	t.Cleanup(func() {
+		if err := w.StopJob(jobID); err == nil {
+			waitForStatus(t, w, jobID, job.StatusKilled)
+		}
+	})
+
+	// If a fork fails because of pids.max, the pids.events file will look
+	// like so:
+	//
+	// $ cat pids.events
+	// max 84
+	testutil.PollUntil(t, "pids.max to be hit", func() bool {
+		result, err := w.GetJobStatus(jobID)
+		if err != nil {
+			t.Fatalf("GetJobStatus failed: %v", err)
+		}
+		return result.PidsMaxHits > 0
+	})
+
+	data, err := os.ReadFile(filepath.Join(mgr.ParentPath(), jobID, "pids.current"))
+	if err != nil {
+		t.Fatalf("failed to read pids.current: %v", err)
+	}
+	current, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		t.Fatalf("failed to parse pids.current: %v", err)
+	}
+	if current > 16 {
+		t.Fatalf("expected at most 16 processes in the job, got %d", current)
+	}
+}
+
+func TestStartJobPidsMaxAboveDefault(t *testing.T) {
+	w := newTestWorker(t)
+
+	_, err := w.StartJob(job.JobTypeLocal, "true", nil, auth.Identity{Username: "testuser"}, job.Options{Limits: resources.Limits{PidsMax: resources.DefaultPidsMax + 1}})
+	if !errors.Is(err, resources.ErrLimitTooHigh) {
+		t.Fatalf("expected ErrLimitTooHigh, got %v", err)
+	}
+}
+
+func TestCgroupUsageRecordedOnExit(t *testing.T) {
+	mgr := testutil.RequireManager(t)
+	w := worker.New(worker.Options{CgroupMgr: mgr})
+
+	// Burn some CPU and start a few processes, so that there is usage to
+	// record.
+	script := "i=0; while [ $i -lt 200000 ]; do i=$((i+1)); done; true & true & wait"
+	jobID, err := w.StartJob(job.JobTypeLocal, "sh", []string{"-c", script}, auth.Identity{Username: "testuser"}, job.Options{})
+	if err != nil {
+		t.Fatalf("StartJob failed: %v", err)
+	}
+	waitForStatus(t, w, jobID, job.StatusSuccess)
+
+	// The cgroup is removed once the job exits, so the usage must come from
+	// the snapshot taken before cleanup.
+	if _, err := os.Stat(filepath.Join(mgr.ParentPath(), jobID)); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected job cgroup to be removed, got %v", err)
+	}
+	result, err := w.GetJobStatus(jobID)
+	if err != nil {
+		t.Fatalf("GetJobStatus failed: %v", err)
+	}
+	if result.Usage == nil {
+		t.Fatal("expected usage to be recorded")
+	}
+	if result.Usage.CPUUsec == 0 {
+		t.Fatalf("expected non-zero CPU time, got %+v", result.Usage)
+	}
+}
+
+func TestStartJobExclusiveCPUsNotConfigured(t *testing.T) {
+	w := worker.New(worker.Options{})
+
+	_, err := w.StartJob(job.JobTypeLocal, "true", nil, auth.Identity{Username: "testuser"}, job.Options{Exclusive: 1})
+	if !errors.Is(err, worker.ErrNoExclusiveCPUs) {
+		t.Fatalf("expected ErrNoExclusiveCPUs, got %v", err)
+	}
+}
+
+func TestStartJobImage(t *testing.T) {
+	tests := []struct {
+		name     string
+		imageDir string
+		image    string
+		want     error
+	}{
+		{"no image directory", "", "alpine.tar", worker.ErrNoImageDir},
+		{"absolute path", "/srv/images", "/home/bob/alpine.tar", image.ErrInvalidName},
+		{"outside the image directory", "/srv/images", "../../home/bob/alpine.tar", image.ErrInvalidName},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := worker.New(worker.Options{CgroupMgr: fake.NewBackend(), DataDir: t.TempDir(), ImageDir: tt.imageDir})
+			_, err := w.StartJob(job.JobTypeOCI, "", nil, auth.Identity{Username: "testuser"}, job.Options{Image: tt.image})
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+// newExclusiveWorker returns a worker whose exclusive pool is the last CPU of
+// a fake backend.
+func newExclusiveWorker(t *testing.T, queue bool) (*worker.Worker, int) {
+	t.Helper()
+	backend := fake.NewBackend()
+	cpu := backend.CPUs[len(backend.CPUs)-1]
+	return worker.New(worker.Options{
+		CgroupMgr: backend,
+		CPUs:      resources.NewCPUAllocator([]int{cpu}, queue),
+	}), cpu
+}
+
+func TestExclusiveCPUs(t *testing.T) {
+	testutil.RequireRoot(t)
+	w, cpu := newExclusiveWorker(t, false)
+	owner := auth.Identity{Username: "testuser"}
+
+	jobID, err := w.StartJob(job.JobTypeLocal, "sleep", []string{"60"}, owner, job.Options{Exclusive: 1})
+	if err != nil {
+		t.Fatalf("StartJob failed: %v", err)
+	}
+	t.Cleanup(func() {
+		w.StopJob(jobID)
+		waitForStatus(t, w, jobID, job.StatusKilled)
+	})
+	result, err := w.GetJobStatus(jobID)
+	if err != nil {
+		t.Fatalf("GetJobStatus failed: %v", err)
+	}
+	if want := strconv.Itoa(cpu); result.Cpuset.CPUs != want {
+		t.Fatalf("expected job to be pinned to cpu %s, got %q", want, result.Cpuset.CPUs)
+	}
+
+	// The pool is empty, so the next job is refused.
+	if _, err := w.StartJob(job.JobTypeLocal, "true", nil, owner, job.Options{Exclusive: 1}); !errors.Is(err, resources.ErrNoFreeCPUs) {
+		t.Fatalf("expected ErrNoFreeCPUs, got %v", err)
+	}
+	// Other jobs are kept off the pool.
+	if _, err := w.StartJob(job.JobTypeLocal, "true", nil, owner, job.Options{Limits: resources.Limits{Cpuset: resources.Cpuset{CPUs: strconv.Itoa(cpu)}}}); !errors.Is(err, resources.ErrInvalidCpuset) {
+		t.Fatalf("expected ErrInvalidCpuset, got %v", err)
+	}
+}
+
+func TestExclusiveCPUsQueue(t *testing.T) {
+	testutil.RequireRoot(t)
+	w, cpu := newExclusiveWorker(t, true)
+	owner := auth.Identity{Username: "testuser"}
+
+	first, err := w.StartJob(job.JobTypeLocal, "sleep", []string{"60"}, owner, job.Options{Exclusive: 1})
+	if err != nil {
+		t.Fatalf("StartJob failed: %v", err)
+	}
+	second, err := w.StartJob(job.JobTypeLocal, "sleep", []string{"60"}, owner, job.Options{Exclusive: 1})
+	if err != nil {
+		t.Fatalf("StartJob failed: %v", err)
+	}
+	third, err := w.StartJob(job.JobTypeLocal, "sleep", []string{"60"}, owner, job.Options{Exclusive: 1})
+	if err != nil {
+		t.Fatalf("StartJob failed: %v", err)
+	}
+	waitForStatus(t, w, second, job.StatusSubmitted)
+
+	// A queued job can be stopped before it starts.
+	if err := w.StopJob(third); err != nil {
+		t.Fatalf("StopJob failed: %v", err)
+	}
+	waitForStatus(t, w, third, job.StatusKilled)
+
+	// Once the first job exits, the second gets its cpu.
+	if err := w.StopJob(first); err != nil {
+		t.Fatalf("StopJob failed: %v", err)
+	}
+	waitForStatus(t, w, second, job.StatusRunning)
+	result, err := w.GetJobStatus(second)
+	if err != nil {
+		t.Fatalf("GetJobStatus failed: %v", err)
+	}
+	if want := strconv.Itoa(cpu); result.Cpuset.CPUs != want {
+		t.Fatalf("expected job to be pinned to cpu %s, got %q", want, result.Cpuset.CPUs)
+	}
+	if err := w.StopJob(second); err != nil {
+		t.Fatalf("StopJob failed: %v", err)
+	}
+	waitForStatus(t, w, second, job.StatusKilled)
+}
+
+func TestCgroupOOMGroupKillsWholeJob(t *testing.T) {
+	skipIfNoPython3(t)
+
+	mgr := testutil.RequireManager(t)
+	w := worker.New(worker.Options{CgroupMgr: mgr})
+
+	// With memory.oom.group, which is the default, the OOM kill of the
+	// python process also kills the sleep beside it, so the job exits
+	// rather than sleeping for a minute.
+	script := `sleep 60 & python3 -c "x = bytearray(600_000_000)"; wait`
+	jobID, err := w.StartJob(job.JobTypeLocal, "sh", []string{"-c", script}, auth.Identity{Username: "testuser"}, job.Options{})
+	if err != nil {
+		t.Fatalf("StartJob failed: %v", err)
+	}
+	waitForNonRunning(t, w, jobID)
+
+	result, err := w.GetJobStatus(jobID)
+	if err != nil {
+		t.Fatalf("GetJobStatus failed: %v", err)
+	}
+	if result.Reason != job.TerminationOOMKilled {
+		t.Fatalf("expected TerminationOOMKilled, got %v", result.Reason)
+	}
+}
+
+func TestStartJobCgroupCreateFails(t *testing.T) {
+	backend := fake.NewBackend()
+	backend.CreateErr = errors.New("injected failure")
+	w := worker.New(worker.Options{CgroupMgr: backend})
+
+	_, err := w.StartJob(job.JobTypeLocal, "true", nil, auth.Identity{Username: "testuser"}, job.Options{})
+	if !errors.Is(err, backend.CreateErr) {
+		t.Fatalf("expected injected failure, got %v", err)
+	}
+}
+
+func TestStopJobCgroupKillFails(t *testing.T) {
+	testutil.RequireRoot(t)
+	backend := fake.NewBackend()
+	w := worker.New(worker.Options{CgroupMgr: backend})
+
+	jobID, err := w.StartJob(job.JobTypeLocal, "sleep", []string{"60"}, auth.Identity{Username: "testuser"}, job.Options{})
+	if err != nil {
+		t.Fatalf("StartJob failed: %v", err)
+	}
+	backend.Cgroup(jobID).KillErr = errors.New("injected failure")
+
+	// The job falls back to killing its process group.
+	if err := w.StopJob(jobID); err != nil {
+		t.Fatalf("StopJob failed: %v", err)
+	}
+	waitForStatus(t, w, jobID, job.StatusKilled)
+}
+
+func TestJobOOMKilled(t *testing.T) {
+	testutil.RequireRoot(t)
+	backend := fake.NewBackend()
+	w := worker.New(worker.Options{CgroupMgr: backend})
+
+	jobID, err := w.StartJob(job.JobTypeLocal, "sleep", []string{"60"}, auth.Identity{Username: "testuser"}, job.Options{})
+	if err != nil {
+		t.Fatalf("StartJob failed: %v", err)
+	}
+	backend.Cgroup(jobID).OOMKill()
+
+	waitForStatus(t, w, jobID, job.StatusFailed)
+	result, err := w.GetJobStatus(jobID)
+	if err != nil {
+		t.Fatalf("GetJobStatus failed: %v", err)
+	}
+	if result.Reason != job.TerminationOOMKilled {
+		t.Fatalf("expected reason OOMKilled, got %v", result.Reason)
+	}
+	// The cgroup is removed once the job exits.
+	testutil.PollUntil(t, "cgroup to be cleaned up", func() bool {
+		return backend.Cgroup(jobID) == nil
+	})
+}
+
+func TestCgroupV1Job(t *testing.T) {
+	mgr := testutil.RequireV1Manager(t)
+	w := worker.New(worker.Options{CgroupMgr: mgr})
+
+	jobID, err := w.StartJob(job.JobTypeLocal, "sh", []string{"-c", "sleep 60 & sleep 60 & wait"}, auth.Identity{Username: "testuser"}, job.Options{})
+	if err != nil {
+		t.Fatalf("StartJob failed: %v", err)
+	}
+
+	// The job and its children are in its cgroup.
+	testutil.PollUntil(t, "children to start", func() bool {
+		stats, err := w.GetJobStats(jobID)
+		if err != nil {
+			t.Fatalf("GetJobStats failed: %v", err)
+		}
+		return stats.PidsCurrent >= 3
+	})
+
+	if err := w.StopJob(jobID); err != nil {
+		t.Fatalf("StopJob failed: %v", err)
+	}
+	waitForStatus(t, w, jobID, job.StatusKilled)
+	testutil.PollUntil(t, "job cgroup to be removed", func() bool {
+		_, err := os.Stat(filepath.Join(mgr.ParentPath("memory"), jobID))
+		return errors.Is(err, os.ErrNotExist)
+	})
+}
@@ -0,0 +1,264 @@
+// Package workspace provides per-job copy-on-write working directories. Each
+// workspace is an overlayfs whose lower layer is a shared, read-only base
+// directory and whose upper layer belongs to a single job, so that jobs can
+// write files without affecting the base directory or each other.
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/kkloberdanz/teleworker/overlay"
+)
+
+// Retention controls what happens to a workspace's upper layer once its job
+// has finished.
+type Retention int
+
+const (
+	// RetainDiscard removes the upper layer when the job finishes.
+	RetainDiscard Retention = iota
+	// RetainKeep keeps the upper layer on disk so that the files the job
+	// wrote can be inspected.
+	RetainKeep
+)
+
+// ParseRetention parses "discard" or "keep" into a Retention.
+func ParseRetention(s string) (Retention, error) {
+	switch s {
+	case "discard":
+		return RetainDiscard, nil
+	case "keep":
+		return RetainKeep, nil
+	default:
+		return 0, fmt.Errorf("unknown workspace retention %q (expected \"discard\" or \"keep\")", s)
+	}
+}
+
+// Config describes how workspaces are created. It is chosen by the
+// teleworker administrator and applies to every job.
+type Config struct {
+	Base      string    // Read-only lower layer shared by every workspace.
+	Dir       string    // Directory that holds each job's workspace.
+	Size      int64     // Maximum bytes a job may write. If 0, the upper layer is on disk and unbounded.
+	Retention Retention // Whether to keep the upper layer once the job finishes.
+}
+
+// Remove removes the workspace a job kept. It returns an error, and leaves
+// the workspace in place, if the workspace has not been closed yet.
+func (c Config) Remove(jobID string) error {
+	w := &Workspace{dir: filepath.Join(c.Dir, jobID)}
+	if _, err := os.Stat(w.Path()); err == nil {
+		return fmt.Errorf("workspace %s has not been closed", w.dir)
+	}
+	return w.remove()
+}
+
+// Workspace is a single job's copy-on-write view of the base directory.
+type Workspace struct {
+	dir       string // Per-job directory under Config.Dir.
+	tmpfs     bool   // If true, the upper and work directories live on a size limited tmpfs.
+	retention Retention
+}
+
+// New mounts a workspace for the given job. The caller must call Close once
+// the job has exited.
+//
+// The size limit is enforced by placing the upper layer on a tmpfs, which
+// means a job's writes are held in memory until the job finishes.
+//
+// TODO: Project quotas on XFS or ext4 could enforce the size limit on disk
+// instead, without holding the job's writes in memory.
+func New(cfg Config, jobID string) (*Workspace, error) {
+	if cfg.Base == "" || cfg.Dir == "" {
+		return nil, errors.New("workspace requires a base directory and a workspace directory")
+	}
+	if fi, err := os.Stat(cfg.Base); err != nil || !fi.IsDir() {
+		return nil, fmt.Errorf("workspace base %q is not a directory", cfg.Base)
+	}
+
+	w := &Workspace{
+		dir:       filepath.Join(cfg.Dir, jobID),
+		tmpfs:     cfg.Size > 0,
+		retention: cfg.Retention,
+	}
+	if err := os.MkdirAll(w.Path(), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create workspace: %w", err)
+	}
+
+	// With a size limit, the upper and work directories must be on the same
+	// filesystem, so both are placed on the tmpfs.
+	layerDir := w.dir
+	if w.tmpfs {
+		layerDir = w.tmpfsDir()
+		if err := os.Mkdir(layerDir, 0700); err != nil {
+			w.remove()
+			return nil, fmt.Errorf("failed to create workspace: %w", err)
+		}
+		if err := unix.Mount("tmpfs", layerDir, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "size="+strconv.FormatInt(cfg.Size, 10)); err != nil {
+			w.remove()
+			return nil, fmt.Errorf("failed to mount workspace tmpfs: %w", err)
+		}
+	}
+
+	upper := filepath.Join(layerDir, "upper")
+	work := filepath.Join(layerDir, "work")
+	for _, dir := range []string{upper, work} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			w.unmountTmpfs()
+			w.remove()
+			return nil, fmt.Errorf("failed to create workspace: %w", err)
+		}
+	}
+
+	if err := overlay.Mount(w.Path(), []string{cfg.Base}, upper, work); err != nil {
+		w.unmountTmpfs()
+		w.remove()
+		return nil, err
+	}
+	return w, nil
+}
+
+// Path returns the directory the job should use as its workspace.
+func (w *Workspace) Path() string {
+	return filepath.Join(w.dir, "merged")
+}
+
+// UpperPath returns the directory that holds the files written by the job. If
+// the workspace is kept, this is where they can be inspected after Close.
+func (w *Workspace) UpperPath() string {
+	return filepath.Join(w.dir, "upper")
+}
+
+// Kept returns true if the workspace's upper layer is kept once it is closed.
+func (w *Workspace) Kept() bool {
+	return w.retention == RetainKeep
+}
+
+func (w *Workspace) tmpfsDir() string {
+	return filepath.Join(w.dir, "tmpfs")
+}
+
+// Close unmounts the workspace, then either removes it or keeps its upper
+// layer depending on the retention setting. Workspaces on a tmpfs are copied
+// to disk before the tmpfs is unmounted, so that they can be kept.
+func (w *Workspace) Close() error {
+	if err := overlay.Unmount(w.Path()); err != nil {
+		// Leave everything in place rather than deleting through a
+		// mounted filesystem.
+		return err
+	}
+
+	if w.retention == RetainDiscard {
+		w.unmountTmpfs()
+		return w.remove()
+	}
+
+	if w.tmpfs {
+		if err := copyTree(filepath.Join(w.tmpfsDir(), "upper"), w.UpperPath()); err != nil {
+			return fmt.Errorf("failed to copy workspace to disk: %w", err)
+		}
+		w.unmountTmpfs()
+		if err := os.RemoveAll(w.tmpfsDir()); err != nil {
+			return err
+		}
+	}
+	if err := os.RemoveAll(filepath.Join(w.dir, "work")); err != nil {
+		return err
+	}
+	return os.Remove(w.Path())
+}
+
+func (w *Workspace) unmountTmpfs() {
+	if !w.tmpfs {
+		return
+	}
+	if err := unix.Unmount(w.tmpfsDir(), unix.MNT_DETACH); err != nil && !errors.Is(err, unix.EINVAL) {
+		slog.Warn(
+			"failed to unmount workspace tmpfs",
+			"path", w.tmpfsDir(),
+			"error", err,
+		)
+	}
+}
+
+func (w *Workspace) remove() error {
+	return os.RemoveAll(w.dir)
+}
+
+// copyTree copies an overlay upper directory from src to dst, preserving the
+// whiteout devices and opaque directory markers that record deletions, so the
+// copy shows exactly what the job changed.
+func copyTree(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		st, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			return fmt.Errorf("failed to stat %s", path)
+		}
+
+		switch mode := info.Mode(); {
+		case mode.IsDir():
+			if err := os.Mkdir(target, mode.Perm()); err != nil && !errors.Is(err, os.ErrExist) {
+				return err
+			}
+			opaque := make([]byte, 1)
+			if n, err := unix.Lgetxattr(path, "trusted.overlay.opaque", opaque); err == nil && n == 1 {
+				if err := unix.Lsetxattr(target, "trusted.overlay.opaque", opaque, 0); err != nil {
+					return err
+				}
+			}
+		case mode.IsRegular():
+			if err := copyFile(path, target, mode.Perm()); err != nil {
+				return err
+			}
+		case mode&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			if err := os.Symlink(link, target); err != nil {
+				return err
+			}
+		default:
+			if err := unix.Mknod(target, st.Mode, int(st.Rdev)); err != nil {
+				return err
+			}
+		}
+		return os.Lchown(target, int(st.Uid), int(st.Gid))
+	})
+}
+
+func copyFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
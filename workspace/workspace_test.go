@@ -0,0 +1,157 @@
+package workspace_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"go.uber.org/goleak"
+
+	"github.com/kkloberdanz/teleworker/workspace"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+// newConfig returns a workspace config whose base directory contains a single
+// file named "base.txt".
+func newConfig(t *testing.T) workspace.Config {
+	t.Helper()
+	if os.Getuid() != 0 {
+		t.Skip("skipping: requires root")
+	}
+
+	base := t.TempDir()
+	if err := os.WriteFile(filepath.Join(base, "base.txt"), []byte("base"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return workspace.Config{Base: base, Dir: t.TempDir()}
+}
+
+func TestWorkspaceIsCopyOnWrite(t *testing.T) {
+	cfg := newConfig(t)
+
+	w1, err := workspace.New(cfg, "job-1")
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	t.Cleanup(func() { w1.Close() })
+	w2, err := workspace.New(cfg, "job-2")
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	t.Cleanup(func() { w2.Close() })
+
+	got, err := os.ReadFile(filepath.Join(w1.Path(), "base.txt"))
+	if err != nil || string(got) != "base" {
+		t.Fatalf("expected base file to be visible, got %q (%v)", got, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(w1.Path(), "base.txt"), []byte("changed"), 0644); err != nil {
+		t.Fatalf("failed to write to workspace: %v", err)
+	}
+
+	// Neither the base directory nor the other workspace see the write.
+	for _, path := range []string{filepath.Join(cfg.Base, "base.txt"), filepath.Join(w2.Path(), "base.txt")} {
+		got, err := os.ReadFile(path)
+		if err != nil || string(got) != "base" {
+			t.Fatalf("expected %s to be unchanged, got %q (%v)", path, got, err)
+		}
+	}
+}
+
+func TestWorkspaceDiscard(t *testing.T) {
+	cfg := newConfig(t)
+
+	w, err := workspace.New(cfg, "job")
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(w.Path(), "out.txt"), []byte("x"), 0644); err != nil {
+		t.Fatalf("failed to write to workspace: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(cfg.Dir, "job")); !os.IsNotExist(err) {
+		t.Fatalf("expected workspace to be removed, got %v", err)
+	}
+}
+
+func TestWorkspaceKeep(t *testing.T) {
+	for _, size := range []int64{0, 1 << 20} {
+		cfg := newConfig(t)
+		cfg.Retention = workspace.RetainKeep
+		cfg.Size = size
+
+		w, err := workspace.New(cfg, "job")
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(w.Path(), "out.txt"), []byte("kept"), 0644); err != nil {
+			t.Fatalf("failed to write to workspace: %v", err)
+		}
+		if err := os.Remove(filepath.Join(w.Path(), "base.txt")); err != nil {
+			t.Fatalf("failed to remove from workspace: %v", err)
+		}
+		if err := cfg.Remove("job"); err == nil {
+			t.Fatalf("size %d: expected Remove to fail before Close", size)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+
+		got, err := os.ReadFile(filepath.Join(w.UpperPath(), "out.txt"))
+		if err != nil || string(got) != "kept" {
+			t.Fatalf("size %d: expected kept file, got %q (%v)", size, got, err)
+		}
+		// The deletion is recorded as a whiteout.
+		fi, err := os.Lstat(filepath.Join(w.UpperPath(), "base.txt"))
+		if err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+			t.Fatalf("size %d: expected whiteout for deleted file, got %v (%v)", size, fi, err)
+		}
+		if _, err := os.Stat(w.Path()); !os.IsNotExist(err) {
+			t.Fatalf("size %d: expected merged directory to be removed, got %v", size, err)
+		}
+
+		if err := cfg.Remove("job"); err != nil {
+			t.Fatalf("size %d: Remove failed: %v", size, err)
+		}
+		if _, err := os.Stat(filepath.Join(cfg.Dir, "job")); !os.IsNotExist(err) {
+			t.Fatalf("size %d: expected workspace to be removed, got %v", size, err)
+		}
+	}
+}
+
+func TestWorkspaceSizeLimit(t *testing.T) {
+	cfg := newConfig(t)
+	cfg.Size = 1 << 20
+
+	w, err := workspace.New(cfg, "job")
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	t.Cleanup(func() { w.Close() })
+
+	err = os.WriteFile(filepath.Join(w.Path(), "big"), make([]byte, 2<<20), 0644)
+	if !errors.Is(err, syscall.ENOSPC) {
+		t.Fatalf("expected ENOSPC when exceeding the workspace size, got %v", err)
+	}
+}
+
+func TestParseRetention(t *testing.T) {
+	if r, err := workspace.ParseRetention("keep"); err != nil || r != workspace.RetainKeep {
+		t.Fatalf("expected RetainKeep, got %v (%v)", r, err)
+	}
+	if r, err := workspace.ParseRetention("discard"); err != nil || r != workspace.RetainDiscard {
+		t.Fatalf("expected RetainDiscard, got %v (%v)", r, err)
+	}
+	if _, err := workspace.ParseRetention("forever"); err == nil || !strings.Contains(err.Error(), "forever") {
+		t.Fatalf("expected error for unknown retention, got %v", err)
+	}
+}